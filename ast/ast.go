@@ -2,13 +2,18 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
 	"interpreter/token"
+	"sort"
 	"strings"
+	"unicode"
 )
 
 type Node interface {
     TokenLiteral() string
     String() string
+    Pos() token.Position // position of the first character of the node
+    End() token.Position // position right after the last character of the node
 }
 
 type Statement interface {
@@ -33,6 +38,18 @@ func (prog *Program) TokenLiteral() string {
     }
 }
 
+func (prog *Program) Pos() token.Position {
+    if len(prog.Statements) > 0 {
+        return prog.Statements[0].Pos()
+    }
+    return token.Position{}
+}
+func (prog *Program) End() token.Position {
+    if len(prog.Statements) > 0 {
+        return prog.Statements[len(prog.Statements)-1].End()
+    }
+    return token.Position{}
+}
 func (prog *Program) String() string {
     var output bytes.Buffer
 
@@ -49,18 +66,35 @@ func (prog *Program) String() string {
 type LetStatement struct {
     Token   token.Token
     Name    *Identifier
+    Type    *TypeExpression // nil when the binding is not annotated
     Value   Expression 
 }
 
 func (ls *LetStatement) statementNode() {}
+// IsConst tells whether the statement declares a constant with const.
+func (ls *LetStatement) IsConst() bool {
+    return ls.Token.Type == token.CONST
+}
 func (ls *LetStatement) TokenLiteral() string {
     return ls.Token.Literal
 }
+func (ls *LetStatement) Pos() token.Position {
+    return ls.Token.Pos
+}
+func (ls *LetStatement) End() token.Position {
+    if ls.Value != nil {
+        return ls.Value.End()
+    }
+    return ls.Name.End()
+}
 func (ls *LetStatement) String() string {
     var output bytes.Buffer
 
     output.WriteString(ls.TokenLiteral() + " ")
     output.WriteString(ls.Name.String())
+    if ls.Type != nil {
+        output.WriteString(": " + ls.Type.String())
+    }
     output.WriteString(" = ")
 
     if ls.Value != nil {
@@ -81,6 +115,12 @@ func (i *Identifier) expressionNode() {}
 func (i *Identifier) TokenLiteral() string {
     return i.Token.Literal
 }
+func (i *Identifier) Pos() token.Position {
+    return i.Token.Pos
+}
+func (i *Identifier) End() token.Position {
+    return i.Token.End
+}
 func (i *Identifier) String() string {
     return i.Value
 }
@@ -97,6 +137,15 @@ func (rs *ReturnStatement) statementNode() {}
 func (rs *ReturnStatement) TokenLiteral() string {
     return rs.Token.Literal
 }
+func (rs *ReturnStatement) Pos() token.Position {
+    return rs.Token.Pos
+}
+func (rs *ReturnStatement) End() token.Position {
+    if rs.ReturnValue != nil {
+        return rs.ReturnValue.End()
+    }
+    return rs.Token.End
+}
 func (rs *ReturnStatement) String() string {
     var output bytes.Buffer
 
@@ -122,6 +171,15 @@ func (es *ExpressionStatement) statementNode()  {}
 func (es *ExpressionStatement) TokenLiteral() string {
     return es.Token.Literal
 }
+func (es *ExpressionStatement) Pos() token.Position {
+    return es.Token.Pos
+}
+func (es *ExpressionStatement) End() token.Position {
+    if es.Expression != nil {
+        return es.Expression.End()
+    }
+    return es.Token.End
+}
 func (es *ExpressionStatement) String() string {
     if es.Expression != nil {
         return es.Expression.String()
@@ -140,10 +198,37 @@ func (il *IntegerLiteral) expressionNode() {}
 func (il *IntegerLiteral) TokenLiteral() string {
     return il.Token.Literal
 }
+func (il *IntegerLiteral) Pos() token.Position {
+    return il.Token.Pos
+}
+func (il *IntegerLiteral) End() token.Position {
+    return il.Token.End
+}
 func (il *IntegerLiteral) String() string {
     return il.Token.Literal
 }
 
+// Float Literal
+
+type FloatLiteral struct {
+    Token   token.Token
+    Value   float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+func (fl *FloatLiteral) TokenLiteral() string {
+    return fl.Token.Literal
+}
+func (fl *FloatLiteral) Pos() token.Position {
+    return fl.Token.Pos
+}
+func (fl *FloatLiteral) End() token.Position {
+    return fl.Token.End
+}
+func (fl *FloatLiteral) String() string {
+    return fl.Token.Literal
+}
+
 // Prefix Expression
 
 type PrefixExpression struct {
@@ -156,6 +241,15 @@ func (pe *PrefixExpression) expressionNode() {}
 func (pe *PrefixExpression) TokenLiteral() string {
     return pe.Token.Literal
 }
+func (pe *PrefixExpression) Pos() token.Position {
+    return pe.Token.Pos
+}
+func (pe *PrefixExpression) End() token.Position {
+    if pe.Right != nil {
+        return pe.Right.End()
+    }
+    return pe.Token.End
+}
 func (pe *PrefixExpression) String() string {
     var output bytes.Buffer
 
@@ -180,6 +274,18 @@ func (oe *InfixExpression) expressionNode() {}
 func (oe *InfixExpression) TokenLiteral() string {
     return oe.Token.Literal
 }
+func (oe *InfixExpression) Pos() token.Position {
+    if oe.Left != nil {
+        return oe.Left.Pos()
+    }
+    return oe.Token.Pos
+}
+func (oe *InfixExpression) End() token.Position {
+    if oe.Right != nil {
+        return oe.Right.End()
+    }
+    return oe.Token.End
+}
 func (oe *InfixExpression) String() string {
     var output bytes.Buffer
 
@@ -203,6 +309,12 @@ func (b *Boolean) expressionNode() {}
 func (b *Boolean) TokenLiteral() string {
     return b.Token.Literal
 }
+func (b *Boolean) Pos() token.Position {
+    return b.Token.Pos
+}
+func (b *Boolean) End() token.Position {
+    return b.Token.End
+}
 func (b *Boolean) String() string {
     return b.Token.Literal
 }
@@ -220,6 +332,18 @@ func (ie *IfExpression) expressionNode() {}
 func (ie *IfExpression) TokenLiteral() string {
     return ie.Token.Literal
 }
+func (ie *IfExpression) Pos() token.Position {
+    return ie.Token.Pos
+}
+func (ie *IfExpression) End() token.Position {
+    if ie.Alternative != nil {
+        return ie.Alternative.End()
+    }
+    if ie.Consequence != nil {
+        return ie.Consequence.End()
+    }
+    return ie.Token.End
+}
 func (ie *IfExpression) String() string {
     var output bytes.Buffer
 
@@ -239,12 +363,19 @@ func (ie *IfExpression) String() string {
 type BlockStatement struct {
     Token       token.Token
     Statements  []Statement
+    Rbrace      token.Token
 }
 
 func (bs *BlockStatement) statementNode() {}
 func (bs *BlockStatement) TokenLiteral() string {
     return bs.Token.Literal
 }
+func (bs *BlockStatement) Pos() token.Position {
+    return bs.Token.Pos
+}
+func (bs *BlockStatement) End() token.Position {
+    return bs.Rbrace.End
+}
 func (bs *BlockStatement) String() string {
     var output bytes.Buffer
 
@@ -254,45 +385,426 @@ func (bs *BlockStatement) String() string {
     return output.String()
 }
 
-// Functional Literal
+// Exceptions
 
-type FunctionLiteral struct {
+// TryExpression evaluates to the value of Block, or to the value of Catch when
+// Block fails, with the error bound to Parameter.
+type TryExpression struct {
     Token       token.Token
-    Parameters  []*Identifier
+    Block       *BlockStatement
+    Parameter   *Identifier
+    Catch       *BlockStatement
+}
+
+func (te *TryExpression) expressionNode() {}
+func (te *TryExpression) TokenLiteral() string {
+    return te.Token.Literal
+}
+func (te *TryExpression) Pos() token.Position {
+    return te.Token.Pos
+}
+func (te *TryExpression) End() token.Position {
+    if te.Catch != nil {
+        return te.Catch.End()
+    }
+    return te.Token.End
+}
+func (te *TryExpression) String() string {
+    var output bytes.Buffer
+
+    output.WriteString("try ")
+    output.WriteString(te.Block.String())
+    output.WriteString(" catch(")
+    output.WriteString(te.Parameter.String())
+    output.WriteString(") ")
+    output.WriteString(te.Catch.String())
+
+    return output.String()
+}
+
+type ThrowStatement struct {
+    Token       token.Token
+    Value       Expression
+}
+
+func (ts *ThrowStatement) statementNode() {}
+func (ts *ThrowStatement) TokenLiteral() string {
+    return ts.Token.Literal
+}
+func (ts *ThrowStatement) Pos() token.Position {
+    return ts.Token.Pos
+}
+func (ts *ThrowStatement) End() token.Position {
+    if ts.Value != nil {
+        return ts.Value.End()
+    }
+    return ts.Token.End
+}
+func (ts *ThrowStatement) String() string {
+    return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
+// Assignment
+
+type AssignExpression struct {
+    Token       token.Token // the = or compound assignment operator
+    Target      Expression  // an *Identifier or an *IndexExpression
+    Operator    string
+    Value       Expression
+}
+
+func (ae *AssignExpression) expressionNode() {}
+func (ae *AssignExpression) TokenLiteral() string {
+    return ae.Token.Literal
+}
+func (ae *AssignExpression) Pos() token.Position {
+    return ae.Target.Pos()
+}
+func (ae *AssignExpression) End() token.Position {
+    if ae.Value != nil {
+        return ae.Value.End()
+    }
+    return ae.Token.End
+}
+func (ae *AssignExpression) String() string {
+    return ae.Target.String() + " " + ae.Operator + " " + ae.Value.String()
+}
+
+// Loops
+
+type WhileStatement struct {
+    Token       token.Token
+    Condition   Expression
     Body        *BlockStatement
 }
 
+func (ws *WhileStatement) statementNode() {}
+func (ws *WhileStatement) TokenLiteral() string {
+    return ws.Token.Literal
+}
+func (ws *WhileStatement) Pos() token.Position {
+    return ws.Token.Pos
+}
+func (ws *WhileStatement) End() token.Position {
+    if ws.Body != nil {
+        return ws.Body.End()
+    }
+    return ws.Token.End
+}
+func (ws *WhileStatement) String() string {
+    var output bytes.Buffer
+
+    output.WriteString("while")
+    output.WriteString(ws.Condition.String())
+    output.WriteString(" ")
+    output.WriteString(ws.Body.String())
+
+    return output.String()
+}
+
+type ForStatement struct {
+    Token       token.Token
+    Variable    *Identifier
+    Iterable    Expression
+    Body        *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+func (fs *ForStatement) TokenLiteral() string {
+    return fs.Token.Literal
+}
+func (fs *ForStatement) Pos() token.Position {
+    return fs.Token.Pos
+}
+func (fs *ForStatement) End() token.Position {
+    if fs.Body != nil {
+        return fs.Body.End()
+    }
+    return fs.Token.End
+}
+func (fs *ForStatement) String() string {
+    var output bytes.Buffer
+
+    output.WriteString("for(")
+    output.WriteString(fs.Variable.String())
+    output.WriteString(" in ")
+    output.WriteString(fs.Iterable.String())
+    output.WriteString(") ")
+    output.WriteString(fs.Body.String())
+
+    return output.String()
+}
+
+type BreakStatement struct {
+    Token       token.Token
+}
+
+func (bs *BreakStatement) statementNode() {}
+func (bs *BreakStatement) TokenLiteral() string {
+    return bs.Token.Literal
+}
+func (bs *BreakStatement) Pos() token.Position {
+    return bs.Token.Pos
+}
+func (bs *BreakStatement) End() token.Position {
+    return bs.Token.End
+}
+func (bs *BreakStatement) String() string {
+    return bs.Token.Literal + ";"
+}
+
+type ContinueStatement struct {
+    Token       token.Token
+}
+
+func (cs *ContinueStatement) statementNode() {}
+func (cs *ContinueStatement) TokenLiteral() string {
+    return cs.Token.Literal
+}
+func (cs *ContinueStatement) Pos() token.Position {
+    return cs.Token.Pos
+}
+func (cs *ContinueStatement) End() token.Position {
+    return cs.Token.End
+}
+func (cs *ContinueStatement) String() string {
+    return cs.Token.Literal + ";"
+}
+
+// Modules
+
+type ImportStatement struct {
+    Token       token.Token
+    Path        *StringLiteral
+    Name        *Identifier // the name the module is bound to, after as
+}
+
+func (is *ImportStatement) statementNode() {}
+func (is *ImportStatement) TokenLiteral() string {
+    return is.Token.Literal
+}
+func (is *ImportStatement) Pos() token.Position {
+    return is.Token.Pos
+}
+func (is *ImportStatement) End() token.Position {
+    return is.Name.End()
+}
+func (is *ImportStatement) String() string {
+    return is.TokenLiteral() + " " + is.Path.String() + " as " + is.Name.String() + ";"
+}
+
+// ExportStatement makes the binding of a top-level let or const statement
+// visible to the files that import the module.
+type ExportStatement struct {
+    Token       token.Token
+    Statement   *LetStatement
+}
+
+func (es *ExportStatement) statementNode() {}
+func (es *ExportStatement) TokenLiteral() string {
+    return es.Token.Literal
+}
+func (es *ExportStatement) Pos() token.Position {
+    return es.Token.Pos
+}
+func (es *ExportStatement) End() token.Position {
+    return es.Statement.End()
+}
+func (es *ExportStatement) String() string {
+    return es.TokenLiteral() + " " + es.Statement.String()
+}
+
+// MemberExpression is `object.name`, a shorthand for `object["name"]`.
+type MemberExpression struct {
+    Token       token.Token // the . token
+    Object      Expression
+    Member      *Identifier
+}
+
+func (me *MemberExpression) expressionNode() {}
+func (me *MemberExpression) TokenLiteral() string {
+    return me.Token.Literal
+}
+func (me *MemberExpression) Pos() token.Position {
+    return me.Object.Pos()
+}
+func (me *MemberExpression) End() token.Position {
+    return me.Member.End()
+}
+func (me *MemberExpression) String() string {
+    return me.Object.String() + "." + me.Member.String()
+}
+
+// Functional Literal
+
+type FunctionLiteral struct {
+    Token          token.Token
+    Parameters     []*Identifier
+    ParameterTypes map[string]*TypeExpression // annotations of the parameters and the rest parameter, by name
+    Defaults       map[string]Expression      // default values of optional parameters, by name
+    Rest           *Identifier                // collects the remaining arguments, may be nil
+    ReturnType     *TypeExpression            // nil when the result is not annotated
+    Body           *BlockStatement
+}
+
 func (fl *FunctionLiteral) expressionNode() {}
 func (fl *FunctionLiteral) TokenLiteral() string {
     return fl.Token.Literal
 }
+func (fl *FunctionLiteral) Pos() token.Position {
+    return fl.Token.Pos
+}
+func (fl *FunctionLiteral) End() token.Position {
+    if fl.Body != nil {
+        return fl.Body.End()
+    }
+    return fl.Token.End
+}
 func (fl *FunctionLiteral) String() string {
     var output bytes.Buffer
 
-    params := []string{}
-    for _, p := range fl.Parameters {
-        params = append(params, p.String())
-    }
+    params := ParametersString(fl.Parameters, fl.ParameterTypes, fl.Defaults, fl.Rest)
 
     output.WriteString(fl.TokenLiteral())
     output.WriteString("(")
     output.WriteString(strings.Join(params, ","))
     output.WriteString(") ")
+    if fl.ReturnType != nil {
+        output.WriteString(": " + fl.ReturnType.String() + " ")
+    }
     output.WriteString(fl.Body.String())
 
     return output.String()
 }
 
+// ParametersString lists parameters the way they are written in source,
+// including type annotations, default values and the rest parameter.
+func ParametersString(parameters []*Identifier, types map[string]*TypeExpression, defaults map[string]Expression, rest *Identifier) []string {
+    params := []string{}
+    for _, p := range parameters {
+        param := p.String()
+        if t, ok := types[p.Value]; ok {
+            param += ": " + t.String()
+        }
+        if value, ok := defaults[p.Value]; ok {
+            param += " = " + value.String()
+        }
+        params = append(params, param)
+    }
+    if rest != nil {
+        param := "..." + rest.String()
+        if t, ok := types[rest.Value]; ok {
+            param += ": " + t.String()
+        }
+        params = append(params, param)
+    }
+    return params
+}
+
+// Type annotations
+
+// TypeExpression is the type in an annotation: a name like int or any, an
+// array or hash type with its element types like array<int> or
+// hash<string, int>, or a function type like fn(int, string): bool. A bare
+// array, hash or fn leaves the element or signature types open.
+type TypeExpression struct {
+    Token       token.Token       // the name of the type, or fn
+    Name        string
+    Arguments   []*TypeExpression // element types, or parameter types of a function type
+    Result      *TypeExpression   // result type of a function type, may be nil
+    Close       token.Token       // the closing > or ), when there is one
+}
+
+func (te *TypeExpression) TokenLiteral() string {
+    return te.Token.Literal
+}
+func (te *TypeExpression) Pos() token.Position {
+    return te.Token.Pos
+}
+func (te *TypeExpression) End() token.Position {
+    if te.Result != nil {
+        return te.Result.End()
+    }
+    if te.Close.Literal != "" {
+        return te.Close.End
+    }
+    return te.Token.End
+}
+func (te *TypeExpression) String() string {
+    arguments := []string{}
+    for _, argument := range te.Arguments {
+        arguments = append(arguments, argument.String())
+    }
+
+    switch {
+    case te.Name == "fn" && te.Close.Literal != "":
+        result := "fn(" + strings.Join(arguments, ", ") + ")"
+        if te.Result != nil {
+            result += ": " + te.Result.String()
+        }
+        return result
+    case len(arguments) > 0:
+        return te.Name + "<" + strings.Join(arguments, ", ") + ">"
+    default:
+        return te.Name
+    }
+}
+
+// Macro Literal
+
+type MacroLiteral struct {
+    Token       token.Token
+    Parameters  []*Identifier
+    Body        *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode() {}
+func (ml *MacroLiteral) TokenLiteral() string {
+    return ml.Token.Literal
+}
+func (ml *MacroLiteral) Pos() token.Position {
+    return ml.Token.Pos
+}
+func (ml *MacroLiteral) End() token.Position {
+    if ml.Body != nil {
+        return ml.Body.End()
+    }
+    return ml.Token.End
+}
+func (ml *MacroLiteral) String() string {
+    var output bytes.Buffer
+
+    params := ParametersString(ml.Parameters, nil, nil, nil)
+
+    output.WriteString(ml.TokenLiteral())
+    output.WriteString("(")
+    output.WriteString(strings.Join(params, ","))
+    output.WriteString(") ")
+    output.WriteString(ml.Body.String())
+
+    return output.String()
+}
+
 type CallExpression struct {
     Token      token.Token
     Function   Expression
     Arguments  []Expression
+    Rparen     token.Token
 }
 
 func (ce *CallExpression) expressionNode() {}
 func (ce *CallExpression) TokenLiteral() string {
     return ce.Token.Literal
 }
+func (ce *CallExpression) Pos() token.Position {
+    if ce.Function != nil {
+        return ce.Function.Pos()
+    }
+    return ce.Token.Pos
+}
+func (ce *CallExpression) End() token.Position {
+    return ce.Rparen.End
+}
 func (ce *CallExpression) String() string {
     var output bytes.Buffer
 
@@ -318,19 +830,54 @@ func (sl *StringLiteral) expressionNode() {}
 func (sl *StringLiteral) TokenLiteral() string {
     return sl.Token.Literal
 }
+func (sl *StringLiteral) Pos() token.Position {
+    return sl.Token.Pos
+}
+func (sl *StringLiteral) End() token.Position {
+    return sl.Token.End
+}
+// String returns the literal in source form, with quotes and escape
+// sequences.
 func (sl *StringLiteral) String() string {
-    return sl.Token.Literal
+    var out strings.Builder
+    out.WriteByte('"')
+    for _, character := range sl.Value {
+        switch {
+        case character == '"' || character == '\\':
+            out.WriteByte('\\')
+            out.WriteRune(character)
+        case character == '\n':
+            out.WriteString("\\n")
+        case character == '\t':
+            out.WriteString("\\t")
+        case character < 0x20 || character == 0x7f:
+            fmt.Fprintf(&out, "\\x%02x", character)
+        case !unicode.IsPrint(character):
+            fmt.Fprintf(&out, "\\u{%x}", character)
+        default:
+            out.WriteRune(character)
+        }
+    }
+    out.WriteByte('"')
+    return out.String()
 }
 
 // Arrays
 type ArrayLiteral struct {
     Token token.Token
     Elements []Expression
+    Rbracket token.Token
 }
 func (al *ArrayLiteral) expressionNode() {}
 func (al *ArrayLiteral) TokenLiteral() string {
     return al.Token.Literal
 }
+func (al *ArrayLiteral) Pos() token.Position {
+    return al.Token.Pos
+}
+func (al *ArrayLiteral) End() token.Position {
+    return al.Rbracket.End
+}
 func (al *ArrayLiteral) String() string {
     var output bytes.Buffer
 
@@ -350,11 +897,21 @@ type IndexExpression struct {
     Token token.Token
     Left  Expression
     Index Expression
+    Rbracket token.Token
 }
 func (ie *IndexExpression) expressionNode() {}
 func (ie *IndexExpression) TokenLiteral() string {
     return ie.Token.Literal
 }
+func (ie *IndexExpression) Pos() token.Position {
+    if ie.Left != nil {
+        return ie.Left.Pos()
+    }
+    return ie.Token.Pos
+}
+func (ie *IndexExpression) End() token.Position {
+    return ie.Rbracket.End
+}
 func (ie *IndexExpression) String() string {
     var output bytes.Buffer
 
@@ -371,17 +928,35 @@ func (ie *IndexExpression) String() string {
 type HashLiteral struct {
     Token token.Token
     Pairs map[Expression]Expression
+    Rbrace token.Token
 }
 func (hl *HashLiteral) expressionNode() {}
 func (hl *HashLiteral) TokenLiteral() string {
     return hl.Token.Literal
 }
+func (hl *HashLiteral) Pos() token.Position {
+    return hl.Token.Pos
+}
+func (hl *HashLiteral) End() token.Position {
+    return hl.Rbrace.End
+}
+// Keys returns the keys of the pairs in source order.
+func (hl *HashLiteral) Keys() []Expression {
+    keys := make([]Expression, 0, len(hl.Pairs))
+    for key := range hl.Pairs {
+        keys = append(keys, key)
+    }
+    sort.SliceStable(keys, func(i, j int) bool {
+        return keys[i].Pos().Offset < keys[j].Pos().Offset
+    })
+    return keys
+}
 func (hl *HashLiteral) String() string {
     var output bytes.Buffer
 
     pairs := []string{}
-    for key, value := range hl.Pairs {
-        pairs = append(pairs, key.String() + ":" + value.String())
+    for _, key := range hl.Keys() {
+        pairs = append(pairs, key.String() + ":" + hl.Pairs[key].String())
     }
     
     output.WriteString("{")
@@ -22,7 +22,30 @@ func TestString(t *testing.T) {
         },
     }
 
-    if program.String() != "let myVar = anotherVar" {
+    // LetStatement.String has always ended in a semicolon
+    if program.String() != "let myVar = anotherVar;" {
         t.Errorf("program.String is wrong, got: %q", program.String())
     } 
 }
+
+func TestStringLiteralString(t *testing.T) {
+    tests := []struct{
+        value    string
+        expected string
+    }{
+        {"plain", `"plain"`},
+        {"say \"hi\"", `"say \"hi\""`},
+        {`a\b`, `"a\\b"`},
+        {"line\n\ttab", `"line\n\ttab"`},
+        {"\x00\x1b\x7f", `"\x00\x1b\x7f"`},
+        {"héllo 日本", `"héllo 日本"`},
+        {"zero\u200bwidth", `"zero\u{200b}width"`},
+    }
+
+    for _, tt := range tests {
+        literal := &StringLiteral{Token: token.Token{Type: token.STRING, Literal: tt.value}, Value: tt.value}
+        if literal.String() != tt.expected {
+            t.Errorf("%q: wrong String. expected=%q, got=%q", tt.value, tt.expected, literal.String())
+        }
+    }
+}
@@ -0,0 +1,207 @@
+package ast
+
+// Copy returns a deep copy of node, so that the copy can be changed with
+// Modify without touching the original tree.
+func Copy(node Node) Node {
+    switch node := node.(type) {
+    case *Program:
+        c := *node
+        c.Statements = copyStatements(node.Statements)
+        return &c
+    case *ExpressionStatement:
+        c := *node
+        c.Expression = copyExpression(node.Expression)
+        return &c
+    case *BlockStatement:
+        return copyBlock(node)
+    case *LetStatement:
+        c := *node
+        c.Name = copyIdentifier(node.Name)
+        c.Value = copyExpression(node.Value)
+        return &c
+    case *ImportStatement:
+        c := *node
+        c.Path = Copy(node.Path).(*StringLiteral)
+        c.Name = copyIdentifier(node.Name)
+        return &c
+    case *ExportStatement:
+        c := *node
+        c.Statement = Copy(node.Statement).(*LetStatement)
+        return &c
+    case *ThrowStatement:
+        c := *node
+        c.Value = copyExpression(node.Value)
+        return &c
+    case *ReturnStatement:
+        c := *node
+        c.ReturnValue = copyExpression(node.ReturnValue)
+        return &c
+    case *WhileStatement:
+        c := *node
+        c.Condition = copyExpression(node.Condition)
+        c.Body = copyBlock(node.Body)
+        return &c
+    case *ForStatement:
+        c := *node
+        c.Variable = copyIdentifier(node.Variable)
+        c.Iterable = copyExpression(node.Iterable)
+        c.Body = copyBlock(node.Body)
+        return &c
+    case *BreakStatement:
+        c := *node
+        return &c
+    case *ContinueStatement:
+        c := *node
+        return &c
+    case *Identifier:
+        return copyIdentifier(node)
+    case *IntegerLiteral:
+        c := *node
+        return &c
+    case *FloatLiteral:
+        c := *node
+        return &c
+    case *StringLiteral:
+        c := *node
+        return &c
+    case *Boolean:
+        c := *node
+        return &c
+    case *PrefixExpression:
+        c := *node
+        c.Right = copyExpression(node.Right)
+        return &c
+    case *InfixExpression:
+        c := *node
+        c.Left = copyExpression(node.Left)
+        c.Right = copyExpression(node.Right)
+        return &c
+    case *AssignExpression:
+        c := *node
+        c.Target = copyExpression(node.Target)
+        c.Value = copyExpression(node.Value)
+        return &c
+    case *MemberExpression:
+        c := *node
+        c.Object = copyExpression(node.Object)
+        c.Member = copyIdentifier(node.Member)
+        return &c
+    case *IndexExpression:
+        c := *node
+        c.Left = copyExpression(node.Left)
+        c.Index = copyExpression(node.Index)
+        return &c
+    case *IfExpression:
+        c := *node
+        c.Condition = copyExpression(node.Condition)
+        c.Consequence = copyBlock(node.Consequence)
+        c.Alternative = copyBlock(node.Alternative)
+        return &c
+    case *TryExpression:
+        c := *node
+        c.Block = copyBlock(node.Block)
+        c.Parameter = copyIdentifier(node.Parameter)
+        c.Catch = copyBlock(node.Catch)
+        return &c
+    case *FunctionLiteral:
+        c := *node
+        c.Parameters = copyIdentifiers(node.Parameters)
+        if node.Defaults != nil {
+            c.Defaults = make(map[string]Expression)
+            for name, value := range node.Defaults {
+                c.Defaults[name] = copyExpression(value)
+            }
+        }
+        if node.ParameterTypes != nil {
+            // type expressions are never changed, they can be shared
+            c.ParameterTypes = make(map[string]*TypeExpression)
+            for name, t := range node.ParameterTypes {
+                c.ParameterTypes[name] = t
+            }
+        }
+        c.Rest = copyIdentifier(node.Rest)
+        c.Body = copyBlock(node.Body)
+        return &c
+    case *MacroLiteral:
+        c := *node
+        c.Parameters = copyIdentifiers(node.Parameters)
+        c.Body = copyBlock(node.Body)
+        return &c
+    case *CallExpression:
+        c := *node
+        c.Function = copyExpression(node.Function)
+        c.Arguments = copyExpressions(node.Arguments)
+        return &c
+    case *ArrayLiteral:
+        c := *node
+        c.Elements = copyExpressions(node.Elements)
+        return &c
+    case *HashLiteral:
+        c := *node
+        c.Pairs = make(map[Expression]Expression)
+        for key, value := range node.Pairs {
+            c.Pairs[copyExpression(key)] = copyExpression(value)
+        }
+        return &c
+    }
+
+    return node
+}
+
+func copyExpression(expression Expression) Expression {
+    if expression == nil {
+        return nil
+    }
+    copied, _ := Copy(expression).(Expression)
+    return copied
+}
+
+func copyExpressions(expressions []Expression) []Expression {
+    if expressions == nil {
+        return nil
+    }
+    copied := make([]Expression, len(expressions))
+    for i, expression := range expressions {
+        copied[i] = copyExpression(expression)
+    }
+    return copied
+}
+
+func copyStatements(statements []Statement) []Statement {
+    if statements == nil {
+        return nil
+    }
+    copied := make([]Statement, len(statements))
+    for i, statement := range statements {
+        copied[i], _ = Copy(statement).(Statement)
+    }
+    return copied
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+    if block == nil {
+        return nil
+    }
+    c := *block
+    c.Statements = copyStatements(block.Statements)
+    return &c
+}
+
+func copyIdentifier(ident *Identifier) *Identifier {
+    if ident == nil {
+        return nil
+    }
+    c := *ident
+    return &c
+}
+
+func copyIdentifiers(idents []*Identifier) []*Identifier {
+    if idents == nil {
+        return nil
+    }
+    copied := make([]*Identifier, len(idents))
+    for i, ident := range idents {
+        copied[i] = copyIdentifier(ident)
+    }
+    return copied
+}
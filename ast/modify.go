@@ -0,0 +1,121 @@
+package ast
+
+// ModifierFunc returns the node that replaces node, which may be node itself.
+type ModifierFunc func(Node) Node
+
+// Modify rewrites the tree rooted at node bottom-up: the children of a node are
+// modified before modifier is called on the node itself. Names in binding
+// positions, like parameters, are only replaced by other identifiers.
+func Modify(node Node, modifier ModifierFunc) Node {
+    switch node := node.(type) {
+    case *Program:
+        for i, statement := range node.Statements {
+            node.Statements[i], _ = Modify(statement, modifier).(Statement)
+        }
+    case *ExpressionStatement:
+        node.Expression, _ = Modify(node.Expression, modifier).(Expression)
+    case *BlockStatement:
+        for i, statement := range node.Statements {
+            node.Statements[i], _ = Modify(statement, modifier).(Statement)
+        }
+    case *LetStatement:
+        node.Name = modifyIdentifier(node.Name, modifier)
+        node.Value, _ = Modify(node.Value, modifier).(Expression)
+    case *ExportStatement:
+        node.Statement, _ = Modify(node.Statement, modifier).(*LetStatement)
+    case *ThrowStatement:
+        node.Value, _ = Modify(node.Value, modifier).(Expression)
+    case *ReturnStatement:
+        node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+    case *WhileStatement:
+        node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+        node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+    case *ForStatement:
+        node.Variable = modifyIdentifier(node.Variable, modifier)
+        node.Iterable, _ = Modify(node.Iterable, modifier).(Expression)
+        node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+    case *PrefixExpression:
+        node.Right, _ = Modify(node.Right, modifier).(Expression)
+    case *InfixExpression:
+        node.Left, _ = Modify(node.Left, modifier).(Expression)
+        node.Right, _ = Modify(node.Right, modifier).(Expression)
+    case *AssignExpression:
+        node.Target, _ = Modify(node.Target, modifier).(Expression)
+        node.Value, _ = Modify(node.Value, modifier).(Expression)
+    case *MemberExpression:
+        node.Object, _ = Modify(node.Object, modifier).(Expression)
+    case *IndexExpression:
+        node.Left, _ = Modify(node.Left, modifier).(Expression)
+        node.Index, _ = Modify(node.Index, modifier).(Expression)
+    case *IfExpression:
+        node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+        node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
+        if node.Alternative != nil {
+            node.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
+        }
+    case *TryExpression:
+        node.Block, _ = Modify(node.Block, modifier).(*BlockStatement)
+        node.Parameter = modifyIdentifier(node.Parameter, modifier)
+        node.Catch, _ = Modify(node.Catch, modifier).(*BlockStatement)
+    case *FunctionLiteral:
+        // defaults and types are keyed by parameter name, which the
+        // modifier may change
+        defaults, types := node.Defaults, node.ParameterTypes
+        if defaults != nil {
+            node.Defaults = make(map[string]Expression)
+        }
+        if types != nil {
+            node.ParameterTypes = make(map[string]*TypeExpression)
+        }
+        for i, parameter := range node.Parameters {
+            node.Parameters[i] = modifyIdentifier(parameter, modifier)
+            if value, ok := defaults[parameter.Value]; ok {
+                node.Defaults[node.Parameters[i].Value], _ = Modify(value, modifier).(Expression)
+            }
+            if t, ok := types[parameter.Value]; ok {
+                node.ParameterTypes[node.Parameters[i].Value] = t
+            }
+        }
+        if node.Rest != nil {
+            rest := node.Rest.Value
+            node.Rest = modifyIdentifier(node.Rest, modifier)
+            if t, ok := types[rest]; ok {
+                node.ParameterTypes[node.Rest.Value] = t
+            }
+        }
+        node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+    case *MacroLiteral:
+        for i, parameter := range node.Parameters {
+            node.Parameters[i] = modifyIdentifier(parameter, modifier)
+        }
+        node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+    case *CallExpression:
+        node.Function, _ = Modify(node.Function, modifier).(Expression)
+        for i, argument := range node.Arguments {
+            node.Arguments[i], _ = Modify(argument, modifier).(Expression)
+        }
+    case *ArrayLiteral:
+        for i, element := range node.Elements {
+            node.Elements[i], _ = Modify(element, modifier).(Expression)
+        }
+    case *HashLiteral:
+        pairs := make(map[Expression]Expression)
+        for key, value := range node.Pairs {
+            newKey, _ := Modify(key, modifier).(Expression)
+            newValue, _ := Modify(value, modifier).(Expression)
+            pairs[newKey] = newValue
+        }
+        node.Pairs = pairs
+    }
+
+    return modifier(node)
+}
+
+// modifyIdentifier modifies an identifier in a binding position. It keeps
+// the identifier when the modifier turns it into anything else.
+func modifyIdentifier(ident *Identifier, modifier ModifierFunc) *Identifier {
+    if modified, ok := Modify(ident, modifier).(*Identifier); ok {
+        return modified
+    }
+    return ident
+}
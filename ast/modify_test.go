@@ -0,0 +1,150 @@
+package ast
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestModify(t *testing.T) {
+    one := func() Expression { return &IntegerLiteral{Value: 1} }
+    two := func() Expression { return &IntegerLiteral{Value: 2} }
+
+    turnOneIntoTwo := func(node Node) Node {
+        integer, ok := node.(*IntegerLiteral)
+        if !ok {
+            return node
+        }
+        if integer.Value != 1 {
+            return node
+        }
+        integer.Value = 2
+        return integer
+    }
+
+    tests := []struct{
+        input    Node
+        expected Node
+    }{
+        {one(), two()},
+        {
+            &Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+            &Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+        },
+        {&InfixExpression{Left: one(), Operator: "+", Right: two()}, &InfixExpression{Left: two(), Operator: "+", Right: two()}},
+        {&InfixExpression{Left: two(), Operator: "+", Right: one()}, &InfixExpression{Left: two(), Operator: "+", Right: two()}},
+        {&PrefixExpression{Operator: "-", Right: one()}, &PrefixExpression{Operator: "-", Right: two()}},
+        {&IndexExpression{Left: one(), Index: one()}, &IndexExpression{Left: two(), Index: two()}},
+        {
+            &IfExpression{
+                Condition:   one(),
+                Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+                Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+            },
+            &IfExpression{
+                Condition:   two(),
+                Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+                Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+            },
+        },
+        {&ReturnStatement{ReturnValue: one()}, &ReturnStatement{ReturnValue: two()}},
+        {&LetStatement{Value: one()}, &LetStatement{Value: two()}},
+        {&AssignExpression{Target: &Identifier{Value: "x"}, Operator: "=", Value: one()}, &AssignExpression{Target: &Identifier{Value: "x"}, Operator: "=", Value: two()}},
+        {
+            &WhileStatement{Condition: one(), Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}}},
+            &WhileStatement{Condition: two(), Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}}},
+        },
+        {
+            &ForStatement{Variable: &Identifier{Value: "x"}, Iterable: one(), Body: &BlockStatement{Statements: []Statement{}}},
+            &ForStatement{Variable: &Identifier{Value: "x"}, Iterable: two(), Body: &BlockStatement{Statements: []Statement{}}},
+        },
+        {
+            &FunctionLiteral{
+                Parameters: []*Identifier{{Value: "a"}},
+                Defaults:   map[string]Expression{"a": one()},
+                Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+            },
+            &FunctionLiteral{
+                Parameters: []*Identifier{{Value: "a"}},
+                Defaults:   map[string]Expression{"a": two()},
+                Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+            },
+        },
+        {&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one(), one()}}, &CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{two(), two()}}},
+        {&ArrayLiteral{Elements: []Expression{one(), one()}}, &ArrayLiteral{Elements: []Expression{two(), two()}}},
+    }
+
+    for _, tt := range tests {
+        modified := Modify(tt.input, turnOneIntoTwo)
+
+        if !reflect.DeepEqual(modified, tt.expected) {
+            t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+        }
+    }
+
+    hashLiteral := &HashLiteral{
+        Pairs: map[Expression]Expression{
+            one(): one(),
+            one(): one(),
+        },
+    }
+
+    Modify(hashLiteral, turnOneIntoTwo)
+
+    for key, val := range hashLiteral.Pairs {
+        key, _ := key.(*IntegerLiteral)
+        if key.Value != 2 {
+            t.Errorf("value is not %d, got=%d", 2, key.Value)
+        }
+        val, _ := val.(*IntegerLiteral)
+        if val.Value != 2 {
+            t.Errorf("value is not %d, got=%d", 2, val.Value)
+        }
+    }
+}
+
+func TestModifyRenamesParameters(t *testing.T) {
+    fn := &FunctionLiteral{
+        Parameters:     []*Identifier{{Value: "a"}, {Value: "b"}},
+        ParameterTypes: map[string]*TypeExpression{"a": {Name: "int"}},
+        Defaults:       map[string]Expression{"b": &Identifier{Value: "a"}},
+        Body:           &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: &Identifier{Value: "a"}}}},
+    }
+
+    Modify(fn, func(node Node) Node {
+        if ident, ok := node.(*Identifier); ok && ident.Value == "a" {
+            return &Identifier{Value: "x"}
+        }
+        return node
+    })
+
+    if fn.String() != "(x: int,b = x) x" {
+        t.Errorf("wrong function. got=%q", fn.String())
+    }
+}
+
+func TestCopy(t *testing.T) {
+    original := &InfixExpression{
+        Left:     &IntegerLiteral{Value: 1},
+        Operator: "+",
+        Right:    &CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{&IntegerLiteral{Value: 1}}},
+    }
+
+    copied := Copy(original)
+    if !reflect.DeepEqual(copied, original) {
+        t.Fatalf("copy differs from the original. got=%#v", copied)
+    }
+
+    Modify(copied, func(node Node) Node {
+        if integer, ok := node.(*IntegerLiteral); ok {
+            return &IntegerLiteral{Value: integer.Value + 1}
+        }
+        return node
+    })
+
+    if original.Left.(*IntegerLiteral).Value != 1 {
+        t.Errorf("modifying the copy changed the original")
+    }
+    if original.Right.(*CallExpression).Arguments[0].(*IntegerLiteral).Value != 1 {
+        t.Errorf("modifying the copy changed the arguments of the original")
+    }
+}
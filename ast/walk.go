@@ -0,0 +1,110 @@
+package ast
+
+// Inspect calls f for node and, as long as f returns true, for the children
+// of node in source order. Nil children are skipped. The member name of a
+// member expression is not visited, as it is not a reference to a binding.
+func Inspect(node Node, f func(Node) bool) {
+    if isNil(node) || !f(node) {
+        return
+    }
+
+    switch node := node.(type) {
+    case *Program:
+        for _, statement := range node.Statements {
+            Inspect(statement, f)
+        }
+    case *ExpressionStatement:
+        Inspect(node.Expression, f)
+    case *BlockStatement:
+        for _, statement := range node.Statements {
+            Inspect(statement, f)
+        }
+    case *LetStatement:
+        Inspect(node.Name, f)
+        Inspect(node.Value, f)
+    case *ImportStatement:
+        Inspect(node.Path, f)
+        Inspect(node.Name, f)
+    case *ExportStatement:
+        Inspect(node.Statement, f)
+    case *ThrowStatement:
+        Inspect(node.Value, f)
+    case *ReturnStatement:
+        Inspect(node.ReturnValue, f)
+    case *WhileStatement:
+        Inspect(node.Condition, f)
+        Inspect(node.Body, f)
+    case *ForStatement:
+        Inspect(node.Variable, f)
+        Inspect(node.Iterable, f)
+        Inspect(node.Body, f)
+    case *PrefixExpression:
+        Inspect(node.Right, f)
+    case *InfixExpression:
+        Inspect(node.Left, f)
+        Inspect(node.Right, f)
+    case *AssignExpression:
+        Inspect(node.Target, f)
+        Inspect(node.Value, f)
+    case *MemberExpression:
+        Inspect(node.Object, f)
+    case *IndexExpression:
+        Inspect(node.Left, f)
+        Inspect(node.Index, f)
+    case *IfExpression:
+        Inspect(node.Condition, f)
+        Inspect(node.Consequence, f)
+        Inspect(node.Alternative, f)
+    case *TryExpression:
+        Inspect(node.Block, f)
+        Inspect(node.Parameter, f)
+        Inspect(node.Catch, f)
+    case *FunctionLiteral:
+        for _, parameter := range node.Parameters {
+            Inspect(parameter, f)
+            if value, ok := node.Defaults[parameter.Value]; ok {
+                Inspect(value, f)
+            }
+        }
+        Inspect(node.Rest, f)
+        Inspect(node.Body, f)
+    case *MacroLiteral:
+        for _, parameter := range node.Parameters {
+            Inspect(parameter, f)
+        }
+        Inspect(node.Body, f)
+    case *CallExpression:
+        Inspect(node.Function, f)
+        for _, argument := range node.Arguments {
+            Inspect(argument, f)
+        }
+    case *ArrayLiteral:
+        for _, element := range node.Elements {
+            Inspect(element, f)
+        }
+    case *HashLiteral:
+        for _, key := range node.Keys() {
+            Inspect(key, f)
+            Inspect(node.Pairs[key], f)
+        }
+    }
+}
+
+// isNil tells whether node is nil or a typed nil pointer, which optional
+// children like IfExpression.Alternative are when they are missing.
+func isNil(node Node) bool {
+    if node == nil {
+        return true
+    }
+    switch node := node.(type) {
+    case *BlockStatement:
+        return node == nil
+    case *Identifier:
+        return node == nil
+    case *LetStatement:
+        return node == nil
+    case *StringLiteral:
+        return node == nil
+    }
+    return false
+}
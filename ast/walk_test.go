@@ -0,0 +1,53 @@
+package ast
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestInspect(t *testing.T) {
+    ident := func(name string) *Identifier { return &Identifier{Value: name} }
+
+    program := &Program{Statements: []Statement{
+        &LetStatement{Name: ident("f"), Value: &FunctionLiteral{
+            Parameters: []*Identifier{ident("a"), ident("b")},
+            Defaults:   map[string]Expression{"b": ident("c")},
+            Body: &BlockStatement{Statements: []Statement{
+                &ExpressionStatement{Expression: &IfExpression{
+                    Condition:   ident("a"),
+                    Consequence: &BlockStatement{Statements: []Statement{
+                        &ReturnStatement{ReturnValue: &MemberExpression{Object: ident("lib"), Member: ident("member")}},
+                    }},
+                }},
+            }},
+        }},
+        &ExpressionStatement{Expression: &CallExpression{Function: ident("f"), Arguments: []Expression{ident("x")}}},
+    }}
+
+    var names []string
+    Inspect(program, func(node Node) bool {
+        if ident, ok := node.(*Identifier); ok {
+            names = append(names, ident.Value)
+        }
+        return true
+    })
+
+    expected := []string{"f", "a", "b", "c", "a", "lib", "f", "x"}
+    if !reflect.DeepEqual(names, expected) {
+        t.Errorf("wrong identifiers visited. expected=%v, got=%v", expected, names)
+    }
+
+    names = nil
+    Inspect(program, func(node Node) bool {
+        if ident, ok := node.(*Identifier); ok {
+            names = append(names, ident.Value)
+        }
+        _, isFunction := node.(*FunctionLiteral)
+        return !isFunction
+    })
+
+    expected = []string{"f", "f", "x"}
+    if !reflect.DeepEqual(names, expected) {
+        t.Errorf("wrong identifiers visited when skipping functions. expected=%v, got=%v", expected, names)
+    }
+}
@@ -0,0 +1,302 @@
+// Package checker finds mistakes in a program without running it: names
+// that are not defined, let bindings and parameters that are never used,
+// bindings that shadow a builtin, code after a return and builtins called
+// with the wrong number of arguments.
+package checker
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/evaluator"
+	"interpreter/token"
+	"sort"
+	"strings"
+)
+
+// Kinds of problems.
+const (
+    UNDEFINED        = "undefined"
+    UNUSED           = "unused"
+    SHADOWED_BUILTIN = "shadowed builtin"
+    UNREACHABLE      = "unreachable"
+    ARGUMENT_COUNT   = "argument count"
+)
+
+type Problem struct {
+    Kind    string
+    Pos     token.Position
+    Message string
+}
+
+func (p *Problem) Error() string {
+    return fmt.Sprintf("%s: %s", p.Pos, p.Message)
+}
+
+// binding is a name declared by a let statement, a parameter, a loop
+// variable, a catch clause or an import.
+type binding struct {
+    name *ast.Identifier
+    kind string // let, parameter or another kind that is not reported when unused
+    used bool
+}
+
+// scope holds the bindings of a program, a function or a block, the way the
+// evaluator makes an environment for each of them.
+type scope struct {
+    outer    *scope
+    bindings map[string]*binding
+}
+
+func newScope(outer *scope) *scope {
+    return &scope{outer: outer, bindings: make(map[string]*binding)}
+}
+
+func (s *scope) resolve(name string) *binding {
+    for ; s != nil; s = s.outer {
+        if b, ok := s.bindings[name]; ok {
+            return b
+        }
+    }
+    return nil
+}
+
+// function is a function or macro literal whose body is still to be checked.
+type function struct {
+    node  ast.Expression
+    scope *scope
+}
+
+type checker struct {
+    problems  []*Problem
+    bindings  []*binding
+    functions []function
+}
+
+// Check returns the problems found in program, ordered by position. Macro
+// calls are checked as written, before expansion: only the unquoted parts of
+// a quote are.
+func Check(program *ast.Program) []*Problem {
+    c := &checker{}
+    c.statements(program.Statements, newScope(nil))
+
+    // Function bodies run when the function is called, after the scopes
+    // around it are complete, so they are checked last and can refer to
+    // names declared after the function.
+    for len(c.functions) > 0 {
+        fn := c.functions[0]
+        c.functions = c.functions[1:]
+        c.function(fn)
+    }
+
+    for _, b := range c.bindings {
+        if !b.used && !strings.HasPrefix(b.name.Value, "_") {
+            c.report(UNUSED, b.name, "unused %s %s", b.kind, b.name.Value)
+        }
+    }
+
+    sort.SliceStable(c.problems, func(i, j int) bool {
+        return c.problems[i].Pos.Offset < c.problems[j].Pos.Offset
+    })
+    return c.problems
+}
+
+func (c *checker) report(kind string, node ast.Node, format string, a ...interface{}) {
+    c.problems = append(c.problems, &Problem{Kind: kind, Pos: node.Pos(), Message: fmt.Sprintf(format, a...)})
+}
+
+func (c *checker) declare(name *ast.Identifier, kind string, s *scope) *binding {
+    if _, ok := evaluator.LookupBuiltin(name.Value); ok {
+        c.report(SHADOWED_BUILTIN, name, "%s shadows the builtin %s", name.Value, name.Value)
+    }
+    b := &binding{name: name, kind: kind}
+    s.bindings[name.Value] = b
+    if kind == "let" || kind == "parameter" {
+        c.bindings = append(c.bindings, b)
+    }
+    return b
+}
+
+func (c *checker) statements(statements []ast.Statement, s *scope) {
+    reachable := true
+    for _, statement := range statements {
+        if !reachable {
+            c.report(UNREACHABLE, statement, "unreachable code")
+            reachable = true
+        }
+        c.statement(statement, s)
+
+        switch statement.(type) {
+        case *ast.ReturnStatement, *ast.ThrowStatement, *ast.BreakStatement, *ast.ContinueStatement:
+            reachable = false
+        }
+    }
+}
+
+func (c *checker) statement(statement ast.Statement, s *scope) {
+    switch node := statement.(type) {
+    case *ast.ExpressionStatement:
+        c.expression(node.Expression, s)
+    case *ast.LetStatement:
+        // the value is evaluated before the name is declared
+        c.expression(node.Value, s)
+        c.declare(node.Name, "let", s)
+    case *ast.ExportStatement:
+        c.statement(node.Statement, s)
+        s.bindings[node.Statement.Name.Value].used = true
+    case *ast.ImportStatement:
+        c.declare(node.Name, "import", s)
+    case *ast.ReturnStatement:
+        c.expression(node.ReturnValue, s)
+    case *ast.ThrowStatement:
+        c.expression(node.Value, s)
+    case *ast.WhileStatement:
+        c.expression(node.Condition, s)
+        c.block(node.Body, newScope(s))
+    case *ast.ForStatement:
+        c.expression(node.Iterable, s)
+        body := newScope(s)
+        c.declare(node.Variable, "loop variable", body)
+        c.block(node.Body, body)
+    case *ast.BlockStatement:
+        c.block(node, newScope(s))
+    }
+}
+
+func (c *checker) block(block *ast.BlockStatement, s *scope) {
+    if block != nil {
+        c.statements(block.Statements, s)
+    }
+}
+
+func (c *checker) expression(expression ast.Expression, s *scope) {
+    switch node := expression.(type) {
+    case *ast.Identifier:
+        c.identifier(node, s)
+    case *ast.PrefixExpression:
+        c.expression(node.Right, s)
+    case *ast.InfixExpression:
+        c.expression(node.Left, s)
+        c.expression(node.Right, s)
+    case *ast.AssignExpression:
+        if target, ok := node.Target.(*ast.Identifier); ok {
+            b := s.resolve(target.Value)
+            if b == nil {
+                c.report(UNDEFINED, target, "assignment to undeclared variable: %s", target.Value)
+            } else if node.Operator != "=" {
+                // a compound assignment reads the variable
+                b.used = true
+            }
+        } else {
+            c.expression(node.Target, s)
+        }
+        c.expression(node.Value, s)
+    case *ast.IfExpression:
+        c.expression(node.Condition, s)
+        c.block(node.Consequence, newScope(s))
+        c.block(node.Alternative, newScope(s))
+    case *ast.TryExpression:
+        c.block(node.Block, newScope(s))
+        catch := newScope(s)
+        c.declare(node.Parameter, "error", catch)
+        c.block(node.Catch, catch)
+    case *ast.FunctionLiteral, *ast.MacroLiteral:
+        c.functions = append(c.functions, function{node, s})
+    case *ast.CallExpression:
+        c.call(node, s)
+    case *ast.MemberExpression:
+        c.expression(node.Object, s)
+    case *ast.IndexExpression:
+        c.expression(node.Left, s)
+        c.expression(node.Index, s)
+    case *ast.ArrayLiteral:
+        for _, element := range node.Elements {
+            c.expression(element, s)
+        }
+    case *ast.HashLiteral:
+        for _, key := range node.Keys() {
+            c.expression(key, s)
+            c.expression(node.Pairs[key], s)
+        }
+    }
+}
+
+func (c *checker) identifier(ident *ast.Identifier, s *scope) {
+    if b := s.resolve(ident.Value); b != nil {
+        b.used = true
+        return
+    }
+    if _, ok := evaluator.LookupBuiltin(ident.Value); !ok {
+        c.report(UNDEFINED, ident, "identifier not found: %s", ident.Value)
+    }
+}
+
+func (c *checker) call(call *ast.CallExpression, s *scope) {
+    if isCallTo(call, "quote") {
+        for _, argument := range call.Arguments {
+            c.unquoted(argument, s)
+        }
+        return
+    }
+
+    c.expression(call.Function, s)
+    for _, argument := range call.Arguments {
+        c.expression(argument, s)
+    }
+
+    ident, ok := call.Function.(*ast.Identifier)
+    if !ok || s.resolve(ident.Value) != nil {
+        return
+    }
+    builtin, ok := evaluator.LookupBuiltin(ident.Value)
+    if ok && builtin.Arity >= 0 && len(call.Arguments) != builtin.Arity {
+        c.report(ARGUMENT_COUNT, call, "wrong number of arguments to %s. got=%d, want=%d", ident.Value, len(call.Arguments), builtin.Arity)
+    }
+}
+
+// unquoted checks the arguments of the unquote calls in quoted code, which
+// are the only parts of it that are evaluated.
+func (c *checker) unquoted(quoted ast.Node, s *scope) {
+    ast.Inspect(quoted, func(node ast.Node) bool {
+        call, ok := node.(*ast.CallExpression)
+        if !ok || !isCallTo(call, "unquote") {
+            return true
+        }
+        for _, argument := range call.Arguments {
+            c.expression(argument, s)
+        }
+        return false
+    })
+}
+
+func (c *checker) function(fn function) {
+    s := newScope(fn.scope)
+
+    switch node := fn.node.(type) {
+    case *ast.FunctionLiteral:
+        for _, parameter := range node.Parameters {
+            // defaults are evaluated after the parameters before them are bound
+            if value, ok := node.Defaults[parameter.Value]; ok {
+                c.expression(value, s)
+            }
+            c.declare(parameter, "parameter", s)
+        }
+        if node.Rest != nil {
+            c.declare(node.Rest, "parameter", s)
+        }
+        c.block(node.Body, s)
+    case *ast.MacroLiteral:
+        for _, parameter := range node.Parameters {
+            c.declare(parameter, "parameter", s)
+        }
+        c.block(node.Body, s)
+    }
+}
+
+func isCallTo(node ast.Node, name string) bool {
+    call, ok := node.(*ast.CallExpression)
+    if !ok {
+        return false
+    }
+    ident, ok := call.Function.(*ast.Identifier)
+    return ok && ident.Value == name
+}
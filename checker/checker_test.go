@@ -0,0 +1,93 @@
+package checker
+
+import (
+	"interpreter/lexer"
+	"interpreter/parser"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected []string
+    }{
+        // undefined identifiers
+        {"let a = 1; a + b", []string{"1:16: identifier not found: b"}},
+        {"let a = a + 1;", []string{"1:5: unused let a", "1:9: identifier not found: a"}},
+        {"puts(x); let x = 1;", []string{"1:6: identifier not found: x", "1:14: unused let x"}},
+        {"y = 2;", []string{"1:1: assignment to undeclared variable: y"}},
+        {"if (true) { let z = 1; puts(z) }; z", []string{"1:35: identifier not found: z"}},
+        {"for (e in [1]) { puts(e) }; e", []string{"1:29: identifier not found: e"}},
+        {`try { throw "x" } catch (err) { puts(err) }; err`, []string{"1:46: identifier not found: err"}},
+        {"let h = {k: 1}; puts(h.k)", []string{"1:10: identifier not found: k"}},
+        // function bodies can use names declared after them
+        {"let f = fn() { g() }; let g = fn() { f() }; f()", []string{}},
+        {"let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(5)", []string{}},
+        {"let f = fn(a, b = a + 1, ...more) { puts(b, more) }; f(1)", []string{}},
+        {"let f = fn(a = b, b = 1) { puts(a, b) }; f()", []string{"1:16: identifier not found: b"}},
+        {`import "lib.mk" as lib; lib.missing`, []string{}},
+        {"let twice = macro(x) { quote(unquote(x) * 2) }; twice(y)", []string{"1:55: identifier not found: y"}},
+        {"let bad = macro(x) { quote(unquote(z)) }; bad(1)", []string{"1:17: unused parameter x", "1:36: identifier not found: z"}},
+        // unused bindings
+        {"let a = 1; let b = 2; puts(b)", []string{"1:5: unused let a"}},
+        {"let f = fn(x, y) { x }; f(1, 2)", []string{"1:15: unused parameter y"}},
+        {"let f = fn(_x, ...more) { 1 }; f(1)", []string{"1:19: unused parameter more"}},
+        {"let i = 0; i = 1;", []string{"1:5: unused let i"}},
+        {"let i = 0; i += 1;", []string{}},
+        {"export let a = 1;", []string{}},
+        {"let a = 1; let a = 2; a", []string{"1:5: unused let a"}},
+        {"for (x in [1]) { 1 }", []string{}},
+        // shadowed builtins
+        {"let len = 1; puts(len)", []string{"1:5: len shadows the builtin len"}},
+        {"let f = fn(first) { first }; f(1)", []string{"1:12: first shadows the builtin first"}},
+        {"let rest = fn() { 1 }; rest(1, 2)", []string{"1:5: rest shadows the builtin rest"}},
+        // unreachable code
+        {"let f = fn() { return 1; puts(2); puts(3) }; f()", []string{"1:26: unreachable code"}},
+        {"while (true) { break; puts(1) }", []string{"1:23: unreachable code"}},
+        {`throw "x"; 1`, []string{"1:12: unreachable code"}},
+        {"let f = fn() { if (true) { return 1 } puts(2) }; f()", []string{}},
+        // builtin arguments
+        {"len(1, 2)", []string{"1:1: wrong number of arguments to len. got=2, want=1"}},
+        {"push([])", []string{"1:1: wrong number of arguments to push. got=1, want=2"}},
+        {"puts(); puts(1, 2, 3); first([1])", []string{}},
+    }
+
+    for _, tt := range tests {
+        p := parser.New(lexer.New(tt.input))
+        program := p.ParseProgram()
+        if len(p.Errors()) != 0 {
+            t.Fatalf("%q: parse errors: %v", tt.input, p.Errors())
+        }
+
+        problems := Check(program)
+        got := []string{}
+        for _, problem := range problems {
+            got = append(got, problem.Error())
+        }
+        if len(got) != len(tt.expected) {
+            t.Errorf("%q: wrong problems. expected=%q, got=%q", tt.input, tt.expected, got)
+            continue
+        }
+        for i := range got {
+            if got[i] != tt.expected[i] {
+                t.Errorf("%q: wrong problem %d. expected=%q, got=%q", tt.input, i, tt.expected[i], got[i])
+            }
+        }
+    }
+}
+
+func TestProblemKinds(t *testing.T) {
+    input := "let len = 1; let f = fn(x) { return 1; y }; f(1); first()"
+    program := parser.New(lexer.New(input)).ParseProgram()
+
+    expected := []string{SHADOWED_BUILTIN, UNUSED, UNUSED, UNREACHABLE, UNDEFINED, ARGUMENT_COUNT}
+    problems := Check(program)
+    if len(problems) != len(expected) {
+        t.Fatalf("wrong number of problems. expected=%d, got=%d: %v", len(expected), len(problems), problems)
+    }
+    for i, problem := range problems {
+        if problem.Kind != expected[i] {
+            t.Errorf("problem %d (%s) has wrong kind. expected=%q, got=%q", i, problem, expected[i], problem.Kind)
+        }
+    }
+}
@@ -0,0 +1,255 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"interpreter/token"
+	"sort"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+    var output bytes.Buffer
+
+    i := 0
+    for i < len(ins) {
+        def, err := Lookup(ins[i])
+        if err != nil {
+            fmt.Fprintf(&output, "ERROR: %s\n", err)
+            i++
+            continue
+        }
+
+        operands, read := ReadOperands(def, ins[i+1:])
+
+        fmt.Fprintf(&output, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+        i += 1 + read
+    }
+
+    return output.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+    operandCount := len(def.OperandWidths)
+
+    if len(operands) != operandCount {
+        return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+    }
+
+    switch operandCount {
+    case 0:
+        return def.Name
+    case 1:
+        return fmt.Sprintf("%s %d", def.Name, operands[0])
+    case 2:
+        return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+    }
+
+    return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+    OpConstant Opcode = iota
+
+    OpPop
+
+    OpAdd
+    OpSub
+    OpMul
+    OpDiv
+    OpMod
+
+    OpTrue
+    OpFalse
+    OpNull
+
+    OpEqual
+    OpNotEqual
+    OpGreaterThan
+    OpLessThan
+    OpGreaterEqual
+    OpLessEqual
+
+    OpMinus
+    OpBang
+
+    OpJumpNotTruthy
+    OpJumpNotTruthyOrPop
+    OpJumpTruthyOrPop
+    OpJump
+    OpJumpIfBound
+
+    OpGetGlobal
+    OpSetGlobal
+    OpGetLocal
+    OpSetLocal
+    OpClearLocals
+    OpGetBuiltin
+    OpGetFree
+    OpSetFree
+    OpCaptureLocal
+    OpCaptureFree
+    OpCurrentClosure
+
+    OpArray
+    OpHash
+    OpIndex
+    OpPeekIndex
+    OpSetIndex
+
+    OpIter
+    OpIterNext
+
+    OpTry
+    OpEndTry
+    OpThrow
+
+    OpCall
+    OpReturnValue
+    OpReturn
+    OpClosure
+)
+
+type Definition struct {
+    Name          string
+    OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition {
+    OpConstant:           {"OpConstant", []int{2}},
+    OpPop:                {"OpPop", []int{}},
+    OpAdd:                {"OpAdd", []int{}},
+    OpSub:                {"OpSub", []int{}},
+    OpMul:                {"OpMul", []int{}},
+    OpDiv:                {"OpDiv", []int{}},
+    OpMod:                {"OpMod", []int{}},
+    OpTrue:               {"OpTrue", []int{}},
+    OpFalse:              {"OpFalse", []int{}},
+    OpNull:               {"OpNull", []int{}},
+    OpEqual:              {"OpEqual", []int{}},
+    OpNotEqual:           {"OpNotEqual", []int{}},
+    OpGreaterThan:        {"OpGreaterThan", []int{}},
+    OpLessThan:           {"OpLessThan", []int{}},
+    OpGreaterEqual:       {"OpGreaterEqual", []int{}},
+    OpLessEqual:          {"OpLessEqual", []int{}},
+    OpMinus:              {"OpMinus", []int{}},
+    OpBang:               {"OpBang", []int{}},
+    OpJumpNotTruthy:      {"OpJumpNotTruthy", []int{2}},
+    OpJumpNotTruthyOrPop: {"OpJumpNotTruthyOrPop", []int{2}},
+    OpJumpTruthyOrPop:    {"OpJumpTruthyOrPop", []int{2}},
+    OpJump:               {"OpJump", []int{2}},
+    OpJumpIfBound:        {"OpJumpIfBound", []int{1, 2}},
+    OpGetGlobal:          {"OpGetGlobal", []int{2}},
+    OpSetGlobal:          {"OpSetGlobal", []int{2}},
+    OpGetLocal:           {"OpGetLocal", []int{1}},
+    OpSetLocal:           {"OpSetLocal", []int{1}},
+    OpClearLocals:        {"OpClearLocals", []int{1, 1}},
+    OpGetBuiltin:         {"OpGetBuiltin", []int{1}},
+    OpGetFree:            {"OpGetFree", []int{1}},
+    OpSetFree:            {"OpSetFree", []int{1}},
+    OpCaptureLocal:       {"OpCaptureLocal", []int{1}},
+    OpCaptureFree:        {"OpCaptureFree", []int{1}},
+    OpCurrentClosure:     {"OpCurrentClosure", []int{}},
+    OpArray:              {"OpArray", []int{2}},
+    OpHash:               {"OpHash", []int{2}},
+    OpIndex:              {"OpIndex", []int{}},
+    OpPeekIndex:          {"OpPeekIndex", []int{}},
+    OpSetIndex:           {"OpSetIndex", []int{}},
+    OpIter:               {"OpIter", []int{}},
+    OpIterNext:           {"OpIterNext", []int{2}},
+    OpTry:                {"OpTry", []int{2}},
+    OpEndTry:             {"OpEndTry", []int{}},
+    OpThrow:              {"OpThrow", []int{}},
+    OpCall:               {"OpCall", []int{1}},
+    OpReturnValue:        {"OpReturnValue", []int{}},
+    OpReturn:             {"OpReturn", []int{}},
+    OpClosure:            {"OpClosure", []int{2, 1}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+    def, ok := definitions[Opcode(op)]
+    if !ok {
+        return nil, fmt.Errorf("opcode %d undefined", op)
+    }
+
+    return def, nil
+}
+
+func Make(op Opcode, operands ...int) []byte {
+    def, ok := definitions[op]
+    if !ok {
+        return []byte{}
+    }
+
+    instructionLen := 1
+    for _, w := range def.OperandWidths {
+        instructionLen += w
+    }
+
+    instruction := make([]byte, instructionLen)
+    instruction[0] = byte(op)
+
+    offset := 1
+    for i, o := range operands {
+        width := def.OperandWidths[i]
+        switch width {
+        case 2:
+            binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+        case 1:
+            instruction[offset] = byte(o)
+        }
+        offset += width
+    }
+
+    return instruction
+}
+
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+    operands := make([]int, len(def.OperandWidths))
+    offset := 0
+
+    for i, width := range def.OperandWidths {
+        switch width {
+        case 2:
+            operands[i] = int(ReadUint16(ins[offset:]))
+        case 1:
+            operands[i] = int(ReadUint8(ins[offset:]))
+        }
+        offset += width
+    }
+
+    return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+    return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+    return uint8(ins[0])
+}
+
+// SourcePosition says that the instructions from Offset on were compiled from
+// source at Pos.
+type SourcePosition struct {
+    Offset int
+    Pos    token.Position
+}
+
+// Positions maps instructions to the source they were compiled from, ordered
+// by offset.
+type Positions []SourcePosition
+
+// At returns the source position of the instruction at offset.
+func (p Positions) At(offset int) token.Position {
+    i := sort.Search(len(p), func(i int) bool { return p[i].Offset > offset })
+    if i == 0 {
+        return token.Position{}
+    }
+    return p[i-1].Pos
+}
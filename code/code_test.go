@@ -0,0 +1,118 @@
+package code
+
+import (
+	"interpreter/token"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+    tests := []struct{
+        op       Opcode
+        operands []int
+        expected []byte
+    }{
+        {OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+        {OpAdd, []int{}, []byte{byte(OpAdd)}},
+        {OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+        {OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+        {OpJumpIfBound, []int{1, 65534}, []byte{byte(OpJumpIfBound), 1, 255, 254}},
+    }
+
+    for _, tt := range tests {
+        instruction := Make(tt.op, tt.operands...)
+
+        if len(instruction) != len(tt.expected) {
+            t.Errorf("instruction has wrong length. want=%d, got=%d", len(tt.expected), len(instruction))
+        }
+
+        for i, b := range tt.expected {
+            if instruction[i] != tt.expected[i] {
+                t.Errorf("wrong byte at pos %d. want=%d, got=%d", i, b, instruction[i])
+            }
+        }
+    }
+}
+
+func TestInstructionsString(t *testing.T) {
+    instructions := []Instructions{
+        Make(OpAdd),
+        Make(OpGetLocal, 1),
+        Make(OpConstant, 2),
+        Make(OpConstant, 65535),
+        Make(OpClosure, 65535, 255),
+    }
+
+    expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535 255
+`
+
+    concatted := Instructions{}
+    for _, ins := range instructions {
+        concatted = append(concatted, ins...)
+    }
+
+    if concatted.String() != expected {
+        t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, concatted.String())
+    }
+}
+
+func TestReadOperands(t *testing.T) {
+    tests := []struct{
+        op        Opcode
+        operands  []int
+        bytesRead int
+    }{
+        {OpConstant, []int{65535}, 2},
+        {OpGetLocal, []int{255}, 1},
+        {OpClosure, []int{65535, 255}, 3},
+    }
+
+    for _, tt := range tests {
+        instruction := Make(tt.op, tt.operands...)
+
+        def, err := Lookup(byte(tt.op))
+        if err != nil {
+            t.Fatalf("definition not found: %q", err)
+        }
+
+        operandsRead, n := ReadOperands(def, instruction[1:])
+        if n != tt.bytesRead {
+            t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+        }
+
+        for i, want := range tt.operands {
+            if operandsRead[i] != want {
+                t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+            }
+        }
+    }
+}
+
+func TestPositionsAt(t *testing.T) {
+    positions := Positions{
+        {Offset: 0, Pos: token.Position{Line: 1, Column: 1}},
+        {Offset: 3, Pos: token.Position{Line: 2, Column: 5}},
+        {Offset: 7, Pos: token.Position{Line: 1, Column: 1}},
+    }
+
+    tests := []struct{
+        offset   int
+        expected string
+    }{
+        {-1, "-"},
+        {0, "1:1"},
+        {2, "1:1"},
+        {3, "2:5"},
+        {6, "2:5"},
+        {100, "1:1"},
+    }
+
+    for _, tt := range tests {
+        if pos := positions.At(tt.offset); pos.String() != tt.expected {
+            t.Errorf("wrong position at %d. want=%q, got=%q", tt.offset, tt.expected, pos)
+        }
+    }
+}
@@ -0,0 +1,862 @@
+package compiler
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/code"
+	"interpreter/evaluator"
+	"interpreter/object"
+	"interpreter/token"
+	"sort"
+	"strings"
+)
+
+type Compiler struct {
+    constants []object.Object
+
+    symbolTable *SymbolTable
+
+    scopes     []CompilationScope
+    scopeIndex int
+
+    loops []*Loop
+    tries int // number of try blocks around the current statement
+
+    pos token.Position // position of the node being compiled
+}
+
+// Loop collects the jumps of break and continue statements, which are
+// patched once the position they jump to is known.
+type Loop struct {
+    breaks    []int
+    continues []int
+    tries     int // number of try blocks around the loop
+}
+
+// Error is a compile error at a position in the source, for programs or
+// features the vm cannot run.
+type Error struct {
+    Pos     token.Position
+    Message string
+}
+
+func (e *Error) Error() string {
+    return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+type Bytecode struct {
+    Instructions code.Instructions
+    Positions    code.Positions
+    Constants    []object.Object
+    NumLocals    int // locals of blocks in the main program
+}
+
+type EmittedInstruction struct {
+    Opcode   code.Opcode
+    Position int
+}
+
+type CompilationScope struct {
+    instructions        code.Instructions
+    positions           code.Positions
+    lastInstruction     EmittedInstruction
+    previousInstruction EmittedInstruction
+}
+
+var infixOpcodes = map[string]code.Opcode {
+    "+":  code.OpAdd,
+    "-":  code.OpSub,
+    "*":  code.OpMul,
+    "/":  code.OpDiv,
+    "%":  code.OpMod,
+    "==": code.OpEqual,
+    "!=": code.OpNotEqual,
+    ">":  code.OpGreaterThan,
+    "<":  code.OpLessThan,
+    ">=": code.OpGreaterEqual,
+    "<=": code.OpLessEqual,
+}
+
+var prefixOpcodes = map[string]code.Opcode {
+    "!": code.OpBang,
+    "-": code.OpMinus,
+}
+
+func New() *Compiler {
+    mainScope := CompilationScope{
+        instructions:        code.Instructions{},
+        lastInstruction:     EmittedInstruction{},
+        previousInstruction: EmittedInstruction{},
+    }
+
+    symbolTable := NewSymbolTable()
+    for i, name := range evaluator.BuiltinNames {
+        symbolTable.DefineBuiltin(i, name)
+    }
+
+    return &Compiler{
+        constants:   []object.Object{},
+        symbolTable: symbolTable,
+        scopes:      []CompilationScope{mainScope},
+        scopeIndex:  0,
+    }
+}
+
+// NewWithState creates a compiler that keeps defining globals and constants
+// where a previous compilation left off, which the REPL needs.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+    compiler := New()
+    compiler.symbolTable = s
+    compiler.constants = constants
+    return compiler
+}
+
+func (c *Compiler) errorf(node ast.Node, format string, a ...interface{}) error {
+    return &Error{Pos: node.Pos(), Message: fmt.Sprintf(format, a...)}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+    // instructions get the position of the innermost node they belong to,
+    // so runtime errors can be reported where the evaluator reports them
+    outer := c.pos
+    c.pos = node.Pos()
+    defer func() { c.pos = outer }()
+
+    switch node := node.(type) {
+    case *ast.Program:
+        for _, s := range node.Statements {
+            err := c.Compile(s)
+            if err != nil {
+                return err
+            }
+        }
+    case *ast.ExpressionStatement:
+        err := c.Compile(node.Expression)
+        if err != nil {
+            return err
+        }
+        c.emit(code.OpPop)
+    case *ast.BlockStatement:
+        for _, s := range node.Statements {
+            err := c.Compile(s)
+            if err != nil {
+                return err
+            }
+        }
+    case *ast.LetStatement:
+        return c.compileLetStatement(node)
+    case *ast.ExportStatement:
+        return c.compileLetStatement(node.Statement)
+    case *ast.ImportStatement:
+        return c.errorf(node, "import is not supported by the vm")
+    case *ast.WhileStatement:
+        return c.compileWhileStatement(node)
+    case *ast.ForStatement:
+        return c.compileForStatement(node)
+    case *ast.BreakStatement:
+        if len(c.loops) == 0 {
+            return c.errorf(node, "break outside of a loop")
+        }
+        loop := c.loops[len(c.loops)-1]
+        c.leaveTries(loop)
+        loop.breaks = append(loop.breaks, c.emit(code.OpJump, 9999))
+    case *ast.ContinueStatement:
+        if len(c.loops) == 0 {
+            return c.errorf(node, "continue outside of a loop")
+        }
+        loop := c.loops[len(c.loops)-1]
+        c.leaveTries(loop)
+        loop.continues = append(loop.continues, c.emit(code.OpJump, 9999))
+    case *ast.ThrowStatement:
+        err := c.Compile(node.Value)
+        if err != nil {
+            return err
+        }
+        c.emit(code.OpThrow)
+    case *ast.TryExpression:
+        return c.compileTryExpression(node)
+    case *ast.ReturnStatement:
+        err := c.Compile(node.ReturnValue)
+        if err != nil {
+            return err
+        }
+        c.emit(code.OpReturnValue)
+    case *ast.Identifier:
+        symbol, ok := c.symbolTable.Resolve(node.Value)
+        if !ok {
+            return c.errorf(node, "identifier not found: %s", node.Value)
+        }
+        c.loadSymbol(symbol)
+    case *ast.IntegerLiteral:
+        integer := &object.Integer{Value: node.Value}
+        c.emit(code.OpConstant, c.addConstant(integer))
+    case *ast.FloatLiteral:
+        float := &object.Float{Value: node.Value}
+        c.emit(code.OpConstant, c.addConstant(float))
+    case *ast.StringLiteral:
+        str := &object.String{Value: node.Value}
+        c.emit(code.OpConstant, c.addConstant(str))
+    case *ast.Boolean:
+        if node.Value {
+            c.emit(code.OpTrue)
+        } else {
+            c.emit(code.OpFalse)
+        }
+    case *ast.PrefixExpression:
+        op, ok := prefixOpcodes[node.Operator]
+        if !ok {
+            return c.errorf(node, "unknown operator %s", node.Operator)
+        }
+        err := c.Compile(node.Right)
+        if err != nil {
+            return err
+        }
+        c.emit(op)
+    case *ast.InfixExpression:
+        if node.Operator == "&&" || node.Operator == "||" {
+            return c.compileLogicalExpression(node)
+        }
+        op, ok := infixOpcodes[node.Operator]
+        if !ok {
+            return c.errorf(node, "unknown operator %s", node.Operator)
+        }
+        err := c.Compile(node.Left)
+        if err != nil {
+            return err
+        }
+        err = c.Compile(node.Right)
+        if err != nil {
+            return err
+        }
+        c.emit(op)
+    case *ast.IfExpression:
+        return c.compileIfExpression(node)
+    case *ast.AssignExpression:
+        return c.compileAssignExpression(node)
+    case *ast.ArrayLiteral:
+        for _, el := range node.Elements {
+            err := c.Compile(el)
+            if err != nil {
+                return err
+            }
+        }
+        c.emit(code.OpArray, len(node.Elements))
+    case *ast.HashLiteral:
+        keys := []ast.Expression{}
+        for k := range node.Pairs {
+            keys = append(keys, k)
+        }
+        // Map iteration order is random, sorting keeps the output deterministic.
+        sort.Slice(keys, func(i, j int) bool {
+            return keys[i].String() < keys[j].String()
+        })
+
+        for _, k := range keys {
+            err := c.Compile(k)
+            if err != nil {
+                return err
+            }
+            err = c.Compile(node.Pairs[k])
+            if err != nil {
+                return err
+            }
+        }
+        c.emit(code.OpHash, len(node.Pairs)*2)
+    case *ast.IndexExpression:
+        err := c.Compile(node.Left)
+        if err != nil {
+            return err
+        }
+        err = c.Compile(node.Index)
+        if err != nil {
+            return err
+        }
+        c.emit(code.OpIndex)
+    case *ast.MemberExpression:
+        err := c.Compile(node.Object)
+        if err != nil {
+            return err
+        }
+        member := &object.String{Value: node.Member.Value}
+        c.emit(code.OpConstant, c.addConstant(member))
+        c.emit(code.OpIndex)
+    case *ast.FunctionLiteral:
+        return c.compileFunctionLiteral(node, "")
+    case *ast.CallExpression:
+        if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "quote" {
+            return c.errorf(node, "quote is not supported by the vm")
+        }
+        err := c.Compile(node.Function)
+        if err != nil {
+            return err
+        }
+        for _, a := range node.Arguments {
+            err := c.Compile(a)
+            if err != nil {
+                return err
+            }
+        }
+        c.emit(code.OpCall, len(node.Arguments))
+    case *ast.MacroLiteral:
+        return c.errorf(node, "macros can only be defined by top-level let statements")
+    default:
+        return c.errorf(node, "unsupported node %T", node)
+    }
+
+    return nil
+}
+
+func (c *Compiler) compileLetStatement(node *ast.LetStatement) error {
+    name := node.Name.Value
+    if symbol, ok := c.symbolTable.lookupLocal(name); ok && symbol.Constant &&
+        (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+        return c.errorf(node, "cannot redeclare constant %s", name)
+    }
+
+    var err error
+    if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+        err = c.compileFunctionLiteral(fn, name)
+    } else {
+        err = c.Compile(node.Value)
+    }
+    if err != nil {
+        return err
+    }
+
+    if node.IsConst() {
+        c.storeSymbol(c.symbolTable.DefineConstant(name))
+    } else {
+        c.storeSymbol(c.symbolTable.Define(name))
+    }
+    return nil
+}
+
+// compileAssignExpression leaves the assigned value on the stack, so that
+// assignments can be chained like in the evaluator.
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+    var op code.Opcode
+    compound := node.Operator != "="
+    if compound {
+        var ok bool
+        op, ok = infixOpcodes[strings.TrimSuffix(node.Operator, "=")]
+        if !ok {
+            return c.errorf(node, "unknown operator %s", node.Operator)
+        }
+    }
+
+    switch target := node.Target.(type) {
+    case *ast.Identifier:
+        symbol, ok := c.symbolTable.Resolve(target.Value)
+        if !ok || symbol.Scope == BuiltinScope {
+            return c.errorf(target, "assignment to undeclared variable: %s", target.Value)
+        }
+        if symbol.Constant {
+            return c.errorf(target, "cannot assign to constant %s", target.Value)
+        }
+
+        if compound {
+            c.loadSymbol(symbol)
+        }
+        err := c.Compile(node.Value)
+        if err != nil {
+            return err
+        }
+        if compound {
+            c.emit(op)
+        }
+
+        switch symbol.Scope {
+        case GlobalScope:
+            c.emit(code.OpSetGlobal, symbol.Index)
+        case LocalScope:
+            c.emit(code.OpSetLocal, symbol.Index)
+        case FreeScope:
+            c.emit(code.OpSetFree, symbol.Index)
+        default:
+            return c.errorf(target, "cannot assign to %s", target.Value)
+        }
+        c.loadSymbol(symbol)
+    case *ast.IndexExpression:
+        err := c.Compile(target.Left)
+        if err != nil {
+            return err
+        }
+        err = c.Compile(target.Index)
+        if err != nil {
+            return err
+        }
+        if compound {
+            c.emit(code.OpPeekIndex)
+        }
+        err = c.Compile(node.Value)
+        if err != nil {
+            return err
+        }
+        if compound {
+            c.emit(op)
+        }
+        c.emit(code.OpSetIndex)
+    default:
+        return c.errorf(node.Target, "cannot assign to %s", node.Target.String())
+    }
+
+    return nil
+}
+
+// compileLogicalExpression leaves the deciding operand on the stack: the left
+// one when it already decides the result, the right one otherwise.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+    err := c.Compile(node.Left)
+    if err != nil {
+        return err
+    }
+
+    op := code.OpJumpNotTruthyOrPop
+    if node.Operator == "||" {
+        op = code.OpJumpTruthyOrPop
+    }
+    jumpPos := c.emit(op, 9999)
+
+    err = c.Compile(node.Right)
+    if err != nil {
+        return err
+    }
+    c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+    return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+    err := c.Compile(node.Condition)
+    if err != nil {
+        return err
+    }
+
+    jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+    err = c.compileBranch(node.Consequence, nil)
+    if err != nil {
+        return err
+    }
+
+    jumpPos := c.emit(code.OpJump, 9999)
+    c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+    if node.Alternative == nil {
+        c.emit(code.OpNull)
+    } else {
+        err := c.compileBranch(node.Alternative, nil)
+        if err != nil {
+            return err
+        }
+    }
+    c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+    return nil
+}
+
+// compileTryExpression installs a handler for the try block, which the vm
+// jumps to with the error value on the stack when the block fails.
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+    tryPos := c.emit(code.OpTry, 9999)
+    firstLocal := c.symbolTable.nextLocalIndex()
+
+    c.tries++
+    err := c.compileBranch(node.Block, nil)
+    c.tries--
+    if err != nil {
+        return err
+    }
+    c.emit(code.OpEndTry)
+    jumpPos := c.emit(code.OpJump, 9999)
+
+    // a failed block did not get to unset its locals
+    c.changeOperand(tryPos, len(c.currentInstructions()))
+    c.clearBlockLocals(firstLocal)
+
+    err = c.compileBranch(node.Catch, node.Parameter)
+    if err != nil {
+        return err
+    }
+    c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+    return nil
+}
+
+// leaveTries removes the handlers of the try blocks a break or continue
+// jumps out of.
+func (c *Compiler) leaveTries(loop *Loop) {
+    for i := loop.tries; i < c.tries; i++ {
+        c.emit(code.OpEndTry)
+    }
+}
+
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+    loopStart := len(c.currentInstructions())
+
+    err := c.Compile(node.Condition)
+    if err != nil {
+        return err
+    }
+
+    jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+    exit, err := c.compileLoopBody(node.Body, nil, loopStart)
+    if err != nil {
+        return err
+    }
+
+    c.changeOperand(jumpNotTruthyPos, exit)
+    return nil
+}
+
+// compileForStatement keeps the iterator in a hidden variable rather than on
+// the stack, so break, continue and return can leave the loop from anywhere.
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+    err := c.Compile(node.Iterable)
+    if err != nil {
+        return err
+    }
+    c.emit(code.OpIter)
+
+    iterator := c.symbolTable.Define(fmt.Sprintf("(iterator %d)", len(c.loops)))
+    c.storeSymbol(iterator)
+
+    loopStart := len(c.currentInstructions())
+    c.loadSymbol(iterator)
+    iterNextPos := c.emit(code.OpIterNext, 9999)
+
+    exit, err := c.compileLoopBody(node.Body, node.Variable, loopStart)
+    if err != nil {
+        return err
+    }
+
+    c.changeOperand(iterNextPos, exit)
+    return nil
+}
+
+// compileLoopBody compiles the body of a loop as a block, which first stores
+// the value on the stack in variable if there is one, followed by the jump
+// back to loopStart. It returns the position the loop exits to.
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement, variable *ast.Identifier, loopStart int) (int, error) {
+    firstLocal := c.enterBlock()
+    if variable != nil {
+        c.storeSymbol(c.symbolTable.Define(variable.Value))
+    }
+
+    loop := &Loop{tries: c.tries}
+    c.loops = append(c.loops, loop)
+
+    err := c.Compile(body)
+    if err != nil {
+        return 0, err
+    }
+
+    c.loops = c.loops[:len(c.loops)-1]
+
+    // every iteration starts with fresh locals, both at the end of the body
+    // and when leaving the loop
+    continuePos := len(c.currentInstructions())
+    c.clearBlockLocals(firstLocal)
+    c.emit(code.OpJump, loopStart)
+
+    exit := len(c.currentInstructions())
+    c.clearBlockLocals(firstLocal)
+    c.leaveBlock()
+
+    for _, pos := range loop.continues {
+        c.changeOperand(pos, continuePos)
+    }
+    for _, pos := range loop.breaks {
+        c.changeOperand(pos, exit)
+    }
+    return exit, nil
+}
+
+// compileBranch compiles an if/else block so that it leaves exactly one value
+// on the stack, falling back to null when the block does not end in an
+// expression. The block first stores the value on the stack in variable if
+// there is one.
+func (c *Compiler) compileBranch(block *ast.BlockStatement, variable *ast.Identifier) error {
+    start := len(c.currentInstructions())
+    firstLocal := c.enterBlock()
+    if variable != nil {
+        c.storeSymbol(c.symbolTable.Define(variable.Value))
+    }
+
+    err := c.Compile(block)
+    if err != nil {
+        return err
+    }
+
+    if len(c.currentInstructions()) > start && c.lastInstructionIs(code.OpPop) {
+        c.removeLastPop()
+    } else {
+        c.emit(code.OpNull)
+    }
+
+    c.clearBlockLocals(firstLocal)
+    c.leaveBlock()
+    return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral, name string) error {
+    c.enterScope()
+
+    if name != "" {
+        c.symbolTable.DefineFunctionName(name)
+    }
+
+    for _, p := range node.Parameters {
+        c.symbolTable.Define(p.Value)
+    }
+    if node.Rest != nil {
+        c.symbolTable.Define(node.Rest.Value)
+    }
+
+    err := c.compileDefaults(node)
+    if err != nil {
+        return err
+    }
+
+    err = c.Compile(node.Body)
+    if err != nil {
+        return err
+    }
+
+    if c.lastInstructionIs(code.OpPop) {
+        c.replaceLastPopWithReturn()
+    }
+    if !c.lastInstructionIs(code.OpReturnValue) {
+        c.emit(code.OpReturn)
+    }
+
+    freeSymbols := c.symbolTable.FreeSymbols
+    numLocals := c.symbolTable.numDefinitions
+    positions := c.scopes[c.scopeIndex].positions
+    instructions := c.leaveScope()
+
+    for _, s := range freeSymbols {
+        c.captureSymbol(s)
+    }
+
+    compiledFn := &object.CompiledFunction{
+        Instructions:  instructions,
+        Positions:     positions,
+        NumLocals:     numLocals,
+        NumParameters: len(node.Parameters),
+        NumDefaults:   len(node.Defaults),
+        Variadic:      node.Rest != nil,
+    }
+
+    fnIndex := c.addConstant(compiledFn)
+    c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+
+    return nil
+}
+
+// compileDefaults emits the prologue that assigns default values to the
+// optional parameters the caller left out. The vm leaves the slots of missing
+// arguments unset.
+func (c *Compiler) compileDefaults(node *ast.FunctionLiteral) error {
+    for i, p := range node.Parameters {
+        value, ok := node.Defaults[p.Value]
+        if !ok {
+            continue
+        }
+
+        jumpPos := c.emit(code.OpJumpIfBound, i, 9999)
+
+        err := c.Compile(value)
+        if err != nil {
+            return err
+        }
+        c.emit(code.OpSetLocal, i)
+
+        c.replaceInstruction(jumpPos, code.Make(code.OpJumpIfBound, i, len(c.currentInstructions())))
+    }
+    return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+    switch s.Scope {
+    case GlobalScope:
+        c.emit(code.OpGetGlobal, s.Index)
+    case LocalScope:
+        c.emit(code.OpGetLocal, s.Index)
+    case BuiltinScope:
+        c.emit(code.OpGetBuiltin, s.Index)
+    case FreeScope:
+        c.emit(code.OpGetFree, s.Index)
+    case FunctionScope:
+        c.emit(code.OpCurrentClosure)
+    }
+}
+
+// captureSymbol pushes what a closure keeps of a free variable. Locals are
+// captured by reference, so assignments are seen by the closure and by the
+// function that defined them.
+func (c *Compiler) captureSymbol(s Symbol) {
+    switch s.Scope {
+    case LocalScope:
+        c.emit(code.OpCaptureLocal, s.Index)
+    case FreeScope:
+        c.emit(code.OpCaptureFree, s.Index)
+    default:
+        c.loadSymbol(s)
+    }
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+    if s.Scope == GlobalScope {
+        c.emit(code.OpSetGlobal, s.Index)
+    } else {
+        c.emit(code.OpSetLocal, s.Index)
+    }
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+    return &Bytecode{
+        Instructions: c.currentInstructions(),
+        Positions:    c.scopes[c.scopeIndex].positions,
+        Constants:    c.constants,
+        NumLocals:    c.symbolTable.function().numBlockLocals,
+    }
+}
+
+func (c *Compiler) SymbolTable() *SymbolTable {
+    return c.symbolTable
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+    c.constants = append(c.constants, obj)
+    return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+    ins := code.Make(op, operands...)
+    pos := c.addInstruction(ins)
+
+    c.setLastInstruction(op, pos)
+
+    return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+    posNewInstruction := len(c.currentInstructions())
+    updatedInstructions := append(c.currentInstructions(), ins...)
+
+    c.scopes[c.scopeIndex].instructions = updatedInstructions
+    c.addPosition(posNewInstruction)
+
+    return posNewInstruction
+}
+
+// addPosition records the position of the node being compiled for the
+// instruction at offset, dropping the ones of removed instructions.
+func (c *Compiler) addPosition(offset int) {
+    positions := c.scopes[c.scopeIndex].positions
+    for len(positions) > 0 && positions[len(positions)-1].Offset >= offset {
+        positions = positions[:len(positions)-1]
+    }
+    if len(positions) == 0 || positions[len(positions)-1].Pos != c.pos {
+        positions = append(positions, code.SourcePosition{Offset: offset, Pos: c.pos})
+    }
+    c.scopes[c.scopeIndex].positions = positions
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+    previous := c.scopes[c.scopeIndex].lastInstruction
+    last := EmittedInstruction{Opcode: op, Position: pos}
+
+    c.scopes[c.scopeIndex].previousInstruction = previous
+    c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+    return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+    if len(c.currentInstructions()) == 0 {
+        return false
+    }
+
+    return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+    last := c.scopes[c.scopeIndex].lastInstruction
+    previous := c.scopes[c.scopeIndex].previousInstruction
+
+    old := c.currentInstructions()
+    new := old[:last.Position]
+
+    c.scopes[c.scopeIndex].instructions = new
+    c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+    ins := c.currentInstructions()
+
+    for i := 0; i < len(newInstruction); i++ {
+        ins[pos+i] = newInstruction[i]
+    }
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+    op := code.Opcode(c.currentInstructions()[opPos])
+    newInstruction := code.Make(op, operand)
+
+    c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+    lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+    c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+    c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) enterScope() {
+    scope := CompilationScope{
+        instructions:        code.Instructions{},
+        lastInstruction:     EmittedInstruction{},
+        previousInstruction: EmittedInstruction{},
+    }
+    c.scopes = append(c.scopes, scope)
+    c.scopeIndex++
+
+    c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+// enterBlock gives the following statements their own names and returns the
+// slot of the first local they define.
+func (c *Compiler) enterBlock() int {
+    c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+    return c.symbolTable.nextLocalIndex()
+}
+
+func (c *Compiler) leaveBlock() {
+    c.symbolTable = c.symbolTable.Outer
+}
+
+// clearBlockLocals unsets the locals defined since firstLocal, so a block that
+// runs again does not share variables captured by closures with earlier runs.
+func (c *Compiler) clearBlockLocals(firstLocal int) {
+    count := c.symbolTable.nextLocalIndex() - firstLocal
+    if count > 0 {
+        c.emit(code.OpClearLocals, firstLocal, count)
+    }
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+    instructions := c.currentInstructions()
+
+    c.scopes = c.scopes[:len(c.scopes)-1]
+    c.scopeIndex--
+
+    c.symbolTable = c.symbolTable.Outer
+
+    return instructions
+}
@@ -0,0 +1,482 @@
+package compiler
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/code"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"testing"
+)
+
+type compilerTestCase struct {
+    input                string
+    expectedConstants    []interface{}
+    expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+    tests := []compilerTestCase{
+        {
+            input:             "1 + 2",
+            expectedConstants: []interface{}{1, 2},
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpConstant, 0),
+                code.Make(code.OpConstant, 1),
+                code.Make(code.OpAdd),
+                code.Make(code.OpPop),
+            },
+        },
+        {
+            input:             "1 < 2",
+            expectedConstants: []interface{}{1, 2},
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpConstant, 0),
+                code.Make(code.OpConstant, 1),
+                code.Make(code.OpLessThan),
+                code.Make(code.OpPop),
+            },
+        },
+        {
+            input:             "-1",
+            expectedConstants: []interface{}{1},
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpConstant, 0),
+                code.Make(code.OpMinus),
+                code.Make(code.OpPop),
+            },
+        },
+    }
+
+    runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+    tests := []compilerTestCase{
+        {
+            input:             "if (true) { 10 }; 3333;",
+            expectedConstants: []interface{}{10, 3333},
+            expectedInstructions: []code.Instructions{
+                // 0000
+                code.Make(code.OpTrue),
+                // 0001
+                code.Make(code.OpJumpNotTruthy, 10),
+                // 0004
+                code.Make(code.OpConstant, 0),
+                // 0007
+                code.Make(code.OpJump, 11),
+                // 0010
+                code.Make(code.OpNull),
+                // 0011
+                code.Make(code.OpPop),
+                // 0012
+                code.Make(code.OpConstant, 1),
+                // 0015
+                code.Make(code.OpPop),
+            },
+        },
+        {
+            input:             "if (true) { let a = 1; } else { 20 }",
+            expectedConstants: []interface{}{1, 20},
+            expectedInstructions: []code.Instructions{
+                // 0000
+                code.Make(code.OpTrue),
+                // 0001
+                code.Make(code.OpJumpNotTruthy, 16),
+                // 0004
+                code.Make(code.OpConstant, 0),
+                // 0007
+                code.Make(code.OpSetLocal, 0),
+                // 0009
+                code.Make(code.OpNull),
+                // 0010
+                code.Make(code.OpClearLocals, 0, 1),
+                // 0013
+                code.Make(code.OpJump, 19),
+                // 0016
+                code.Make(code.OpConstant, 1),
+                // 0019
+                code.Make(code.OpPop),
+            },
+        },
+    }
+
+    runCompilerTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+    tests := []compilerTestCase{
+        {
+            input: "true && false",
+            expectedConstants: []interface{}{},
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpTrue),
+                code.Make(code.OpJumpNotTruthyOrPop, 5),
+                code.Make(code.OpFalse),
+                code.Make(code.OpPop),
+            },
+        },
+        {
+            input: "1 || 2 <= 3",
+            expectedConstants: []interface{}{1, 2, 3},
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpConstant, 0),
+                code.Make(code.OpJumpTruthyOrPop, 13),
+                code.Make(code.OpConstant, 1),
+                code.Make(code.OpConstant, 2),
+                code.Make(code.OpLessEqual),
+                code.Make(code.OpPop),
+            },
+        },
+    }
+
+    runCompilerTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+    tests := []compilerTestCase{
+        {
+            input: "while (true) { break; continue; }",
+            expectedConstants: []interface{}{},
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpTrue),
+                code.Make(code.OpJumpNotTruthy, 13),
+                code.Make(code.OpJump, 13),
+                code.Make(code.OpJump, 10),
+                code.Make(code.OpJump, 0),
+            },
+        },
+        {
+            input: "for (x in [1]) { x }",
+            expectedConstants: []interface{}{1},
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpConstant, 0),
+                code.Make(code.OpArray, 1),
+                code.Make(code.OpIter),
+                code.Make(code.OpSetGlobal, 0),
+                code.Make(code.OpGetGlobal, 0),
+                code.Make(code.OpIterNext, 27),
+                code.Make(code.OpSetLocal, 0),
+                code.Make(code.OpGetLocal, 0),
+                code.Make(code.OpPop),
+                code.Make(code.OpClearLocals, 0, 1),
+                code.Make(code.OpJump, 10),
+                code.Make(code.OpClearLocals, 0, 1),
+            },
+        },
+    }
+
+    runCompilerTests(t, tests)
+}
+
+func TestTryAndThrow(t *testing.T) {
+    tests := []compilerTestCase{
+        {
+            input: "try { 1 } catch (e) { e }; throw 2;",
+            expectedConstants: []interface{}{1, 2},
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpTry, 10),
+                code.Make(code.OpConstant, 0),
+                code.Make(code.OpEndTry),
+                code.Make(code.OpJump, 17),
+                code.Make(code.OpSetLocal, 0),
+                code.Make(code.OpGetLocal, 0),
+                code.Make(code.OpClearLocals, 0, 1),
+                code.Make(code.OpPop),
+                code.Make(code.OpConstant, 1),
+                code.Make(code.OpThrow),
+            },
+        },
+        {
+            input: "while (true) { try { break; } catch (e) { } }",
+            expectedConstants: []interface{}{},
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpTrue),
+                code.Make(code.OpJumpNotTruthy, 29),
+                code.Make(code.OpTry, 16),
+                code.Make(code.OpEndTry),
+                code.Make(code.OpJump, 29),
+                code.Make(code.OpNull),
+                code.Make(code.OpEndTry),
+                code.Make(code.OpJump, 22),
+                code.Make(code.OpSetLocal, 0),
+                code.Make(code.OpNull),
+                code.Make(code.OpClearLocals, 0, 1),
+                code.Make(code.OpPop),
+                code.Make(code.OpClearLocals, 0, 1),
+                code.Make(code.OpJump, 0),
+                code.Make(code.OpClearLocals, 0, 1),
+            },
+        },
+    }
+
+    runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+    tests := []compilerTestCase{
+        {
+            input:             "let one = 1; let two = one; two;",
+            expectedConstants: []interface{}{1},
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpConstant, 0),
+                code.Make(code.OpSetGlobal, 0),
+                code.Make(code.OpGetGlobal, 0),
+                code.Make(code.OpSetGlobal, 1),
+                code.Make(code.OpGetGlobal, 1),
+                code.Make(code.OpPop),
+            },
+        },
+    }
+
+    runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+    tests := []compilerTestCase{
+        {
+            input: "fn(a) { fn(b) { a + b } }",
+            expectedConstants: []interface{}{
+                []code.Instructions{
+                    code.Make(code.OpGetFree, 0),
+                    code.Make(code.OpGetLocal, 0),
+                    code.Make(code.OpAdd),
+                    code.Make(code.OpReturnValue),
+                },
+                []code.Instructions{
+                    code.Make(code.OpCaptureLocal, 0),
+                    code.Make(code.OpClosure, 0, 1),
+                    code.Make(code.OpReturnValue),
+                },
+            },
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpClosure, 1, 0),
+                code.Make(code.OpPop),
+            },
+        },
+        {
+            input: "let countDown = fn(x) { countDown(x - 1); }; countDown(1);",
+            expectedConstants: []interface{}{
+                1,
+                []code.Instructions{
+                    code.Make(code.OpCurrentClosure),
+                    code.Make(code.OpGetLocal, 0),
+                    code.Make(code.OpConstant, 0),
+                    code.Make(code.OpSub),
+                    code.Make(code.OpCall, 1),
+                    code.Make(code.OpReturnValue),
+                },
+                1,
+            },
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpClosure, 1, 0),
+                code.Make(code.OpSetGlobal, 0),
+                code.Make(code.OpGetGlobal, 0),
+                code.Make(code.OpConstant, 2),
+                code.Make(code.OpCall, 1),
+                code.Make(code.OpPop),
+            },
+        },
+    }
+
+    runCompilerTests(t, tests)
+}
+
+func TestDefaultParameters(t *testing.T) {
+    tests := []compilerTestCase{
+        {
+            input: "fn(a, b = 2) { a + b }",
+            expectedConstants: []interface{}{
+                2,
+                []code.Instructions{
+                    code.Make(code.OpJumpIfBound, 1, 9),
+                    code.Make(code.OpConstant, 0),
+                    code.Make(code.OpSetLocal, 1),
+                    code.Make(code.OpGetLocal, 0),
+                    code.Make(code.OpGetLocal, 1),
+                    code.Make(code.OpAdd),
+                    code.Make(code.OpReturnValue),
+                },
+            },
+            expectedInstructions: []code.Instructions{
+                code.Make(code.OpClosure, 1, 0),
+                code.Make(code.OpPop),
+            },
+        },
+    }
+
+    runCompilerTests(t, tests)
+}
+
+func TestBuiltins(t *testing.T) {
+    comp := New()
+    err := comp.Compile(parse(`len([]);`))
+    if err != nil {
+        t.Fatalf("compiler error: %s", err)
+    }
+
+    symbol, ok := comp.SymbolTable().Resolve("len")
+    if !ok || symbol.Scope != BuiltinScope {
+        t.Fatalf("len is not resolved as a builtin. got=%+v", symbol)
+    }
+
+    expected := []code.Instructions{
+        code.Make(code.OpGetBuiltin, symbol.Index),
+        code.Make(code.OpArray, 0),
+        code.Make(code.OpCall, 1),
+        code.Make(code.OpPop),
+    }
+
+    err = testInstructions(expected, comp.Bytecode().Instructions)
+    if err != nil {
+        t.Fatalf("testInstructions failed: %s", err)
+    }
+}
+
+func TestCompileErrors(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {`foobar`, "1:1: identifier not found: foobar"},
+        {`foobar = 1`, "1:1: assignment to undeclared variable: foobar"},
+        {`len += 1`, "1:1: assignment to undeclared variable: len"},
+        {`if (true) { let t = 1; }; t`, "1:27: identifier not found: t"},
+        {`const x = 1; x = 2`, "1:14: cannot assign to constant x"},
+        {`const x = 1; let x = 2`, "1:14: cannot redeclare constant x"},
+        {`fn() { const y = 1; y += 1 }`, "1:21: cannot assign to constant y"},
+        // features only the evaluator has
+        {`import "lib.mk" as lib;`, "1:1: import is not supported by the vm"},
+        {"let x = 1;\nquote(x + 1)", "2:1: quote is not supported by the vm"},
+        {"let f = fn() { let m = macro(x) { x }; };", "1:24: macros can only be defined by top-level let statements"},
+    }
+
+    for _, tt := range tests {
+        comp := New()
+        err := comp.Compile(parse(tt.input))
+        if err == nil {
+            t.Fatalf("expected compiler error for %q", tt.input)
+        }
+
+        if err.Error() != tt.expected {
+            t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, err.Error())
+        }
+    }
+}
+
+func TestResolveFree(t *testing.T) {
+    global := NewSymbolTable()
+    global.Define("a")
+
+    firstLocal := NewEnclosedSymbolTable(global)
+    firstLocal.Define("c")
+
+    secondLocal := NewEnclosedSymbolTable(firstLocal)
+    secondLocal.Define("e")
+
+    expected := []Symbol{
+        {Name: "a", Scope: GlobalScope, Index: 0},
+        {Name: "c", Scope: FreeScope, Index: 0},
+        {Name: "e", Scope: LocalScope, Index: 0},
+    }
+
+    for _, sym := range expected {
+        result, ok := secondLocal.Resolve(sym.Name)
+        if !ok {
+            t.Errorf("name %s not resolvable", sym.Name)
+            continue
+        }
+        if result != sym {
+            t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+        }
+    }
+
+    if len(secondLocal.FreeSymbols) != 1 || secondLocal.FreeSymbols[0].Name != "c" {
+        t.Errorf("wrong free symbols. got=%+v", secondLocal.FreeSymbols)
+    }
+}
+
+func parse(input string) *ast.Program {
+    l := lexer.New(input)
+    p := parser.New(l)
+    return p.ParseProgram()
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+    t.Helper()
+
+    for _, tt := range tests {
+        program := parse(tt.input)
+
+        compiler := New()
+        err := compiler.Compile(program)
+        if err != nil {
+            t.Fatalf("compiler error: %s", err)
+        }
+
+        bytecode := compiler.Bytecode()
+
+        err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+        if err != nil {
+            t.Fatalf("testInstructions failed: %s", err)
+        }
+
+        err = testConstants(tt.expectedConstants, bytecode.Constants)
+        if err != nil {
+            t.Fatalf("testConstants failed: %s", err)
+        }
+    }
+}
+
+func concatInstructions(s []code.Instructions) code.Instructions {
+    output := code.Instructions{}
+    for _, ins := range s {
+        output = append(output, ins...)
+    }
+    return output
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) error {
+    concatted := concatInstructions(expected)
+
+    if len(actual) != len(concatted) {
+        return fmt.Errorf("wrong instructions length.\nwant=%q\ngot =%q", concatted, actual)
+    }
+
+    for i, ins := range concatted {
+        if actual[i] != ins {
+            return fmt.Errorf("wrong instruction at %d.\nwant=%q\ngot =%q", i, concatted, actual)
+        }
+    }
+
+    return nil
+}
+
+func testConstants(expected []interface{}, actual []object.Object) error {
+    if len(expected) != len(actual) {
+        return fmt.Errorf("wrong number of constants. got=%d, want=%d", len(actual), len(expected))
+    }
+
+    for i, constant := range expected {
+        switch constant := constant.(type) {
+        case int:
+            integer, ok := actual[i].(*object.Integer)
+            if !ok || integer.Value != int64(constant) {
+                return fmt.Errorf("constant %d - wrong integer. got=%+v, want=%d", i, actual[i], constant)
+            }
+        case []code.Instructions:
+            fn, ok := actual[i].(*object.CompiledFunction)
+            if !ok {
+                return fmt.Errorf("constant %d - not a function: %T", i, actual[i])
+            }
+
+            err := testInstructions(constant, fn.Instructions)
+            if err != nil {
+                return fmt.Errorf("constant %d - testInstructions failed: %s", i, err)
+            }
+        }
+    }
+
+    return nil
+}
@@ -0,0 +1,152 @@
+package compiler
+
+type SymbolScope string
+
+const (
+    GlobalScope   SymbolScope = "GLOBAL"
+    LocalScope    SymbolScope = "LOCAL"
+    BuiltinScope  SymbolScope = "BUILTIN"
+    FreeScope     SymbolScope = "FREE"
+    FunctionScope SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+    Name     string
+    Scope    SymbolScope
+    Index    int
+    Constant bool
+}
+
+// SymbolTable holds the names of a function, of the main program or of a
+// block inside them. Blocks have their own names, but their locals live in
+// the frame of the function around them.
+type SymbolTable struct {
+    Outer *SymbolTable
+
+    store          map[string]Symbol
+    numDefinitions int
+    numBlockLocals int // locals of blocks in the main program
+    block          bool
+
+    FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+    s := make(map[string]Symbol)
+    free := []Symbol{}
+    return &SymbolTable{store: s, FreeSymbols: free}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+    s := NewSymbolTable()
+    s.Outer = outer
+    return s
+}
+
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+    s := NewEnclosedSymbolTable(outer)
+    s.block = true
+    return s
+}
+
+// Define adds a global or local symbol. Defining a name again in the same
+// table reuses its slot, like let overwrites a binding in the evaluator.
+func (s *SymbolTable) Define(name string) Symbol {
+    return s.define(name, false)
+}
+
+func (s *SymbolTable) DefineConstant(name string) Symbol {
+    return s.define(name, true)
+}
+
+func (s *SymbolTable) define(name string, constant bool) Symbol {
+    symbol, ok := s.store[name]
+    if !ok || (symbol.Scope != GlobalScope && symbol.Scope != LocalScope) {
+        symbol = Symbol{Name: name, Index: s.nextLocalIndex()}
+
+        fn := s.function()
+        switch {
+        case fn.Outer != nil:
+            symbol.Scope = LocalScope
+            fn.numDefinitions++
+        case s.block:
+            symbol.Scope = LocalScope
+            fn.numBlockLocals++
+        default:
+            symbol.Scope = GlobalScope
+            symbol.Index = fn.numDefinitions
+            fn.numDefinitions++
+        }
+    }
+
+    symbol.Constant = constant
+    s.store[name] = symbol
+    return symbol
+}
+
+// function returns the table of the function or main program s belongs to.
+func (s *SymbolTable) function() *SymbolTable {
+    for s.block {
+        s = s.Outer
+    }
+    return s
+}
+
+// nextLocalIndex returns the slot the next local defined in s gets. The
+// locals of a block are defined one after the other, so they end up in
+// consecutive slots.
+func (s *SymbolTable) nextLocalIndex() int {
+    fn := s.function()
+    if fn.Outer == nil {
+        return fn.numBlockLocals
+    }
+    return fn.numDefinitions
+}
+
+// lookupLocal returns the symbol name has in s itself, without looking at
+// the tables around it.
+func (s *SymbolTable) lookupLocal(name string) (Symbol, bool) {
+    symbol, ok := s.store[name]
+    return symbol, ok
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+    symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+    s.store[name] = symbol
+    return symbol
+}
+
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+    symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+    s.store[name] = symbol
+    return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+    s.FreeSymbols = append(s.FreeSymbols, original)
+
+    symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+    symbol.Scope = FreeScope
+    symbol.Constant = original.Constant
+
+    s.store[original.Name] = symbol
+    return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+    symbol, ok := s.store[name]
+    if !ok && s.Outer != nil {
+        symbol, ok = s.Outer.Resolve(name)
+        if !ok || s.block {
+            return symbol, ok
+        }
+
+        if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+            return symbol, ok
+        }
+
+        free := s.defineFree(symbol)
+        return free, true
+    }
+    return symbol, ok
+}
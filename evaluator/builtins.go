@@ -3,32 +3,40 @@ package evaluator
 import (
 	"fmt"
 	"interpreter/object"
+	"sort"
+	"unicode/utf8"
 )
 
 var builtins = map[string]*object.Builtin {
     "len": &object.Builtin{
+        Signature: "len(value)",
+        Arity:     1,
+        Doc:       "Returns the number of characters in a string or elements in an array.",
         Fn: func(args ...object.Object) object.Object {
             if len(args) != 1 {
-                return newError("wrong number of arguments. got=%d, want=1", len(args))
+                return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
             }
 
             switch arg := args[0].(type) {
             case *object.String:
-                return &object.Integer{Value: int64(len(arg.Value))}
+                return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
             case *object.Array:
                 return &object.Integer{Value: int64(len(arg.Elements))}
             default:
-                return newError("argument to `len` not supported, got %s", args[0].Type())        
+                return newError(object.TYPE_ERROR, "argument to `len` not supported, got %s", args[0].Type())        
             }
         }, 
     }, 
     "first": &object.Builtin{
+        Signature: "first(array)",
+        Arity:     1,
+        Doc:       "Returns the first element of an array, or null when it is empty.",
         Fn: func(args ...object.Object) object.Object {
             if len(args) != 1 {
-                return newError("wrong number of arguments. got=%d, want=1", len(args))
+                return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
             }
             if args[0].Type() != object.ARRAY_OBJ {
-                return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
+                return newError(object.TYPE_ERROR, "argument to `first` must be ARRAY, got %s", args[0].Type())
             }
 
             arr := args[0].(*object.Array)
@@ -40,12 +48,15 @@ var builtins = map[string]*object.Builtin {
        },
     },
     "last": &object.Builtin{
+        Signature: "last(array)",
+        Arity:     1,
+        Doc:       "Returns the last element of an array, or null when it is empty.",
         Fn: func(args ...object.Object) object.Object {
             if len(args) != 1 {
-                return newError("wrong number of arguments. got=%d, want=1", len(args))
+                return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
             }
             if args[0].Type() != object.ARRAY_OBJ {
-                return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
+                return newError(object.TYPE_ERROR, "argument to `last` must be ARRAY, got %s", args[0].Type())
             }
 
             arr := args[0].(*object.Array)
@@ -58,13 +69,16 @@ var builtins = map[string]*object.Builtin {
         },
     },
     "rest": &object.Builtin{
+        Signature: "rest(array)",
+        Arity:     1,
+        Doc:       "Returns a new array without the first element, or null when it is empty.",
         Fn: func(args ...object.Object) object.Object {
             
             if len(args) != 1 {
-                return newError("wrong number of arguments. got=%d, want=1", len(args))
+                return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
             }
             if args[0].Type() != object.ARRAY_OBJ {
-                return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
+                return newError(object.TYPE_ERROR, "argument to `rest` must be ARRAY, got %s", args[0].Type())
             }
 
             arr := args[0].(*object.Array)
@@ -79,13 +93,16 @@ var builtins = map[string]*object.Builtin {
         },
     },
     "push": &object.Builtin{
+        Signature: "push(array, value)",
+        Arity:     2,
+        Doc:       "Returns a new array with value added at the end.",
         Fn: func(args ...object.Object) object.Object {
             if len(args) != 2 {
-                return newError("wrong number of arguments. got=%d, want=2", len(args))
+                return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
             }
 
             if args[0].Type() != object.ARRAY_OBJ {
-                return newError("arguments to `push` must be ARRAY, got %s", args[0].Type())
+                return newError(object.TYPE_ERROR, "arguments to `push` must be ARRAY, got %s", args[0].Type())
             }
 
             arr := args[0].(*object.Array)
@@ -99,6 +116,9 @@ var builtins = map[string]*object.Builtin {
         },
     },
     "puts": &object.Builtin{
+        Signature: "puts(...values)",
+        Arity:     -1,
+        Doc:       "Prints each value on its own line and returns null.",
         Fn: func(args ...object.Object) object.Object {
             for _, arg := range args {
                 fmt.Println(arg.Inspect())
@@ -107,3 +127,19 @@ var builtins = map[string]*object.Builtin {
         },
     },
 }
+
+// BuiltinNames holds the names of all builtins in a stable order, so the
+// compiler and the vm can refer to a builtin by its index.
+var BuiltinNames []string
+
+func init() {
+    for name := range builtins {
+        BuiltinNames = append(BuiltinNames, name)
+    }
+    sort.Strings(BuiltinNames)
+}
+
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+    builtin, ok := builtins[name]
+    return builtin, ok
+}
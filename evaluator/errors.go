@@ -0,0 +1,96 @@
+package evaluator
+
+import (
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+func (e *evaluation) evalTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+    result := e.Eval(node.Block, object.NewEnclosedEnvironment(env))
+
+    // limit errors end the whole evaluation
+    err, ok := result.(*object.Error)
+    if !ok || err.Kind == object.LIMIT_ERROR {
+        return result
+    }
+
+    catchEnv := object.NewEnclosedEnvironment(env)
+    catchEnv.Set(node.Parameter.Value, ErrorValue(err))
+    return e.Eval(node.Catch, catchEnv)
+}
+
+// reservedKinds are the kinds of errors only the interpreter raises, which
+// try cannot catch.
+var reservedKinds = map[string]bool{
+    object.LIMIT_ERROR: true,
+}
+
+// Throw turns the value of a throw statement into an error. Hashes with a
+// string kind and message, like the ones catch binds, keep their kind and
+// message, so errors can be rethrown. A reserved kind is thrown as a plain
+// Error instead.
+func Throw(value object.Object) *object.Error {
+    err := &object.Error{Kind: object.THROWN_ERROR, Message: value.Inspect(), Value: value}
+
+    if hash, ok := value.(*object.Hash); ok {
+        if kind, ok := hashString(hash, "kind"); ok && !reservedKinds[kind] {
+            err.Kind = kind
+        }
+        if message, ok := hashString(hash, "message"); ok {
+            err.Message = message
+        }
+    }
+    return err
+}
+
+// ErrorValue is the value catch binds for err, a hash with its kind,
+// message, line, column, stack and the thrown value, if any.
+func ErrorValue(err *object.Error) *object.Hash {
+    stack := []object.Object{}
+    for _, frame := range err.Stack {
+        stack = append(stack, &object.String{Value: frame.String()})
+    }
+
+    value := err.Value
+    if value == nil {
+        value = NULL
+    }
+
+    fields := map[string]object.Object{
+        "kind":    &object.String{Value: err.Kind},
+        "message": &object.String{Value: err.Message},
+        "line":    &object.Integer{Value: int64(err.Pos.Line)},
+        "column":  &object.Integer{Value: int64(err.Pos.Column)},
+        "stack":   &object.Array{Elements: stack},
+        "value":   value,
+    }
+
+    hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+    for name, field := range fields {
+        key := &object.String{Value: name}
+        hash.Pairs[key.HashKey()] = object.HashPair{Key: key, Value: field}
+    }
+    return hash
+}
+
+func hashString(hash *object.Hash, name string) (string, bool) {
+    pair, ok := hash.Pairs[(&object.String{Value: name}).HashKey()]
+    if !ok {
+        return "", false
+    }
+    str, ok := pair.Value.(*object.String)
+    if !ok {
+        return "", false
+    }
+    return str.Value, true
+}
+
+// callName is the name a call shows up with in stack traces.
+func callName(function ast.Expression) string {
+    switch function := function.(type) {
+    case *ast.Identifier, *ast.MemberExpression:
+        return function.String()
+    default:
+        return "anonymous function"
+    }
+}
@@ -0,0 +1,107 @@
+package evaluator
+
+import (
+    "testing"
+    "interpreter/object"
+)
+
+func TestTryCatch(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected interface{}
+    }{
+        {`try { 1 } catch (e) { 2 }`, 1},
+        {`try { 1 + true } catch (e) { e.kind }`, "TypeError"},
+        {`try { 1 + true } catch (e) { e.message }`, "type mismatch: INTEGER + BOOLEAN"},
+        {`try { [1][5 / 0] } catch (e) { e.kind }`, "ZeroDivisionError"},
+        {`try { undefined } catch (e) { e.kind }`, "NameError"},
+        {`try { len(1, 2) } catch (e) { e.kind }`, "ArgumentError"},
+        {`try { throw "boom"; } catch (e) { e.message }`, "boom"},
+        {`try { throw "boom"; } catch (e) { e.kind }`, "Error"},
+        {`try { throw 42; } catch (e) { e.value }`, 42},
+        {`try { throw {"kind": "ValueError", "message": "bad"}; } catch (e) { e.kind + ": " + e.message }`, "ValueError: bad"},
+        {`try { throw {"kind": "LimitError", "message": "fake"}; } catch (e) { e.kind + ": " + e.message }`, "Error: fake"},
+        {`try { try { throw "inner"; } catch (e) { throw e.message + "!"; } } catch (e) { e.message }`, "inner!"},
+        {`let f = fn() { throw "deep"; }; let g = fn() { f() }; try { g() } catch (e) { len(e.stack) }`, 2},
+        {`let f = fn() { -true }; try { f() } catch (e) { e.stack[0] }`, "at f (1:31)"},
+        {`try { 1 + true } catch (e) { e.line * 100 + e.column }`, 107},
+        {`let x = try { throw 1; } catch (e) { 5 }; x`, 5},
+        {`let n = 0; while (true) { try { n += 1; if (n == 3) { break; } } catch (e) { } }; n`, 3},
+        {`let f = fn() { try { return 1; } catch (e) { 2 } }; f()`, 1},
+        {`try { let a = 1; a + true } catch (e) { a }`, "identifier not found: a"},
+        {`throw "uncaught";`, "uncaught"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+
+        switch expected := tt.expected.(type) {
+        case int:
+            testIntegerObject(t, evaluated, int64(expected))
+        case string:
+            switch obj := evaluated.(type) {
+            case *object.String:
+                if obj.Value != expected {
+                    t.Errorf("%q: wrong string. expected=%q, got=%q", tt.input, expected, obj.Value)
+                }
+            case *object.Error:
+                if obj.Message != expected {
+                    t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, obj.Message)
+                }
+            default:
+                t.Errorf("%q: object is not String or Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+            }
+        }
+    }
+}
+
+func TestErrorKinds(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"1 + true", object.TYPE_ERROR},
+        {"foo", object.NAME_ERROR},
+        {"let a = [1]; a[3] = 1", object.INDEX_ERROR},
+        {"fn(a) { a }()", object.ARGUMENT_ERROR},
+        {"1 % 0", object.ZERO_DIVISION_ERROR},
+        {`throw "x";`, object.THROWN_ERROR},
+        {`throw {"kind": "LimitError", "message": "x"};`, object.THROWN_ERROR},
+        {`throw {"kind": "TypeError", "message": "x"};`, object.TYPE_ERROR},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+
+        errObj, ok := evaluated.(*object.Error)
+        if !ok {
+            t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+            continue
+        }
+        if errObj.Kind != tt.expected {
+            t.Errorf("%q: wrong error kind. expected=%q, got=%q", tt.input, tt.expected, errObj.Kind)
+        }
+    }
+}
+
+func TestStackTrace(t *testing.T) {
+    input := `let inner = fn() { 1 + true };
+let outer = fn() { inner() };
+outer();`
+
+    evaluated := testEval(input)
+    errObj, ok := evaluated.(*object.Error)
+    if !ok {
+        t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+    }
+
+    expected := []string{"at inner (2:20)", "at outer (3:1)"}
+    if len(errObj.Stack) != len(expected) {
+        t.Fatalf("wrong stack length. expected=%d, got=%d (%v)", len(expected), len(errObj.Stack), errObj.Stack)
+    }
+    for i, frame := range errObj.Stack {
+        if frame.String() != expected[i] {
+            t.Errorf("stack[%d] wrong. expected=%q, got=%q", i, expected[i], frame.String())
+        }
+    }
+}
@@ -1,105 +1,165 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 	"interpreter/ast"
     "interpreter/object"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
 )
 
 var (
     NULL  = &object.Null{}
     TRUE  = &object.Boolean{Value: true}
     FALSE = &object.Boolean{Value: false}
+
+    BREAK    = &object.Break{}
+    CONTINUE = &object.Continue{}
 )
 
+// Eval evaluates node in env without limits, except for the default maximum
+// call depth.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+    return EvalContext(context.Background(), node, env, Limits{})
+}
+
+// Eval evaluates node, giving errors that have no position the position of node.
+func (e *evaluation) Eval(node ast.Node, env *object.Environment) object.Object {
+    if err := e.step(); err != nil {
+        return err
+    }
+
+    result := e.eval(node, env)
+    if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+        err.Pos = node.Pos()
+    }
+    return result
+}
+
+func (e *evaluation) eval(node ast.Node, env *object.Environment) object.Object {
     switch node := node.(type) {
     case *ast.Program:
-        return evalProgram(node.Statements, env)
+        return e.evalProgram(node.Statements, env)
     case *ast.ExpressionStatement:
-        return Eval(node.Expression, env)
+        return e.Eval(node.Expression, env)
     case *ast.IntegerLiteral:
         return &object.Integer{Value: node.Value}
+    case *ast.FloatLiteral:
+        return &object.Float{Value: node.Value}
     case *ast.Boolean:
         return nativeBoolToBooleanObject(node.Value)    
     case *ast.PrefixExpression:
-        right := Eval(node.Right, env)
+        right := e.Eval(node.Right, env)
         if isError(right) {
             return right
         }
-        return evalPrefixExpression(node.Operator, right)
+        return evalPrefixExpression(node.Operator, right, e.overflow)
     case *ast.InfixExpression:
-        left := Eval(node.Left, env)
+        left := e.Eval(node.Left, env)
         if isError(left) {
             return left
         }
-        right := Eval(node.Right, env)
+        if node.Operator == "&&" || node.Operator == "||" {
+            return e.evalLogicalExpression(node.Operator, left, node.Right, env)
+        }
+        right := e.Eval(node.Right, env)
         if isError(right) {
             return right
         }
-        return evalInflixExpression(node.Operator, left, right)
+        return e.track(evalInflixExpression(node.Operator, left, right, e.overflow))
     case *ast.BlockStatement:
-        return evalBlockStatement(node, env)
+        return e.evalBlockStatement(node, env)
     case *ast.IfExpression:
-        return evalIfExpression(node, env)
+        return e.evalIfExpression(node, env)
+    case *ast.TryExpression:
+        return e.evalTryExpression(node, env)
+    case *ast.ThrowStatement:
+        val := e.Eval(node.Value, env)
+        if isError(val) {
+            return val
+        }
+        return Throw(val)
+    case *ast.AssignExpression:
+        return e.evalAssignExpression(node, env)
+    case *ast.WhileStatement:
+        return e.evalWhileStatement(node, env)
+    case *ast.ForStatement:
+        return e.evalForStatement(node, env)
+    case *ast.BreakStatement:
+        return BREAK
+    case *ast.ContinueStatement:
+        return CONTINUE
     case *ast.ReturnStatement:
-        val := Eval(node.ReturnValue, env)
+        val := e.Eval(node.ReturnValue, env)
         if isError(val) {
             return val
         }
         return &object.ReturnValue{Value: val}
     case *ast.LetStatement:
-        val := Eval(node.Value, env)
+        val := e.Eval(node.Value, env)
         if isError(val) {
             return val
         }
-        env.Set(node.Name.Value, val)
+        if !env.Declare(node.Name.Value, val, node.IsConst()) {
+            return newError(object.NAME_ERROR, "cannot redeclare constant %s", node.Name.Value)
+        }
+    case *ast.ImportStatement:
+        return e.evalImportStatement(node, env)
+    case *ast.ExportStatement:
+        return e.Eval(node.Statement, env)
     case *ast.Identifier:
         return evalIdentifier(node, env)
     case *ast.FunctionLiteral:
-        params := node.Parameters
-        body := node.Body
-        return &object.Function{Parameters: params, Env: env, Body: body}
-    case *ast.CallExpression:
-        function := Eval(node.Function, env)
-        if isError(function) {
-            return function
-        }
-        args := evalExpression(node.Arguments, env)
-        if len(args) == 1 && isError(args[0]) {
-            return args[0]
+        return &object.Function{
+            Parameters: node.Parameters,
+            Defaults:   node.Defaults,
+            Rest:       node.Rest,
+            Env:        env,
+            Body:       node.Body,
         }
-        return applyFunction(function, args)
+    case *ast.MacroLiteral:
+        return newError(object.MACRO_ERROR, "macros can only be defined by top-level let statements")
+    case *ast.CallExpression:
+        return e.evalCallExpression(node, env, false)
     case *ast.StringLiteral:
         return &object.String{Value: node.Value}
     case *ast.ArrayLiteral:
-        elements := evalExpression(node.Elements, env)
+        elements := e.evalExpression(node.Elements, env)
         if len(elements) == 1 && isError(elements[0]) {
             return elements[0]  
         }
-        return &object.Array{Elements: elements}
+        return e.track(&object.Array{Elements: elements})
     case *ast.IndexExpression:
-        left := Eval(node.Left, env)
+        left := e.Eval(node.Left, env)
         if isError(left) {
             return left
         }
-        index := Eval(node.Index, env)
+        index := e.Eval(node.Index, env)
         if isError(index) {
             return index
         }
         return evalIndexExpression(left, index)
+    case *ast.MemberExpression:
+        left := e.Eval(node.Object, env)
+        if isError(left) {
+            return left
+        }
+        return evalIndexExpression(left, &object.String{Value: node.Member.Value})
     case *ast.HashLiteral:
-        return evalHashLiteral(node, env)
+        return e.evalHashLiteral(node, env)
     }
 
     return nil
 }
 
-func evalProgram(statements []ast.Statement, env *object.Environment) object.Object {
+func (e *evaluation) evalProgram(statements []ast.Statement, env *object.Environment) object.Object {
     var result object.Object
     
     for _, statement := range statements {
-        result = Eval(statement, env)
+        result = e.Eval(statement, env)
 
         switch result := result.(type) {
         case *object.ReturnValue:
@@ -112,15 +172,16 @@ func evalProgram(statements []ast.Statement, env *object.Environment) object.Obj
     return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (e *evaluation) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
     var result object.Object
 
     for _, statement := range block.Statements {
-        result = Eval(statement, env)
+        result = e.Eval(statement, env)
 
         if result != nil {
             resultType := result.Type()
-            if resultType == object.RETURN_VALUE_OBJ || resultType == object.ERROR_OBJ {
+            if resultType == object.RETURN_VALUE_OBJ || resultType == object.ERROR_OBJ ||
+                resultType == object.BREAK_OBJ || resultType == object.CONTINUE_OBJ {
                 return result
             }
         }
@@ -137,7 +198,7 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
         return builtin
     }
 
-    return newError("identifier not found: " + node.Value)
+    return newError(object.NAME_ERROR, "identifier not found: " + node.Value)
 }
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -147,14 +208,14 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
     return FALSE
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func evalPrefixExpression(operator string, right object.Object, overflow OverflowPolicy) object.Object {
     switch operator {
     case "!":
         return evalBangOperatorExpression(right)
     case "-":
-        return evalMinusPrefixOperatorExpression(right)
+        return evalMinusPrefixOperatorExpression(right, overflow)
     default:
-        return newError("unknown operator: %s:%s", operator, right.Type()) 
+        return newError(object.TYPE_ERROR, "unknown operator: %s:%s", operator, right.Type()) 
     }
 }
 
@@ -171,68 +232,266 @@ func evalBangOperatorExpression(right object.Object) object.Object {
     }
 }
 
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-    if right.Type() != object.INTEGER_OBJ {
-        return newError("unknown operator: -%s", right.Type())
+func evalMinusPrefixOperatorExpression(right object.Object, overflow OverflowPolicy) object.Object {
+    switch right := right.(type) {
+    case *object.Integer:
+        return evalIntegerNegation(right.Value, overflow)
+    case *object.BigInteger:
+        return normalizeBigInteger(new(big.Int).Neg(right.Value))
+    case *object.Float:
+        return &object.Float{Value: -right.Value}
+    default:
+        return newError(object.TYPE_ERROR, "unknown operator: -%s", right.Type())
     }
-
-    value := right.(*object.Integer).Value
-    return &object.Integer{Value: -value}
 }
 
-func evalInflixExpression(operator string, left object.Object, right object.Object) object.Object {
+func evalInflixExpression(operator string, left object.Object, right object.Object, overflow OverflowPolicy) object.Object {
     switch {
     case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-        return evalIntegerInflixExpression(operator, left, right)
+        return evalIntegerInflixExpression(operator, left, right, overflow)
+    case isInteger(left) && isInteger(right):
+        return evalBigIntegerInflixExpression(operator, toBigInt(left), toBigInt(right))
+    case isNumber(left) && isNumber(right):
+        return evalFloatInflixExpression(operator, left, right)
     case operator == "==":
         return nativeBoolToBooleanObject(left == right)
     case operator == "!=":
         return nativeBoolToBooleanObject(left != right)
     case left.Type() != right.Type():
-        return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+        return newError(object.TYPE_ERROR, "type mismatch: %s %s %s", left.Type(), operator, right.Type())
     case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
         return evalStringInflixExpression(operator, left, right)
     default:
-        return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type()) 
+        return newError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type()) 
     }
 }
 
-func evalIntegerInflixExpression(operator string, left object.Object, right object.Object) object.Object {
+func evalIntegerInflixExpression(operator string, left object.Object, right object.Object, overflow OverflowPolicy) object.Object {
     leftVal := left.(*object.Integer).Value
     rightVal := right.(*object.Integer).Value
 
     switch operator {
-    case "+":
-        return &object.Integer{Value: leftVal + rightVal}
-    case "-":
-        return &object.Integer{Value: leftVal - rightVal}
-    case "*":
-        return &object.Integer{Value: leftVal * rightVal}
+    case "+", "-", "*":
+        return evalIntegerArithmetic(operator, leftVal, rightVal, overflow)
     case "/":
-        return &object.Integer{Value: leftVal / rightVal}
+        if rightVal == 0 {
+            return newError(object.ZERO_DIVISION_ERROR, "division by zero")
+        }
+        return evalIntegerArithmetic(operator, leftVal, rightVal, overflow)
+    case "%":
+        if rightVal == 0 {
+            return newError(object.ZERO_DIVISION_ERROR, "division by zero")
+        }
+        return &object.Integer{Value: leftVal % rightVal}
     case "<":
         return nativeBoolToBooleanObject(leftVal < rightVal)    
     case ">":
         return nativeBoolToBooleanObject(leftVal > rightVal)        
+    case "<=":
+        return nativeBoolToBooleanObject(leftVal <= rightVal)
+    case ">=":
+        return nativeBoolToBooleanObject(leftVal >= rightVal)
     case "==":
         return nativeBoolToBooleanObject(leftVal == rightVal)
     case "!=":
         return nativeBoolToBooleanObject(leftVal != rightVal)
     default: 
-        return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type()) 
+        return newError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type()) 
     }
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-    condition := Eval(ie.Condition, env)
+// evalFloatInflixExpression handles arithmetic where at least one side is a
+// float, the other side is promoted to a float.
+func evalFloatInflixExpression(operator string, left object.Object, right object.Object) object.Object {
+    leftVal := toFloat(left)
+    rightVal := toFloat(right)
+
+    switch operator {
+    case "+":
+        return &object.Float{Value: leftVal + rightVal}
+    case "-":
+        return &object.Float{Value: leftVal - rightVal}
+    case "*":
+        return &object.Float{Value: leftVal * rightVal}
+    case "/":
+        if rightVal == 0 {
+            return newError(object.ZERO_DIVISION_ERROR, "division by zero")
+        }
+        return &object.Float{Value: leftVal / rightVal}
+    case "%":
+        if rightVal == 0 {
+            return newError(object.ZERO_DIVISION_ERROR, "division by zero")
+        }
+        return &object.Float{Value: math.Mod(leftVal, rightVal)}
+    case "<":
+        return nativeBoolToBooleanObject(leftVal < rightVal)
+    case ">":
+        return nativeBoolToBooleanObject(leftVal > rightVal)
+    case "<=":
+        return nativeBoolToBooleanObject(leftVal <= rightVal)
+    case ">=":
+        return nativeBoolToBooleanObject(leftVal >= rightVal)
+    case "==":
+        return nativeBoolToBooleanObject(leftVal == rightVal)
+    case "!=":
+        return nativeBoolToBooleanObject(leftVal != rightVal)
+    default:
+        return newError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
+    }
+}
+
+func isNumber(obj object.Object) bool {
+    return isInteger(obj) || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+    switch obj := obj.(type) {
+    case *object.Integer:
+        return float64(obj.Value)
+    case *object.BigInteger:
+        value, _ := new(big.Float).SetInt(obj.Value).Float64()
+        return value
+    case *object.Float:
+        return obj.Value
+    default:
+        return 0
+    }
+}
+
+// evalAssignExpression assigns to a variable, updating the binding where it
+// was declared, or to an element of an array or hash.
+func (e *evaluation) evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+    switch target := node.Target.(type) {
+    case *ast.Identifier:
+        current, ok := env.Get(target.Value)
+        if !ok {
+            return newError(object.NAME_ERROR, "assignment to undeclared variable: %s", target.Value)
+        }
+        if env.IsConstant(target.Value) {
+            return newError(object.NAME_ERROR, "cannot assign to constant %s", target.Value)
+        }
+
+        value := e.evalAssignedValue(node, current, env)
+        if isError(value) {
+            return value
+        }
+        env.Assign(target.Value, value)
+        return value
+    case *ast.IndexExpression:
+        left := e.Eval(target.Left, env)
+        if isError(left) {
+            return left
+        }
+        index := e.Eval(target.Index, env)
+        if isError(index) {
+            return index
+        }
+
+        var current object.Object
+        if node.Operator != "=" {
+            current = evalIndexExpression(left, index)
+            if isError(current) {
+                return current
+            }
+        }
+
+        value := e.evalAssignedValue(node, current, env)
+        if isError(value) {
+            return value
+        }
+        return evalSetIndexExpression(left, index, value)
+    default:
+        return newError(object.TYPE_ERROR, "cannot assign to %s", node.Target.String())
+    }
+}
+
+// evalAssignedValue evaluates the right hand side of an assignment. Compound
+// operators like += combine it with the current value of the target.
+func (e *evaluation) evalAssignedValue(node *ast.AssignExpression, current object.Object, env *object.Environment) object.Object {
+    value := e.Eval(node.Value, env)
+    if isError(value) || node.Operator == "=" {
+        return value
+    }
+    return e.track(evalInflixExpression(strings.TrimSuffix(node.Operator, "="), current, value, e.overflow))
+}
+
+func (e *evaluation) evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+    for {
+        condition := e.Eval(ws.Condition, env)
+        if isError(condition) {
+            return condition
+        }
+        if !isTruly(condition) {
+            return nil
+        }
+
+        if stop, result := loopSignal(e.Eval(ws.Body, object.NewEnclosedEnvironment(env))); stop {
+            return result
+        }
+    }
+}
+
+func (e *evaluation) evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+    iterable := e.Eval(fs.Iterable, env)
+    if isError(iterable) {
+        return iterable
+    }
+
+    elements, err := Iterate(iterable)
+    if err != nil {
+        return err
+    }
+
+    // every iteration gets its own variable, closures made in the body keep
+    // the element of their iteration
+    for _, element := range elements {
+        iterationEnv := object.NewEnclosedEnvironment(env)
+        iterationEnv.Set(fs.Variable.Value, element)
+
+        if stop, result := loopSignal(e.Eval(fs.Body, iterationEnv)); stop {
+            return result
+        }
+    }
+    return nil
+}
+
+// loopSignal looks at the result of a loop body and tells whether the loop
+// has to stop. Return values and errors are passed on to the caller, a break
+// ends the loop without a value.
+func loopSignal(result object.Object) (bool, object.Object) {
+    if result == nil {
+        return false, nil
+    }
+
+    switch result.Type() {
+    case object.BREAK_OBJ:
+        return true, nil
+    case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+        return true, result
+    default:
+        return false, nil
+    }
+}
+
+// evalLogicalExpression short-circuits && and ||, the result is the operand
+// that decided the outcome rather than a boolean.
+func (e *evaluation) evalLogicalExpression(operator string, left object.Object, right ast.Expression, env *object.Environment) object.Object {
+    if isTruly(left) == (operator == "||") {
+        return left
+    }
+    return e.Eval(right, env)
+}
+
+func (e *evaluation) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+    condition := e.Eval(ie.Condition, env)
     if isError(condition) {
         return condition
     }
 
     if isTruly(condition) {
-        return Eval(ie.Consequence, env)
+        return e.Eval(ie.Consequence, object.NewEnclosedEnvironment(env))
     } else if ie.Alternative != nil {
-        return Eval(ie.Alternative, env)
+        return e.Eval(ie.Alternative, object.NewEnclosedEnvironment(env))
     } else {
         return NULL
     }
@@ -251,8 +510,8 @@ func isTruly(obj object.Object) bool {
     }
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-    return &object.Error{Message: fmt.Sprintf(format, a...)}
+func newError(kind string, format string, a ...interface{}) *object.Error {
+    return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
 }
 
 func isError(obj object.Object) bool {
@@ -262,11 +521,11 @@ func isError(obj object.Object) bool {
     return false
 }
 
-func evalExpression(exps []ast.Expression, env *object.Environment) []object.Object {
+func (e *evaluation) evalExpression(exps []ast.Expression, env *object.Environment) []object.Object {
     var result []object.Object
 
-    for _, e := range exps {
-        evaluated := Eval(e, env)
+    for _, exp := range exps {
+        evaluated := e.Eval(exp, env)
         if isError(evaluated) {
             return []object.Object{evaluated}
         }
@@ -275,26 +534,96 @@ func evalExpression(exps []ast.Expression, env *object.Environment) []object.Obj
     return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (e *evaluation) applyFunction(fn object.Object, args []object.Object) object.Object {
     switch fn := fn.(type) {
     case *object.Function: 
-        extendedEnv := extendFunctionEnv(fn, args)
-        evaluated := Eval(fn.Body, extendedEnv)
-        return unwrapReturnValue(evaluated)
+        if e.depth >= e.limits.MaxCallDepth {
+            return newError(object.LIMIT_ERROR, "maximum call depth of %d exceeded", e.limits.MaxCallDepth)
+        }
+        e.depth++
+        defer func() { e.depth-- }()
+
+        // calls in tail position come back as a tailCall and are made here,
+        // so tail recursion does not grow the Go stack
+        var call *ast.CallExpression
+        for {
+            var result object.Object
+            extendedEnv, err := e.extendFunctionEnv(fn, args)
+            if err != nil {
+                result = err
+            } else {
+                result = unwrapReturnValue(e.evalTail(fn.Body, extendedEnv, true))
+            }
+
+            next, ok := result.(*tailCall)
+            if !ok {
+                if err, ok := result.(*object.Error); ok && call != nil {
+                    traceCall(err, call)
+                }
+                return result
+            }
+            fn, args, call = next.fn, next.args, next.node
+        }
     case *object.Builtin:
-        return fn.Fn(args...)
+        if fn.FnApply != nil {
+            return e.track(fn.FnApply(e.applyFunction, args...))
+        }
+        return e.track(fn.Fn(args...))
     default:
-        return newError("not a function: %s", fn.Type())
+        return newError(object.TYPE_ERROR, "not a function: %s", fn.Type())
     }
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// extendFunctionEnv binds the arguments to the parameters of fn. Missing
+// optional arguments get their default value, which is evaluated in the new
+// environment so it can refer to earlier parameters.
+func (e *evaluation) extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, object.Object) {
+    required := len(fn.Parameters) - len(fn.Defaults)
+    if err := CheckArity(len(args), required, len(fn.Parameters), fn.Rest != nil); err != nil {
+        return nil, err
+    }
+
     env := object.NewEnclosedEnvironment(fn.Env)
 
     for paramIdx, param := range fn.Parameters {
-        env.Set(param.Value, args[paramIdx])
+        if paramIdx < len(args) {
+            env.Set(param.Value, args[paramIdx])
+            continue
+        }
+
+        value := e.Eval(fn.Defaults[param.Value], env)
+        if isError(value) {
+            return nil, value
+        }
+        env.Set(param.Value, value)
+    }
+
+    if fn.Rest != nil {
+        rest := []object.Object{}
+        if len(args) > len(fn.Parameters) {
+            rest = append(rest, args[len(fn.Parameters):]...)
+        }
+        env.Set(fn.Rest.Value, &object.Array{Elements: rest})
+    }
+
+    return env, nil
+}
+
+// CheckArity returns an error when got arguments cannot be passed to a
+// function with required mandatory and total declared parameters.
+func CheckArity(got int, required int, total int, variadic bool) object.Object {
+    if got >= required && (variadic || got <= total) {
+        return nil
+    }
+
+    switch {
+    case variadic:
+        return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=at least %d", got, required)
+    case required != total:
+        return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=%d to %d", got, required, total)
+    default:
+        return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=%d", got, total)
     }
-    return env
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -306,7 +635,7 @@ func unwrapReturnValue(obj object.Object) object.Object {
 
 func evalStringInflixExpression(operator string, left object.Object, right object.Object) object.Object {
     if operator != "+" {
-        return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+        return newError(object.TYPE_ERROR, "unknown operator: %s %s %s", left.Type(), operator, right.Type())
     }
 
     leftVal := left.(*object.String).Value
@@ -319,10 +648,14 @@ func evalIndexExpression(left object.Object, index object.Object) object.Object
     switch {
     case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
         return evalArrayIndexExpression(left, index)
+    case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+        return evalStringIndexExpression(left, index)
     case left.Type() == object.HASH_OBJ:
         return evalHashIndexExpression(left, index)
+    case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+        return evalModuleIndexExpression(left, index)
     default: 
-        return newError("index operator not supported: %s", left.Type())
+        return newError(object.TYPE_ERROR, "index operator not supported: %s", left.Type())
     }
 }
 
@@ -337,12 +670,29 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
     return arrayObject.Elements[idx]
 }
 
+// evalStringIndexExpression returns the character at index, counting
+// characters rather than bytes.
+func evalStringIndexExpression(str, index object.Object) object.Object {
+    idx := index.(*object.Integer).Value
+    if idx < 0 {
+        return NULL
+    }
+
+    for _, character := range str.(*object.String).Value {
+        if idx == 0 {
+            return &object.String{Value: string(character)}
+        }
+        idx--
+    }
+    return NULL
+}
+
 func evalHashIndexExpression(hash, index object.Object) object.Object {
     hashObject := hash.(*object.Hash)
 
     key, ok := index.(object.Hashable)
     if !ok {
-        return newError("unusable as hash key: %s", index.Type())
+        return newError(object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
     }
 
     pair, ok := hashObject.Pairs[key.HashKey()]
@@ -353,21 +703,42 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
     return pair.Value
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+func evalSetIndexExpression(left object.Object, index object.Object, value object.Object) object.Object {
+    switch {
+    case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+        arrayObject := left.(*object.Array)
+        idx := index.(*object.Integer).Value
+        if idx < 0 || idx >= int64(len(arrayObject.Elements)) {
+            return newError(object.INDEX_ERROR, "index out of range: %d", idx)
+        }
+        arrayObject.Elements[idx] = value
+    case left.Type() == object.HASH_OBJ:
+        key, ok := index.(object.Hashable)
+        if !ok {
+            return newError(object.TYPE_ERROR, "unusable as hash key: %s", index.Type())
+        }
+        left.(*object.Hash).Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+    default:
+        return newError(object.TYPE_ERROR, "index assignment not supported: %s", left.Type())
+    }
+    return value
+}
+
+func (e *evaluation) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
     pairs := make(map[object.HashKey]object.HashPair)
 
     for keyNode, valueNode := range node.Pairs {
-        key := Eval(keyNode, env)
+        key := e.Eval(keyNode, env)
         if isError(key) {
             return key
         }
 
         hashKey, ok := key.(object.Hashable)
         if !ok {
-            return newError("unusable as hash key: %s", key.Type())
+            return newError(object.TYPE_ERROR, "unusable as hash key: %s", key.Type())
         }
 
-        value := Eval(valueNode, env)
+        value := e.Eval(valueNode, env)
         if isError(value) {
             return value
         }
@@ -376,5 +747,62 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
         pairs[hashed] = object.HashPair{Key: key, Value: value}
     }
 
-    return &object.Hash{Pairs: pairs}
+    return e.track(&object.Hash{Pairs: pairs})
+}
+
+// The functions below expose the evaluator's operator semantics so that
+// other backends, like the vm, produce exactly the same results as Eval.
+
+func EvalPrefix(operator string, right object.Object, overflow OverflowPolicy) object.Object {
+    return evalPrefixExpression(operator, right, overflow)
+}
+
+func EvalInfix(operator string, left object.Object, right object.Object, overflow OverflowPolicy) object.Object {
+    return evalInflixExpression(operator, left, right, overflow)
+}
+
+// Apply calls a function or a builtin with args, the way a call expression
+// does, in a new evaluation without limits. Builtins that call functions they
+// are given should use the Applier they get through FnApply instead.
+func Apply(fn object.Object, args []object.Object) object.Object {
+    return newEvaluation(context.Background(), Options{}).applyFunction(fn, args)
+}
+
+func EvalIndex(left object.Object, index object.Object) object.Object {
+    return evalIndexExpression(left, index)
+}
+
+func SetIndex(left object.Object, index object.Object, value object.Object) object.Object {
+    return evalSetIndexExpression(left, index, value)
+}
+
+func IsTruthy(obj object.Object) bool {
+    return isTruly(obj)
+}
+
+// Iterate returns the elements a for loop visits: the elements of an array,
+// the characters of a string or the keys of a hash, sorted so that the order
+// does not change from run to run.
+func Iterate(obj object.Object) ([]object.Object, object.Object) {
+    switch obj := obj.(type) {
+    case *object.Array:
+        return obj.Elements, nil
+    case *object.String:
+        elements := []object.Object{}
+        for _, character := range obj.Value {
+            elements = append(elements, &object.String{Value: string(character)})
+        }
+        return elements, nil
+    case *object.Hash:
+        keys := []object.Object{}
+        for _, pair := range obj.Pairs {
+            keys = append(keys, pair.Key)
+        }
+        sort.Slice(keys, func(i, j int) bool {
+            return keys[i].Inspect() < keys[j].Inspect()
+        })
+        return keys, nil
+    default:
+        return nil, newError(object.TYPE_ERROR, "cannot iterate over %s", obj.Type())
+    }
 }
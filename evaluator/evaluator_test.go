@@ -83,6 +83,13 @@ func TestEvalBooleanExpression(t *testing.T) {
         {"(1 < 2) == false", false},
         {"(1 > 2) == true", false},
         {"(1 > 2) == false", true},
+        {"1 <= 2", true},
+        {"2 <= 2", true},
+        {"3 <= 2", false},
+        {"1 >= 2", false},
+        {"2 >= 2", true},
+        {"1.5 >= 1", true},
+        {"1 <= 0.5", false},
     }
 
     for _, tt := range tests {
@@ -358,6 +365,9 @@ func TestBuiltInFunctions(t *testing.T) {
         {`len("")`, 0},
         {`len("four")`, 4},
         {`len("hello world")`, 11},
+        {`len("héllo")`, 5},
+        {`len("日本語")`, 3},
+        {`len("a\tb\"\u{e9}\x41")`, 6},
         {`len(1)`, "argument to `len` not supported, got INTEGER"},
         {`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
     }
@@ -532,3 +542,451 @@ func TestHashIndexExpressions(t *testing.T) {
         }
     }
 }
+
+func TestErrorPositions(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"5 + true;", "1:1"},
+        {"let a = 1;\nlet b = a + c;", "2:13"},
+        {"let f = fn() {\n  -true\n};\nf();", "2:3"},
+        {`len(1)`, "1:1"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+
+        errObj, ok := evaluated.(*object.Error)
+        if !ok {
+            t.Errorf("no error object returned. got=%T (+%v)", evaluated, evaluated)
+            continue
+        }
+
+        if errObj.Pos.String() != tt.expected {
+            t.Errorf("wrong error position for %q. expected=%q, got=%q", tt.input, tt.expected, errObj.Pos)
+        }
+    }
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected float64
+    }{
+        {"1.5", 1.5},
+        {"-2.5", -2.5},
+        {"1.5 + 1.5", 3},
+        {"1 + 0.5", 1.5},
+        {"0.5 + 1", 1.5},
+        {"10 / 4.0", 2.5},
+        {"2 * 1e-1", 0.2},
+        {"3.5 - 1", 2.5},
+        {"let avg = fn(a, b) { (a + b) / 2.0 }; avg(3, 4)", 3.5},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+        testFloatObject(t, evaluated, tt.expected)
+    }
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+    result, ok := obj.(*object.Float)
+    if !ok {
+        t.Errorf("object is not Float, got=%T (%+v)", obj, obj)
+        return false
+    }
+
+    if result.Value != expected {
+        t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+        return false
+    }
+
+    return true
+}
+
+func TestEvalMixedNumberComparison(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected bool
+    }{
+        {"1 == 1.0", true},
+        {"1.0 != 1", false},
+        {"1 < 1.5", true},
+        {"2.5 > 2", true},
+        {"0.1 + 0.2 == 0.3", false},
+        {"10 / 4 == 2", true},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+        testBooleanObject(t, evaluated, tt.expected)
+    }
+}
+
+func TestFloatErrors(t *testing.T) {
+    tests := []struct{
+        input           string
+        expectedMessage string
+    }{
+        {"1.5 + true", "type mismatch: FLOAT + BOOLEAN"},
+        {`"a" + 1.5`, "type mismatch: STRING + FLOAT"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+
+        errObj, ok := evaluated.(*object.Error)
+        if !ok {
+            t.Errorf("no error object returned. got=%T (+%v)", evaluated, evaluated)
+            continue
+        }
+
+        if errObj.Message != tt.expectedMessage {
+            t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+        }
+    }
+}
+
+func TestModuloAndDivisionByZero(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected interface{}
+    }{
+        {"7 % 3", 1},
+        {"-7 % 3", -1},
+        {"10 % 5 + 1", 1},
+        {"2 + 7 % 4 * 2", 8},
+        {"7.5 % 2", 1.5},
+        {"1 / 0", "division by zero"},
+        {"1 % 0", "division by zero"},
+        {"1.5 / 0", "division by zero"},
+        {"1 / 0.0", "division by zero"},
+        {"let f = fn(x) { 10 / x }; f(0)", "division by zero"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+
+        switch expected := tt.expected.(type) {
+        case int:
+            testIntegerObject(t, evaluated, int64(expected))
+        case float64:
+            testFloatObject(t, evaluated, expected)
+        case string:
+            errObj, ok := evaluated.(*object.Error)
+            if !ok {
+                t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+                continue
+            }
+            if errObj.Message != expected {
+                t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+            }
+        }
+    }
+}
+
+func TestIntegerOverflowPolicies(t *testing.T) {
+    tests := []struct{
+        policy   OverflowPolicy
+        input    string
+        expected string
+    }{
+        {OverflowWrap, "9223372036854775807 + 1", "-9223372036854775808"},
+        {OverflowWrap, "-9223372036854775807 - 2", "9223372036854775807"},
+        {OverflowError, "9223372036854775807 + 1", "ERROR: 1:1: integer overflow: 9223372036854775807 + 1"},
+        {OverflowError, "4611686018427387904 * 2", "ERROR: 1:1: integer overflow: 4611686018427387904 * 2"},
+        {OverflowError, "let min = -9223372036854775807 - 1; -min", "ERROR: 1:37: integer overflow: -(-9223372036854775808)"},
+        {OverflowError, "9223372036854775806 + 1", "9223372036854775807"},
+        {OverflowPromote, "9223372036854775807 + 1", "9223372036854775808"},
+        {OverflowPromote, "4611686018427387904 * 4 * 4", "73786976294838206464"},
+        {OverflowPromote, "(9223372036854775807 + 1) - 1", "9223372036854775807"},
+        {OverflowPromote, "(9223372036854775807 * 2) / 2 == 9223372036854775807", "true"},
+        {OverflowPromote, "(9223372036854775807 + 1) > 1.5", "true"},
+        {OverflowPromote, "(9223372036854775807 + 1) % 0", "ERROR: 1:2: division by zero"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEvalOptions(tt.input, Options{Overflow: tt.policy})
+
+        if evaluated.Inspect() != tt.expected {
+            t.Errorf("%s: wrong result for %q. expected=%q, got=%q", tt.policy, tt.input, tt.expected, evaluated.Inspect())
+        }
+    }
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+    for _, policy := range []OverflowPolicy{OverflowWrap, OverflowError, OverflowPromote} {
+        parsed, err := ParseOverflowPolicy(policy.String())
+        if err != nil || parsed != policy {
+            t.Errorf("ParseOverflowPolicy(%q) = %s, %v", policy.String(), parsed, err)
+        }
+    }
+
+    if _, err := ParseOverflowPolicy("saturate"); err == nil {
+        t.Errorf("expected an error for an unknown policy")
+    }
+}
+
+func TestFunctionArguments(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected interface{}
+    }{
+        {"fn(a, b) { a + b }(1)", "wrong number of arguments. got=1, want=2"},
+        {"fn(a) { a }(1, 2)", "wrong number of arguments. got=2, want=1"},
+        {"fn() { 1 }(1)", "wrong number of arguments. got=1, want=0"},
+        {"fn(a, b = 2) { a + b }(1)", 3},
+        {"fn(a, b = 2) { a + b }(1, 5)", 6},
+        {"fn(a, b = 2) { a + b }()", "wrong number of arguments. got=0, want=1 to 2"},
+        {"fn(a, b = 2) { a + b }(1, 2, 3)", "wrong number of arguments. got=3, want=1 to 2"},
+        {"fn(a, b = a * 10) { b }(4)", 40},
+        {"let base = 100; fn(a, b = base) { a + b }(1)", 101},
+        {"fn(a, b = -true) { b }(1)", "unknown operator: -BOOLEAN"},
+        {"fn(a, ...rest) { len(rest) }(1, 2, 3)", 2},
+        {"fn(a, ...rest) { len(rest) }(1)", 0},
+        {"fn(a, ...rest) { rest[1] }(1, 2, 3)", 3},
+        {"fn(a, ...rest) { a }()", "wrong number of arguments. got=0, want=at least 1"},
+        {"fn(a, b = 2, ...rest) { a + b + len(rest) }(1)", 3},
+        {"fn(a, b = 2, ...rest) { a + b + len(rest) }(1, 1, 1, 1)", 4},
+        {"let sum = fn(xs, acc = 0) { if (len(xs) == 0) { acc } else { sum(rest(xs), acc + first(xs)) } }; sum([1, 2, 3])", 6},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+
+        switch expected := tt.expected.(type) {
+        case int:
+            testIntegerObject(t, evaluated, int64(expected))
+        case string:
+            errObj, ok := evaluated.(*object.Error)
+            if !ok {
+                t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+                continue
+            }
+            if errObj.Message != expected {
+                t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+            }
+        }
+    }
+}
+
+func TestLogicalOperators(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected interface{}
+    }{
+        {"true && true", true},
+        {"true && false", false},
+        {"false || true", true},
+        {"false || false", false},
+        {"1 && 2", 2},
+        {"0 && 2", 2},
+        {"false && 2", false},
+        {"1 || 2", 1},
+        {"if (false) { 1 } || 3", 3},
+        {"if (false) { 1 } && 3", nil},
+        {"false && -true", false},
+        {"true || -true", true},
+        {"true && -true", "unknown operator: -BOOLEAN"},
+        {"let calls = fn() { boom() }; false && calls()", false},
+        {"1 < 2 && 2 < 3", true},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+
+        switch expected := tt.expected.(type) {
+        case bool:
+            testBooleanObject(t, evaluated, expected)
+        case int:
+            testIntegerObject(t, evaluated, int64(expected))
+        case string:
+            errObj, ok := evaluated.(*object.Error)
+            if !ok || errObj.Message != expected {
+                t.Errorf("%q: expected error %q, got=%+v", tt.input, expected, evaluated)
+            }
+        default:
+            testNullObject(t, evaluated)
+        }
+    }
+}
+
+func TestLoops(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected interface{}
+    }{
+        {"let i = 0; while (i < 5) { i = i + 1; }; i", 5},
+        {"let i = 0; while (false) { i = i + 1; }; i", 0},
+        {"let i = 0; while (true) { i = i + 1; if (i == 3) { break; } }; i", 3},
+        {"let i = 0; let n = 0; while (i < 10) { i = i + 1; if (i % 2 == 0) { continue; } n = n + 1; }; n", 5},
+        {"let sum = 0; for (x in [1, 2, 3, 4]) { sum = sum + x; }; sum", 10},
+        {"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { break } sum = sum + x; }; sum", 3},
+        {"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { continue } sum = sum + x; }; sum", 7},
+        {`let s = ""; for (c in "abc") { s = c + s; }; s`, "cba"},
+        {`let s = ""; for (c in "añ日") { s = c + s; }; s`, "日ña"},
+        {`let s = ""; for (k in {"b": 2, "a": 1, "c": 3}) { s = s + k; }; s`, "abc"},
+        {"let n = 0; for (x in []) { n = n + 1; }; n", 0},
+        {"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } 0 }; f()", 20},
+        {"let f = fn() { while (true) { return 7; } }; f()", 7},
+        {"let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y == 2) { break; } n = n + 1; } }; n", 2},
+        {"for (x in 5) { x }", "cannot iterate over INTEGER"},
+        {"while (-true) { 1 }", "unknown operator: -BOOLEAN"},
+        {"for (x in [1, 2]) { x + true }", "type mismatch: INTEGER + BOOLEAN"},
+        {"while (false) { 1 }", nil},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+
+        switch expected := tt.expected.(type) {
+        case int:
+            testIntegerObject(t, evaluated, int64(expected))
+        case string:
+            switch obj := evaluated.(type) {
+            case *object.String:
+                if obj.Value != expected {
+                    t.Errorf("%q: wrong string. expected=%q, got=%q", tt.input, expected, obj.Value)
+                }
+            case *object.Error:
+                if obj.Message != expected {
+                    t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, expected, obj.Message)
+                }
+            default:
+                t.Errorf("%q: unexpected result %T (%+v)", tt.input, evaluated, evaluated)
+            }
+        default:
+            if evaluated != nil {
+                t.Errorf("%q: expected no value, got=%T (%+v)", tt.input, evaluated, evaluated)
+            }
+        }
+    }
+}
+
+func TestConstAndBlockScoping(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected interface{}
+    }{
+        {"const x = 1; x", 1},
+        {"const x = 1; x = 2", "cannot assign to constant x"},
+        {"const x = 1; x += 2", "cannot assign to constant x"},
+        {"const x = 1; let x = 2", "cannot redeclare constant x"},
+        {"const x = 1; const x = 2", "cannot redeclare constant x"},
+        {"const x = 1; let f = fn() { let x = 2; x = 3; x }; f() + x", 4},
+        {"const x = 1; if (true) { let x = 5; x = 6; x }", 6},
+        {"let x = 1; if (true) { let x = 2; }; x", 1},
+        {"let x = 1; if (true) { x = 2; }; x", 2},
+        {"if (true) { let t = 1; }; t", "identifier not found: t"},
+        {"for (x in [1, 2]) { }; x", "identifier not found: x"},
+        {"let i = 0; while (i < 3) { let j = i; i += 1; }; j", "identifier not found: j"},
+        {"let n = 0; for (x in [1, 2, 3]) { const y = x * 2; n += y; }; n", 12},
+        {"let fs = []; for (x in [1, 2, 3]) { let y = x * 10; fs = push(fs, fn() { y }); }; fs[0]() + fs[2]()", 40},
+        {"let fs = []; let i = 0; while (i < 2) { let j = i; fs = push(fs, fn() { j }); i += 1; }; fs[0]()", 0},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+
+        switch expected := tt.expected.(type) {
+        case int:
+            testIntegerObject(t, evaluated, int64(expected))
+        case string:
+            errObj, ok := evaluated.(*object.Error)
+            if !ok {
+                t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+                continue
+            }
+            if errObj.Message != expected {
+                t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+            }
+        }
+    }
+}
+
+func TestAssignment(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected interface{}
+    }{
+        {"let x = 1; x = 2; x", 2},
+        {"let x = 1; x = x + 1", 2},
+        {"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x %= 4; x", 2},
+        {"let a = 1; let b = 2; a = b = 7; a + b", 14},
+        {"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", 3},
+        {"let n = 0; let inc = fn() { n = n + 1; }; inc(); inc(); n", 2},
+        {"let n = 1; let f = fn() { let n = 5; n = 10; n }; f() + n", 11},
+        {"let arr = [1, 2, 3]; arr[1] = 20; arr[1]", 20},
+        {"let arr = [1, 2, 3]; arr[2] *= 10; arr[2]", 30},
+        {`let h = {"a": 1}; h["a"] += 1; h["b"] = 5; h["a"] + h["b"]`, 7},
+        {"let i = 0; let sum = 0; while (i < 4) { sum += i; i += 1; }; sum", 6},
+        {"x = 1", "assignment to undeclared variable: x"},
+        {"len = 1", "assignment to undeclared variable: len"},
+        {"let x = 1; x += true", "type mismatch: INTEGER + BOOLEAN"},
+        {"let arr = [1]; arr[1] = 2", "index out of range: 1"},
+        {"let arr = [1]; arr[-1] = 2", "index out of range: -1"},
+        {"let arr = [1]; arr[5] += 2", "type mismatch: NULL + INTEGER"},
+        {`let h = {}; h[fn() {}] = 1`, "unusable as hash key: FUNCTION"},
+        {`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+
+        switch expected := tt.expected.(type) {
+        case int:
+            testIntegerObject(t, evaluated, int64(expected))
+        case string:
+            errObj, ok := evaluated.(*object.Error)
+            if !ok {
+                t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+                continue
+            }
+            if errObj.Message != expected {
+                t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+            }
+        }
+    }
+}
+
+func TestStringIndexExpressions(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected interface{}
+    }{
+        {`"abc"[0]`, "a"},
+        {`"abc"[2]`, "c"},
+        {`"héllo"[1]`, "é"},
+        {`"日本語"[2]`, "語"},
+        {`let s = "naïve"; s[len(s) - 1]`, "e"},
+        {`"abc"[3]`, nil},
+        {`"abc"[-1]`, nil},
+        {`""[0]`, nil},
+        {`"abc"["a"]`, "index operator not supported: STRING"},
+        {`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+
+        switch expected := tt.expected.(type) {
+        case string:
+            switch evaluated := evaluated.(type) {
+            case *object.String:
+                if evaluated.Value != expected {
+                    t.Errorf("%q: wrong string. expected=%q, got=%q", tt.input, expected, evaluated.Value)
+                }
+            case *object.Error:
+                if evaluated.Message != expected {
+                    t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, evaluated.Message)
+                }
+            default:
+                t.Errorf("%q: object is not a string. got=%T (%+v)", tt.input, evaluated, evaluated)
+            }
+        default:
+            testNullObject(t, evaluated)
+        }
+    }
+}
@@ -0,0 +1,147 @@
+package evaluator
+
+import (
+	"fmt"
+	"interpreter/object"
+	"math"
+	"math/big"
+)
+
+// OverflowPolicy decides what +, -, * and / do when the result of an
+// operation on integers does not fit into 64 bits.
+type OverflowPolicy int
+
+const (
+    OverflowWrap OverflowPolicy = iota // wrap around like Go's int64
+    OverflowError                      // return an error object
+    OverflowPromote                    // continue with big integers
+)
+
+var overflowPolicyNames = map[OverflowPolicy]string {
+    OverflowWrap:    "wrap",
+    OverflowError:   "error",
+    OverflowPromote: "promote",
+}
+
+func (p OverflowPolicy) String() string {
+    return overflowPolicyNames[p]
+}
+
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+    for policy, policyName := range overflowPolicyNames {
+        if policyName == name {
+            return policy, nil
+        }
+    }
+    return OverflowWrap, fmt.Errorf("unknown overflow policy %q, want wrap, error or promote", name)
+}
+
+func evalIntegerArithmetic(operator string, left int64, right int64, policy OverflowPolicy) object.Object {
+    var result int64
+    var overflow bool
+
+    switch operator {
+    case "+":
+        result = left + right
+        overflow = (left >= 0) == (right >= 0) && (result >= 0) != (left >= 0)
+    case "-":
+        result = left - right
+        overflow = (left >= 0) != (right >= 0) && (result >= 0) != (left >= 0)
+    case "*":
+        result = left * right
+        overflow = left != 0 && (result/left != right || (left == -1 && right == math.MinInt64))
+    case "/":
+        result = left / right
+        overflow = left == math.MinInt64 && right == -1
+    }
+
+    if !overflow {
+        return &object.Integer{Value: result}
+    }
+
+    return integerOverflow(policy, result, func() object.Object {
+        return evalBigIntegerInflixExpression(operator, big.NewInt(left), big.NewInt(right))
+    }, "integer overflow: %d %s %d", left, operator, right)
+}
+
+func evalIntegerNegation(value int64, policy OverflowPolicy) object.Object {
+    if value != math.MinInt64 {
+        return &object.Integer{Value: -value}
+    }
+
+    return integerOverflow(policy, value, func() object.Object {
+        return normalizeBigInteger(new(big.Int).Neg(big.NewInt(value)))
+    }, "integer overflow: -(%d)", value)
+}
+
+// integerOverflow applies policy. wrapped is the result with
+// two's complement wrap around and exact computes the promoted result.
+func integerOverflow(policy OverflowPolicy, wrapped int64, exact func() object.Object, format string, a ...interface{}) object.Object {
+    switch policy {
+    case OverflowError:
+        return newError(object.OVERFLOW_ERROR, format, a...)
+    case OverflowPromote:
+        return exact()
+    default:
+        return &object.Integer{Value: wrapped}
+    }
+}
+
+func evalBigIntegerInflixExpression(operator string, leftVal *big.Int, rightVal *big.Int) object.Object {
+    switch operator {
+    case "+":
+        return normalizeBigInteger(new(big.Int).Add(leftVal, rightVal))
+    case "-":
+        return normalizeBigInteger(new(big.Int).Sub(leftVal, rightVal))
+    case "*":
+        return normalizeBigInteger(new(big.Int).Mul(leftVal, rightVal))
+    case "/":
+        if rightVal.Sign() == 0 {
+            return newError(object.ZERO_DIVISION_ERROR, "division by zero")
+        }
+        return normalizeBigInteger(new(big.Int).Quo(leftVal, rightVal))
+    case "%":
+        if rightVal.Sign() == 0 {
+            return newError(object.ZERO_DIVISION_ERROR, "division by zero")
+        }
+        return normalizeBigInteger(new(big.Int).Rem(leftVal, rightVal))
+    case "<":
+        return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+    case ">":
+        return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+    case "<=":
+        return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) <= 0)
+    case ">=":
+        return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) >= 0)
+    case "==":
+        return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+    case "!=":
+        return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+    default:
+        return newError(object.TYPE_ERROR, "unknown operator: %s %s %s", object.BIG_INTEGER_OBJ, operator, object.BIG_INTEGER_OBJ)
+    }
+}
+
+// normalizeBigInteger turns results that fit into 64 bits back into plain
+// integers, so big integers only exist where they are needed.
+func normalizeBigInteger(value *big.Int) object.Object {
+    if value.IsInt64() {
+        return &object.Integer{Value: value.Int64()}
+    }
+    return &object.BigInteger{Value: value}
+}
+
+func isInteger(obj object.Object) bool {
+    return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.BIG_INTEGER_OBJ
+}
+
+func toBigInt(obj object.Object) *big.Int {
+    switch obj := obj.(type) {
+    case *object.Integer:
+        return big.NewInt(obj.Value)
+    case *object.BigInteger:
+        return obj.Value
+    default:
+        return new(big.Int)
+    }
+}
@@ -0,0 +1,99 @@
+package evaluator
+
+import (
+	"context"
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+// DefaultMaxCallDepth is the call depth used when Limits do not set one. It
+// stops runaway recursion long before the Go stack runs out.
+const DefaultMaxCallDepth = 10000
+
+// Limits bound the work an evaluation may do. Zero means no limit, except for
+// MaxCallDepth. Exceeding a limit ends the evaluation with a LimitError,
+// which try cannot catch.
+type Limits struct {
+    MaxSteps      int64 // number of nodes evaluated
+    MaxCallDepth  int   // number of nested function calls, DefaultMaxCallDepth when zero
+    MaxAllocation int64 // approximate number of string bytes, array elements and hash pairs created
+}
+
+// Options configure an evaluation.
+type Options struct {
+    Limits
+    Overflow OverflowPolicy // what integer arithmetic does on overflow
+    Modules  *ModuleLoader  // loads the imports, a new loader for the working directory when nil
+}
+
+// evaluation is the state of one call to EvalContext.
+type evaluation struct {
+    done      <-chan struct{}
+    ctx       context.Context
+    limits    Limits
+    overflow  OverflowPolicy
+    modules   *ModuleLoader // created by the first import when nil
+    importing []string // modules being evaluated, the innermost is last
+    steps     int64
+    depth     int
+    allocated int64
+}
+
+func newEvaluation(ctx context.Context, options Options) *evaluation {
+    limits := options.Limits
+    if limits.MaxCallDepth <= 0 {
+        limits.MaxCallDepth = DefaultMaxCallDepth
+    }
+    return &evaluation{done: ctx.Done(), ctx: ctx, limits: limits, overflow: options.Overflow, modules: options.Modules}
+}
+
+// EvalContext evaluates node in env like Eval, but stops with an error when
+// ctx is cancelled or its deadline passes, or when a limit is exceeded.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, limits Limits) object.Object {
+    return EvalOptions(ctx, node, env, Options{Limits: limits})
+}
+
+// EvalOptions is EvalContext with the overflow policy and the module loader
+// of options as well as its limits.
+func EvalOptions(ctx context.Context, node ast.Node, env *object.Environment, options Options) object.Object {
+    return newEvaluation(ctx, options).Eval(node, env)
+}
+
+// step counts a node against the step limit and checks for cancellation.
+func (e *evaluation) step() *object.Error {
+    e.steps++
+    if e.limits.MaxSteps > 0 && e.steps > e.limits.MaxSteps {
+        return newError(object.LIMIT_ERROR, "step limit of %d exceeded", e.limits.MaxSteps)
+    }
+
+    select {
+    case <-e.done:
+        return newError(object.LIMIT_ERROR, "evaluation stopped: %s", e.ctx.Err())
+    default:
+        return nil
+    }
+}
+
+// track counts the size of a string, array or hash that was just created
+// against the allocation limit.
+func (e *evaluation) track(obj object.Object) object.Object {
+    if e.limits.MaxAllocation <= 0 {
+        return obj
+    }
+
+    switch obj := obj.(type) {
+    case *object.String:
+        e.allocated += int64(len(obj.Value))
+    case *object.Array:
+        e.allocated += int64(len(obj.Elements))
+    case *object.Hash:
+        e.allocated += int64(len(obj.Pairs))
+    default:
+        return obj
+    }
+
+    if e.allocated > e.limits.MaxAllocation {
+        return newError(object.LIMIT_ERROR, "allocation limit of %d exceeded", e.limits.MaxAllocation)
+    }
+    return obj
+}
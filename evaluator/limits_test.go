@@ -0,0 +1,87 @@
+package evaluator
+
+import (
+    "context"
+    "interpreter/lexer"
+    "interpreter/object"
+    "interpreter/parser"
+    "testing"
+    "time"
+)
+
+func testEvalLimits(ctx context.Context, input string, limits Limits) object.Object {
+    program := parser.New(lexer.New(input)).ParseProgram()
+    return EvalContext(ctx, program, object.NewEnvironment(), limits)
+}
+
+func testEvalOptions(input string, options Options) object.Object {
+    program := parser.New(lexer.New(input)).ParseProgram()
+    return EvalOptions(context.Background(), program, object.NewEnvironment(), options)
+}
+
+func TestLimits(t *testing.T) {
+    countdown := "let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } };"
+
+    tests := []struct{
+        input    string
+        limits   Limits
+        expected string // error message, empty when the evaluation has to succeed
+    }{
+        {"let f = fn(n) { 1 + f(n + 1) }; f(0)", Limits{}, "maximum call depth of 10000 exceeded"},
+        {countdown + "f(9)", Limits{MaxCallDepth: 10}, ""},
+        {countdown + "f(10)", Limits{MaxCallDepth: 10}, "maximum call depth of 10 exceeded"},
+        {"let n = 0; while (n < 10) { n += 1; }", Limits{MaxSteps: 1000}, ""},
+        {"while (true) { }", Limits{MaxSteps: 1000}, "step limit of 1000 exceeded"},
+        {"try { while (true) { } } catch (e) { 1 }", Limits{MaxSteps: 1000}, "step limit of 1000 exceeded"},
+        {`let s = ""; while (len(s) < 10) { s += "a"; }`, Limits{MaxAllocation: 100}, ""},
+        {`let s = ""; while (true) { s += "abc"; }`, Limits{MaxAllocation: 1000}, "allocation limit of 1000 exceeded"},
+        {"let xs = []; while (true) { xs = push(xs, 1); }", Limits{MaxAllocation: 1000}, "allocation limit of 1000 exceeded"},
+        {"while (true) { [1, 2, 3]; }", Limits{MaxAllocation: 1000}, "allocation limit of 1000 exceeded"},
+        {`while (true) { {"a": 1}; }`, Limits{MaxAllocation: 1000}, "allocation limit of 1000 exceeded"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEvalLimits(context.Background(), tt.input, tt.limits)
+        errObj, ok := evaluated.(*object.Error)
+
+        if tt.expected == "" {
+            if ok {
+                t.Errorf("%q: unexpected error: %s", tt.input, errObj.Message)
+            }
+            continue
+        }
+        if !ok {
+            t.Errorf("%q: no error returned. got=%T (%+v)", tt.input, evaluated, evaluated)
+            continue
+        }
+        if errObj.Kind != object.LIMIT_ERROR || errObj.Message != tt.expected {
+            t.Errorf("%q: wrong error. expected=%s: %q, got=%s: %q", tt.input, object.LIMIT_ERROR, tt.expected, errObj.Kind, errObj.Message)
+        }
+    }
+}
+
+func TestEvalContext(t *testing.T) {
+    cancelled, cancel := context.WithCancel(context.Background())
+    cancel()
+    timeout, cancel := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+    defer cancel()
+
+    tests := []struct{
+        ctx      context.Context
+        expected string
+    }{
+        {cancelled, "evaluation stopped: context canceled"},
+        {timeout, "evaluation stopped: context deadline exceeded"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEvalLimits(tt.ctx, "let f = fn() { while (true) { } }; f()", Limits{})
+        errObj, ok := evaluated.(*object.Error)
+        if !ok {
+            t.Fatalf("no error returned. got=%T (%+v)", evaluated, evaluated)
+        }
+        if errObj.Kind != object.LIMIT_ERROR || errObj.Message != tt.expected {
+            t.Errorf("wrong error. expected=%q, got=%s: %q", tt.expected, errObj.Kind, errObj.Message)
+        }
+    }
+}
@@ -0,0 +1,118 @@
+package evaluator
+
+import (
+	"context"
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+// DefineMacros binds the macros defined by top-level let statements, like
+// `let unless = macro(cond, body) { ... }`, in env and removes the
+// definitions from program.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+    statements := []ast.Statement{}
+
+    for _, statement := range program.Statements {
+        let, ok := statement.(*ast.LetStatement)
+        if !ok {
+            statements = append(statements, statement)
+            continue
+        }
+        literal, ok := let.Value.(*ast.MacroLiteral)
+        if !ok {
+            statements = append(statements, statement)
+            continue
+        }
+
+        env.Set(let.Name.Value, &object.Macro{
+            Parameters: literal.Parameters,
+            Body:       literal.Body,
+            Env:        env,
+        })
+    }
+
+    program.Statements = statements
+}
+
+// DefaultMaxMacroSteps is the step limit of macro expansion when the limits
+// do not set one, so a macro that never returns cannot hang it.
+const DefaultMaxMacroSteps = 1000000
+
+// ExpandMacros replaces the calls to macros defined in env by the code the
+// macros return. The arguments are passed to the macro as quotes, without
+// evaluating them.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+    return ExpandMacrosContext(context.Background(), program, env, Options{})
+}
+
+// ExpandMacrosContext is ExpandMacros, evaluating the macros with options and
+// stopping when ctx is done. The step limit covers all the macro calls
+// together, it is DefaultMaxMacroSteps when options do not set one.
+func ExpandMacrosContext(ctx context.Context, program ast.Node, env *object.Environment, options Options) (ast.Node, *object.Error) {
+    if options.MaxSteps <= 0 {
+        options.MaxSteps = DefaultMaxMacroSteps
+    }
+    e := newEvaluation(ctx, options)
+    var err *object.Error
+
+    expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+        if err != nil {
+            return node
+        }
+        call, ok := node.(*ast.CallExpression)
+        if !ok {
+            return node
+        }
+        macro, ok := isMacroCall(call, env)
+        if !ok {
+            return node
+        }
+
+        if len(call.Arguments) != len(macro.Parameters) {
+            err = newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=%d", len(call.Arguments), len(macro.Parameters))
+            err.Pos = call.Pos()
+            return node
+        }
+
+        evaluated := unwrapReturnValue(e.Eval(macro.Body, extendMacroEnv(macro, call.Arguments)))
+        if errObj, ok := evaluated.(*object.Error); ok {
+            err = errObj
+            return node
+        }
+
+        quote, ok := evaluated.(*object.Quote)
+        if !ok {
+            err = newError(object.MACRO_ERROR, "macro %s did not return a quote", call.Function.String())
+            err.Pos = call.Pos()
+            return node
+        }
+        return quote.Node
+    })
+
+    return expanded, err
+}
+
+func isMacroCall(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+    ident, ok := call.Function.(*ast.Identifier)
+    if !ok {
+        return nil, false
+    }
+
+    obj, ok := env.Get(ident.Value)
+    if !ok {
+        return nil, false
+    }
+
+    macro, ok := obj.(*object.Macro)
+    return macro, ok
+}
+
+func extendMacroEnv(macro *object.Macro, args []ast.Expression) *object.Environment {
+    env := object.NewEnclosedEnvironment(macro.Env)
+
+    for i, param := range macro.Parameters {
+        env.Set(param.Value, &object.Quote{Node: args[i]})
+    }
+
+    return env
+}
@@ -0,0 +1,175 @@
+package evaluator
+
+import (
+    "context"
+    "testing"
+    "interpreter/ast"
+    "interpreter/lexer"
+    "interpreter/object"
+    "interpreter/parser"
+)
+
+func TestDefineMacros(t *testing.T) {
+    input := `
+    let number = 1;
+    let function = fn(x, y) { x + y };
+    let mymacro = macro(x, y) { x + y; };
+    `
+
+    env := object.NewEnvironment()
+    program := testParseProgram(input)
+
+    DefineMacros(program, env)
+
+    if len(program.Statements) != 2 {
+        t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+    }
+
+    _, ok := env.Get("number")
+    if ok {
+        t.Fatalf("number should not be defined")
+    }
+    _, ok = env.Get("function")
+    if ok {
+        t.Fatalf("function should not be defined")
+    }
+
+    obj, ok := env.Get("mymacro")
+    if !ok {
+        t.Fatalf("macro not in environment.")
+    }
+
+    macro, ok := obj.(*object.Macro)
+    if !ok {
+        t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+    }
+
+    if len(macro.Parameters) != 2 {
+        t.Fatalf("Wrong number of macro parameters. got=%d", len(macro.Parameters))
+    }
+    if macro.Parameters[0].String() != "x" || macro.Parameters[1].String() != "y" {
+        t.Errorf("wrong parameters. got=%s, %s", macro.Parameters[0], macro.Parameters[1])
+    }
+
+    expectedBody := "(x + y)"
+    if macro.Body.String() != expectedBody {
+        t.Fatalf("body is not %q. got=%q", expectedBody, macro.Body.String())
+    }
+}
+
+func TestExpandMacros(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {
+            `
+            let infixExpression = macro() { quote(1 + 2); };
+            infixExpression();
+            `,
+            `(1 + 2)`,
+        },
+        {
+            `
+            let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+            reverse(2 + 2, 10 - 5);
+            `,
+            `(10 - 5) - (2 + 2)`,
+        },
+        {
+            `
+            let unless = macro(condition, consequence, alternative) {
+                quote(if (!(unquote(condition))) {
+                    unquote(consequence);
+                } else {
+                    unquote(alternative);
+                });
+            };
+
+            unless(10 > 5, puts("not greater"), puts("greater"));
+            `,
+            `if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+        },
+        {
+            `
+            let twice = macro(x) { return quote(unquote(x) + unquote(x)); };
+            let f = fn() { twice(1) };
+            `,
+            `let f = fn() { (1 + 1) };`,
+        },
+    }
+
+    for _, tt := range tests {
+        expected := testParseProgram(tt.expected)
+        program := testParseProgram(tt.input)
+
+        env := object.NewEnvironment()
+        DefineMacros(program, env)
+        expanded, err := ExpandMacros(program, env)
+        if err != nil {
+            t.Fatalf("%q: unexpected error %s", tt.input, err.Message)
+        }
+
+        if expanded.String() != expected.String() {
+            t.Errorf("not equal. want=%q, got=%q", expected.String(), expanded.String())
+        }
+    }
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {`let m = macro(x) { quote(x) }; m(1, 2)`, "wrong number of arguments. got=2, want=1"},
+        {`let m = macro() { 1 }; m()`, "macro m did not return a quote"},
+        {`let m = macro() { }; m()`, "macro m did not return a quote"},
+        {`let m = macro() { 1 + true }; m()`, "type mismatch: INTEGER + BOOLEAN"},
+        {`let m = macro() { while (true) { } }; m()`, "step limit of 1000000 exceeded"},
+    }
+
+    for _, tt := range tests {
+        program := testParseProgram(tt.input)
+
+        env := object.NewEnvironment()
+        DefineMacros(program, env)
+        _, err := ExpandMacros(program, env)
+        if err == nil {
+            t.Errorf("%q: expected an error", tt.input)
+            continue
+        }
+        if err.Message != tt.expected {
+            t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, tt.expected, err.Message)
+        }
+    }
+
+    evaluated := testEval("let m = fn() { macro(x) { x } }; m()")
+    errObj, ok := evaluated.(*object.Error)
+    if !ok || errObj.Message != "macros can only be defined by top-level let statements" {
+        t.Errorf("expected an error for a nested macro literal. got=%+v", evaluated)
+    }
+}
+
+func testParseProgram(input string) *ast.Program {
+    l := lexer.New(input)
+    p := parser.New(l)
+    return p.ParseProgram()
+}
+
+func TestExpandMacrosContext(t *testing.T) {
+    program := testParseProgram(`let m = macro() { while (true) { } }; m()`)
+    env := object.NewEnvironment()
+    DefineMacros(program, env)
+
+    _, err := ExpandMacrosContext(context.Background(), program, env, Options{Limits: Limits{MaxSteps: 100}})
+    if err == nil || err.Kind != object.LIMIT_ERROR || err.Message != "step limit of 100 exceeded" {
+        t.Errorf("expected the step limit to be exceeded, got=%v", err)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    _, err = ExpandMacrosContext(ctx, program, env, Options{})
+    if err == nil || err.Message != "evaluation stopped: context canceled" {
+        t.Errorf("wrong error for a cancelled context. got=%v", err)
+    }
+}
@@ -0,0 +1,178 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ModuleLoader loads the files named by import statements. Every file is
+// evaluated once, later imports of the same file get the same module. A
+// loader may be shared by evaluations running at the same time.
+type ModuleLoader struct {
+    dir     string // the directory of the main program, the working directory when empty
+    main    string // the file of the main program, if there is one
+    mutex   sync.Mutex
+    modules map[string]*object.Module
+}
+
+// NewModuleLoader returns a loader for a program read from mainFile. Relative
+// paths in the main program are resolved against the directory of mainFile,
+// or against the working directory when mainFile is empty.
+func NewModuleLoader(mainFile string) *ModuleLoader {
+    loader := &ModuleLoader{modules: make(map[string]*object.Module)}
+    if mainFile != "" {
+        loader.main = absolutePath(mainFile)
+        loader.dir = filepath.Dir(loader.main)
+    }
+    return loader
+}
+
+// NewModuleLoaderIn returns a loader that resolves relative paths in the main
+// program against dir.
+func NewModuleLoaderIn(dir string) *ModuleLoader {
+    return &ModuleLoader{dir: absolutePath(dir), modules: make(map[string]*object.Module)}
+}
+
+// Load returns the module for path, evaluating the file the first time it is
+// imported.
+func (loader *ModuleLoader) Load(path string) (*object.Module, *object.Error) {
+    return loader.load(path, newEvaluation(context.Background(), Options{Modules: loader}))
+}
+
+// load is Load for an import statement, the module is evaluated within the
+// limits of the importing program.
+func (loader *ModuleLoader) load(path string, e *evaluation) (*object.Module, *object.Error) {
+    // the files being evaluated, the innermost importer is last
+    loading := e.importing
+    if loader.main != "" {
+        loading = append([]string{loader.main}, loading...)
+    }
+
+    resolved := loader.resolve(path, e)
+    loader.mutex.Lock()
+    module, ok := loader.modules[resolved]
+    loader.mutex.Unlock()
+    if ok {
+        return module, nil
+    }
+
+    for i, file := range loading {
+        if file == resolved {
+            cycle := []string{}
+            for _, file := range append(loading[i:], resolved) {
+                cycle = append(cycle, filepath.Base(file))
+            }
+            return nil, newError(object.IMPORT_ERROR, "import cycle: %s", strings.Join(cycle, " -> "))
+        }
+    }
+
+    source, err := os.ReadFile(resolved)
+    if err != nil {
+        var pathErr *os.PathError
+        if errors.As(err, &pathErr) {
+            err = pathErr.Err
+        }
+        return nil, newError(object.IMPORT_ERROR, "cannot import %q: %s", path, err)
+    }
+
+    p := parser.New(lexer.New(string(source)))
+    program := p.ParseProgram()
+    if len(p.Errors()) != 0 {
+        first := p.Errors()[0]
+        return nil, newError(object.SYNTAX_ERROR, "%s:%s: %s", path, first.Pos, first.Message)
+    }
+
+    e.importing = append(e.importing, resolved)
+    env, errObj := e.evalModule(program)
+    e.importing = e.importing[:len(e.importing)-1]
+    if errObj != nil {
+        // the error keeps its kind, the position inside the module goes
+        // into the message
+        return nil, newError(errObj.Kind, "%s:%s: %s", path, errObj.Pos, errObj.Message)
+    }
+
+    module = &object.Module{Path: resolved, Env: env, Exports: make(map[string]bool)}
+    for _, statement := range program.Statements {
+        if export, ok := statement.(*ast.ExportStatement); ok {
+            module.Exports[export.Statement.Name.Value] = true
+        }
+    }
+
+    // an evaluation running at the same time may have loaded the file too,
+    // the first module stored is the one everyone gets
+    loader.mutex.Lock()
+    defer loader.mutex.Unlock()
+    if stored, ok := loader.modules[resolved]; ok {
+        return stored, nil
+    }
+    loader.modules[resolved] = module
+    return module, nil
+}
+
+// resolve turns path into an absolute path. Relative paths are relative to
+// the directory of the importing file.
+func (loader *ModuleLoader) resolve(path string, e *evaluation) string {
+    if !filepath.IsAbs(path) {
+        dir := loader.dir
+        if len(e.importing) > 0 {
+            dir = filepath.Dir(e.importing[len(e.importing)-1])
+        }
+        path = filepath.Join(dir, path)
+    }
+    return absolutePath(path)
+}
+
+func absolutePath(path string) string {
+    if abs, err := filepath.Abs(path); err == nil {
+        return abs
+    }
+    return filepath.Clean(path)
+}
+
+func (e *evaluation) evalModule(program *ast.Program) (*object.Environment, *object.Error) {
+    macros := object.NewEnvironment()
+    DefineMacros(program, macros)
+    expanded, err := ExpandMacrosContext(e.ctx, program, macros, Options{Limits: e.limits, Overflow: e.overflow, Modules: e.modules})
+    if err != nil {
+        return nil, err
+    }
+
+    env := object.NewEnvironment()
+    if errObj, ok := e.Eval(expanded, env).(*object.Error); ok {
+        return nil, errObj
+    }
+    return env, nil
+}
+
+func evalModuleIndexExpression(module, index object.Object) object.Object {
+    name := index.(*object.String).Value
+
+    member, ok := module.(*object.Module).Member(name)
+    if !ok {
+        return newError(object.NAME_ERROR, "module %s does not export %s", filepath.Base(module.(*object.Module).Path), name)
+    }
+    return member
+}
+
+func (e *evaluation) evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+    if e.modules == nil {
+        e.modules = NewModuleLoader("")
+    }
+    module, err := e.modules.load(node.Path.Value, e)
+    if err != nil {
+        return err
+    }
+
+    if !env.Declare(node.Name.Value, module, true) {
+        return newError(object.NAME_ERROR, "cannot redeclare constant %s", node.Name.Value)
+    }
+    return nil
+}
@@ -0,0 +1,131 @@
+package evaluator
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+    "interpreter/object"
+)
+
+func TestImports(t *testing.T) {
+    dir := t.TempDir()
+    files := map[string]string{
+        "lib/math.mk": `
+            import "helpers.mk" as helpers;
+            export let square = fn(x) { helpers.times(x, x) };
+            export const pi = 3;
+            let hidden = 1;
+        `,
+        "lib/helpers.mk": `export let times = fn(a, b) { a * b };`,
+        "counter.mk": `
+            export let count = 0;
+            export let increment = fn() { count += 1 };
+        `,
+        "a.mk":      `import "b.mk" as b;`,
+        "b.mk":      `import "a.mk" as a;`,
+        "self.mk":   `import "self.mk" as self;`,
+        "broken.mk": "let x = 1;\nlet = 2;",
+        "failing.mk": "export let x = 1 + true;",
+    }
+    for name, source := range files {
+        path := filepath.Join(dir, name)
+        if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    tests := []struct{
+        input    string
+        expected interface{}
+    }{
+        {`import "lib/math.mk" as math; math.square(4)`, 16},
+        {`import "lib/math.mk" as math; math["pi"]`, 3},
+        {`import "lib/math.mk" as math; math.hidden`, "module math.mk does not export hidden"},
+        {`import "lib/math.mk" as math; math.times`, "module math.mk does not export times"},
+        {`import "lib/math.mk" as math; import "lib/math.mk" as again; math == again`, true},
+        {`import "lib/math.mk" as math; math = 1`, "cannot assign to constant math"},
+        {`import "lib/math.mk" as math; math["pi"] = 1`, "index assignment not supported: MODULE"},
+        {`import "counter.mk" as counter; counter.increment(); counter.increment(); counter.count`, 2},
+        {`import "a.mk" as a;`, "a.mk:1:1: b.mk:1:1: import cycle: a.mk -> b.mk -> a.mk"},
+        {`import "self.mk" as self;`, "self.mk:1:1: import cycle: self.mk -> self.mk"},
+        {`import "broken.mk" as broken;`, "broken.mk:2:5: Next token should be IDENT but got ="},
+        {`import "failing.mk" as failing;`, "failing.mk:1:16: type mismatch: INTEGER + BOOLEAN"},
+        {`import "missing.mk" as missing;`, `cannot import "missing.mk": no such file or directory`},
+        {`let h = {"a": 1}; h.a`, 1},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEvalOptions(tt.input, Options{Modules: NewModuleLoader(filepath.Join(dir, "main.mk"))})
+
+        switch expected := tt.expected.(type) {
+        case int:
+            testIntegerObject(t, evaluated, int64(expected))
+        case bool:
+            testBooleanObject(t, evaluated, expected)
+        case string:
+            errObj, ok := evaluated.(*object.Error)
+            if !ok {
+                t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+                continue
+            }
+            if errObj.Message != expected {
+                t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+            }
+        }
+    }
+}
+
+func TestModulesAreLoadedOnce(t *testing.T) {
+    dir := t.TempDir()
+    lib := filepath.Join(dir, "lib.mk")
+    err := os.WriteFile(lib, []byte(`export let items = [1];`), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    modules := NewModuleLoader(filepath.Join(dir, "main.mk"))
+
+    first, errObj := modules.Load("lib.mk")
+    if errObj != nil {
+        t.Fatalf("loading the module failed: %s", errObj.Message)
+    }
+    second, errObj := modules.Load(lib)
+    if errObj != nil {
+        t.Fatalf("loading the module again failed: %s", errObj.Message)
+    }
+
+    if first != second {
+        t.Errorf("the module was loaded twice")
+    }
+}
+
+func TestModulesAreSharedByConcurrentEvaluations(t *testing.T) {
+    dir := t.TempDir()
+    err := os.WriteFile(filepath.Join(dir, "lib.mk"), []byte(`export let n = 2;`), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    modules := NewModuleLoaderIn(dir)
+    results := make(chan object.Object)
+    for i := 0; i < 8; i++ {
+        go func() {
+            results <- testEvalOptions(`import "lib.mk" as lib; lib.n * 2`, Options{Modules: modules})
+        }()
+    }
+    for i := 0; i < 8; i++ {
+        testIntegerObject(t, <-results, 4)
+    }
+
+    first, errObj := modules.Load("lib.mk")
+    if errObj != nil {
+        t.Fatalf("loading the module failed: %s", errObj.Message)
+    }
+    second, _ := modules.Load("lib.mk")
+    if first != second {
+        t.Errorf("the module was loaded twice")
+    }
+}
@@ -0,0 +1,81 @@
+package evaluator
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/object"
+	"interpreter/token"
+)
+
+// quote returns its argument unevaluated, except for the unquote(...) calls in
+// it, which are evaluated and replaced by their result.
+func (e *evaluation) quote(node *ast.CallExpression, env *object.Environment) object.Object {
+    if len(node.Arguments) != 1 {
+        return newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1", len(node.Arguments))
+    }
+
+    var err object.Object
+    quoted := ast.Modify(ast.Copy(node.Arguments[0]), func(node ast.Node) ast.Node {
+        if err != nil || !isCallTo(node, "unquote") {
+            return node
+        }
+
+        call := node.(*ast.CallExpression)
+        if len(call.Arguments) != 1 {
+            err = newError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1", len(call.Arguments))
+            return node
+        }
+
+        unquoted := e.Eval(call.Arguments[0], env)
+        if isError(unquoted) {
+            err = unquoted
+            return node
+        }
+
+        converted, ok := convertObjectToASTNode(unquoted)
+        if !ok {
+            err = newError(object.MACRO_ERROR, "cannot unquote %s", unquoted.Type())
+            return node
+        }
+        return converted
+    })
+    if err != nil {
+        return err
+    }
+
+    return &object.Quote{Node: quoted}
+}
+
+// isCallTo tells whether node calls the identifier name, like unquote(x).
+func isCallTo(node ast.Node, name string) bool {
+    call, ok := node.(*ast.CallExpression)
+    if !ok {
+        return false
+    }
+    ident, ok := call.Function.(*ast.Identifier)
+    return ok && ident.Value == name
+}
+
+func convertObjectToASTNode(obj object.Object) (ast.Node, bool) {
+    switch obj := obj.(type) {
+    case *object.Integer:
+        t := token.Token{Type: token.INT, Literal: fmt.Sprintf("%d", obj.Value)}
+        return &ast.IntegerLiteral{Token: t, Value: obj.Value}, true
+    case *object.Float:
+        t := token.Token{Type: token.FLOAT, Literal: obj.Inspect()}
+        return &ast.FloatLiteral{Token: t, Value: obj.Value}, true
+    case *object.Boolean:
+        t := token.Token{Type: token.FALSE, Literal: "false"}
+        if obj.Value {
+            t = token.Token{Type: token.TRUE, Literal: "true"}
+        }
+        return &ast.Boolean{Token: t, Value: obj.Value}, true
+    case *object.String:
+        t := token.Token{Type: token.STRING, Literal: obj.Value}
+        return &ast.StringLiteral{Token: t, Value: obj.Value}, true
+    case *object.Quote:
+        return ast.Copy(obj.Node), true
+    default:
+        return nil, false
+    }
+}
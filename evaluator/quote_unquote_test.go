@@ -0,0 +1,90 @@
+package evaluator
+
+import (
+    "testing"
+    "interpreter/object"
+)
+
+func TestQuote(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {`quote(5)`, `5`},
+        {`quote(5 + 8)`, `(5 + 8)`},
+        {`quote(foobar)`, `foobar`},
+        {`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+    }
+
+    for _, tt := range tests {
+        testQuote(t, testEval(tt.input), tt.expected)
+    }
+}
+
+func TestQuoteUnquote(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {`quote(unquote(4))`, `4`},
+        {`quote(unquote(4 + 4))`, `8`},
+        {`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+        {`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+        {`let foobar = 8; quote(foobar)`, `foobar`},
+        {`let foobar = 8; quote(unquote(foobar))`, `8`},
+        {`quote(unquote(true))`, `true`},
+        {`quote(unquote(true == false))`, `false`},
+        {`quote(unquote(1.5))`, `1.5`},
+        {`quote(unquote("a" + "b"))`, `"ab"`},
+        {`quote(unquote("say \"hi\"\n"))`, `"say \"hi\"\n"`},
+        {`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+        {`let quotedInfixExpression = quote(4 + 4); quote(unquote(4 + 4) + unquote(quotedInfixExpression))`, `(8 + (4 + 4))`},
+        {`quote(f(unquote(1 + 1)))`, `f(2)`},
+        {`let f = fn(x) { quote(unquote(x) * 2) }; f(1); f(3)`, `(3 * 2)`},
+    }
+
+    for _, tt := range tests {
+        testQuote(t, testEval(tt.input), tt.expected)
+    }
+}
+
+func TestQuoteErrors(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {`quote(1, 2)`, "wrong number of arguments. got=2, want=1"},
+        {`quote(unquote())`, "wrong number of arguments. got=0, want=1"},
+        {`quote(unquote(1 + true))`, "type mismatch: INTEGER + BOOLEAN"},
+        {`quote(unquote([1]))`, "cannot unquote ARRAY"},
+        {`unquote(1)`, "identifier not found: unquote"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+
+        errObj, ok := evaluated.(*object.Error)
+        if !ok {
+            t.Errorf("%q: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+            continue
+        }
+        if errObj.Message != tt.expected {
+            t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, tt.expected, errObj.Message)
+        }
+    }
+}
+
+func testQuote(t *testing.T, evaluated object.Object, expected string) {
+    quote, ok := evaluated.(*object.Quote)
+    if !ok {
+        t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+    }
+
+    if quote.Node == nil {
+        t.Fatalf("quote.Node is nil")
+    }
+
+    if quote.Node.String() != expected {
+        t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), expected)
+    }
+}
@@ -0,0 +1,102 @@
+package evaluator
+
+import (
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+// tailCall is a call in tail position of a function body that has not been
+// made yet. applyFunction makes it in place of the call that returned it.
+type tailCall struct {
+    fn   *object.Function
+    args []object.Object
+    node *ast.CallExpression
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// evalTail evaluates a function body. When tail is set the value of node is
+// the result of the function, and a call to a function there is returned as
+// a tailCall. The values of return statements are always in tail position,
+// except in loops and try blocks, which are evaluated as usual.
+func (e *evaluation) evalTail(node ast.Node, env *object.Environment, tail bool) object.Object {
+    switch node := node.(type) {
+    case *ast.BlockStatement:
+        var result object.Object
+        for i, statement := range node.Statements {
+            result = e.evalTail(statement, env, tail && i == len(node.Statements) - 1)
+
+            switch result.(type) {
+            case *object.ReturnValue, *object.Error, *object.Break, *object.Continue, *tailCall:
+                return result
+            }
+        }
+        return result
+    case *ast.ExpressionStatement:
+        return e.evalTail(node.Expression, env, tail)
+    case *ast.ReturnStatement:
+        val := e.evalTail(node.ReturnValue, env, true)
+        switch val.(type) {
+        case *object.Error, *tailCall:
+            return val
+        }
+        return &object.ReturnValue{Value: val}
+    case *ast.IfExpression:
+        condition := e.Eval(node.Condition, env)
+        if isError(condition) {
+            return condition
+        }
+
+        if isTruly(condition) {
+            return e.evalTail(node.Consequence, object.NewEnclosedEnvironment(env), tail)
+        } else if node.Alternative != nil {
+            return e.evalTail(node.Alternative, object.NewEnclosedEnvironment(env), tail)
+        }
+        return NULL
+    case *ast.CallExpression:
+        if !tail || isCallTo(node, "quote") {
+            return e.Eval(node, env)
+        }
+        if err := e.step(); err != nil {
+            return err
+        }
+        return e.evalCallExpression(node, env, true)
+    default:
+        return e.Eval(node, env)
+    }
+}
+
+// evalCallExpression calls a function, or in tail position returns a
+// tailCall for it.
+func (e *evaluation) evalCallExpression(node *ast.CallExpression, env *object.Environment, tail bool) object.Object {
+    if isCallTo(node, "quote") {
+        return e.quote(node, env)
+    }
+    function := e.Eval(node.Function, env)
+    if isError(function) {
+        return function
+    }
+    args := e.evalExpression(node.Arguments, env)
+    if len(args) == 1 && isError(args[0]) {
+        return args[0]
+    }
+
+    if fn, ok := function.(*object.Function); ok && tail {
+        return &tailCall{fn: fn, args: args, node: node}
+    }
+
+    result := e.applyFunction(function, args)
+    if err, ok := result.(*object.Error); ok {
+        traceCall(err, node)
+    }
+    return result
+}
+
+// traceCall adds the call an error came out of to its stack trace.
+func traceCall(err *object.Error, node *ast.CallExpression) {
+    if !err.Pos.IsValid() {
+        err.Pos = node.Pos()
+    }
+    err.Stack = append(err.Stack, object.StackFrame{Function: callName(node.Function), Pos: node.Pos()})
+}
@@ -0,0 +1,97 @@
+package evaluator
+
+import (
+    "context"
+    "interpreter/lexer"
+    "interpreter/object"
+    "interpreter/parser"
+    "testing"
+)
+
+func TestTailCalls(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected interface{}
+    }{
+        // deeper than DefaultMaxCallDepth, so only tail calls get through
+        {"let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(100000, 0)", 100000},
+        {"let count = fn(n, acc) { if (n == 0) { return acc; } return count(n - 1, acc + 1); }; count(100000, 0)", 100000},
+        {"let count = fn(n, acc) { if (n > 0) { return count(n - 1, acc + 1); } acc }; count(100000, 0)", 100000},
+        {"let count = fn(n) { if (n > 0) { let m = n - 1; count(m) } else { \"done\" } }; count(100000)", "done"},
+        {`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+          let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+          even(100001)`, false},
+        {"let f = fn(n, acc = 0) { if (n == 0) { acc } else { f(n - 1, acc + n) } }; f(100000)", 5000050000},
+        // calls that are not in tail position still count
+        {"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(100000)", "maximum call depth of 10000 exceeded"},
+        {"let f = fn(n) { while (true) { return if (n == 0) { 0 } else { f(n - 1) }; } }; f(100000)", "maximum call depth of 10000 exceeded"},
+        {"let f = fn(n) { try { if (n == 0) { 0 } else { f(n - 1) } } catch (e) { -1 } }; f(100000)", "maximum call depth of 10000 exceeded"},
+        // builtins in tail position are called right away
+        {"let f = fn(xs) { len(xs) }; f([1, 2])", 2},
+        {"let f = fn() { quote(1 + 2) }; f()", "QUOTE((1 + 2))"},
+        // errors report the tail call they came out of
+        {"let f = fn(a) { a }; let g = fn() { f() }; g()", "wrong number of arguments. got=0, want=1"},
+    }
+
+    for _, tt := range tests {
+        evaluated := testEval(tt.input)
+
+        switch expected := tt.expected.(type) {
+        case int:
+            testIntegerObject(t, evaluated, int64(expected))
+        case bool:
+            testBooleanObject(t, evaluated, expected)
+        case string:
+            switch evaluated := evaluated.(type) {
+            case *object.Error:
+                if evaluated.Message != expected {
+                    t.Errorf("%q: wrong error message. expected=%q, got=%q", tt.input, expected, evaluated.Message)
+                }
+            case *object.String:
+                if evaluated.Value != expected {
+                    t.Errorf("%q: wrong string. expected=%q, got=%q", tt.input, expected, evaluated.Value)
+                }
+            default:
+                if evaluated.Inspect() != expected {
+                    t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+                }
+            }
+        }
+    }
+}
+
+func TestTailCallStack(t *testing.T) {
+    input := "let f = fn(a) { a };\nlet g = fn() { f() };\ng()"
+    evaluated := testEval(input)
+
+    errObj, ok := evaluated.(*object.Error)
+    if !ok {
+        t.Fatalf("no error returned. got=%T (%+v)", evaluated, evaluated)
+    }
+    if errObj.Pos.String() != "2:16" {
+        t.Errorf("wrong position. expected=%q, got=%q", "2:16", errObj.Pos)
+    }
+
+    expected := []string{"at f (2:16)", "at g (3:1)"}
+    if len(errObj.Stack) != len(expected) {
+        t.Fatalf("wrong stack. expected=%q, got=%v", expected, errObj.Stack)
+    }
+    for i, frame := range errObj.Stack {
+        if frame.String() != expected[i] {
+            t.Errorf("wrong frame %d. expected=%q, got=%q", i, expected[i], frame.String())
+        }
+    }
+}
+
+func TestTailRecursionOverLargeArray(t *testing.T) {
+    elements := make([]object.Object, 100000)
+    for i := range elements {
+        elements[i] = &object.Integer{Value: 1}
+    }
+    env := object.NewEnvironment()
+    env.Set("xs", &object.Array{Elements: elements})
+
+    input := "let sum = fn(i, acc) { if (i == len(xs)) { acc } else { sum(i + 1, acc + xs[i]) } }; sum(0, 0)"
+    program := parser.New(lexer.New(input)).ParseProgram()
+    testIntegerObject(t, EvalContext(context.Background(), program, env, Limits{}), 100000)
+}
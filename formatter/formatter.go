@@ -0,0 +1,329 @@
+// Package formatter prints programs in a canonical layout: one statement per
+// line, blocks indented by four spaces and only the parentheses the parser
+// needs. Comments are kept, and formatting formatted source changes nothing.
+package formatter
+
+import (
+	"bytes"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"interpreter/token"
+	"math"
+	"strings"
+)
+
+const indentation = "    "
+
+// Format parses source and returns it formatted. It returns the first syntax
+// error, as a *parser.ParseError, when source does not parse.
+func Format(source string) (string, error) {
+    p := parser.New(lexer.NewWithComments(source))
+    program := p.ParseProgram()
+    if len(p.Errors()) != 0 {
+        return "", p.Errors()[0]
+    }
+    return Program(program, p.Comments()), nil
+}
+
+// Program formats program, placing the comments, which are COMMENT tokens
+// in source order, between its statements.
+func Program(program *ast.Program, comments []token.Token) string {
+    p := &printer{comments: comments, blockEnd: math.MaxInt}
+    p.statements(program.Statements, false)
+    p.commentsBefore(math.MaxInt)
+    if p.started {
+        p.out.WriteString("\n")
+    }
+    return p.out.String()
+}
+
+type printer struct {
+    out      bytes.Buffer
+    indent   int
+    comments []token.Token // comments not printed yet
+    blockEnd int           // source offset of the end of the block being printed
+
+    started  bool // whether anything was printed yet
+    lastLine int  // source line of the last printed statement or comment, 0 at the start of a block
+}
+
+// newline starts a line in the current block for something at line in the
+// source, keeping a single blank line where the source had any.
+func (p *printer) newline(line int) {
+    if p.started {
+        p.out.WriteString("\n")
+        if p.lastLine > 0 && line > p.lastLine+1 {
+            p.out.WriteString("\n")
+        }
+    }
+    p.out.WriteString(strings.Repeat(indentation, p.indent))
+    p.started = true
+}
+
+// commentsBefore prints the comments before offset on lines of their own.
+func (p *printer) commentsBefore(offset int) {
+    for len(p.comments) > 0 && p.comments[0].Pos.Offset < offset {
+        comment := p.comments[0]
+        p.comments = p.comments[1:]
+
+        p.newline(comment.Pos.Line)
+        p.out.WriteString(comment.Literal)
+        p.lastLine = comment.End.Line
+    }
+}
+
+// trailingComments prints the comments inside a statement that ends at end,
+// and the ones following it on the same line, after the statement. Comments
+// after the end of the enclosing block belong to the statement around it.
+func (p *printer) trailingComments(end token.Position) {
+    for len(p.comments) > 0 {
+        comment := p.comments[0]
+        if comment.Pos.Offset >= end.Offset && (comment.Pos.Line != end.Line || comment.Pos.Offset >= p.blockEnd) {
+            return
+        }
+        p.comments = p.comments[1:]
+
+        p.out.WriteString(" " + comment.Literal)
+        if comment.End.Line > p.lastLine {
+            p.lastLine = comment.End.Line
+        }
+    }
+}
+
+// statements prints a list of statements. In a block whose value is used,
+// like a function body, the last expression statement has no semicolon.
+func (p *printer) statements(statements []ast.Statement, valueBlock bool) {
+    for i, statement := range statements {
+        p.commentsBefore(statement.Pos().Offset)
+        p.newline(statement.Pos().Line)
+        p.statement(statement, valueBlock && i == len(statements)-1)
+        p.lastLine = statement.End().Line
+        p.trailingComments(statement.End())
+    }
+}
+
+func (p *printer) block(block *ast.BlockStatement, valueBlock bool) {
+    end := block.Rbrace.Pos.Offset
+    if len(block.Statements) == 0 && (len(p.comments) == 0 || p.comments[0].Pos.Offset >= end) {
+        p.out.WriteString("{}")
+        return
+    }
+
+    lastLine, blockEnd := p.lastLine, p.blockEnd
+    p.out.WriteString("{")
+    p.indent++
+    p.lastLine = 0
+    p.blockEnd = end
+
+    p.statements(block.Statements, valueBlock)
+    p.commentsBefore(end)
+
+    p.indent--
+    p.out.WriteString("\n" + strings.Repeat(indentation, p.indent) + "}")
+    p.lastLine, p.blockEnd = lastLine, blockEnd
+}
+
+func (p *printer) statement(statement ast.Statement, last bool) {
+    switch statement := statement.(type) {
+    case *ast.LetStatement:
+        p.out.WriteString(statement.Token.Literal + " " + statement.Name.Value)
+        p.annotation(statement.Type)
+        p.out.WriteString(" = ")
+        p.expression(statement.Value)
+        p.out.WriteString(";")
+    case *ast.ExportStatement:
+        p.out.WriteString("export ")
+        p.statement(statement.Statement, false)
+    case *ast.ImportStatement:
+        p.out.WriteString("import " + statement.Path.String() + " as " + statement.Name.Value + ";")
+    case *ast.ReturnStatement:
+        p.out.WriteString("return ")
+        p.expression(statement.ReturnValue)
+        p.out.WriteString(";")
+    case *ast.ThrowStatement:
+        p.out.WriteString("throw ")
+        p.expression(statement.Value)
+        p.out.WriteString(";")
+    case *ast.BreakStatement:
+        p.out.WriteString("break;")
+    case *ast.ContinueStatement:
+        p.out.WriteString("continue;")
+    case *ast.WhileStatement:
+        p.out.WriteString("while (")
+        p.expression(statement.Condition)
+        p.out.WriteString(") ")
+        p.block(statement.Body, false)
+    case *ast.ForStatement:
+        p.out.WriteString("for (" + statement.Variable.Value + " in ")
+        p.expression(statement.Iterable)
+        p.out.WriteString(") ")
+        p.block(statement.Body, false)
+    case *ast.ExpressionStatement:
+        p.expression(statement.Expression)
+        switch statement.Expression.(type) {
+        case *ast.IfExpression, *ast.TryExpression:
+        default:
+            if !last {
+                p.out.WriteString(";")
+            }
+        }
+    }
+}
+
+// precedence returns how tightly an expression binds, the way the parser
+// sees it.
+func precedence(expression ast.Expression) int {
+    switch expression := expression.(type) {
+    case *ast.InfixExpression:
+        return parser.Precedence(expression.Token.Type)
+    case *ast.AssignExpression:
+        return parser.ASSIGNMENT
+    case *ast.PrefixExpression:
+        return parser.PREFIX
+    case *ast.CallExpression, *ast.IndexExpression, *ast.MemberExpression:
+        return parser.CALL
+    }
+    return parser.INDEX + 1
+}
+
+// operand prints an operand, in parentheses when it binds less tightly than
+// min.
+func (p *printer) operand(expression ast.Expression, min int) {
+    if precedence(expression) < min {
+        p.out.WriteString("(")
+        p.expression(expression)
+        p.out.WriteString(")")
+        return
+    }
+    p.expression(expression)
+}
+
+func (p *printer) expression(expression ast.Expression) {
+    switch expression := expression.(type) {
+    case *ast.Identifier:
+        p.out.WriteString(expression.Value)
+    case *ast.IntegerLiteral:
+        p.out.WriteString(expression.Token.Literal)
+    case *ast.FloatLiteral:
+        p.out.WriteString(expression.Token.Literal)
+    case *ast.Boolean:
+        p.out.WriteString(expression.Token.Literal)
+    case *ast.StringLiteral:
+        p.out.WriteString(expression.String())
+    case *ast.PrefixExpression:
+        p.out.WriteString(expression.Operator)
+        if right, ok := expression.Right.(*ast.PrefixExpression); ok && expression.Operator == "-" && right.Operator == "-" {
+            // -(-x) rather than --x
+            p.operand(right, parser.CALL)
+            return
+        }
+        p.operand(expression.Right, parser.PREFIX)
+    case *ast.InfixExpression:
+        // operators are left associative
+        prec := parser.Precedence(expression.Token.Type)
+        p.operand(expression.Left, prec)
+        p.out.WriteString(" " + expression.Operator + " ")
+        p.operand(expression.Right, prec+1)
+    case *ast.AssignExpression:
+        p.operand(expression.Target, parser.CALL)
+        p.out.WriteString(" " + expression.Operator + " ")
+        p.expression(expression.Value)
+    case *ast.CallExpression:
+        p.operand(expression.Function, parser.CALL)
+        p.out.WriteString("(")
+        p.list(expression.Arguments)
+        p.out.WriteString(")")
+    case *ast.IndexExpression:
+        p.operand(expression.Left, parser.CALL)
+        p.out.WriteString("[")
+        p.expression(expression.Index)
+        p.out.WriteString("]")
+    case *ast.MemberExpression:
+        p.operand(expression.Object, parser.CALL)
+        p.out.WriteString("." + expression.Member.Value)
+    case *ast.ArrayLiteral:
+        p.out.WriteString("[")
+        p.list(expression.Elements)
+        p.out.WriteString("]")
+    case *ast.HashLiteral:
+        p.hash(expression)
+    case *ast.IfExpression:
+        p.out.WriteString("if (")
+        p.expression(expression.Condition)
+        p.out.WriteString(") ")
+        p.block(expression.Consequence, true)
+        if expression.Alternative != nil {
+            p.out.WriteString(" else ")
+            p.block(expression.Alternative, true)
+        }
+    case *ast.TryExpression:
+        p.out.WriteString("try ")
+        p.block(expression.Block, true)
+        p.out.WriteString(" catch (" + expression.Parameter.Value + ") ")
+        p.block(expression.Catch, true)
+    case *ast.FunctionLiteral:
+        p.out.WriteString("fn(")
+        for i, parameter := range expression.Parameters {
+            if i > 0 {
+                p.out.WriteString(", ")
+            }
+            p.out.WriteString(parameter.Value)
+            p.annotation(expression.ParameterTypes[parameter.Value])
+            if value, ok := expression.Defaults[parameter.Value]; ok {
+                p.out.WriteString(" = ")
+                p.expression(value)
+            }
+        }
+        if expression.Rest != nil {
+            if len(expression.Parameters) > 0 {
+                p.out.WriteString(", ")
+            }
+            p.out.WriteString("..." + expression.Rest.Value)
+            p.annotation(expression.ParameterTypes[expression.Rest.Value])
+        }
+        p.out.WriteString(")")
+        p.annotation(expression.ReturnType)
+        p.out.WriteString(" ")
+        p.block(expression.Body, true)
+    case *ast.MacroLiteral:
+        p.out.WriteString("macro(")
+        for i, parameter := range expression.Parameters {
+            if i > 0 {
+                p.out.WriteString(", ")
+            }
+            p.out.WriteString(parameter.Value)
+        }
+        p.out.WriteString(") ")
+        p.block(expression.Body, true)
+    }
+}
+
+func (p *printer) annotation(t *ast.TypeExpression) {
+    if t != nil {
+        p.out.WriteString(": " + t.String())
+    }
+}
+
+func (p *printer) list(expressions []ast.Expression) {
+    for i, expression := range expressions {
+        if i > 0 {
+            p.out.WriteString(", ")
+        }
+        p.expression(expression)
+    }
+}
+
+// hash prints the pairs of a hash literal in source order.
+func (p *printer) hash(hash *ast.HashLiteral) {
+    p.out.WriteString("{")
+    for i, key := range hash.Keys() {
+        if i > 0 {
+            p.out.WriteString(", ")
+        }
+        p.expression(key)
+        p.out.WriteString(": ")
+        p.expression(hash.Pairs[key])
+    }
+    p.out.WriteString("}")
+}
@@ -0,0 +1,90 @@
+package formatter
+
+import (
+	"interpreter/lexer"
+	"interpreter/parser"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"", ""},
+        {"let x=1", "let x = 1;\n"},
+        {"const  y = x ;", "const y = x;\n"},
+        {"((a + b) * c)", "(a + b) * c;\n"},
+        {"a + (b * c)", "a + b * c;\n"},
+        {"(a - b) - c; a - (b - c)", "a - b - c;\na - (b - c);\n"},
+        {"-(a + b); -(-a); !(-a); !!a; (-a).b", "-(a + b);\n-(-a);\n!-a;\n!!a;\n(-a).b;\n"},
+        {"a || (b && c); (a || b) && c", "a || b && c;\n(a || b) && c;\n"},
+        {"(x = 1) + 2; a = b = c", "(x = 1) + 2;\na = b = c;\n"},
+        {"(f)(1)(2); (a[0])[1]; (f(x)).y; h . a", "f(1)(2);\na[0][1];\nf(x).y;\nh.a;\n"},
+        {"x+=1;h[\"k\"]*=2", "x += 1;\nh[\"k\"] *= 2;\n"},
+        {"[1,2 , 3]", "[1, 2, 3];\n"},
+        {`"a\tb"+"\x41\u{e9}\u{200b}"+"q\"\\"`, "\"a\\tb\" + \"Aé\\u{200b}\" + \"q\\\"\\\\\";\n"},
+        {"\"two\nlines\"", "\"two\\nlines\";\n"},
+        {`{"b":1,"a":2, 3: [ ]}`, "{\"b\": 1, \"a\": 2, 3: []};\n"},
+        {"1.50 + 2", "1.50 + 2;\n"},
+        {"let f = fn(a,b=2,...r){a+b}", "let f = fn(a, b = 2, ...r) {\n    a + b\n};\n"},
+        {"fn(...r) {}", "fn(...r) {};\n"},
+        {"let x:int=1", "let x: int = 1;\n"},
+        {"let f=fn(a:int,b:hash<string,int> ={},...r:array):fn(int):bool{g}", "let f = fn(a: int, b: hash<string, int> = {}, ...r: array): fn(int): bool {\n    g\n};\n"},
+        {"let m = macro(x){quote(unquote(x))};", "let m = macro(x) {\n    quote(unquote(x))\n};\n"},
+        {"if(a){b}else{c;d}", "if (a) {\n    b\n} else {\n    c;\n    d\n}\n"},
+        {"if (a) { return 1; }", "if (a) {\n    return 1;\n}\n"},
+        {"while(i<3){i+=1}", "while (i < 3) {\n    i += 1;\n}\n"},
+        {"for(x in xs){if(x){break}else{continue}}", "for (x in xs) {\n    if (x) {\n        break;\n    } else {\n        continue;\n    }\n}\n"},
+        {"try{throw \"x\"}catch(e){e.message}", "try {\n    throw \"x\";\n} catch (e) {\n    e.message\n}\n"},
+        {"import \"lib.mk\" as lib\nexport let a=lib.b", "import \"lib.mk\" as lib;\nexport let a = lib.b;\n"},
+        {"a;\n\n\n\nb;\nc", "a;\n\nb;\nc;\n"},
+        {"fn() {\n\n  a;\n\n  b\n\n}", "fn() {\n    a;\n\n    b\n};\n"},
+        // comments
+        {"// about a\nlet a = 1; // one\n\n/* b */ b", "// about a\nlet a = 1; // one\n\n/* b */\nb;\n"},
+        {"let f = fn() {\n  // nothing yet\n};", "let f = fn() {\n    // nothing yet\n};\n"},
+        {"let f = fn(a, /* b */ b) {\n  a\n  // done\n}", "let f = fn(a, b) {\n    /* b */\n    a\n    // done\n};\n"},
+        {"let a = [1, // one\n  2];\nb", "let a = [1, 2]; // one\nb;\n"},
+        {"a\n// the end", "a;\n// the end\n"},
+        {"let f = fn(x) { x }; // note\nf(1)", "let f = fn(x) {\n    x\n}; // note\nf(1);\n"},
+        {"if (a) { b } // note", "if (a) {\n    b\n} // note\n"},
+        {"let f = fn(x) { x /* inside */ }; // after", "let f = fn(x) {\n    x /* inside */\n}; // after\n"},
+    }
+
+    for _, tt := range tests {
+        formatted, err := Format(tt.input)
+        if err != nil {
+            t.Errorf("%q: unexpected error %s", tt.input, err)
+            continue
+        }
+        if formatted != tt.expected {
+            t.Errorf("%q: wrong formatting.\nexpected=%q\ngot=     %q", tt.input, tt.expected, formatted)
+            continue
+        }
+
+        again, err := Format(formatted)
+        if err != nil || again != formatted {
+            t.Errorf("%q: formatting is not idempotent. got=%q (%v)", tt.input, again, err)
+        }
+
+        if parse(tt.input) != parse(formatted) {
+            t.Errorf("%q: formatting changed the program. before=%q, after=%q", tt.input, parse(tt.input), parse(formatted))
+        }
+    }
+}
+
+func TestFormatErrors(t *testing.T) {
+    _, err := Format("let x = ;")
+    parseErr, ok := err.(*parser.ParseError)
+    if !ok {
+        t.Fatalf("error is not *parser.ParseError. got=%T (%v)", err, err)
+    }
+    if parseErr.Error() != "1:9: no prefix parse function found for ;" {
+        t.Errorf("wrong error. got=%q", parseErr.Error())
+    }
+}
+
+func parse(input string) string {
+    p := parser.New(lexer.New(input))
+    return p.ParseProgram().String()
+}
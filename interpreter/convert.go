@@ -0,0 +1,447 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"interpreter/evaluator"
+	"interpreter/object"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+var (
+    objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+    errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// ToObject converts a Go value to an object: nil to null, booleans,
+// integers, floats and strings to their objects, slices and arrays to
+// arrays, maps to hashes and functions to builtins. Objects are returned as
+// they are, and pointers and interfaces are followed.
+func ToObject(value interface{}) (object.Object, error) {
+    if obj, ok := value.(object.Object); ok {
+        return obj, nil
+    }
+    if value == nil {
+        return evaluator.NULL, nil
+    }
+    return toObject(reflect.ValueOf(value))
+}
+
+func toObject(v reflect.Value) (object.Object, error) {
+    if v.Type().Implements(objectType) && !(v.Kind() == reflect.Interface && v.IsNil()) {
+        return v.Interface().(object.Object), nil
+    }
+
+    switch v.Kind() {
+    case reflect.Bool:
+        if v.Bool() {
+            return evaluator.TRUE, nil
+        }
+        return evaluator.FALSE, nil
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return &object.Integer{Value: v.Int()}, nil
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+        if v.Uint() > math.MaxInt64 {
+            return &object.BigInteger{Value: new(big.Int).SetUint64(v.Uint())}, nil
+        }
+        return &object.Integer{Value: int64(v.Uint())}, nil
+    case reflect.Float32, reflect.Float64:
+        return &object.Float{Value: v.Float()}, nil
+    case reflect.String:
+        return &object.String{Value: v.String()}, nil
+    case reflect.Slice, reflect.Array:
+        if v.Kind() == reflect.Slice && v.IsNil() {
+            return evaluator.NULL, nil
+        }
+        elements := make([]object.Object, v.Len())
+        for i := range elements {
+            element, err := toObject(v.Index(i))
+            if err != nil {
+                return nil, err
+            }
+            elements[i] = element
+        }
+        return &object.Array{Elements: elements}, nil
+    case reflect.Map:
+        if v.IsNil() {
+            return evaluator.NULL, nil
+        }
+        pairs := make(map[object.HashKey]object.HashPair)
+        iter := v.MapRange()
+        for iter.Next() {
+            key, err := toObject(iter.Key())
+            if err != nil {
+                return nil, err
+            }
+            hashable, ok := key.(object.Hashable)
+            if !ok {
+                return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+            }
+            value, err := toObject(iter.Value())
+            if err != nil {
+                return nil, err
+            }
+            pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+        }
+        return &object.Hash{Pairs: pairs}, nil
+    case reflect.Func:
+        if v.IsNil() {
+            return evaluator.NULL, nil
+        }
+        return wrapFunction("function", v.Interface())
+    case reflect.Ptr, reflect.Interface:
+        if v.IsNil() {
+            return evaluator.NULL, nil
+        }
+        return toObject(v.Elem())
+    }
+    return nil, fmt.Errorf("cannot convert %s to an object", v.Type())
+}
+
+// FromObject converts an object to the natural Go value: int64, *big.Int,
+// float64, string, bool or nil, []interface{} for arrays,
+// map[interface{}]interface{} for hashes and
+// func(...interface{}) (interface{}, error) for functions and builtins.
+// Other objects are returned as they are.
+func FromObject(obj object.Object) interface{} {
+    return fromObject(obj, evaluator.Apply)
+}
+
+// fromObject converts obj like FromObject. Functions are called with apply.
+func fromObject(obj object.Object, apply object.Applier) interface{} {
+    switch obj := obj.(type) {
+    case nil, *object.Null:
+        return nil
+    case *object.Integer:
+        return obj.Value
+    case *object.BigInteger:
+        return new(big.Int).Set(obj.Value)
+    case *object.Float:
+        return obj.Value
+    case *object.String:
+        return obj.Value
+    case *object.Boolean:
+        return obj.Value
+    case *object.Array:
+        elements := make([]interface{}, len(obj.Elements))
+        for i, element := range obj.Elements {
+            elements[i] = fromObject(element, apply)
+        }
+        return elements
+    case *object.Hash:
+        pairs := make(map[interface{}]interface{}, len(obj.Pairs))
+        for _, pair := range obj.Pairs {
+            pairs[fromObject(pair.Key, apply)] = fromObject(pair.Value, apply)
+        }
+        return pairs
+    case *object.Function, *object.Builtin:
+        return func(args ...interface{}) (interface{}, error) {
+            result, err := call(obj, args, apply)
+            if err != nil {
+                return nil, err
+            }
+            return fromObject(result, apply), nil
+        }
+    }
+    return obj
+}
+
+// Convert stores obj in the value target points to, converting it to the
+// type of that value. Integers convert to every integer and float type they
+// fit in, arrays to slices, hashes to maps and functions to func types. A
+// func type without an error result panics when the call fails.
+func Convert(obj object.Object, target interface{}) error {
+    ptr := reflect.ValueOf(target)
+    if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+        return fmt.Errorf("target must be a non-nil pointer, got %T", target)
+    }
+
+    v, err := convert(obj, ptr.Type().Elem(), evaluator.Apply)
+    if err != nil {
+        return err
+    }
+    ptr.Elem().Set(v)
+    return nil
+}
+
+// convert converts obj to a value of type t like Convert. Functions are
+// called with apply.
+func convert(obj object.Object, t reflect.Type, apply object.Applier) (reflect.Value, error) {
+    if obj == nil {
+        obj = evaluator.NULL
+    }
+    if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+        value := fromObject(obj, apply)
+        if value == nil {
+            return reflect.Zero(t), nil
+        }
+        return reflect.ValueOf(value), nil
+    }
+    if reflect.TypeOf(obj).AssignableTo(t) {
+        return reflect.ValueOf(obj), nil
+    }
+
+    fail := func() (reflect.Value, error) {
+        return reflect.Value{}, fmt.Errorf("cannot convert %s to %s", obj.Type(), t)
+    }
+
+    v := reflect.New(t).Elem()
+    switch t.Kind() {
+    case reflect.Bool:
+        b, ok := obj.(*object.Boolean)
+        if !ok {
+            return fail()
+        }
+        v.SetBool(b.Value)
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        i, ok := obj.(*object.Integer)
+        if !ok || v.OverflowInt(i.Value) {
+            return fail()
+        }
+        v.SetInt(i.Value)
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+        var u uint64
+        switch obj := obj.(type) {
+        case *object.Integer:
+            if obj.Value < 0 {
+                return fail()
+            }
+            u = uint64(obj.Value)
+        case *object.BigInteger:
+            if !obj.Value.IsUint64() {
+                return fail()
+            }
+            u = obj.Value.Uint64()
+        default:
+            return fail()
+        }
+        if v.OverflowUint(u) {
+            return fail()
+        }
+        v.SetUint(u)
+    case reflect.Float32, reflect.Float64:
+        switch obj := obj.(type) {
+        case *object.Float:
+            v.SetFloat(obj.Value)
+        case *object.Integer:
+            v.SetFloat(float64(obj.Value))
+        default:
+            return fail()
+        }
+    case reflect.String:
+        s, ok := obj.(*object.String)
+        if !ok {
+            return fail()
+        }
+        v.SetString(s.Value)
+    case reflect.Slice:
+        if obj == evaluator.NULL {
+            return v, nil
+        }
+        array, ok := obj.(*object.Array)
+        if !ok {
+            return fail()
+        }
+        v.Set(reflect.MakeSlice(t, len(array.Elements), len(array.Elements)))
+        for i, element := range array.Elements {
+            converted, err := convert(element, t.Elem(), apply)
+            if err != nil {
+                return reflect.Value{}, err
+            }
+            v.Index(i).Set(converted)
+        }
+    case reflect.Map:
+        if obj == evaluator.NULL {
+            return v, nil
+        }
+        hash, ok := obj.(*object.Hash)
+        if !ok {
+            return fail()
+        }
+        v.Set(reflect.MakeMapWithSize(t, len(hash.Pairs)))
+        for _, pair := range hash.Pairs {
+            key, err := convert(pair.Key, t.Key(), apply)
+            if err != nil {
+                return reflect.Value{}, err
+            }
+            value, err := convert(pair.Value, t.Elem(), apply)
+            if err != nil {
+                return reflect.Value{}, err
+            }
+            v.SetMapIndex(key, value)
+        }
+    case reflect.Func:
+        if obj.Type() != object.FUNCTION_OBJ && obj.Type() != object.BUILTIN_OBJ {
+            return fail()
+        }
+        v.Set(makeFunc(obj, t, apply))
+    default:
+        return fail()
+    }
+    return v, nil
+}
+
+// makeFunc returns a Go function of type t that calls fn with apply. When t
+// has an error as its last result, errors are returned there, otherwise they
+// panic.
+func makeFunc(fn object.Object, t reflect.Type, apply object.Applier) reflect.Value {
+    returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+
+    return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+        args := make([]interface{}, 0, len(in))
+        for i, arg := range in {
+            if t.IsVariadic() && i == len(in)-1 {
+                for j := 0; j < arg.Len(); j++ {
+                    args = append(args, arg.Index(j).Interface())
+                }
+                continue
+            }
+            args = append(args, arg.Interface())
+        }
+
+        out := make([]reflect.Value, t.NumOut())
+        for i := range out {
+            out[i] = reflect.Zero(t.Out(i))
+        }
+
+        result, err := call(fn, args, apply)
+        if err == nil && t.NumOut() > 0 && !(returnsError && t.NumOut() == 1) {
+            var v reflect.Value
+            v, err = convert(result, t.Out(0), apply)
+            if err == nil {
+                out[0] = v
+            }
+        }
+        if err != nil {
+            if !returnsError {
+                panic(err)
+            }
+            out[len(out)-1] = reflect.ValueOf(&err).Elem()
+        }
+        return out
+    })
+}
+
+// call converts args to objects and calls fn with them through apply.
+func call(fn object.Object, args []interface{}, apply object.Applier) (object.Object, error) {
+    objects := make([]object.Object, len(args))
+    for i, arg := range args {
+        obj, err := ToObject(arg)
+        if err != nil {
+            return nil, err
+        }
+        objects[i] = obj
+    }
+
+    result := apply(fn, objects)
+    if err, ok := result.(*object.Error); ok {
+        return nil, err
+    }
+    if result == nil {
+        return evaluator.NULL, nil
+    }
+    return result, nil
+}
+
+// wrapFunction turns a Go function into a builtin that converts its
+// arguments and results.
+func wrapFunction(name string, fn interface{}) (*object.Builtin, error) {
+    switch fn := fn.(type) {
+    case object.BuiltinFunction:
+        return &object.Builtin{Fn: fn, Signature: name + "(...values)", Arity: -1}, nil
+    case func(args ...object.Object) object.Object:
+        return &object.Builtin{Fn: fn, Signature: name + "(...values)", Arity: -1}, nil
+    }
+
+    v := reflect.ValueOf(fn)
+    if v.Kind() != reflect.Func || v.IsNil() {
+        return nil, fmt.Errorf("%s is not a function: %T", name, fn)
+    }
+    t := v.Type()
+
+    returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+    if t.NumOut() > 2 || t.NumOut() == 2 && !returnsError {
+        return nil, fmt.Errorf("%s must return at most a value and an error", name)
+    }
+
+    parameters := []string{}
+    for i := 0; i < t.NumIn(); i++ {
+        if t.IsVariadic() && i == t.NumIn()-1 {
+            parameters = append(parameters, "..." + t.In(i).Elem().String())
+        } else {
+            parameters = append(parameters, t.In(i).String())
+        }
+    }
+
+    total := t.NumIn()
+    arity := total
+    if t.IsVariadic() {
+        total--
+        arity = -1
+    }
+
+    builtin := &object.Builtin{Signature: name + "(" + strings.Join(parameters, ", ") + ")", Arity: arity}
+    // functions passed to fn are called through apply, so they run within the
+    // limits of the evaluation that called the builtin
+    builtin.FnApply = func(apply object.Applier, args ...object.Object) (result object.Object) {
+        if err := evaluator.CheckArity(len(args), total, total, t.IsVariadic()); err != nil {
+            return err
+        }
+
+        in := make([]reflect.Value, len(args))
+        for i, arg := range args {
+            var parameter reflect.Type
+            if i < total {
+                parameter = t.In(i)
+            } else {
+                parameter = t.In(total).Elem()
+            }
+            converted, err := convert(arg, parameter, apply)
+            if err != nil {
+                return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("argument %d to %s: %s", i + 1, name, err)}
+            }
+            in[i] = converted
+        }
+
+        // a function argument without an error result panics when its call
+        // fails, which ends fn with that error
+        defer func() {
+            if r := recover(); r != nil {
+                err, ok := r.(*object.Error)
+                if !ok {
+                    panic(r)
+                }
+                result = err
+            }
+        }()
+
+        out := v.Call(in)
+        if returnsError {
+            if err := out[len(out)-1]; !err.IsNil() {
+                // errors of function arguments, like exceeded limits, are kept
+                var objErr *object.Error
+                if errors.As(err.Interface().(error), &objErr) {
+                    return objErr
+                }
+                return &object.Error{Kind: object.THROWN_ERROR, Message: err.Interface().(error).Error()}
+            }
+            out = out[:len(out)-1]
+        }
+        if len(out) == 0 {
+            return evaluator.NULL
+        }
+
+        result, err := toObject(out[0])
+        if err != nil {
+            return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("result of %s: %s", name, err)}
+        }
+        return result
+    }
+    builtin.Fn = func(args ...object.Object) object.Object {
+        return builtin.FnApply(evaluator.Apply, args...)
+    }
+    return builtin, nil
+}
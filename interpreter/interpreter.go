@@ -0,0 +1,183 @@
+// Package interpreter embeds the language in Go programs. An Interpreter
+// compiles and runs source in its own global environment, which the host can
+// extend with Go functions and values:
+//
+//     in := interpreter.New()
+//     in.Register("double", func(n int) int { return n * 2 })
+//     in.Set("name", "world")
+//     result, err := in.Eval(`double(len(name))`)
+//
+// Go values are converted to objects and back automatically, see ToObject
+// and Convert.
+package interpreter
+
+import (
+	"context"
+	"interpreter/ast"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"interpreter/types"
+	"strings"
+)
+
+// Interpreter runs programs in a global environment that is kept between
+// runs, so later programs see the bindings of earlier ones.
+type Interpreter struct {
+    env      *object.Environment
+    macroEnv *object.Environment
+    options  evaluator.Options
+}
+
+// New returns an interpreter whose programs import files relative to the
+// working directory.
+func New() *Interpreter {
+    return &Interpreter{
+        env:      object.NewEnvironment(),
+        macroEnv: object.NewEnvironment(),
+        options:  evaluator.Options{Modules: evaluator.NewModuleLoader("")},
+    }
+}
+
+// Program is compiled source, ready to run.
+type Program struct {
+    program *ast.Program
+}
+
+func (p *Program) String() string {
+    return p.program.String()
+}
+
+// CompileError holds the parse, macro or type errors that stopped source
+// from compiling.
+type CompileError struct {
+    Errors []error
+}
+
+func (e *CompileError) Error() string {
+    messages := []string{}
+    for _, err := range e.Errors {
+        messages = append(messages, err.Error())
+    }
+    return strings.Join(messages, "\n")
+}
+
+// Compile parses source, expands its macros and checks its types. Names
+// bound by Register, Set and earlier programs are checked as any. Macros it
+// defines can be used by the programs compiled after it.
+func (in *Interpreter) Compile(source string) (*Program, error) {
+    return in.CompileContext(context.Background(), source)
+}
+
+// CompileContext is Compile, stopping the macros with a LimitError when ctx
+// is done. Macros run within the limits set by SetLimits, and stop after
+// evaluator.DefaultMaxMacroSteps when no step limit is set.
+func (in *Interpreter) CompileContext(ctx context.Context, source string) (*Program, error) {
+    p := parser.New(lexer.New(source))
+    program := p.ParseProgram()
+    if len(p.Errors()) != 0 {
+        errs := []error{}
+        for _, err := range p.Errors() {
+            errs = append(errs, err)
+        }
+        return nil, &CompileError{Errors: errs}
+    }
+
+    evaluator.DefineMacros(program, in.macroEnv)
+    expanded, errObj := evaluator.ExpandMacrosContext(ctx, program, in.macroEnv, in.options)
+    if errObj != nil {
+        return nil, &CompileError{Errors: []error{errObj}}
+    }
+    program = expanded.(*ast.Program)
+
+    if typeErrors := types.Check(program, in.env.Names()...); len(typeErrors) != 0 {
+        errs := []error{}
+        for _, err := range typeErrors {
+            errs = append(errs, err)
+        }
+        return nil, &CompileError{Errors: errs}
+    }
+    return &Program{program: program}, nil
+}
+
+// SetLimits bounds the work of the programs run after it.
+func (in *Interpreter) SetLimits(limits evaluator.Limits) {
+    in.options.Limits = limits
+}
+
+// SetOverflow sets what integer arithmetic does on overflow in the programs
+// run after it. It wraps around by default.
+func (in *Interpreter) SetOverflow(policy evaluator.OverflowPolicy) {
+    in.options.Overflow = policy
+}
+
+// SetModuleDir makes the programs run after it import files relative to dir.
+// The modules imported so far are loaded again when they are imported.
+func (in *Interpreter) SetModuleDir(dir string) {
+    in.options.Modules = evaluator.NewModuleLoaderIn(dir)
+}
+
+// Run runs a compiled program and returns the value of its last statement.
+// A runtime error is returned as an *object.Error.
+func (in *Interpreter) Run(program *Program) (object.Object, error) {
+    return in.RunContext(context.Background(), program)
+}
+
+// RunContext is Run, stopping the program with a LimitError when ctx is
+// done.
+func (in *Interpreter) RunContext(ctx context.Context, program *Program) (object.Object, error) {
+    result := evaluator.EvalOptions(ctx, program.program, in.env, in.options)
+    if err, ok := result.(*object.Error); ok {
+        return nil, err
+    }
+    if result == nil {
+        return evaluator.NULL, nil
+    }
+    return result, nil
+}
+
+// Eval compiles and runs source.
+func (in *Interpreter) Eval(source string) (object.Object, error) {
+    return in.EvalContext(context.Background(), source)
+}
+
+// EvalContext compiles and runs source, stopping it when ctx is done.
+func (in *Interpreter) EvalContext(ctx context.Context, source string) (object.Object, error) {
+    program, err := in.CompileContext(ctx, source)
+    if err != nil {
+        return nil, err
+    }
+    return in.RunContext(ctx, program)
+}
+
+// Register makes a Go function callable from programs under name. fn can be
+// an object.BuiltinFunction, which gets the arguments as they are, or any
+// other function, whose arguments and results are converted like Convert and
+// ToObject do. Such a function may return an error as its last result, which
+// is thrown in the program. Functions it is passed run within the context and
+// limits of the evaluation that called it.
+func (in *Interpreter) Register(name string, fn interface{}) error {
+    builtin, err := wrapFunction(name, fn)
+    if err != nil {
+        return err
+    }
+    in.env.Set(name, builtin)
+    return nil
+}
+
+// Set binds name to a Go value, converted with ToObject.
+func (in *Interpreter) Set(name string, value interface{}) error {
+    obj, err := ToObject(value)
+    if err != nil {
+        return err
+    }
+    in.env.Set(name, obj)
+    return nil
+}
+
+// Get returns the global bound to name. Use Convert or FromObject to turn it
+// into a Go value.
+func (in *Interpreter) Get(name string) (object.Object, bool) {
+    return in.env.Get(name)
+}
@@ -0,0 +1,574 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"interpreter/evaluator"
+	"fmt"
+	"interpreter/object"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEval(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"1 + 2", "3"},
+        {`let s = "a" + "b"; s`, "ab"},
+        {"[1, 2, 3]", "[1, 2, 3]"},
+        {"let x = 5;", "null"},
+        {"", "null"},
+    }
+
+    for _, tt := range tests {
+        result, err := New().Eval(tt.input)
+        if err != nil {
+            t.Errorf("%q: unexpected error: %s", tt.input, err)
+            continue
+        }
+        if result.Inspect() != tt.expected {
+            t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+        }
+    }
+}
+
+func TestStateIsKept(t *testing.T) {
+    in := New()
+    for _, input := range []string{
+        "let x = 1;",
+        "let add = fn(a, b) { a + b };",
+        "let m = macro(a) { quote(unquote(a) * 10) };",
+    } {
+        if _, err := in.Eval(input); err != nil {
+            t.Fatalf("%q: unexpected error: %s", input, err)
+        }
+    }
+
+    result, err := in.Eval("x = add(x, m(2)); x")
+    if err != nil {
+        t.Fatalf("unexpected error: %s", err)
+    }
+    if result.Inspect() != "21" {
+        t.Errorf("wrong result. expected=%q, got=%q", "21", result.Inspect())
+    }
+
+    x, ok := in.Get("x")
+    if !ok || x.Inspect() != "21" {
+        t.Errorf("wrong global x. got=%v (%t)", x, ok)
+    }
+    if _, ok := in.Get("missing"); ok {
+        t.Errorf("Get found a missing global")
+    }
+}
+
+func TestCompileErrors(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"let = 1;", "1:5: Next token should be IDENT but got ="},
+        {"let x: int = \"a\";", "1:14: cannot use string as int in let x"},
+    }
+
+    for _, tt := range tests {
+        _, err := New().Eval(tt.input)
+        var compileError *CompileError
+        if !errors.As(err, &compileError) {
+            t.Errorf("%q: expected a *CompileError, got=%T (%v)", tt.input, err, err)
+            continue
+        }
+        if !strings.HasPrefix(err.Error(), tt.expected) {
+            t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected, err.Error())
+        }
+    }
+}
+
+func TestCompileWithHostBindings(t *testing.T) {
+    in := New()
+    if err := in.Register("first", func(s string) string { return s[:1] }); err != nil {
+        t.Fatal(err)
+    }
+    if err := in.Set("len", 3); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := in.Eval("let push = fn(x) { x };"); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {`first("abc")`, "a"},
+        {"len + 1", "4"},
+        {"push(1)", "1"},
+    }
+
+    for _, tt := range tests {
+        result, err := in.Eval(tt.input)
+        if err != nil {
+            t.Errorf("%q: unexpected error: %s", tt.input, err)
+            continue
+        }
+        got := result.Inspect()
+        if s, ok := result.(*object.String); ok {
+            got = s.Value
+        }
+        if got != tt.expected {
+            t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, got)
+        }
+    }
+}
+
+func TestRuntimeErrors(t *testing.T) {
+    in := New()
+    program, err := in.Compile(`throw "boom"`)
+    if err != nil {
+        t.Fatalf("unexpected compile error: %s", err)
+    }
+
+    _, err = in.Run(program)
+    var errObj *object.Error
+    if !errors.As(err, &errObj) {
+        t.Fatalf("expected an *object.Error, got=%T (%v)", err, err)
+    }
+    if errObj.Kind != object.THROWN_ERROR || errObj.Message != "boom" {
+        t.Errorf("wrong error. got=%s: %s", errObj.Kind, errObj.Message)
+    }
+}
+
+func TestLimits(t *testing.T) {
+    in := New()
+    in.SetLimits(evaluator.Limits{MaxSteps: 100})
+    if _, err := in.Eval("let n = 1 + 2;"); err != nil {
+        t.Fatalf("unexpected error: %s", err)
+    }
+
+    _, err := in.Eval("while (true) { }")
+    var errObj *object.Error
+    if !errors.As(err, &errObj) || errObj.Kind != object.LIMIT_ERROR {
+        t.Errorf("expected a LimitError, got=%v", err)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    in.SetLimits(evaluator.Limits{})
+    if _, err := in.EvalContext(ctx, "n"); err == nil || err.Error() != "evaluation stopped: context canceled" {
+        t.Errorf("wrong error for a cancelled context. got=%v", err)
+    }
+}
+
+func TestLimitsInMacros(t *testing.T) {
+    looping := "let m = macro() { while (true) { } }; m()"
+
+    in := New()
+    _, err := in.Compile(looping)
+    if err == nil || err.Error() != "step limit of 1000000 exceeded" {
+        t.Errorf("expected the default macro step limit to be exceeded, got=%v", err)
+    }
+
+    in.SetLimits(evaluator.Limits{MaxSteps: 1000})
+    _, err = in.Compile(looping)
+    if err == nil || err.Error() != "step limit of 1000 exceeded" {
+        t.Errorf("expected the step limit to be exceeded, got=%v", err)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    in.SetLimits(evaluator.Limits{})
+    if _, err := in.EvalContext(ctx, looping); err == nil || err.Error() != "evaluation stopped: context canceled" {
+        t.Errorf("wrong error for a cancelled context. got=%v", err)
+    }
+}
+
+func TestLimitsInCallbacks(t *testing.T) {
+    in := New()
+    if err := in.Register("call", func(f func() error) error { return f() }); err != nil {
+        t.Fatal(err)
+    }
+    if err := in.Register("apply", func(f func(int) int, x int) int { return f(x) }); err != nil {
+        t.Fatal(err)
+    }
+    in.SetLimits(evaluator.Limits{MaxSteps: 1000})
+
+    for _, input := range []string{
+        "call(fn() { while (true) { } })",
+        "apply(fn(x) { while (true) { } }, 1)",
+        "try { call(fn() { while (true) { } }) } catch (e) { 1 }",
+    } {
+        _, err := in.Eval(input)
+        var errObj *object.Error
+        if !errors.As(err, &errObj) || errObj.Kind != object.LIMIT_ERROR || errObj.Message != "step limit of 1000 exceeded" {
+            t.Errorf("%q: expected the step limit to be exceeded, got=%v", input, err)
+        }
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+    defer cancel()
+    in.SetLimits(evaluator.Limits{})
+    if _, err := in.EvalContext(ctx, "call(fn() { while (true) { } })"); err == nil || err.Error() != "evaluation stopped: context deadline exceeded" {
+        t.Errorf("wrong error for an expired context. got=%v", err)
+    }
+}
+
+func TestSettingsArePerInterpreter(t *testing.T) {
+    dirs := []string{t.TempDir(), t.TempDir()}
+    for i, dir := range dirs {
+        source := fmt.Sprintf("export let n = %d;", i)
+        if err := os.WriteFile(filepath.Join(dir, "lib.mk"), []byte(source), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    policies := []evaluator.OverflowPolicy{evaluator.OverflowWrap, evaluator.OverflowPromote}
+    expected := []string{"-9223372036854775808", "9223372036854775809"}
+
+    var wg sync.WaitGroup
+    for i := range dirs {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            in := New()
+            in.SetModuleDir(dirs[i])
+            in.SetOverflow(policies[i])
+            if _, err := in.Eval(`import "lib.mk" as lib;`); err != nil {
+                t.Errorf("%d: unexpected error: %s", i, err)
+                return
+            }
+            for j := 0; j < 50; j++ {
+                result, err := in.Eval("9223372036854775807 + lib.n + 1")
+                if err != nil {
+                    t.Errorf("%d: unexpected error: %s", i, err)
+                    return
+                }
+                if result.Inspect() != expected[i] {
+                    t.Errorf("%d: wrong result. expected=%q, got=%q", i, expected[i], result.Inspect())
+                    return
+                }
+            }
+        }(i)
+    }
+    wg.Wait()
+}
+
+func TestRegister(t *testing.T) {
+    in := New()
+    register := func(name string, fn interface{}) {
+        if err := in.Register(name, fn); err != nil {
+            t.Fatalf("Register(%q): %s", name, err)
+        }
+    }
+    register("double", func(n int) int { return n * 2 })
+    register("join", func(sep string, parts ...string) string { return strings.Join(parts, sep) })
+    register("sum", func(xs []float64) float64 {
+        total := 0.0
+        for _, x := range xs {
+            total += x
+        }
+        return total
+    })
+    register("keys", func(h map[string]int) int { return len(h) })
+    register("check", func(ok bool) error {
+        if !ok {
+            return errors.New("check failed")
+        }
+        return nil
+    })
+    register("divide", func(a, b int) (int, error) {
+        if b == 0 {
+            return 0, errors.New("division by zero")
+        }
+        return a / b, nil
+    })
+    register("count", object.BuiltinFunction(func(args ...object.Object) object.Object {
+        return &object.Integer{Value: int64(len(args))}
+    }))
+    register("nothing", func() {})
+    register("twice", func(f func(int) int, x int) int { return f(f(x)) })
+
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"double(21)", "42"},
+        {`join("-", "a", "b", "c")`, "a-b-c"},
+        {`join(",")`, ""},
+        {"sum([1, 2.5])", "3.5"},
+        {`keys({"a": 1, "b": 2})`, "2"},
+        {"check(true)", "null"},
+        {"divide(7, 2)", "3"},
+        {"count(1, true, [])", "3"},
+        {"nothing()", "null"},
+        {"twice(fn(x) { x * 3 }, 2)", "18"},
+        {`try { divide(1, 0) } catch (e) { e.message }`, "division by zero"},
+        {"check(false)", "ERROR: check failed"},
+        {"double(1, 2)", "ERROR: wrong number of arguments. got=2, want=1"},
+        {`double("a")`, "ERROR: argument 1 to double: cannot convert STRING to int"},
+        {"join()", "ERROR: wrong number of arguments. got=0, want=at least 1"},
+    }
+
+    for _, tt := range tests {
+        result, err := in.Eval(tt.input)
+        got := ""
+        if err != nil {
+            got = "ERROR: " + err.Error()
+        } else if s, ok := result.(*object.String); ok {
+            got = s.Value
+        } else {
+            got = result.Inspect()
+        }
+        if got != tt.expected {
+            t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, got)
+        }
+    }
+}
+
+func TestRegisterErrors(t *testing.T) {
+    tests := []struct{
+        fn       interface{}
+        expected string
+    }{
+        {42, "f is not a function: int"},
+        {func() (int, int) { return 1, 2 }, "f must return at most a value and an error"},
+        {func() (int, string, error) { return 1, "", nil }, "f must return at most a value and an error"},
+    }
+
+    for _, tt := range tests {
+        err := New().Register("f", tt.fn)
+        if err == nil || err.Error() != tt.expected {
+            t.Errorf("%T: wrong error. expected=%q, got=%v", tt.fn, tt.expected, err)
+        }
+    }
+}
+
+func TestSet(t *testing.T) {
+    in := New()
+    values := map[string]interface{}{
+        "n":    7,
+        "f":    1.5,
+        "s":    "go",
+        "b":    true,
+        "none": nil,
+        "xs":   []int{1, 2, 3},
+        "h":    map[string]interface{}{"a": 1, "b": []string{"x"}},
+        "p":    new(int),
+    }
+    for name, value := range values {
+        if err := in.Set(name, value); err != nil {
+            t.Fatalf("Set(%q): %s", name, err)
+        }
+    }
+
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"n * 2", "14"},
+        {"f + 1", "2.5"},
+        {"len(s)", "2"},
+        {"!b", "false"},
+        {"none", "null"},
+        {"push(xs, 4)", "[1, 2, 3, 4]"},
+        {"h.b[0]", "x"},
+        {"p", "0"},
+    }
+
+    for _, tt := range tests {
+        result, err := in.Eval(tt.input)
+        if err != nil {
+            t.Errorf("%q: unexpected error: %s", tt.input, err)
+            continue
+        }
+        if result.Inspect() != tt.expected {
+            t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+        }
+    }
+
+    if err := in.Set("c", make(chan int)); err == nil || err.Error() != "cannot convert chan int to an object" {
+        t.Errorf("wrong error for a channel. got=%v", err)
+    }
+    if err := in.Set("k", map[bool][]int{true: nil}); err != nil {
+        t.Errorf("unexpected error for a hash with bool keys: %s", err)
+    }
+    if err := in.Set("k", map[[1]int]int{{1}: 1}); err == nil || err.Error() != "unusable as hash key: ARRAY" {
+        t.Errorf("wrong error for an array key. got=%v", err)
+    }
+}
+
+func TestToObject(t *testing.T) {
+    tests := []struct{
+        value    interface{}
+        expected string
+    }{
+        {int8(-3), "-3"},
+        {uint64(math.MaxUint64), "18446744073709551615"},
+        {float32(0.5), "0.5"},
+        {[2]bool{true, false}, "[true, false]"},
+        {[]interface{}{1, "a", nil}, "[1, a, null]"},
+        {map[int]string{1: "one"}, "{1: one}"},
+        {&object.Integer{Value: 3}, "3"},
+    }
+
+    for _, tt := range tests {
+        obj, err := ToObject(tt.value)
+        if err != nil {
+            t.Errorf("%#v: unexpected error: %s", tt.value, err)
+            continue
+        }
+        if obj.Inspect() != tt.expected {
+            t.Errorf("%#v: wrong object. expected=%q, got=%q", tt.value, tt.expected, obj.Inspect())
+        }
+    }
+}
+
+func TestFromObject(t *testing.T) {
+    in := New()
+    tests := []struct{
+        input    string
+        expected interface{}
+    }{
+        {"1", int64(1)},
+        {"2.5", 2.5},
+        {`"a"`, "a"},
+        {"true", true},
+        {"if (false) { 1 }", nil},
+        {`[1, "a", [false]]`, []interface{}{int64(1), "a", []interface{}{false}}},
+        {`{"a": 1, 2: [3]}`, map[interface{}]interface{}{"a": int64(1), int64(2): []interface{}{int64(3)}}},
+    }
+
+    for _, tt := range tests {
+        result, err := in.Eval(tt.input)
+        if err != nil {
+            t.Fatalf("%q: unexpected error: %s", tt.input, err)
+        }
+        if got := FromObject(result); !reflect.DeepEqual(got, tt.expected) {
+            t.Errorf("%q: wrong value. expected=%#v, got=%#v", tt.input, tt.expected, got)
+        }
+    }
+
+    result, err := in.Eval("fn(a, b) { if (b == 0) { throw \"zero\"; } a / b }")
+    if err != nil {
+        t.Fatalf("unexpected error: %s", err)
+    }
+    divide, ok := FromObject(result).(func(...interface{}) (interface{}, error))
+    if !ok {
+        t.Fatalf("function converted to %T", FromObject(result))
+    }
+    if got, err := divide(6, 3); err != nil || got != int64(2) {
+        t.Errorf("divide(6, 3) wrong. got=%v, %v", got, err)
+    }
+    if _, err := divide(6, 0); err == nil || err.Error() != "zero" {
+        t.Errorf("divide(6, 0) wrong error. got=%v", err)
+    }
+}
+
+func TestConvert(t *testing.T) {
+    in := New()
+    eval := func(input string) object.Object {
+        result, err := in.Eval(input)
+        if err != nil {
+            t.Fatalf("%q: unexpected error: %s", input, err)
+        }
+        return result
+    }
+
+    var n int
+    var u8 uint8
+    var f float64
+    var s string
+    var xs []int
+    var h map[string][]bool
+    var any interface{}
+    var obj object.Object
+
+    tests := []struct{
+        input    string
+        target   interface{}
+        expected interface{}
+    }{
+        {"42", &n, 42},
+        {"255", &u8, uint8(255)},
+        {"3", &f, 3.0},
+        {"1.5", &f, 1.5},
+        {`"a" + "b"`, &s, "ab"},
+        {"[1, 2]", &xs, []int{1, 2}},
+        {"if (false) { 1 }", &xs, []int(nil)},
+        {`{"a": [true]}`, &h, map[string][]bool{"a": {true}}},
+        {"[1]", &any, []interface{}{int64(1)}},
+        {"if (false) { 1 }", &any, nil},
+    }
+
+    for _, tt := range tests {
+        if err := Convert(eval(tt.input), tt.target); err != nil {
+            t.Errorf("%q: unexpected error: %s", tt.input, err)
+            continue
+        }
+        if got := reflect.ValueOf(tt.target).Elem().Interface(); !reflect.DeepEqual(got, tt.expected) {
+            t.Errorf("%q: wrong value. expected=%#v, got=%#v", tt.input, tt.expected, got)
+        }
+    }
+
+    if err := Convert(eval("[1]"), &obj); err != nil || obj.Inspect() != "[1]" {
+        t.Errorf("conversion to object.Object wrong. got=%v, %v", obj, err)
+    }
+
+    failures := []struct{
+        input    string
+        target   interface{}
+        expected string
+    }{
+        {"256", &u8, "cannot convert INTEGER to uint8"},
+        {"-1", &u8, "cannot convert INTEGER to uint8"},
+        {`"a"`, &n, "cannot convert STRING to int"},
+        {`[1, "a"]`, &xs, "cannot convert STRING to int"},
+        {"1", n, "target must be a non-nil pointer, got int"},
+    }
+
+    for _, tt := range failures {
+        err := Convert(eval(tt.input), tt.target)
+        if err == nil || err.Error() != tt.expected {
+            t.Errorf("%q: wrong error. expected=%q, got=%v", tt.input, tt.expected, err)
+        }
+    }
+}
+
+func TestConvertFunction(t *testing.T) {
+    in := New()
+    fn, err := in.Eval(`fn(name, times) { if (times < 0) { throw "negative"; } let s = ""; while (times > 0) { s += name; times -= 1; } s }`)
+    if err != nil {
+        t.Fatalf("unexpected error: %s", err)
+    }
+
+    var repeat func(string, int) (string, error)
+    if err := Convert(fn, &repeat); err != nil {
+        t.Fatalf("unexpected error: %s", err)
+    }
+    if got, err := repeat("ab", 2); err != nil || got != "abab" {
+        t.Errorf("repeat(\"ab\", 2) wrong. got=%q, %v", got, err)
+    }
+    if _, err := repeat("ab", -1); err == nil || err.Error() != "negative" {
+        t.Errorf("repeat(\"ab\", -1) wrong error. got=%v", err)
+    }
+
+    var mustRepeat func(string, int) string
+    if err := Convert(fn, &mustRepeat); err != nil {
+        t.Fatalf("unexpected error: %s", err)
+    }
+    if got := mustRepeat("x", 3); got != "xxx" {
+        t.Errorf("mustRepeat(\"x\", 3) wrong. got=%q", got)
+    }
+    defer func() {
+        if r := recover(); r == nil || fmt.Sprint(r) != "negative" {
+            t.Errorf("mustRepeat(\"x\", -1) wrong panic. got=%v", r)
+        }
+    }()
+    mustRepeat("x", -1)
+}
@@ -2,29 +2,69 @@ package lexer
 
 import (
 	"interpreter/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+// Lexer reads UTF-8 source. Positions count lines and columns in
+// characters, offsets in bytes.
 type Lexer struct {
     input         string
     position      int
     readPosition  int
-    character     byte
+    character     rune
+
+    line          int
+    column        int
+
+    keepComments  bool
 }
 
 func New(input string) *Lexer {
-    lexer := &Lexer{input: input}
+    lexer := &Lexer{input: input, line: 1}
     lexer.readChar()
     return lexer
 }
 
+// NewWithComments returns a lexer that emits comments as COMMENT tokens
+// instead of skipping them, for tools that need to keep them around.
+func NewWithComments(input string) *Lexer {
+    lexer := New(input)
+    lexer.keepComments = true
+    return lexer
+}
+
 func (lexer *Lexer) readChar() {
+    if lexer.character == '\n' {
+        lexer.line += 1
+        lexer.column = 0
+    }
+
+    width := 1
     if lexer.readPosition >= len(lexer.input) {
         lexer.character = 0
     } else {
-        lexer.character = lexer.input[lexer.readPosition]
+        lexer.character, width = utf8.DecodeRuneInString(lexer.input[lexer.readPosition:])
     }
     lexer.position = lexer.readPosition
-    lexer.readPosition += 1
+    lexer.readPosition += width
+    lexer.column += 1
+}
+
+// invalid tells whether the current character is a byte that is not valid
+// UTF-8.
+func (lexer *Lexer) invalid() bool {
+    return lexer.character == utf8.RuneError && lexer.readPosition - lexer.position == 1
+}
+
+func (lexer *Lexer) currentPosition() token.Position {
+    return token.Position{
+        Line:   lexer.line,
+        Column: lexer.column,
+        Offset: lexer.position,
+    }
 }
 
 func (lexer *Lexer) NextToken() token.Token {
@@ -32,6 +72,19 @@ func (lexer *Lexer) NextToken() token.Token {
 
     lexer.skipWhiteSpaces()
 
+    start := lexer.currentPosition()
+
+    for lexer.character == '/' && (lexer.peekChar() == '/' || lexer.peekChar() == '*') {
+        comment, ok := lexer.readComment()
+        if ok && !lexer.keepComments {
+            lexer.skipWhiteSpaces()
+            start = lexer.currentPosition()
+            continue
+        }
+        comment.Pos, comment.End = start, lexer.currentPosition()
+        return comment
+    }
+
     switch lexer.character {
     case ';':
         tok = newToken(token.SEMICOLON, lexer.character)
@@ -60,13 +113,15 @@ func (lexer *Lexer) NextToken() token.Token {
             tok = newToken(token.ASSIGN, lexer.character)
         }
     case '+':
-        tok = newToken(token.PLUS, lexer.character)
+        tok = lexer.readOperator(token.PLUS, token.PLUS_ASSIGN)
     case '-':
-        tok = newToken(token.MINUS, lexer.character)
+        tok = lexer.readOperator(token.MINUS, token.MINUS_ASSIGN)
     case '/':
-        tok = newToken(token.SLASH, lexer.character)
+        tok = lexer.readOperator(token.SLASH, token.SLASH_ASSIGN)
     case '*':
-        tok = newToken(token.ASTERISK, lexer.character)
+        tok = lexer.readOperator(token.ASTERISK, token.ASTERISK_ASSIGN)
+    case '%':
+        tok = lexer.readOperator(token.PERCENT, token.PERCENT_ASSIGN)
     case '(':
         tok = newToken(token.LPAREN, lexer.character)
     case ')':
@@ -76,45 +131,96 @@ func (lexer *Lexer) NextToken() token.Token {
     case '}':
         tok = newToken(token.RBRACE, lexer.character)
     case '>':
-        tok = newToken(token.GT, lexer.character)
+        if lexer.peekChar() == '=' {
+            lexer.readChar()
+            tok = token.Token{Type: token.GT_EQ, Literal: ">="}
+        } else {
+            tok = newToken(token.GT, lexer.character)
+        }
     case '<':
-        tok = newToken(token.LT, lexer.character)
+        if lexer.peekChar() == '=' {
+            lexer.readChar()
+            tok = token.Token{Type: token.LT_EQ, Literal: "<="}
+        } else {
+            tok = newToken(token.LT, lexer.character)
+        }
+    case '&':
+        if lexer.peekChar() == '&' {
+            lexer.readChar()
+            tok = token.Token{Type: token.AND, Literal: "&&"}
+        } else {
+            tok = newToken(token.ILLEGAL, lexer.character)
+        }
+    case '|':
+        if lexer.peekChar() == '|' {
+            lexer.readChar()
+            tok = token.Token{Type: token.OR, Literal: "||"}
+        } else {
+            tok = newToken(token.ILLEGAL, lexer.character)
+        }
     case '"':
-        tok.Type = token.STRING
-        tok.Literal = lexer.readString()
+        return lexer.readString()
     case '[':
         tok = newToken(token.LBRACKET, lexer.character)
     case ']':
         tok = newToken(token.RBRACKET, lexer.character)
     case ':':
         tok = newToken(token.COLON, lexer.character)
+    case '.':
+        if lexer.peekChar() == '.' && lexer.peekCharAt(2) == '.' {
+            lexer.readChar()
+            lexer.readChar()
+            tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+        } else if isDigit(lexer.peekChar()) {
+            tok.Type, tok.Literal = lexer.readNumber()
+            tok.Pos, tok.End = start, lexer.currentPosition()
+            return tok
+        } else {
+            tok = newToken(token.DOT, lexer.character)
+        }
     case 0:
         tok.Literal = ""
         tok.Type = token.EOF
     default:
-        if isLetter(lexer.character) {
+        if lexer.invalid() {
+            tok = token.Token{Type: token.ILLEGAL, Literal: lexer.input[lexer.position:lexer.readPosition]}
+        } else if isLetter(lexer.character) {
             tok.Literal = lexer.readIdentifier()
             tok.Type = token.LookupIdent(tok.Literal)
+            tok.Pos, tok.End = start, lexer.currentPosition()
             return tok
         } else if isDigit(lexer.character) {
-            tok.Type = token.INT
-            tok.Literal = lexer.readNumber()
+            tok.Type, tok.Literal = lexer.readNumber()
+            tok.Pos, tok.End = start, lexer.currentPosition()
             return tok
         }else {
             tok = newToken(token.ILLEGAL, lexer.character)
         }
     }
-    lexer.readChar()
+    if tok.Type != token.EOF {
+        lexer.readChar()
+    }
+    tok.Pos, tok.End = start, lexer.currentPosition()
     return tok
 }
 
-func newToken(tokenType token.TokenType, character byte) token.Token {
+func newToken(tokenType token.TokenType, character rune) token.Token {
     return token.Token{
         Type:     tokenType,
         Literal:  string(character),
     }
 }
 
+// readOperator reads an arithmetic operator, or its compound assignment form
+// when it is followed by =.
+func (lexer *Lexer) readOperator(operator token.TokenType, assignment token.TokenType) token.Token {
+    if lexer.peekChar() != '=' {
+        return newToken(operator, lexer.character)
+    }
+    lexer.readChar()
+    return token.Token{Type: assignment, Literal: string(assignment)}
+}
+
 func (lexer *Lexer) readIdentifier() string {
     position := lexer.position
     for isLetter(lexer.character) {
@@ -123,20 +229,139 @@ func (lexer *Lexer) readIdentifier() string {
     return lexer.input[position:lexer.position]
 }
 
-func (lexer *Lexer) readString() string {
-    position := lexer.position + 1
+// readString reads a string literal up to and including the closing quote.
+// The literal of the token is the value with its escape sequences decoded.
+// An unterminated string or a bad escape sequence is an ERROR token, which
+// for a bad escape starts at the backslash.
+func (lexer *Lexer) readString() token.Token {
+    start := lexer.currentPosition()
+    var value strings.Builder
+    var bad *token.Token
+
     for {
         lexer.readChar()
-        if lexer.character == '"' || lexer.character == 0 {
-            break
+        switch {
+        case lexer.character == 0:
+            return token.Token{Type: token.ERROR, Literal: "unterminated string", Pos: start, End: lexer.currentPosition()}
+        case lexer.character == '"':
+            lexer.readChar()
+            end := lexer.currentPosition()
+            if bad != nil {
+                bad.End = end
+                return *bad
+            }
+            if raw := lexer.input[start.Offset:end.Offset]; !utf8.ValidString(raw) {
+                // the quotes tell the parser that the string is at fault
+                return token.Token{Type: token.ILLEGAL, Literal: raw, Pos: start, End: end}
+            }
+            return token.Token{Type: token.STRING, Literal: value.String(), Pos: start, End: end}
+        case lexer.character == '\\':
+            pos := lexer.currentPosition()
+            decoded, message := lexer.readEscape()
+            if message != "" && bad == nil {
+                bad = &token.Token{Type: token.ERROR, Literal: message, Pos: pos}
+            }
+            value.WriteString(decoded)
+        default:
+            value.WriteString(lexer.input[lexer.position:lexer.readPosition])
         }
     }
-    return lexer.input[position:lexer.position]
 }
 
-func isLetter(character byte) bool {
-    return (('a' <= character && 'z' >= character) ||
-    ('A' <= character && 'Z' >= character) || character == '_')
+// readEscape reads the escape sequence after a backslash: \n, \t, \\, \",
+// \xNN for characters up to \x7f and \u{N...} for any other character. It
+// returns the decoded value, or a message saying what is wrong with the
+// sequence. The lexer is left on the last character of the sequence.
+func (lexer *Lexer) readEscape() (string, string) {
+    switch lexer.peekChar() {
+    case 'n':
+        lexer.readChar()
+        return "\n", ""
+    case 't':
+        lexer.readChar()
+        return "\t", ""
+    case '\\', '"':
+        lexer.readChar()
+        return string(lexer.character), ""
+    case 'x':
+        lexer.readChar()
+        digits := lexer.readHexDigits(2)
+        if len(digits) != 2 {
+            return "", "invalid escape sequence \\x" + digits + ", want two hex digits"
+        }
+        code, _ := strconv.ParseUint(digits, 16, 8)
+        if code > 0x7f {
+            return "", "invalid escape sequence \\x" + digits + ", use \\u{" + digits + "} above \\x7f"
+        }
+        return string(rune(code)), ""
+    case 'u':
+        lexer.readChar()
+        if lexer.peekChar() != '{' {
+            return "", "invalid escape sequence \\u, want \\u{N...} with hex digits"
+        }
+        lexer.readChar()
+        digits := lexer.readHexDigits(6)
+        if digits == "" || lexer.peekChar() != '}' {
+            return "", "invalid escape sequence \\u{" + digits + ", want \\u{N...} with up to 6 hex digits"
+        }
+        lexer.readChar()
+        code, _ := strconv.ParseUint(digits, 16, 32)
+        if !utf8.ValidRune(rune(code)) {
+            return "", "invalid escape sequence \\u{" + digits + "}, not a valid character"
+        }
+        return string(rune(code)), ""
+    case 0:
+        // the string is unterminated, which readString reports
+        return "", ""
+    default:
+        lexer.readChar()
+        return "", "unknown escape sequence \\" + string(lexer.character)
+    }
+}
+
+// readHexDigits reads up to max hex digits following the current character.
+func (lexer *Lexer) readHexDigits(max int) string {
+    position := lexer.readPosition
+    for i := 0; i < max && isHexDigit(lexer.peekChar()); i++ {
+        lexer.readChar()
+    }
+    return lexer.input[position:lexer.readPosition]
+}
+
+// readComment reads a // comment up to the end of the line or a /* */
+// comment, which may be nested. ok is false for an unterminated block
+// comment, in which case the returned token is an ERROR.
+func (lexer *Lexer) readComment() (tok token.Token, ok bool) {
+    position := lexer.position
+
+    if lexer.peekChar() == '/' {
+        for lexer.character != '\n' && lexer.character != 0 {
+            lexer.readChar()
+        }
+        return token.Token{Type: token.COMMENT, Literal: lexer.input[position:lexer.position]}, true
+    }
+
+    lexer.readChar()
+    lexer.readChar()
+    depth := 1
+    for depth > 0 {
+        switch {
+        case lexer.character == 0:
+            return token.Token{Type: token.ERROR, Literal: "unterminated comment"}, false
+        case lexer.character == '/' && lexer.peekChar() == '*':
+            depth += 1
+            lexer.readChar()
+        case lexer.character == '*' && lexer.peekChar() == '/':
+            depth -= 1
+            lexer.readChar()
+        }
+        lexer.readChar()
+    }
+    return token.Token{Type: token.COMMENT, Literal: lexer.input[position:lexer.position]}, true
+}
+
+func isLetter(character rune) bool {
+    return unicode.IsLetter(character) || character == '_'
 }
 
 func (lexer *Lexer) skipWhiteSpaces() {
@@ -145,22 +370,66 @@ func (lexer *Lexer) skipWhiteSpaces() {
     }
 }
 
-func (lexer *Lexer) readNumber() string {
+// readNumber reads an integer or a float. Floats have a fraction (1.5, .5),
+// an exponent (1e-3) or both.
+func (lexer *Lexer) readNumber() (token.TokenType, string) {
     position := lexer.position
+    tokenType := token.TokenType(token.INT)
+
+    lexer.readDigits()
+
+    if lexer.character == '.' && isDigit(lexer.peekChar()) {
+        tokenType = token.FLOAT
+        lexer.readChar()
+        lexer.readDigits()
+    }
+
+    if lexer.character == 'e' || lexer.character == 'E' {
+        next := lexer.peekChar()
+        if (next == '+' || next == '-') && isDigit(lexer.peekCharAt(2)) {
+            tokenType = token.FLOAT
+            lexer.readChar()
+            lexer.readChar()
+            lexer.readDigits()
+        } else if isDigit(next) {
+            tokenType = token.FLOAT
+            lexer.readChar()
+            lexer.readDigits()
+        }
+    }
+
+    return tokenType, lexer.input[position:lexer.position]
+}
+
+func (lexer *Lexer) readDigits() {
     for isDigit(lexer.character) {
         lexer.readChar()
     }
-    return lexer.input[position:lexer.position]
 }
 
-func isDigit(character byte) bool {
+func isDigit(character rune) bool {
     return '0' <= character && '9' >= character
 }
 
-func (lexer *Lexer) peekChar() byte {
-    if lexer.readPosition >= len(lexer.input) {
+func isHexDigit(character rune) bool {
+    return isDigit(character) || 'a' <= character && 'f' >= character || 'A' <= character && 'F' >= character
+}
+
+func (lexer *Lexer) peekChar() rune {
+    return lexer.peekCharAt(1)
+}
+
+// peekCharAt looks n characters ahead of the current one, peekCharAt(1) is
+// the same as peekChar.
+func (lexer *Lexer) peekCharAt(n int) rune {
+    position := lexer.readPosition
+    for ; n > 1 && position < len(lexer.input); n-- {
+        _, width := utf8.DecodeRuneInString(lexer.input[position:])
+        position += width
+    }
+    if position >= len(lexer.input) {
         return 0
-    } else {
-        return lexer.input[lexer.readPosition]
     }
+    character, _ := utf8.DecodeRuneInString(lexer.input[position:])
+    return character
 }
@@ -14,7 +14,7 @@ func TestNextToken(t *testing.T) {
                  x + y;
             };
             let result = add(five, ten);
-            !-/*5;
+            !-/ *5;
             5 < 10 > 5;
             if (5 < 10) {
                 return true;
@@ -28,6 +28,8 @@ func TestNextToken(t *testing.T) {
             "foo bar"
             [1, 2];
             {"foo": "bar"}
+            a <= b >= c && d || e;
+            x += y -= z *= w /= v %= u;
             `
     tests := []struct {
         expectedType token.TokenType
@@ -119,6 +121,28 @@ func TestNextToken(t *testing.T) {
         {token.COLON, ":"}, 
         {token.STRING, "bar"}, 
         {token.RBRACE, "}"}, 
+        {token.IDENT, "a"},
+        {token.LT_EQ, "<="},
+        {token.IDENT, "b"},
+        {token.GT_EQ, ">="},
+        {token.IDENT, "c"},
+        {token.AND, "&&"},
+        {token.IDENT, "d"},
+        {token.OR, "||"},
+        {token.IDENT, "e"},
+        {token.SEMICOLON, ";"},
+        {token.IDENT, "x"},
+        {token.PLUS_ASSIGN, "+="},
+        {token.IDENT, "y"},
+        {token.MINUS_ASSIGN, "-="},
+        {token.IDENT, "z"},
+        {token.ASTERISK_ASSIGN, "*="},
+        {token.IDENT, "w"},
+        {token.SLASH_ASSIGN, "/="},
+        {token.IDENT, "v"},
+        {token.PERCENT_ASSIGN, "%="},
+        {token.IDENT, "u"},
+        {token.SEMICOLON, ";"},
         {token.EOF, ""},
     }
 
@@ -138,3 +162,264 @@ func TestNextToken(t *testing.T) {
         } 
     }
 }
+
+func TestTokenPositions(t *testing.T) {
+    input := "let x = 5;\n  x == 10;"
+
+    tests := []struct {
+        expectedType token.TokenType
+        expectedPos  token.Position
+        expectedEnd  token.Position
+    }{
+        {token.LET, token.Position{Line: 1, Column: 1, Offset: 0}, token.Position{Line: 1, Column: 4, Offset: 3}},
+        {token.IDENT, token.Position{Line: 1, Column: 5, Offset: 4}, token.Position{Line: 1, Column: 6, Offset: 5}},
+        {token.ASSIGN, token.Position{Line: 1, Column: 7, Offset: 6}, token.Position{Line: 1, Column: 8, Offset: 7}},
+        {token.INT, token.Position{Line: 1, Column: 9, Offset: 8}, token.Position{Line: 1, Column: 10, Offset: 9}},
+        {token.SEMICOLON, token.Position{Line: 1, Column: 10, Offset: 9}, token.Position{Line: 1, Column: 11, Offset: 10}},
+        {token.IDENT, token.Position{Line: 2, Column: 3, Offset: 13}, token.Position{Line: 2, Column: 4, Offset: 14}},
+        {token.EQ, token.Position{Line: 2, Column: 5, Offset: 15}, token.Position{Line: 2, Column: 7, Offset: 17}},
+        {token.INT, token.Position{Line: 2, Column: 8, Offset: 18}, token.Position{Line: 2, Column: 10, Offset: 20}},
+        {token.SEMICOLON, token.Position{Line: 2, Column: 10, Offset: 20}, token.Position{Line: 2, Column: 11, Offset: 21}},
+        {token.EOF, token.Position{Line: 2, Column: 11, Offset: 21}, token.Position{Line: 2, Column: 11, Offset: 21}},
+    }
+
+    lexer := New(input)
+
+    for i, tt := range tests {
+        tok := lexer.NextToken()
+
+        if tok.Type != tt.expectedType {
+            t.Fatalf("test[%d] - token type is incorrect. expected: %q but got: %q", i, tt.expectedType, tok.Type)
+        }
+
+        if tok.Pos != tt.expectedPos {
+            t.Errorf("test[%d] - token position is incorrect. expected: %+v but got: %+v", i, tt.expectedPos, tok.Pos)
+        }
+
+        if tok.End != tt.expectedEnd {
+            t.Errorf("test[%d] - token end is incorrect. expected: %+v but got: %+v", i, tt.expectedEnd, tok.End)
+        }
+    }
+}
+
+func TestNumbers(t *testing.T) {
+    tests := []struct {
+        input           string
+        expectedType    token.TokenType
+        expectedLiteral string
+    }{
+        {"42", token.INT, "42"},
+        {"1.5", token.FLOAT, "1.5"},
+        {".5", token.FLOAT, ".5"},
+        {"1e-3", token.FLOAT, "1e-3"},
+        {"1E+10", token.FLOAT, "1E+10"},
+        {"2.5e3", token.FLOAT, "2.5e3"},
+        {"10e", token.INT, "10"},
+        {"3.", token.INT, "3"},
+        {"...rest", token.ELLIPSIS, "..."},
+        {"..", token.DOT, "."},
+        {".name", token.DOT, "."},
+    }
+
+    for i, tt := range tests {
+        tok := New(tt.input).NextToken()
+
+        if tok.Type != tt.expectedType {
+            t.Errorf("test[%d] - token type is incorrect. expected: %q but got: %q", i, tt.expectedType, tok.Type)
+        }
+
+        if tok.Literal != tt.expectedLiteral {
+            t.Errorf("test[%d] - token literal is incorrect. expected: %q but got: %q", i, tt.expectedLiteral, tok.Literal)
+        }
+    }
+}
+
+func TestComments(t *testing.T) {
+    input := `// leading comment
+let a = 1; // trailing comment
+/* block /* nested */ still comment */ a / 2 * 3;
+`
+
+    skipped := []struct {
+        expectedType    token.TokenType
+        expectedLiteral string
+    }{
+        {token.LET, "let"},
+        {token.IDENT, "a"},
+        {token.ASSIGN, "="},
+        {token.INT, "1"},
+        {token.SEMICOLON, ";"},
+        {token.IDENT, "a"},
+        {token.SLASH, "/"},
+        {token.INT, "2"},
+        {token.ASTERISK, "*"},
+        {token.INT, "3"},
+        {token.SEMICOLON, ";"},
+        {token.EOF, ""},
+    }
+
+    lexer := New(input)
+    for i, tt := range skipped {
+        tok := lexer.NextToken()
+        if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+            t.Fatalf("test[%d] - wrong token. expected: %q %q but got: %q %q",
+                i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+        }
+    }
+
+    kept := []struct {
+        expectedType    token.TokenType
+        expectedLiteral string
+        expectedPos     string
+    }{
+        {token.COMMENT, "// leading comment", "1:1"},
+        {token.LET, "let", "2:1"},
+        {token.IDENT, "a", "2:5"},
+        {token.ASSIGN, "=", "2:7"},
+        {token.INT, "1", "2:9"},
+        {token.SEMICOLON, ";", "2:10"},
+        {token.COMMENT, "// trailing comment", "2:12"},
+        {token.COMMENT, "/* block /* nested */ still comment */", "3:1"},
+        {token.IDENT, "a", "3:40"},
+    }
+
+    lexer = NewWithComments(input)
+    for i, tt := range kept {
+        tok := lexer.NextToken()
+        if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+            t.Fatalf("test[%d] - wrong token. expected: %q %q but got: %q %q",
+                i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+        }
+        if tok.Pos.String() != tt.expectedPos {
+            t.Errorf("test[%d] - wrong position. expected: %s but got: %s", i, tt.expectedPos, tok.Pos)
+        }
+    }
+}
+
+func TestUnterminatedComment(t *testing.T) {
+    inputs := []string{
+        "1 /* never closed",
+        "1 /* outer /* inner */ still open",
+        "1 /*",
+    }
+
+    for _, input := range inputs {
+        lexer := New(input)
+        lexer.NextToken()
+        tok := lexer.NextToken()
+
+        if tok.Type != token.ERROR || tok.Literal != "unterminated comment" {
+            t.Errorf("%q: expected unterminated comment error, got %q %q", input, tok.Type, tok.Literal)
+        }
+        if tok.Pos.String() != "1:3" {
+            t.Errorf("%q: wrong position. expected 1:3, got %s", input, tok.Pos)
+        }
+        if next := lexer.NextToken(); next.Type != token.EOF {
+            t.Errorf("%q: expected EOF after error, got %q", input, next.Type)
+        }
+    }
+}
+
+func TestUnicode(t *testing.T) {
+    input := "let größe = \"日本\"; ñ_x + π\n名前"
+
+    tests := []struct {
+        expectedType    token.TokenType
+        expectedLiteral string
+        expectedPos     token.Position
+    }{
+        {token.LET, "let", token.Position{Line: 1, Column: 1, Offset: 0}},
+        {token.IDENT, "größe", token.Position{Line: 1, Column: 5, Offset: 4}},
+        {token.ASSIGN, "=", token.Position{Line: 1, Column: 11, Offset: 12}},
+        {token.STRING, "日本", token.Position{Line: 1, Column: 13, Offset: 14}},
+        {token.SEMICOLON, ";", token.Position{Line: 1, Column: 17, Offset: 22}},
+        {token.IDENT, "ñ_x", token.Position{Line: 1, Column: 19, Offset: 24}},
+        {token.PLUS, "+", token.Position{Line: 1, Column: 23, Offset: 29}},
+        {token.IDENT, "π", token.Position{Line: 1, Column: 25, Offset: 31}},
+        {token.IDENT, "名前", token.Position{Line: 2, Column: 1, Offset: 34}},
+        {token.EOF, "", token.Position{Line: 2, Column: 3, Offset: 40}},
+    }
+
+    lexer := New(input)
+    for i, tt := range tests {
+        tok := lexer.NextToken()
+        if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+            t.Fatalf("test[%d] - wrong token. expected: %q %q but got: %q %q",
+                i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+        }
+        if tok.Pos != tt.expectedPos {
+            t.Errorf("test[%d] - token position is incorrect. expected: %+v but got: %+v", i, tt.expectedPos, tok.Pos)
+        }
+    }
+}
+
+func TestInvalidUTF8(t *testing.T) {
+    tests := []struct {
+        input           string
+        expectedLiteral string
+        expectedPos     string
+    }{
+        {"a \xff b", "\xff", "1:3"},
+        {"é\xc3", "\xc3", "1:2"},
+        {"x = \"a\xffb\";", "\"a\xffb\"", "1:5"},
+        {"\"\xfe\"", "\"\xfe\"", "1:1"},
+        {"€ @", "€", "1:1"},
+    }
+
+    for _, tt := range tests {
+        lexer := New(tt.input)
+        tok := lexer.NextToken()
+        for tok.Type != token.ILLEGAL && tok.Type != token.EOF {
+            tok = lexer.NextToken()
+        }
+
+        if tok.Type != token.ILLEGAL || tok.Literal != tt.expectedLiteral {
+            t.Errorf("%q: wrong token. expected: ILLEGAL %q but got: %q %q", tt.input, tt.expectedLiteral, tok.Type, tok.Literal)
+        }
+        if tok.Pos.String() != tt.expectedPos {
+            t.Errorf("%q: wrong position. expected: %s but got: %s", tt.input, tt.expectedPos, tok.Pos)
+        }
+    }
+}
+
+func TestStrings(t *testing.T) {
+    tests := []struct {
+        input           string
+        expectedType    token.TokenType
+        expectedLiteral string
+        expectedPos     string
+    }{
+        {`"plain"`, token.STRING, "plain", "1:1"},
+        {`"a\nb\tc"`, token.STRING, "a\nb\tc", "1:1"},
+        {`"say \"hi\" \\o/"`, token.STRING, `say "hi" \o/`, "1:1"},
+        {`"\x41\x7f"`, token.STRING, "A\x7f", "1:1"},
+        {`"\u{e9}\u{65E5}\u{1F600}"`, token.STRING, "é日😀", "1:1"},
+        {"\"two\nlines\"", token.STRING, "two\nlines", "1:1"},
+        {`"never closed`, token.ERROR, "unterminated string", "1:1"},
+        {`"escaped quote\"`, token.ERROR, "unterminated string", "1:1"},
+        {`"trailing \`, token.ERROR, "unterminated string", "1:1"},
+        {`"bad \q"`, token.ERROR, `unknown escape sequence \q`, "1:6"},
+        {`"ab\x4"`, token.ERROR, `invalid escape sequence \x4, want two hex digits`, "1:4"},
+        {`"\xe9"`, token.ERROR, `invalid escape sequence \xe9, use \u{e9} above \x7f`, "1:2"},
+        {`"\u00e9"`, token.ERROR, `invalid escape sequence \u, want \u{N...} with hex digits`, "1:2"},
+        {`"\u{}"`, token.ERROR, `invalid escape sequence \u{, want \u{N...} with up to 6 hex digits`, "1:2"},
+        {`"\u{1234567}"`, token.ERROR, `invalid escape sequence \u{123456, want \u{N...} with up to 6 hex digits`, "1:2"},
+        {`"\u{d800}"`, token.ERROR, `invalid escape sequence \u{d800}, not a valid character`, "1:2"},
+        {`"\q and \z"`, token.ERROR, `unknown escape sequence \q`, "1:2"},
+    }
+
+    for _, tt := range tests {
+        lexer := New(tt.input)
+        tok := lexer.NextToken()
+
+        if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+            t.Errorf("%q: wrong token. expected: %q %q but got: %q %q", tt.input, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+        }
+        if tok.Pos.String() != tt.expectedPos {
+            t.Errorf("%q: wrong position. expected: %s but got: %s", tt.input, tt.expectedPos, tok.Pos)
+        }
+        if next := lexer.NextToken(); next.Type != token.EOF {
+            t.Errorf("%q: expected EOF after the string, got %q %q", tt.input, next.Type, next.Literal)
+        }
+    }
+}
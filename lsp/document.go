@@ -0,0 +1,206 @@
+package lsp
+
+import (
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"math"
+	"sort"
+	"unicode/utf8"
+)
+
+// document is an open text document with its parse results.
+type document struct {
+    uri          string
+    text         string
+    program      *ast.Program
+    errors       []*parser.ParseError
+    lineStarts   []int // offset of the first byte of each line
+    declarations []*declaration
+}
+
+// declaration is a name bound by a let or const statement, a parameter, a
+// loop variable, a catch clause or an import, and the part of the source it
+// is visible in.
+type declaration struct {
+    name       *ast.Identifier
+    kind       string // let, const, parameter, loop variable, error or import
+    node       ast.Node
+    scopeStart int
+    scopeEnd   int
+}
+
+func newDocument(uri, text string) *document {
+    p := parser.New(lexer.New(text))
+    d := &document{
+        uri:        uri,
+        text:       text,
+        program:    p.ParseProgram(),
+        errors:     p.Errors(),
+        lineStarts: []int{0},
+    }
+    for i := 0; i < len(text); i++ {
+        if text[i] == '\n' {
+            d.lineStarts = append(d.lineStarts, i+1)
+        }
+    }
+    d.collect(d.program, 0, math.MaxInt)
+    return d
+}
+
+// collect records the declarations in node, whose own declarations are
+// visible from start to end.
+func (d *document) collect(node ast.Node, start, end int) {
+    ast.Inspect(node, func(n ast.Node) bool {
+        if n == node {
+            return true
+        }
+
+        switch n := n.(type) {
+        case *ast.LetStatement:
+            kind := "let"
+            if n.IsConst() {
+                kind = "const"
+            }
+            d.declare(n.Name, kind, n, start, end)
+        case *ast.ImportStatement:
+            d.declare(n.Name, "import", n, start, end)
+        case *ast.ForStatement:
+            d.declare(n.Variable, "loop variable", n, n.Body.Pos().Offset, n.Body.End().Offset)
+        case *ast.TryExpression:
+            d.declare(n.Parameter, "error", n, n.Catch.Pos().Offset, n.Catch.End().Offset)
+        case *ast.BlockStatement:
+            d.collect(n, n.Pos().Offset, n.End().Offset)
+            return false
+        case *ast.FunctionLiteral:
+            for _, parameter := range n.Parameters {
+                d.declare(parameter, "parameter", n, n.Pos().Offset, n.End().Offset)
+            }
+            if n.Rest != nil {
+                d.declare(n.Rest, "parameter", n, n.Pos().Offset, n.End().Offset)
+            }
+            d.collect(n, n.Pos().Offset, n.End().Offset)
+            return false
+        case *ast.MacroLiteral:
+            for _, parameter := range n.Parameters {
+                d.declare(parameter, "parameter", n, n.Pos().Offset, n.End().Offset)
+            }
+            d.collect(n, n.Pos().Offset, n.End().Offset)
+            return false
+        }
+        return true
+    })
+}
+
+func (d *document) declare(name *ast.Identifier, kind string, node ast.Node, start, end int) {
+    if name == nil {
+        return
+    }
+    d.declarations = append(d.declarations, &declaration{name, kind, node, start, end})
+}
+
+// identifierAt returns the identifier at offset, or nil.
+func (d *document) identifierAt(offset int) *ast.Identifier {
+    var found *ast.Identifier
+    ast.Inspect(d.program, func(n ast.Node) bool {
+        if found != nil {
+            return false
+        }
+        if ident, ok := n.(*ast.Identifier); ok && ident.Pos().Offset <= offset && offset <= ident.End().Offset {
+            found = ident
+        }
+        return true
+    })
+    return found
+}
+
+// lookup finds the declaration an identifier refers to: the one in the
+// innermost scope, preferring the last one before the identifier.
+func (d *document) lookup(ident *ast.Identifier) *declaration {
+    offset := ident.Pos().Offset
+    var best *declaration
+
+    for _, decl := range d.visible(offset) {
+        if decl.name.Value != ident.Value {
+            continue
+        }
+        if decl.name == ident {
+            return decl
+        }
+        if best == nil || decl.scopeStart > best.scopeStart {
+            best = decl
+            continue
+        }
+        if decl.scopeStart < best.scopeStart {
+            continue
+        }
+        // same scope: a declaration before the identifier wins over one
+        // after it, and a later one before it over an earlier one
+        before := decl.name.Pos().Offset < offset
+        bestBefore := best.name.Pos().Offset < offset
+        if before && (!bestBefore || decl.name.Pos().Offset > best.name.Pos().Offset) {
+            best = decl
+        }
+    }
+    return best
+}
+
+// visible returns the declarations whose scope includes offset.
+func (d *document) visible(offset int) []*declaration {
+    var result []*declaration
+    for _, decl := range d.declarations {
+        if decl.scopeStart <= offset && offset < decl.scopeEnd {
+            result = append(result, decl)
+        }
+    }
+    return result
+}
+
+// position converts a byte offset to a protocol position.
+func (d *document) position(offset int) Position {
+    if offset > len(d.text) {
+        offset = len(d.text)
+    }
+    if offset < 0 {
+        offset = 0
+    }
+    line := sort.Search(len(d.lineStarts), func(i int) bool { return d.lineStarts[i] > offset }) - 1
+
+    character := 0
+    for _, r := range d.text[d.lineStarts[line]:offset] {
+        character += utf16Len(r)
+    }
+    return Position{Line: line, Character: character}
+}
+
+// offset converts a protocol position to a byte offset, clamped to the line.
+func (d *document) offset(pos Position) int {
+    if pos.Line < 0 {
+        return 0
+    }
+    if pos.Line >= len(d.lineStarts) {
+        return len(d.text)
+    }
+
+    offset := d.lineStarts[pos.Line]
+    for character := 0; character < pos.Character && offset < len(d.text); {
+        r, size := utf8.DecodeRuneInString(d.text[offset:])
+        if r == '\n' {
+            break
+        }
+        character += utf16Len(r)
+        offset += size
+    }
+    return offset
+}
+
+func (d *document) rangeOf(node ast.Node) Range {
+    return Range{Start: d.position(node.Pos().Offset), End: d.position(node.End().Offset)}
+}
+
+func utf16Len(r rune) int {
+    if r >= 0x10000 {
+        return 2
+    }
+    return 1
+}
@@ -0,0 +1,235 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JSON-RPC error codes used by the server.
+const (
+    ParseErrorCode       = -32700
+    InvalidRequest       = -32600
+    MethodNotFound       = -32601
+    InvalidParams        = -32602
+    InternalError        = -32603
+    ServerNotInitialized = -32002
+)
+
+// Message is a JSON-RPC 2.0 request, notification or response. Requests have
+// an ID and a Method, notifications only a Method and responses only an ID.
+type Message struct {
+    JSONRPC string          `json:"jsonrpc"`
+    ID      json.RawMessage `json:"id,omitempty"`
+    Method  string          `json:"method,omitempty"`
+    Params  json.RawMessage `json:"params,omitempty"`
+    Result  json.RawMessage `json:"result,omitempty"`
+    Error   *ResponseError  `json:"error,omitempty"`
+}
+
+func (m *Message) IsRequest() bool {
+    return m.ID != nil && m.Method != ""
+}
+
+func (m *Message) IsNotification() bool {
+    return m.ID == nil && m.Method != ""
+}
+
+type ResponseError struct {
+    Code    int    `json:"code"`
+    Message string `json:"message"`
+}
+
+func (e *ResponseError) Error() string {
+    return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// Conn reads and writes messages framed with a Content-Length header, as
+// the Language Server Protocol sends them. Writes may come from several
+// goroutines.
+type Conn struct {
+    in  *bufio.Reader
+    out io.Writer
+    mu  sync.Mutex
+}
+
+func NewConn(in io.Reader, out io.Writer) *Conn {
+    return &Conn{in: bufio.NewReader(in), out: out}
+}
+
+// Read returns the next message. It returns io.EOF when the input ends
+// between messages.
+func (c *Conn) Read() (*Message, error) {
+    header, err := textproto.NewReader(c.in).ReadMIMEHeader()
+    if err != nil {
+        if err == io.EOF {
+            return nil, io.EOF
+        }
+        return nil, fmt.Errorf("reading header: %w", err)
+    }
+
+    length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+    if err != nil || length < 0 {
+        return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+    }
+
+    body := make([]byte, length)
+    if _, err := io.ReadFull(c.in, body); err != nil {
+        return nil, fmt.Errorf("reading body: %w", err)
+    }
+
+    var msg Message
+    if err := json.Unmarshal(body, &msg); err != nil {
+        return nil, &ResponseError{Code: ParseErrorCode, Message: err.Error()}
+    }
+    return &msg, nil
+}
+
+// Write sends v, which is marshalled to JSON.
+func (c *Conn) Write(v interface{}) error {
+    body, err := json.Marshal(v)
+    if err != nil {
+        return err
+    }
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if _, err := fmt.Fprintf(c.out, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+        return err
+    }
+    _, err = c.out.Write(body)
+    return err
+}
+
+// response is written instead of Message so that a null result is sent as
+// "result": null, which responses must have.
+type response struct {
+    JSONRPC string          `json:"jsonrpc"`
+    ID      json.RawMessage `json:"id"`
+    Result  interface{}     `json:"result"`
+}
+
+type errorResponse struct {
+    JSONRPC string          `json:"jsonrpc"`
+    ID      json.RawMessage `json:"id"`
+    Error   *ResponseError  `json:"error"`
+}
+
+type outgoing struct {
+    JSONRPC string          `json:"jsonrpc"`
+    ID      json.RawMessage `json:"id,omitempty"`
+    Method  string          `json:"method"`
+    Params  interface{}     `json:"params,omitempty"`
+}
+
+func (c *Conn) Reply(id json.RawMessage, result interface{}) error {
+    return c.Write(&response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (c *Conn) ReplyError(id json.RawMessage, err *ResponseError) error {
+    if id == nil {
+        id = json.RawMessage("null")
+    }
+    return c.Write(&errorResponse{JSONRPC: "2.0", ID: id, Error: err})
+}
+
+func (c *Conn) Notify(method string, params interface{}) error {
+    return c.Write(&outgoing{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// Client is the other end of a Conn, used to drive a server in-process. A
+// goroutine reads the messages: responses go to the pending calls and
+// notifications to Notifications.
+type Client struct {
+    conn          *Conn
+    Notifications chan *Message
+
+    mu      sync.Mutex
+    nextID  int
+    pending map[string]chan *Message
+    err     error
+}
+
+func NewClient(in io.Reader, out io.Writer) *Client {
+    c := &Client{
+        conn:          NewConn(in, out),
+        Notifications: make(chan *Message, 100),
+        pending:       make(map[string]chan *Message),
+    }
+    go c.read()
+    return c
+}
+
+func (c *Client) read() {
+    for {
+        msg, err := c.conn.Read()
+        if err != nil {
+            c.mu.Lock()
+            c.err = err
+            for _, ch := range c.pending {
+                close(ch)
+            }
+            c.pending = map[string]chan *Message{}
+            c.mu.Unlock()
+            close(c.Notifications)
+            return
+        }
+
+        if msg.Method != "" {
+            c.Notifications <- msg
+            continue
+        }
+
+        c.mu.Lock()
+        ch, ok := c.pending[string(msg.ID)]
+        delete(c.pending, string(msg.ID))
+        c.mu.Unlock()
+        if ok {
+            ch <- msg
+        }
+    }
+}
+
+// Call sends a request and waits for its response, whose result is
+// unmarshalled into result unless it is nil. An error response is returned
+// as a *ResponseError.
+func (c *Client) Call(method string, params interface{}, result interface{}) error {
+    c.mu.Lock()
+    if c.err != nil {
+        c.mu.Unlock()
+        return c.err
+    }
+    c.nextID++
+    id := json.RawMessage(strconv.Itoa(c.nextID))
+    ch := make(chan *Message, 1)
+    c.pending[string(id)] = ch
+    c.mu.Unlock()
+
+    if err := c.conn.Write(&outgoing{JSONRPC: "2.0", ID: id, Method: method, Params: params}); err != nil {
+        return err
+    }
+
+    msg, ok := <-ch
+    if !ok {
+        c.mu.Lock()
+        err := c.err
+        c.mu.Unlock()
+        return fmt.Errorf("connection closed: %v", err)
+    }
+    if msg.Error != nil {
+        return msg.Error
+    }
+    if result == nil {
+        return nil
+    }
+    return json.Unmarshal(msg.Result, result)
+}
+
+func (c *Client) Notify(method string, params interface{}) error {
+    return c.conn.Notify(method, params)
+}
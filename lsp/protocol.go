@@ -0,0 +1,159 @@
+package lsp
+
+// The subset of the Language Server Protocol types the server uses. Lines
+// and characters are zero-based, characters count UTF-16 code units.
+
+type Position struct {
+    Line      int `json:"line"`
+    Character int `json:"character"`
+}
+
+type Range struct {
+    Start Position `json:"start"`
+    End   Position `json:"end"`
+}
+
+type Location struct {
+    URI   string `json:"uri"`
+    Range Range  `json:"range"`
+}
+
+type TextDocumentIdentifier struct {
+    URI string `json:"uri"`
+}
+
+type TextDocumentItem struct {
+    URI        string `json:"uri"`
+    LanguageID string `json:"languageId"`
+    Version    int    `json:"version"`
+    Text       string `json:"text"`
+}
+
+type VersionedTextDocumentIdentifier struct {
+    URI     string `json:"uri"`
+    Version int    `json:"version"`
+}
+
+type TextDocumentPositionParams struct {
+    TextDocument TextDocumentIdentifier `json:"textDocument"`
+    Position     Position               `json:"position"`
+}
+
+type InitializeParams struct {
+    ProcessID int    `json:"processId"`
+    RootURI   string `json:"rootUri"`
+}
+
+type InitializeResult struct {
+    Capabilities ServerCapabilities `json:"capabilities"`
+    ServerInfo   ServerInfo         `json:"serverInfo"`
+}
+
+type ServerInfo struct {
+    Name string `json:"name"`
+}
+
+const (
+    SyncNone = 0
+    SyncFull = 1
+)
+
+type ServerCapabilities struct {
+    TextDocumentSync           int                `json:"textDocumentSync"`
+    HoverProvider              bool               `json:"hoverProvider"`
+    DefinitionProvider         bool               `json:"definitionProvider"`
+    DocumentSymbolProvider     bool               `json:"documentSymbolProvider"`
+    CompletionProvider         *CompletionOptions `json:"completionProvider,omitempty"`
+    DocumentFormattingProvider bool               `json:"documentFormattingProvider"`
+}
+
+type CompletionOptions struct {
+    TriggerCharacters []string `json:"triggerCharacters,omitempty"`
+}
+
+type DidOpenTextDocumentParams struct {
+    TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+// TextDocumentContentChangeEvent carries the whole new text, as the server
+// only supports full document sync.
+type TextDocumentContentChangeEvent struct {
+    Text string `json:"text"`
+}
+
+type DidChangeTextDocumentParams struct {
+    TextDocument   VersionedTextDocumentIdentifier  `json:"textDocument"`
+    ContentChanges []TextDocumentContentChangeEvent `json:"contentChanges"`
+}
+
+type DidCloseTextDocumentParams struct {
+    TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+const (
+    SeverityError   = 1
+    SeverityWarning = 2
+)
+
+type Diagnostic struct {
+    Range    Range  `json:"range"`
+    Severity int    `json:"severity"`
+    Source   string `json:"source"`
+    Message  string `json:"message"`
+}
+
+type PublishDiagnosticsParams struct {
+    URI         string       `json:"uri"`
+    Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+type MarkupContent struct {
+    Kind  string `json:"kind"`
+    Value string `json:"value"`
+}
+
+type Hover struct {
+    Contents MarkupContent `json:"contents"`
+    Range    *Range        `json:"range,omitempty"`
+}
+
+type DocumentSymbolParams struct {
+    TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+const (
+    SymbolFunction = 12
+    SymbolVariable = 13
+    SymbolConstant = 14
+    SymbolModule   = 2
+)
+
+type DocumentSymbol struct {
+    Name           string `json:"name"`
+    Detail         string `json:"detail,omitempty"`
+    Kind           int    `json:"kind"`
+    Range          Range  `json:"range"`
+    SelectionRange Range  `json:"selectionRange"`
+}
+
+const (
+    CompletionFunction = 3
+    CompletionVariable = 6
+    CompletionKeyword  = 14
+    CompletionConstant = 21
+)
+
+type CompletionItem struct {
+    Label  string `json:"label"`
+    Kind   int    `json:"kind"`
+    Detail string `json:"detail,omitempty"`
+}
+
+type DocumentFormattingParams struct {
+    TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type TextEdit struct {
+    Range   Range  `json:"range"`
+    NewText string `json:"newText"`
+}
@@ -0,0 +1,360 @@
+// Package lsp implements a Language Server Protocol server for the
+// language: parse errors as diagnostics, hover, go to definition, document
+// symbols, completion and formatting.
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/evaluator"
+	"interpreter/formatter"
+	"interpreter/token"
+	"io"
+	"strings"
+)
+
+// Server answers the requests of one client, over a Conn.
+type Server struct {
+    conn        *Conn
+    documents   map[string]*document
+    initialized bool
+    shutdown    bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+    return &Server{
+        conn:      NewConn(in, out),
+        documents: make(map[string]*document),
+    }
+}
+
+// Serve handles messages until the client sends exit or the input ends. It
+// returns an error when exit was not preceded by shutdown.
+func (s *Server) Serve() error {
+    for {
+        msg, err := s.conn.Read()
+        if err == io.EOF {
+            return nil
+        }
+        if rpcErr, ok := err.(*ResponseError); ok {
+            s.conn.ReplyError(nil, rpcErr)
+            continue
+        }
+        if err != nil {
+            return err
+        }
+
+        if msg.Method == "exit" {
+            if !s.shutdown {
+                return errors.New("exit without shutdown")
+            }
+            return nil
+        }
+
+        result, rpcErr := s.handleSafely(msg)
+        if !msg.IsRequest() {
+            continue
+        }
+        if rpcErr != nil {
+            err = s.conn.ReplyError(msg.ID, rpcErr)
+        } else {
+            err = s.conn.Reply(msg.ID, result)
+        }
+        if err != nil {
+            return err
+        }
+    }
+}
+
+// handleSafely is handle, answering with an internal error instead of ending
+// the server when a request panics.
+func (s *Server) handleSafely(msg *Message) (result interface{}, rpcErr *ResponseError) {
+    defer func() {
+        if r := recover(); r != nil {
+            result, rpcErr = nil, &ResponseError{Code: InternalError, Message: fmt.Sprintf("%s failed: %v", msg.Method, r)}
+        }
+    }()
+    return s.handle(msg)
+}
+
+func (s *Server) handle(msg *Message) (interface{}, *ResponseError) {
+    if !s.initialized && msg.Method != "initialize" {
+        if msg.IsRequest() {
+            return nil, &ResponseError{Code: ServerNotInitialized, Message: "server not initialized"}
+        }
+        return nil, nil
+    }
+
+    switch msg.Method {
+    case "initialize":
+        s.initialized = true
+        return &InitializeResult{
+            Capabilities: ServerCapabilities{
+                TextDocumentSync:           SyncFull,
+                HoverProvider:              true,
+                DefinitionProvider:         true,
+                DocumentSymbolProvider:     true,
+                CompletionProvider:         &CompletionOptions{},
+                DocumentFormattingProvider: true,
+            },
+            ServerInfo: ServerInfo{Name: "interpreter"},
+        }, nil
+    case "initialized":
+        return nil, nil
+    case "shutdown":
+        s.shutdown = true
+        return nil, nil
+    case "textDocument/didOpen":
+        var params DidOpenTextDocumentParams
+        if err := decode(msg.Params, &params); err != nil {
+            return nil, err
+        }
+        s.open(params.TextDocument.URI, params.TextDocument.Text)
+        return nil, nil
+    case "textDocument/didChange":
+        var params DidChangeTextDocumentParams
+        if err := decode(msg.Params, &params); err != nil {
+            return nil, err
+        }
+        if n := len(params.ContentChanges); n > 0 {
+            s.open(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+        }
+        return nil, nil
+    case "textDocument/didClose":
+        var params DidCloseTextDocumentParams
+        if err := decode(msg.Params, &params); err != nil {
+            return nil, err
+        }
+        delete(s.documents, params.TextDocument.URI)
+        s.conn.Notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+        return nil, nil
+    case "textDocument/hover":
+        var params TextDocumentPositionParams
+        if err := decode(msg.Params, &params); err != nil {
+            return nil, err
+        }
+        return s.hover(params), nil
+    case "textDocument/definition":
+        var params TextDocumentPositionParams
+        if err := decode(msg.Params, &params); err != nil {
+            return nil, err
+        }
+        return s.definition(params), nil
+    case "textDocument/documentSymbol":
+        var params DocumentSymbolParams
+        if err := decode(msg.Params, &params); err != nil {
+            return nil, err
+        }
+        return s.documentSymbols(params.TextDocument.URI), nil
+    case "textDocument/completion":
+        var params TextDocumentPositionParams
+        if err := decode(msg.Params, &params); err != nil {
+            return nil, err
+        }
+        return s.completion(params), nil
+    case "textDocument/formatting":
+        var params DocumentFormattingParams
+        if err := decode(msg.Params, &params); err != nil {
+            return nil, err
+        }
+        return s.formatting(params.TextDocument.URI), nil
+    }
+
+    if msg.IsRequest() {
+        return nil, &ResponseError{Code: MethodNotFound, Message: "method not found: " + msg.Method}
+    }
+    return nil, nil
+}
+
+func decode(params json.RawMessage, v interface{}) *ResponseError {
+    if err := json.Unmarshal(params, v); err != nil {
+        return &ResponseError{Code: InvalidParams, Message: err.Error()}
+    }
+    return nil
+}
+
+// open parses the new text of a document and publishes its parse errors.
+func (s *Server) open(uri, text string) {
+    d := newDocument(uri, text)
+    s.documents[uri] = d
+
+    diagnostics := []Diagnostic{}
+    for _, err := range d.errors {
+        pos := d.position(err.Pos.Offset)
+        diagnostics = append(diagnostics, Diagnostic{
+            Range:    Range{Start: pos, End: pos},
+            Severity: SeverityError,
+            Source:   "interpreter",
+            Message:  err.Message,
+        })
+    }
+    s.conn.Notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+func (s *Server) hover(params TextDocumentPositionParams) *Hover {
+    d, ok := s.documents[params.TextDocument.URI]
+    if !ok {
+        return nil
+    }
+    ident := d.identifierAt(d.offset(params.Position))
+    if ident == nil {
+        return nil
+    }
+
+    var value string
+    if decl := d.lookup(ident); decl != nil {
+        value = "```\n" + describe(decl) + "\n```"
+    } else if builtin, ok := evaluator.LookupBuiltin(ident.Value); ok {
+        value = "```\n" + builtin.Signature + "\n```\n" + builtin.Doc
+    } else {
+        return nil
+    }
+
+    r := d.rangeOf(ident)
+    return &Hover{Contents: MarkupContent{Kind: "markdown", Value: value}, Range: &r}
+}
+
+// describe shows a declaration the way it was written.
+func describe(decl *declaration) string {
+    name := decl.name.Value
+    switch node := decl.node.(type) {
+    case *ast.LetStatement:
+        if function, ok := node.Value.(*ast.FunctionLiteral); ok {
+            return decl.kind + " " + name + " = " + signature(function)
+        }
+        return decl.kind + " " + name
+    case *ast.ImportStatement:
+        return "import \"" + node.Path.Value + "\" as " + name
+    }
+    return "(" + decl.kind + ") " + name
+}
+
+func signature(function *ast.FunctionLiteral) string {
+    result := "fn(" + strings.Join(ast.ParametersString(function.Parameters, function.ParameterTypes, function.Defaults, function.Rest), ", ") + ")"
+    if function.ReturnType != nil {
+        result += ": " + function.ReturnType.String()
+    }
+    return result
+}
+
+func (s *Server) definition(params TextDocumentPositionParams) *Location {
+    d, ok := s.documents[params.TextDocument.URI]
+    if !ok {
+        return nil
+    }
+    ident := d.identifierAt(d.offset(params.Position))
+    if ident == nil {
+        return nil
+    }
+    decl := d.lookup(ident)
+    if decl == nil {
+        return nil
+    }
+    return &Location{URI: d.uri, Range: d.rangeOf(decl.name)}
+}
+
+// documentSymbols lists the top-level declarations.
+func (s *Server) documentSymbols(uri string) []DocumentSymbol {
+    d, ok := s.documents[uri]
+    if !ok {
+        return nil
+    }
+
+    symbols := []DocumentSymbol{}
+    for _, statement := range d.program.Statements {
+        if export, ok := statement.(*ast.ExportStatement); ok {
+            statement = export.Statement
+        }
+
+        switch statement := statement.(type) {
+        case *ast.LetStatement:
+            symbol := DocumentSymbol{
+                Name:           statement.Name.Value,
+                Kind:           SymbolVariable,
+                Range:          d.rangeOf(statement),
+                SelectionRange: d.rangeOf(statement.Name),
+            }
+            if statement.IsConst() {
+                symbol.Kind = SymbolConstant
+            }
+            if function, ok := statement.Value.(*ast.FunctionLiteral); ok {
+                symbol.Kind = SymbolFunction
+                symbol.Detail = signature(function)
+            }
+            symbols = append(symbols, symbol)
+        case *ast.ImportStatement:
+            symbols = append(symbols, DocumentSymbol{
+                Name:           statement.Name.Value,
+                Detail:         statement.Path.Value,
+                Kind:           SymbolModule,
+                Range:          d.rangeOf(statement),
+                SelectionRange: d.rangeOf(statement.Name),
+            })
+        }
+    }
+    return symbols
+}
+
+// completion offers the names visible at the position, the builtins and the
+// keywords.
+func (s *Server) completion(params TextDocumentPositionParams) []CompletionItem {
+    d, ok := s.documents[params.TextDocument.URI]
+    if !ok {
+        return nil
+    }
+
+    items := []CompletionItem{}
+    seen := make(map[string]bool)
+    for _, decl := range d.visible(d.offset(params.Position)) {
+        name := decl.name.Value
+        if seen[name] {
+            continue
+        }
+        seen[name] = true
+
+        item := CompletionItem{Label: name, Kind: CompletionVariable, Detail: describe(decl)}
+        if decl.kind == "const" {
+            item.Kind = CompletionConstant
+        }
+        if let, ok := decl.node.(*ast.LetStatement); ok {
+            if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+                item.Kind = CompletionFunction
+            }
+        }
+        items = append(items, item)
+    }
+    for _, name := range evaluator.BuiltinNames {
+        if !seen[name] {
+            builtin, _ := evaluator.LookupBuiltin(name)
+            items = append(items, CompletionItem{Label: name, Kind: CompletionFunction, Detail: builtin.Signature})
+        }
+    }
+    for _, keyword := range token.Keywords() {
+        items = append(items, CompletionItem{Label: keyword, Kind: CompletionKeyword})
+    }
+    return items
+}
+
+// formatting replaces the whole document with its formatted text. Documents
+// that do not parse are left alone.
+func (s *Server) formatting(uri string) []TextEdit {
+    d, ok := s.documents[uri]
+    if !ok {
+        return nil
+    }
+    formatted, err := formatter.Format(d.text)
+    if err != nil {
+        return nil
+    }
+
+    edits := []TextEdit{}
+    if formatted != d.text {
+        edits = append(edits, TextEdit{
+            Range:   Range{Start: Position{}, End: d.position(len(d.text))},
+            NewText: formatted,
+        })
+    }
+    return edits
+}
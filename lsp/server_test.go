@@ -0,0 +1,374 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const uri = "file:///test.mk"
+
+// startServer runs a server in-process and returns a client talking to it,
+// and a channel receiving the result of Serve.
+func startServer(t *testing.T) (*Client, chan error) {
+    toServer, clientOut := io.Pipe()
+    clientIn, fromServer := io.Pipe()
+
+    done := make(chan error, 1)
+    go func() {
+        done <- NewServer(toServer, fromServer).Serve()
+        fromServer.Close()
+    }()
+    t.Cleanup(func() { clientOut.Close() })
+
+    return NewClient(clientIn, clientOut), done
+}
+
+func initialize(t *testing.T, client *Client) {
+    var result InitializeResult
+    if err := client.Call("initialize", &InitializeParams{}, &result); err != nil {
+        t.Fatalf("initialize failed: %s", err)
+    }
+    client.Notify("initialized", struct{}{})
+}
+
+func open(t *testing.T, client *Client, text string) *PublishDiagnosticsParams {
+    client.Notify("textDocument/didOpen", &DidOpenTextDocumentParams{
+        TextDocument: TextDocumentItem{URI: uri, LanguageID: "monkey", Version: 1, Text: text},
+    })
+    return diagnostics(t, client)
+}
+
+func diagnostics(t *testing.T, client *Client) *PublishDiagnosticsParams {
+    select {
+    case msg := <-client.Notifications:
+        if msg.Method != "textDocument/publishDiagnostics" {
+            t.Fatalf("unexpected notification %s", msg.Method)
+        }
+        var params PublishDiagnosticsParams
+        if err := json.Unmarshal(msg.Params, &params); err != nil {
+            t.Fatal(err)
+        }
+        return &params
+    case <-time.After(5 * time.Second):
+        t.Fatal("no diagnostics published")
+    }
+    return nil
+}
+
+func at(line, character int) *TextDocumentPositionParams {
+    return &TextDocumentPositionParams{
+        TextDocument: TextDocumentIdentifier{URI: uri},
+        Position:     Position{Line: line, Character: character},
+    }
+}
+
+func TestLifecycle(t *testing.T) {
+    client, done := startServer(t)
+
+    err := client.Call("textDocument/hover", at(0, 0), nil)
+    if rpcErr, ok := err.(*ResponseError); !ok || rpcErr.Code != ServerNotInitialized {
+        t.Errorf("expected server not initialized error. got=%v", err)
+    }
+
+    var result InitializeResult
+    if err := client.Call("initialize", &InitializeParams{}, &result); err != nil {
+        t.Fatal(err)
+    }
+    capabilities := result.Capabilities
+    if capabilities.TextDocumentSync != SyncFull || !capabilities.HoverProvider || !capabilities.DefinitionProvider ||
+        !capabilities.DocumentSymbolProvider || capabilities.CompletionProvider == nil || !capabilities.DocumentFormattingProvider {
+        t.Errorf("wrong capabilities. got=%+v", capabilities)
+    }
+
+    err = client.Call("workspace/symbol", struct{}{}, nil)
+    if rpcErr, ok := err.(*ResponseError); !ok || rpcErr.Code != MethodNotFound {
+        t.Errorf("expected method not found error. got=%v", err)
+    }
+
+    if err := client.Call("shutdown", nil, nil); err != nil {
+        t.Fatal(err)
+    }
+    client.Notify("exit", nil)
+    if err := <-done; err != nil {
+        t.Errorf("Serve returned %v", err)
+    }
+
+    client, done = startServer(t)
+    initialize(t, client)
+    client.Notify("exit", nil)
+    if err := <-done; err == nil {
+        t.Errorf("Serve returned no error for exit without shutdown")
+    }
+}
+
+func TestDiagnostics(t *testing.T) {
+    client, _ := startServer(t)
+    initialize(t, client)
+
+    params := open(t, client, "let a = 1;\nlet b = ;\nlet = 3;")
+    if params.URI != uri {
+        t.Errorf("wrong uri. got=%q", params.URI)
+    }
+    expected := []Diagnostic{
+        {Range{Position{1, 8}, Position{1, 8}}, SeverityError, "interpreter", "no prefix parse function found for ;"},
+        {Range{Position{2, 4}, Position{2, 4}}, SeverityError, "interpreter", "Next token should be IDENT but got ="},
+    }
+    if !reflect.DeepEqual(params.Diagnostics[:2], expected) {
+        t.Errorf("wrong diagnostics. expected=%+v, got=%+v", expected, params.Diagnostics)
+    }
+
+    client.Notify("textDocument/didChange", &DidChangeTextDocumentParams{
+        TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+        ContentChanges: []TextDocumentContentChangeEvent{{Text: "let a = 1;"}},
+    })
+    if params := diagnostics(t, client); len(params.Diagnostics) != 0 {
+        t.Errorf("expected no diagnostics. got=%+v", params.Diagnostics)
+    }
+
+    // positions count UTF-16 code units
+    params = open(t, client, "let s = \"😀\"; let x = ;")
+    if len(params.Diagnostics) == 0 || params.Diagnostics[0].Range.Start != (Position{0, 22}) {
+        t.Errorf("wrong diagnostic position. got=%+v", params.Diagnostics)
+    }
+}
+
+const program = `let add = fn(a, b) {
+    a + b
+};
+let x = 10;
+let f = fn(x) {
+    let y = x * 2;
+    add(x, y)
+};
+const limit = len("abc");
+f(x)`
+
+func TestHover(t *testing.T) {
+    client, _ := startServer(t)
+    initialize(t, client)
+    open(t, client, program)
+
+    tests := []struct{
+        position *TextDocumentPositionParams
+        expected string
+    }{
+        {at(8, 15), "```\nlen(value)\n```\nReturns the number of characters in a string or elements in an array."},
+        {at(6, 5), "```\nlet add = fn(a, b)\n```"},
+        {at(1, 4), "```\n(parameter) a\n```"},
+        {at(8, 8), "```\nconst limit\n```"},
+        {at(9, 0), "```\nlet f = fn(x)\n```"},
+        {at(2, 0), ""},
+    }
+
+    for _, tt := range tests {
+        var hover *Hover
+        if err := client.Call("textDocument/hover", tt.position, &hover); err != nil {
+            t.Fatal(err)
+        }
+        if tt.expected == "" {
+            if hover != nil {
+                t.Errorf("%v: expected no hover. got=%+v", tt.position.Position, hover)
+            }
+            continue
+        }
+        if hover == nil || hover.Contents.Value != tt.expected {
+            t.Errorf("%v: wrong hover. expected=%q, got=%+v", tt.position.Position, tt.expected, hover)
+        }
+    }
+}
+
+func TestDefinition(t *testing.T) {
+    client, _ := startServer(t)
+    initialize(t, client)
+    open(t, client, program)
+
+    tests := []struct{
+        position *TextDocumentPositionParams
+        expected *Range
+    }{
+        // add in f refers to the top-level let
+        {at(6, 4), &Range{Position{0, 4}, Position{0, 7}}},
+        // x in f is the parameter, not the top-level x
+        {at(6, 8), &Range{Position{4, 11}, Position{4, 12}}},
+        {at(6, 11), &Range{Position{5, 8}, Position{5, 9}}},
+        {at(9, 2), &Range{Position{3, 4}, Position{3, 5}}},
+        {at(8, 15), nil},
+    }
+
+    for _, tt := range tests {
+        var location *Location
+        if err := client.Call("textDocument/definition", tt.position, &location); err != nil {
+            t.Fatal(err)
+        }
+        if tt.expected == nil {
+            if location != nil {
+                t.Errorf("%v: expected no definition. got=%+v", tt.position.Position, location)
+            }
+            continue
+        }
+        if location == nil || location.URI != uri || location.Range != *tt.expected {
+            t.Errorf("%v: wrong definition. expected=%+v, got=%+v", tt.position.Position, tt.expected, location)
+        }
+    }
+}
+
+func TestDocumentSymbols(t *testing.T) {
+    client, _ := startServer(t)
+    initialize(t, client)
+    open(t, client, program)
+
+    var symbols []DocumentSymbol
+    err := client.Call("textDocument/documentSymbol", &DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &symbols)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    expected := []DocumentSymbol{
+        {"add", "fn(a, b)", SymbolFunction, Range{Position{0, 0}, Position{2, 1}}, Range{Position{0, 4}, Position{0, 7}}},
+        {"x", "", SymbolVariable, Range{Position{3, 0}, Position{3, 10}}, Range{Position{3, 4}, Position{3, 5}}},
+        {"f", "fn(x)", SymbolFunction, Range{Position{4, 0}, Position{7, 1}}, Range{Position{4, 4}, Position{4, 5}}},
+        {"limit", "", SymbolConstant, Range{Position{8, 0}, Position{8, 24}}, Range{Position{8, 6}, Position{8, 11}}},
+    }
+    if !reflect.DeepEqual(symbols, expected) {
+        t.Errorf("wrong symbols.\nexpected=%+v\ngot=     %+v", expected, symbols)
+    }
+}
+
+func TestCompletion(t *testing.T) {
+    client, _ := startServer(t)
+    initialize(t, client)
+    open(t, client, program)
+
+    labels := func(position *TextDocumentPositionParams) map[string]CompletionItem {
+        var items []CompletionItem
+        if err := client.Call("textDocument/completion", position, &items); err != nil {
+            t.Fatal(err)
+        }
+        result := make(map[string]CompletionItem)
+        for _, item := range items {
+            result[item.Label] = item
+        }
+        return result
+    }
+
+    inside := labels(at(6, 4))
+    for _, name := range []string{"add", "x", "f", "y", "limit", "len", "push", "let", "while"} {
+        if _, ok := inside[name]; !ok {
+            t.Errorf("completion inside f misses %q", name)
+        }
+    }
+    if _, ok := inside["a"]; ok {
+        t.Errorf("completion inside f offers the parameter a of add")
+    }
+    if item := inside["len"]; item.Kind != CompletionFunction || item.Detail != "len(value)" {
+        t.Errorf("wrong completion for len. got=%+v", item)
+    }
+    if item := inside["add"]; item.Kind != CompletionFunction || item.Detail != "let add = fn(a, b)" {
+        t.Errorf("wrong completion for add. got=%+v", item)
+    }
+
+    outside := labels(at(9, 0))
+    if _, ok := outside["y"]; ok {
+        t.Errorf("completion at the top level offers y")
+    }
+}
+
+func TestFormatting(t *testing.T) {
+    client, _ := startServer(t)
+    initialize(t, client)
+    open(t, client, "let a=1\nputs( a )")
+
+    params := &DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: uri}}
+    var edits []TextEdit
+    if err := client.Call("textDocument/formatting", params, &edits); err != nil {
+        t.Fatal(err)
+    }
+    expected := []TextEdit{{Range{Position{0, 0}, Position{1, 9}}, "let a = 1;\nputs(a);\n"}}
+    if !reflect.DeepEqual(edits, expected) {
+        t.Errorf("wrong edits. expected=%+v, got=%+v", expected, edits)
+    }
+
+    open(t, client, "let a = ;")
+    edits = nil
+    if err := client.Call("textDocument/formatting", params, &edits); err != nil {
+        t.Fatal(err)
+    }
+    if edits != nil {
+        t.Errorf("expected no edits for a document with errors. got=%+v", edits)
+    }
+}
+
+func TestConn(t *testing.T) {
+    input := "Content-Length: 40\r\n\r\n" + `{"jsonrpc":"2.0","id":1,"method":"ping"}` +
+        "Content-Length: 5\r\n\r\n" + "{bad}"
+    var out strings.Builder
+    conn := NewConn(strings.NewReader(input), &out)
+
+    msg, err := conn.Read()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !msg.IsRequest() || msg.Method != "ping" || string(msg.ID) != "1" {
+        t.Errorf("wrong message. got=%+v", msg)
+    }
+
+    _, err = conn.Read()
+    if rpcErr, ok := err.(*ResponseError); !ok || rpcErr.Code != ParseErrorCode {
+        t.Errorf("expected parse error. got=%v", err)
+    }
+
+    if _, err = conn.Read(); err != io.EOF {
+        t.Errorf("expected io.EOF. got=%v", err)
+    }
+
+    conn.Reply(msg.ID, nil)
+    expected := "Content-Length: 38\r\n\r\n" + `{"jsonrpc":"2.0","id":1,"result":null}`
+    if out.String() != expected {
+        t.Errorf("wrong reply. expected=%q, got=%q", expected, out.String())
+    }
+}
+
+// Editors send documents while they are being typed, which must not crash
+// the server.
+func TestBrokenDocuments(t *testing.T) {
+    client, _ := startServer(t)
+    initialize(t, client)
+
+    documents := []string{
+        "let = 5;\nlet x = 1;",
+        "let x: array< = 1",
+        "let x = ;\nx",
+        "throw ;\nlet f = fn(a) { let = 1; a }",
+        "export let ;\nlet f = fn(",
+        "let f = fn(a) { if (a) { let y: = 2; } };\nf(",
+        "let h = {\"a\": };\nh.",
+        "for (x in ) { x }\nwhile (",
+    }
+
+    for _, text := range documents {
+        if params := open(t, client, text); len(params.Diagnostics) == 0 {
+            t.Errorf("%q: expected diagnostics", text)
+        }
+
+        var symbols []DocumentSymbol
+        if err := client.Call("textDocument/documentSymbol", &DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &symbols); err != nil {
+            t.Fatalf("%q: documentSymbol failed: %s", text, err)
+        }
+        for line := 0; line < 2; line++ {
+            for character := 0; character < 12; character++ {
+                var hover *Hover
+                if err := client.Call("textDocument/hover", at(line, character), &hover); err != nil {
+                    t.Fatalf("%q: hover at %d:%d failed: %s", text, line, character, err)
+                }
+                var location *Location
+                if err := client.Call("textDocument/definition", at(line, character), &location); err != nil {
+                    t.Fatalf("%q: definition at %d:%d failed: %s", text, line, character, err)
+                }
+            }
+        }
+    }
+}
@@ -1,18 +1,406 @@
 package main
 
 import (
-    "fmt"
-    "os"
-    "os/user"
-    "interpreter/repl"
+	"context"
+	"flag"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/checker"
+	"interpreter/compiler"
+	"interpreter/evaluator"
+	"interpreter/formatter"
+	"interpreter/lexer"
+	"interpreter/lsp"
+	"interpreter/object"
+	"interpreter/parser"
+	"interpreter/repl"
+	"interpreter/token"
+	"interpreter/types"
+	"interpreter/vm"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
 )
 
+const usage = `Usage:
+  interpreter [flags] run FILE    run a script, FILE may be - to read stdin
+  interpreter [flags] repl        start the interactive REPL
+  interpreter [flags] -e EXPR     evaluate EXPR and print the result
+  interpreter fmt [-check | -w] [FILE...]
+                                  format scripts, or stdin when there is no FILE
+  interpreter lint [FILE...]      check scripts for mistakes, or stdin when there is no FILE
+  interpreter lsp                 run the language server on stdin and stdout
+  interpreter [flags]             run stdin when it is piped, otherwise start the REPL
+
+Flags:
+`
+
+// HISTORY_FILE is the name of the REPL history file in the home directory.
+const HISTORY_FILE = ".interpreter_history"
+
 func main() {
+    os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the exit status: 0 on success,
+// 1 when the program has parse or runtime errors and 2 on usage errors.
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+    flags := flag.NewFlagSet("interpreter", flag.ContinueOnError)
+    flags.SetOutput(stderr)
+    flags.Usage = func() {
+        fmt.Fprint(stderr, usage)
+        flags.PrintDefaults()
+    }
+
+    expression := flags.String("e", "", "evaluate `expr` and print the result")
+    engine := flags.String("engine", "eval", "execution backend, `eval` or vm")
+    overflow := flags.String("overflow", evaluator.OverflowWrap.String(), "integer overflow `policy`: wrap, error or promote")
+
+    if err := flags.Parse(args); err != nil {
+        return 2
+    }
+
+    policy, err := evaluator.ParseOverflowPolicy(*overflow)
+    if err != nil {
+        fmt.Fprintln(stderr, err)
+        return 2
+    }
+    options := evaluator.Options{Overflow: policy}
+
+    if *engine != "eval" && *engine != "vm" {
+        fmt.Fprintf(stderr, "unknown engine %q\n", *engine)
+        return 2
+    }
+
+    if isFlagSet(flags, "e") {
+        if flags.NArg() != 0 {
+            flags.Usage()
+            return 2
+        }
+        return execute("-e", *expression, *engine, options, true, stdout, stderr)
+    }
+
+    if flags.NArg() == 0 {
+        if isTerminal(stdin) {
+            return startRepl(*engine, options, stdin, stdout, stderr)
+        }
+        return runReader("<stdin>", stdin, *engine, options, stdout, stderr)
+    }
+
+    switch flags.Arg(0) {
+    case "repl":
+        return startRepl(*engine, options, stdin, stdout, stderr)
+    case "run":
+        if flags.NArg() != 2 {
+            flags.Usage()
+            return 2
+        }
+        if flags.Arg(1) == "-" {
+            return runReader("<stdin>", stdin, *engine, options, stdout, stderr)
+        }
+        return runFile(flags.Arg(1), *engine, options, stdout, stderr)
+    case "fmt":
+        return formatFiles(flags.Args()[1:], stdin, stdout, stderr)
+    case "lint":
+        return lintFiles(flags.Args()[1:], stdin, stdout, stderr)
+    case "lsp":
+        if flags.NArg() != 1 {
+            flags.Usage()
+            return 2
+        }
+        if err := lsp.NewServer(stdin, stdout).Serve(); err != nil {
+            fmt.Fprintln(stderr, err)
+            return 1
+        }
+        return 0
+    default:
+        fmt.Fprintf(stderr, "unknown command %q\n", flags.Arg(0))
+        flags.Usage()
+        return 2
+    }
+}
+
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+    set := false
+    flags.Visit(func(f *flag.Flag) {
+        if f.Name == name {
+            set = true
+        }
+    })
+    return set
+}
+
+func isTerminal(input io.Reader) bool {
+    file, ok := input.(*os.File)
+    if !ok {
+        return false
+    }
+
+    info, err := file.Stat()
+    if err != nil {
+        return false
+    }
+    return info.Mode()&os.ModeCharDevice != 0
+}
+
+func startRepl(engine string, options evaluator.Options, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+    if engine != "eval" {
+        fmt.Fprintf(stderr, "the REPL only supports the eval engine\n")
+        return 2
+    }
+
     user, err := user.Current()
+    if err == nil {
+        fmt.Fprintf(stdout, "Hello %s! \n", user.Username)
+    }
+    fmt.Fprintf(stdout, "REPL Started, type :help for help\n")
+    repl.Start(stdin, stdout, historyFile(), options)
+    return 0
+}
+
+// historyFile returns where the REPL keeps its history, which is not kept
+// when there is no home directory.
+func historyFile() string {
+    home, err := os.UserHomeDir()
     if err != nil {
-        panic(err)
+        return ""
+    }
+    return filepath.Join(home, HISTORY_FILE)
+}
+
+func runFile(filename string, engine string, options evaluator.Options, stdout io.Writer, stderr io.Writer) int {
+    source, err := os.ReadFile(filename)
+    if err != nil {
+        fmt.Fprintln(stderr, err)
+        return 1
+    }
+    // imports are relative to the script
+    options.Modules = evaluator.NewModuleLoader(filename)
+    return execute(filename, string(source), engine, options, false, stdout, stderr)
+}
+
+func runReader(name string, input io.Reader, engine string, options evaluator.Options, stdout io.Writer, stderr io.Writer) int {
+    source, err := io.ReadAll(input)
+    if err != nil {
+        fmt.Fprintln(stderr, err)
+        return 1
+    }
+    return execute(name, string(source), engine, options, false, stdout, stderr)
+}
+
+// execute parses and runs source with options. Errors are reported as
+// name:line:column so they can be picked up by editors.
+func execute(name string, source string, engine string, options evaluator.Options, printResult bool, stdout io.Writer, stderr io.Writer) int {
+    l := lexer.New(source)
+    p := parser.New(l)
+    program := p.ParseProgram()
+
+    if len(p.Errors()) != 0 {
+        for _, err := range p.Errors() {
+            fmt.Fprintf(stderr, "%s: %s\n", location(name, err.Pos), err.Message)
+        }
+        return 1
+    }
+
+    macroEnv := object.NewEnvironment()
+    evaluator.DefineMacros(program, macroEnv)
+    expanded, errObj := evaluator.ExpandMacrosContext(context.Background(), program, macroEnv, options)
+    if errObj != nil {
+        fmt.Fprintf(stderr, "%s: ERROR: %s\n", location(name, errObj.Pos), errObj.Message)
+        return 1
+    }
+    program = expanded.(*ast.Program)
+
+    if errs := types.Check(program); len(errs) != 0 {
+        for _, err := range errs {
+            fmt.Fprintf(stderr, "%s: %s\n", location(name, err.Pos), err.Message)
+        }
+        return 1
+    }
+
+    var result object.Object
+    if engine == "vm" {
+        comp := compiler.New()
+        if err := comp.Compile(program); err != nil {
+            if compileError, ok := err.(*compiler.Error); ok {
+                fmt.Fprintf(stderr, "%s: %s\n", location(name, compileError.Pos), compileError.Message)
+            } else {
+                fmt.Fprintf(stderr, "%s: %s\n", name, err)
+            }
+            return 1
+        }
+
+        machine := vm.New(comp.Bytecode())
+        machine.SetOverflow(options.Overflow)
+        err := machine.Run()
+        if errObj, ok := err.(*object.Error); ok {
+            result = errObj
+        } else if err != nil {
+            fmt.Fprintf(stderr, "%s: %s\n", name, err)
+            return 1
+        } else {
+            result = machine.LastPoppedStackElem()
+        }
+    } else {
+        result = evaluator.EvalOptions(context.Background(), program, object.NewEnvironment(), options)
+    }
+
+    if errObj, ok := result.(*object.Error); ok {
+        fmt.Fprintf(stderr, "%s: ERROR: %s\n", location(name, errObj.Pos), errObj.Message)
+        printStack(stderr, name, errObj.Stack)
+        return 1
+    }
+
+    if printResult && result != nil {
+        fmt.Fprintln(stdout, result.Inspect())
+    }
+    return 0
+}
+
+// stackEnds is the number of frames printed at each end of a long stack
+// trace, like the one of runaway recursion.
+const stackEnds = 10
+
+// printStack prints the frames of a stack trace, innermost first. Only the
+// ends of a long one are printed.
+func printStack(stderr io.Writer, name string, stack []object.StackFrame) {
+    for i, frame := range stack {
+        if len(stack) > 2*stackEnds && i >= stackEnds && i < len(stack)-stackEnds {
+            if i == stackEnds {
+                fmt.Fprintf(stderr, "\t... %d more\n", len(stack)-2*stackEnds)
+            }
+            continue
+        }
+        fmt.Fprintf(stderr, "\tat %s (%s)\n", frame.Function, location(name, frame.Pos))
+    }
+}
+
+// formatFiles runs the fmt command. It prints the formatted files, or with
+// -w writes them back, and with -check lists the files that are not
+// formatted and fails if there are any.
+func formatFiles(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+    flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+    flags.SetOutput(stderr)
+    check := flags.Bool("check", false, "list the files that are not formatted instead of printing them")
+    write := flags.Bool("w", false, "write the result back to the files")
+
+    if err := flags.Parse(args); err != nil {
+        return 2
+    }
+    if *check && *write {
+        fmt.Fprintln(stderr, "-check and -w cannot be used together")
+        return 2
+    }
+
+    if flags.NArg() == 0 {
+        if *write {
+            fmt.Fprintln(stderr, "-w needs files to write")
+            return 2
+        }
+        source, err := io.ReadAll(stdin)
+        if err != nil {
+            fmt.Fprintln(stderr, err)
+            return 1
+        }
+        return formatSource("<stdin>", string(source), *check, false, stdout, stderr)
+    }
+
+    status := 0
+    for _, filename := range flags.Args() {
+        source, err := os.ReadFile(filename)
+        if err != nil {
+            fmt.Fprintln(stderr, err)
+            status = 1
+            continue
+        }
+        if formatSource(filename, string(source), *check, *write, stdout, stderr) != 0 {
+            status = 1
+        }
+    }
+    return status
+}
+
+func formatSource(name string, source string, check bool, write bool, stdout io.Writer, stderr io.Writer) int {
+    formatted, err := formatter.Format(source)
+    if err != nil {
+        if parseErr, ok := err.(*parser.ParseError); ok {
+            fmt.Fprintf(stderr, "%s: %s\n", location(name, parseErr.Pos), parseErr.Message)
+        } else {
+            fmt.Fprintf(stderr, "%s: %s\n", name, err)
+        }
+        return 1
+    }
+
+    switch {
+    case check:
+        if formatted != source {
+            fmt.Fprintln(stdout, name)
+            return 1
+        }
+    case write:
+        if formatted != source {
+            if err := os.WriteFile(name, []byte(formatted), 0644); err != nil {
+                fmt.Fprintln(stderr, err)
+                return 1
+            }
+        }
+    default:
+        io.WriteString(stdout, formatted)
+    }
+    return 0
+}
+
+// lintFiles runs the lint command. It prints the parse errors and the
+// problems the checker finds, and fails if there are any.
+func lintFiles(filenames []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+    if len(filenames) == 0 {
+        source, err := io.ReadAll(stdin)
+        if err != nil {
+            fmt.Fprintln(stderr, err)
+            return 1
+        }
+        return lintSource("<stdin>", string(source), stdout)
+    }
+
+    status := 0
+    for _, filename := range filenames {
+        source, err := os.ReadFile(filename)
+        if err != nil {
+            fmt.Fprintln(stderr, err)
+            status = 1
+            continue
+        }
+        if lintSource(filename, string(source), stdout) != 0 {
+            status = 1
+        }
+    }
+    return status
+}
+
+func lintSource(name string, source string, stdout io.Writer) int {
+    p := parser.New(lexer.New(source))
+    program := p.ParseProgram()
+    if len(p.Errors()) != 0 {
+        for _, err := range p.Errors() {
+            fmt.Fprintf(stdout, "%s: %s\n", location(name, err.Pos), err.Message)
+        }
+        return 1
+    }
+
+    problems := checker.Check(program)
+    for _, problem := range problems {
+        fmt.Fprintf(stdout, "%s: %s\n", location(name, problem.Pos), problem.Message)
+    }
+    if len(problems) != 0 {
+        return 1
+    }
+    return 0
+}
+
+func location(name string, pos token.Position) string {
+    if !pos.IsValid() {
+        return name
     }
-    fmt.Printf("Hello %s! \n", user.Username)
-    fmt.Printf("REPL Started\n")
-    repl.Start(os.Stdin, os.Stdout)
+    return name + ":" + pos.String()
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+    dir := t.TempDir()
+    script := filepath.Join(dir, "script.mk")
+    err := os.WriteFile(script, []byte("let a = 1;\nlet b = a + true;\n"), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = os.MkdirAll(filepath.Join(dir, "lib"), 0755)
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = os.WriteFile(filepath.Join(dir, "lib", "greet.mk"), []byte(`export let greet = fn(name) { "hello " + name };`), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+    importing := filepath.Join(dir, "importing.mk")
+    err = os.WriteFile(importing, []byte("import \"lib/greet.mk\" as lib;\nputs(lib.greet(\"you\"));\nlib.missing"), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+    broken := filepath.Join(dir, "broken.mk")
+    err = os.WriteFile(broken, []byte("let a = ;"), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // the stack trace of runaway recursion only shows its ends
+    recursion := strings.Repeat("\tat f (-e:1:21)\n", 10) + "\t... 9981 more\n" + strings.Repeat("\tat f (-e:1:21)\n", 9) + "\tat f (-e:2:1)\n"
+
+    tests := []struct{
+        args           []string
+        stdin          string
+        expectedStatus int
+        expectedStdout string
+        expectedStderr string
+    }{
+        {[]string{"-e", "1 + 2"}, "", 0, "3\n", ""},
+        {[]string{"-engine", "vm", "-e", "let f = fn(x) { x * 2 }; f(21)"}, "", 0, "42\n", ""},
+        {[]string{"-e", "-true"}, "", 1, "", "-e:1:1: unknown operator: -bool\n"},
+        {[]string{"-e", "let x 1"}, "", 1, "", "-e:1:7: Next token should be = but got INT\n"},
+        {[]string{"run", script}, "", 1, "", script + ":2:9: type mismatch: int + bool\n"},
+        {[]string{"run", broken}, "", 1, "", broken + ":1:9: no prefix parse function found for ;\n"},
+        {[]string{"run", "-"}, "let a = 5; a;", 0, "", ""},
+        {[]string{"run", importing}, "", 1, "", importing + ":3:1: ERROR: module greet.mk does not export missing\n"},
+        {[]string{"-engine", "vm", "-e", `let h = {"a": 1}; h.a`}, "", 0, "1\n", ""},
+        {[]string{}, "1 + foo", 1, "", "<stdin>:1:5: ERROR: identifier not found: foo\n"},
+        {[]string{"-overflow", "promote", "-e", "9223372036854775807 + 1"}, "", 0, "9223372036854775808\n", ""},
+        {[]string{"-overflow", "error", "-e", "9223372036854775807 + 1"}, "", 1, "", "-e:1:1: ERROR: integer overflow: 9223372036854775807 + 1\n"},
+        {[]string{"-e", "let twice = macro(x) { quote(unquote(x) * 2) }; twice(1 + 2)"}, "", 0, "6\n", ""},
+        {[]string{"-e", "let m = macro() { while (true) { } }; m()"}, "", 1, "", "-e:1:19: ERROR: step limit of 1000000 exceeded\n"},
+        {[]string{"-engine", "vm", "-e", "let unless = macro(c, x) { quote(if (!unquote(c)) { unquote(x) }) }; unless(false, 7)"}, "", 0, "7\n", ""},
+        {[]string{"-e", "let m = macro() { 1 }; 1 +\n m()"}, "", 1, "", "-e:2:2: ERROR: macro m did not return a quote\n"},
+        {[]string{"-e", "let f = fn(x) { -x };\nf(true)"}, "", 1, "", "-e:1:17: ERROR: unknown operator: -BOOLEAN\n\tat f (-e:2:1)\n"},
+        {[]string{"-e", "let add = fn(a: int, b: int): int { a + b };\nadd(1, \"2\")"}, "", 1, "", "-e:2:8: cannot use string as int in argument 2 to add\n"},
+        {[]string{"-engine", "vm", "-e", "let x: float = 1;"}, "", 1, "", "-e:1:16: cannot use int as float in let x\n"},
+        {[]string{"-engine", "vm", "-e", "let a = 1;\nquote(a)"}, "", 1, "", "-e:2:1: quote is not supported by the vm\n"},
+        {[]string{"-engine", "vm", "-e", "let f = fn(x) { -x };\nf(true)"}, "", 1, "", "-e:1:17: ERROR: unknown operator: -BOOLEAN\n"},
+        {[]string{"-e", "let xs: array<int> = [1, 2]; let f = fn(n: int): string { \"#\" + len(xs) }; 1"}, "", 1, "", "-e:1:59: type mismatch: string + int\n"},
+        {[]string{"-engine", "vm", "-e", `try { throw "x"; } catch (e) { e.message }`}, "", 0, "x\n", ""},
+        {[]string{"-e", `throw "boom";`}, "", 1, "", "-e:1:1: ERROR: boom\n"},
+        {[]string{"-e", "let f = fn(n) { 1 + f(n + 1) };\nf(0)"}, "", 1, "", "-e:1:21: ERROR: maximum call depth of 10000 exceeded\n" + recursion},
+        {[]string{"-e", "9223372036854775807 + 1"}, "", 0, "-9223372036854775808\n", ""},
+        {[]string{"-overflow", "saturate", "-e", "1"}, "", 2, "", ""},
+        {[]string{"run"}, "", 2, "", ""},
+        {[]string{"compile"}, "", 2, "", ""},
+        {[]string{"-engine", "jit", "-e", "1"}, "", 2, "", ""},
+    }
+
+    for _, tt := range tests {
+        var stdout, stderr bytes.Buffer
+        status := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+
+        if status != tt.expectedStatus {
+            t.Errorf("%v: wrong exit status. expected=%d, got=%d (stderr=%q)", tt.args, tt.expectedStatus, status, stderr.String())
+        }
+
+        if stdout.String() != tt.expectedStdout {
+            t.Errorf("%v: wrong stdout. expected=%q, got=%q", tt.args, tt.expectedStdout, stdout.String())
+        }
+
+        if tt.expectedStatus != 2 && stderr.String() != tt.expectedStderr {
+            t.Errorf("%v: wrong stderr. expected=%q, got=%q", tt.args, tt.expectedStderr, stderr.String())
+        }
+    }
+}
+
+func TestFormatCommand(t *testing.T) {
+    dir := t.TempDir()
+    messy := filepath.Join(dir, "messy.mk")
+    err := os.WriteFile(messy, []byte("let a=1\nputs( a )"), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+    tidy := filepath.Join(dir, "tidy.mk")
+    err = os.WriteFile(tidy, []byte("let a = 1;\nputs(a);\n"), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+    broken := filepath.Join(dir, "broken.mk")
+    err = os.WriteFile(broken, []byte("let a = ;"), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct{
+        args           []string
+        stdin          string
+        expectedStatus int
+        expectedStdout string
+        expectedStderr string
+    }{
+        {[]string{"fmt", messy}, "", 0, "let a = 1;\nputs(a);\n", ""},
+        {[]string{"fmt"}, "if(x){y}", 0, "if (x) {\n    y\n}\n", ""},
+        {[]string{"fmt", "-check", tidy}, "", 0, "", ""},
+        {[]string{"fmt", "--check", messy, tidy}, "", 1, messy + "\n", ""},
+        {[]string{"fmt", broken}, "", 1, "", broken + ":1:9: no prefix parse function found for ;\n"},
+        {[]string{"fmt", "-check", "-w", messy}, "", 2, "", ""},
+        {[]string{"fmt", "-w"}, "", 2, "", ""},
+    }
+
+    for _, tt := range tests {
+        var stdout, stderr bytes.Buffer
+        status := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+
+        if status != tt.expectedStatus {
+            t.Errorf("%v: wrong exit status. expected=%d, got=%d (stderr=%q)", tt.args, tt.expectedStatus, status, stderr.String())
+        }
+        if stdout.String() != tt.expectedStdout {
+            t.Errorf("%v: wrong stdout. expected=%q, got=%q", tt.args, tt.expectedStdout, stdout.String())
+        }
+        if tt.expectedStatus != 2 && stderr.String() != tt.expectedStderr {
+            t.Errorf("%v: wrong stderr. expected=%q, got=%q", tt.args, tt.expectedStderr, stderr.String())
+        }
+    }
+
+    var stdout, stderr bytes.Buffer
+    if status := run([]string{"fmt", "-w", messy}, strings.NewReader(""), &stdout, &stderr); status != 0 {
+        t.Fatalf("fmt -w failed with status %d: %s", status, stderr.String())
+    }
+    written, err := os.ReadFile(messy)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if string(written) != "let a = 1;\nputs(a);\n" {
+        t.Errorf("fmt -w wrote %q", written)
+    }
+}
+
+func TestLintCommand(t *testing.T) {
+    dir := t.TempDir()
+    clean := filepath.Join(dir, "clean.mk")
+    err := os.WriteFile(clean, []byte("let a = 1;\nputs(a);\n"), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+    sloppy := filepath.Join(dir, "sloppy.mk")
+    err = os.WriteFile(sloppy, []byte("let f = fn(x) {\n    return 1;\n    len(1, 2)\n};\nf(y)\n"), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct{
+        args           []string
+        stdin          string
+        expectedStatus int
+        expectedStdout string
+    }{
+        {[]string{"lint", clean}, "", 0, ""},
+        {[]string{"lint", clean, sloppy}, "", 1, sloppy + ":1:12: unused parameter x\n" +
+            sloppy + ":3:5: unreachable code\n" +
+            sloppy + ":3:5: wrong number of arguments to len. got=2, want=1\n" +
+            sloppy + ":5:3: identifier not found: y\n"},
+        {[]string{"lint"}, "let len = 1; len", 1, "<stdin>:1:5: len shadows the builtin len\n"},
+        {[]string{"lint"}, "let a = ;", 1, "<stdin>:1:9: no prefix parse function found for ;\n"},
+    }
+
+    for _, tt := range tests {
+        var stdout, stderr bytes.Buffer
+        status := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+
+        if status != tt.expectedStatus {
+            t.Errorf("%v: wrong exit status. expected=%d, got=%d (stderr=%q)", tt.args, tt.expectedStatus, status, stderr.String())
+        }
+        if stdout.String() != tt.expectedStdout {
+            t.Errorf("%v: wrong stdout. expected=%q, got=%q", tt.args, tt.expectedStdout, stdout.String())
+        }
+    }
+}
@@ -3,23 +3,37 @@ package object
 import (
 	"bytes"
 	"fmt"
-	"go/token"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
 	"interpreter/ast"
+	"interpreter/code"
+	"interpreter/token"
 	"strings"
     "hash/fnv"
 )
 
 const (
     INTEGER_OBJ      = "INTEGER"
+    FLOAT_OBJ        = "FLOAT"
+    BIG_INTEGER_OBJ  = "BIG_INTEGER"
     BOOLEAN_OBJ      = "BOOLEAN"
     NULL_OBJ         = "NULL"
     RETURN_VALUE_OBJ = "RETURN_VALUE"
+    BREAK_OBJ        = "BREAK"
+    CONTINUE_OBJ     = "CONTINUE"
     ERROR_OBJ        = "ERROR"
     FUNCTION_OBJ     = "FUNCTION"
     STRING_OBJ       = "STRING"
     BUILTIN_OBJ      = "BUILTIN"
     ARRAY_OBJ        = "ARRAY"
     HASH_OBJ         = "HASH"
+    QUOTE_OBJ        = "QUOTE"
+    MACRO_OBJ        = "MACRO"
+    MODULE_OBJ       = "MODULE"
+
+    COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 )
 
 type ObjectType string
@@ -37,6 +51,11 @@ type FunctionLiteral struct {
 
 type BuiltinFunction func(args ...Object) Object
 
+// Applier calls a function or builtin with args. A builtin that is handed
+// functions as arguments gets one that calls them as part of the evaluation
+// that called the builtin, so they run within its limits.
+type Applier func(fn Object, args []Object) Object
+
 type HashKey struct {
     Type  ObjectType
     Value uint64
@@ -61,6 +80,50 @@ func (i *Integer) HashKey() HashKey {
 }
 
 
+// BIG INTEGER, only produced for results that do not fit into an Integer
+type BigInteger struct {
+    Value *big.Int
+}
+func (bi *BigInteger) Type() ObjectType {
+    return BIG_INTEGER_OBJ
+}
+func (bi *BigInteger) Inspect() string {
+    return bi.Value.String()
+}
+func (bi *BigInteger) HashKey() HashKey {
+    h := fnv.New64()
+    h.Write(bi.Value.Bytes())
+    if bi.Value.Sign() < 0 {
+        h.Write([]byte{'-'})
+    }
+    return HashKey{Type: bi.Type(), Value: h.Sum64()}
+}
+
+
+// FLOAT
+type Float struct {
+    Value float64
+}
+func (f *Float) Type() ObjectType {
+    return FLOAT_OBJ
+}
+func (f *Float) Inspect() string {
+    output := strconv.FormatFloat(f.Value, 'g', -1, 64)
+    if !strings.ContainsAny(output, ".eIN") {
+        output += ".0"
+    }
+    return output
+}
+// HashKey hashes floats with an integral value like the equal integer, so
+// that 1 and 1.0 are the same hash key, just as 1 == 1.0.
+func (f *Float) HashKey() HashKey {
+    if f.Value == math.Trunc(f.Value) && math.Abs(f.Value) < math.MaxInt64 {
+        return (&Integer{Value: int64(f.Value)}).HashKey()
+    }
+    return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
+
 // BOOLEAN
 type Boolean struct {
     Value bool
@@ -104,21 +167,74 @@ func (rv *ReturnValue) Inspect() string {
     return rv.Value.Inspect()
 }
 
+// BREAK and CONTINUE are signals that unwind a loop body, like ReturnValue
+// unwinds a function body.
+type Break struct {}
+func (b *Break) Type() ObjectType {
+    return BREAK_OBJ
+}
+func (b *Break) Inspect() string {
+    return "break"
+}
+
+type Continue struct {}
+func (c *Continue) Type() ObjectType {
+    return CONTINUE_OBJ
+}
+func (c *Continue) Inspect() string {
+    return "continue"
+}
+
+// Kinds of errors
+const (
+    THROWN_ERROR        = "Error" // values thrown by programs
+    TYPE_ERROR          = "TypeError"
+    NAME_ERROR          = "NameError"
+    INDEX_ERROR         = "IndexError"
+    ARGUMENT_ERROR      = "ArgumentError"
+    ZERO_DIVISION_ERROR = "ZeroDivisionError"
+    OVERFLOW_ERROR      = "OverflowError"
+    SYNTAX_ERROR        = "SyntaxError"
+    IMPORT_ERROR        = "ImportError"
+    MACRO_ERROR         = "MacroError"
+    LIMIT_ERROR         = "LimitError" // cancellation or an exceeded evaluation limit
+)
+
 // ERROR
 type Error struct {
+    Kind    string
     Message string
+    Pos     token.Position
+    Stack   []StackFrame // the calls the error unwound, innermost first
+    Value   Object       // the value passed to throw, nil for other errors
 }
 func (e *Error) Type() ObjectType {
     return ERROR_OBJ
 }
 func (e *Error) Inspect() string {
+    if e.Pos.IsValid() {
+        return "ERROR: " + e.Pos.String() + ": " + e.Message
+    }
     return "ERROR: " + e.Message
 }
+func (e *Error) Error() string {
+    return e.Message
+}
+
+// StackFrame is a call that was running when an error happened.
+type StackFrame struct {
+    Function string
+    Pos      token.Position // position of the call
+}
+func (f StackFrame) String() string {
+    return "at " + f.Function + " (" + f.Pos.String() + ")"
+}
 
 // Environment
 func NewEnvironment() *Environment {
     s := make(map[string]Object)
-    return &Environment{store: s, outer: nil}
+    c := make(map[string]bool)
+    return &Environment{store: s, constants: c, outer: nil}
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
@@ -128,8 +244,9 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 }
 
 type Environment struct {
-    store map[string]Object
-    outer *Environment
+    store     map[string]Object
+    constants map[string]bool
+    outer     *Environment
 }
 func (e *Environment) Get(name string) (Object, bool) {
     obj, ok := e.store[name]
@@ -142,10 +259,62 @@ func (e *Environment) Set(name string, val Object) Object {
     e.store[name] = val
     return val
 }
+// Declare binds name in this environment, as let and const do. It returns
+// false when name is already a constant of this environment.
+func (e *Environment) Declare(name string, val Object, constant bool) bool {
+    if e.constants[name] {
+        return false
+    }
+    e.store[name] = val
+    if constant {
+        e.constants[name] = true
+    }
+    return true
+}
+// IsConstant tells whether the nearest binding of name is a constant.
+func (e *Environment) IsConstant(name string) bool {
+    if _, ok := e.store[name]; ok {
+        return e.constants[name]
+    }
+    if e.outer != nil {
+        return e.outer.IsConstant(name)
+    }
+    return false
+}
+// Names returns the names bound in this environment and the ones it
+// encloses, sorted.
+func (e *Environment) Names() []string {
+    seen := make(map[string]bool)
+    for env := e; env != nil; env = env.outer {
+        for name := range env.store {
+            seen[name] = true
+        }
+    }
+    names := make([]string, 0, len(seen))
+    for name := range seen {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+// Assign updates the binding of name in the nearest environment that has
+// one. It returns false when name is not bound anywhere.
+func (e *Environment) Assign(name string, val Object) bool {
+    if _, ok := e.store[name]; ok {
+        e.store[name] = val
+        return true
+    }
+    if e.outer != nil {
+        return e.outer.Assign(name, val)
+    }
+    return false
+}
 
 // Functions
 type Function struct {
     Parameters  []*ast.Identifier
+    Defaults    map[string]ast.Expression
+    Rest        *ast.Identifier
     Body        *ast.BlockStatement
     Env         *Environment
 }
@@ -155,10 +324,7 @@ func (f *Function) Type() ObjectType {
 func (f *Function) Inspect() string {
     var output bytes.Buffer
 
-    params := []string{}
-    for _, p := range f.Parameters {
-        params = append(params, p.String())
-    }
+    params := ast.ParametersString(f.Parameters, nil, f.Defaults, f.Rest)
     
     output.WriteString("fn")
     output.WriteString("(")
@@ -188,7 +354,11 @@ func (s *String) HashKey() HashKey {
 
 // Builtin
 type Builtin struct {
-    Fn BuiltinFunction 
+    Fn        BuiltinFunction
+    FnApply   func(apply Applier, args ...Object) Object // used instead of Fn by the evaluator when set
+    Signature string // how it is called, like len(value)
+    Arity     int    // number of arguments, -1 when it takes any number
+    Doc       string
 }
 func (b *Builtin) Type() ObjectType {
     return BUILTIN_OBJ
@@ -245,3 +415,88 @@ func (h *Hash) Inspect() string {
     
     return output.String()
 }
+
+// Quote holds the unevaluated code passed to quote
+type Quote struct {
+    Node ast.Node
+}
+func (q *Quote) Type() ObjectType {
+    return QUOTE_OBJ
+}
+func (q *Quote) Inspect() string {
+    return "QUOTE(" + q.Node.String() + ")"
+}
+
+// Macros
+type Macro struct {
+    Parameters []*ast.Identifier
+    Body       *ast.BlockStatement
+    Env        *Environment
+}
+func (m *Macro) Type() ObjectType {
+    return MACRO_OBJ
+}
+func (m *Macro) Inspect() string {
+    var output bytes.Buffer
+
+    params := ast.ParametersString(m.Parameters, nil, nil, nil)
+
+    output.WriteString("macro")
+    output.WriteString("(")
+    output.WriteString(strings.Join(params, ","))
+    output.WriteString("){\n")
+    output.WriteString(m.Body.String())
+    output.WriteString("\n}")
+
+    return output.String()
+}
+
+// Modules are the files loaded by import statements. Only the exported
+// bindings of the module's environment can be reached from outside.
+type Module struct {
+    Path    string
+    Env     *Environment
+    Exports map[string]bool
+}
+func (m *Module) Type() ObjectType {
+    return MODULE_OBJ
+}
+func (m *Module) Inspect() string {
+    return "module(" + m.Path + ")"
+}
+// Member returns the current value of the exported binding name.
+func (m *Module) Member(name string) (Object, bool) {
+    if !m.Exports[name] {
+        return nil, false
+    }
+    return m.Env.Get(name)
+}
+
+// Compiled Functions
+type CompiledFunction struct {
+    Instructions  code.Instructions
+    Positions     code.Positions // source positions of the instructions
+    NumLocals     int
+    NumParameters int  // declared parameters, without the rest parameter
+    NumDefaults   int  // trailing parameters that have a default value
+    Variadic      bool // whether the function has a rest parameter
+}
+func (cf *CompiledFunction) Type() ObjectType {
+    return COMPILED_FUNCTION_OBJ
+}
+func (cf *CompiledFunction) Inspect() string {
+    return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closures are the vm's functions, so they report the same type as Function
+// to Monkey programs.
+type Closure struct {
+    Fn   *CompiledFunction
+    Free []Object
+}
+func (c *Closure) Type() ObjectType {
+    return FUNCTION_OBJ
+}
+func (c *Closure) Inspect() string {
+    return fmt.Sprintf("Closure[%p]", c)
+}
@@ -20,3 +20,94 @@ func TestStringHashKey(t *testing.T) {
         t.Errorf("strings with different content have same hash keys")
     }
 }
+
+func TestFloatHashKey(t *testing.T) {
+    half1 := &Float{Value: 0.5}
+    half2 := &Float{Value: 0.5}
+    other := &Float{Value: 1.5}
+
+    if half1.HashKey() != half2.HashKey() {
+        t.Errorf("floats with same value have different hash keys")
+    }
+
+    if half1.HashKey() == other.HashKey() {
+        t.Errorf("floats with different values have same hash keys")
+    }
+
+    if (&Float{Value: 2}).HashKey() != (&Integer{Value: 2}).HashKey() {
+        t.Errorf("integral float and equal integer have different hash keys")
+    }
+}
+
+func TestFloatInspect(t *testing.T) {
+    tests := []struct{
+        value    float64
+        expected string
+    }{
+        {1.5, "1.5"},
+        {2, "2.0"},
+        {-0.25, "-0.25"},
+        {1e21, "1e+21"},
+    }
+
+    for _, tt := range tests {
+        if actual := (&Float{Value: tt.value}).Inspect(); actual != tt.expected {
+            t.Errorf("wrong Inspect for %g. want=%q, got=%q", tt.value, tt.expected, actual)
+        }
+    }
+}
+
+func TestEnvironmentDeclare(t *testing.T) {
+    outer := NewEnvironment()
+    if !outer.Declare("a", &Integer{Value: 1}, true) {
+        t.Fatalf("declaring a constant failed")
+    }
+    if outer.Declare("a", &Integer{Value: 2}, false) {
+        t.Errorf("redeclaring a constant succeeded")
+    }
+
+    inner := NewEnclosedEnvironment(outer)
+    if !inner.IsConstant("a") {
+        t.Errorf("constant of the outer environment is not constant in the inner one")
+    }
+    if !inner.Declare("a", &Integer{Value: 3}, false) {
+        t.Fatalf("shadowing a constant of the outer environment failed")
+    }
+    if inner.IsConstant("a") {
+        t.Errorf("shadowing binding is still constant")
+    }
+    if a, _ := outer.Get("a"); a.(*Integer).Value != 1 {
+        t.Errorf("outer constant was changed. got=%s", a.Inspect())
+    }
+}
+
+func TestEnvironmentAssign(t *testing.T) {
+    outer := NewEnvironment()
+    outer.Set("a", &Integer{Value: 1})
+    inner := NewEnclosedEnvironment(outer)
+    inner.Set("b", &Integer{Value: 2})
+
+    if !inner.Assign("a", &Integer{Value: 10}) {
+        t.Fatalf("assigning to a binding of the outer environment failed")
+    }
+    if _, ok := inner.store["a"]; ok {
+        t.Errorf("assignment created a new binding in the inner environment")
+    }
+    if a, _ := outer.Get("a"); a.(*Integer).Value != 10 {
+        t.Errorf("outer binding was not updated. got=%s", a.Inspect())
+    }
+
+    if !inner.Assign("b", &Integer{Value: 20}) {
+        t.Fatalf("assigning to a binding of the inner environment failed")
+    }
+    if b, _ := inner.Get("b"); b.(*Integer).Value != 20 {
+        t.Errorf("inner binding was not updated. got=%s", b.Inspect())
+    }
+
+    if inner.Assign("c", &Integer{Value: 3}) {
+        t.Errorf("assigning to an undeclared name succeeded")
+    }
+    if _, ok := inner.Get("c"); ok {
+        t.Errorf("assigning to an undeclared name created a binding")
+    }
+}
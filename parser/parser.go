@@ -6,11 +6,16 @@ import (
 	"interpreter/lexer"
 	"interpreter/token"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 const (
     _ int = iota
     LOWEST
+    ASSIGNMENT
+    LOGICAL_OR
+    LOGICAL_AND
     EQUALS
     LESSGREATER
     SUM
@@ -21,16 +26,38 @@ const (
 )
 
 var precedences = map[token.TokenType]int {
-    token.EQ:       EQUALS,
-    token.NOT_EQ:   EQUALS,
-    token.LT:       LESSGREATER,
-    token.GT:       LESSGREATER,
-    token.PLUS:     SUM,
-    token.MINUS:    SUM,
-    token.SLASH:    PRODUCT,
-    token.ASTERISK: PRODUCT,
-    token.LPAREN:   CALL,
-    token.LBRACKET: INDEX,
+    token.ASSIGN:          ASSIGNMENT,
+    token.PLUS_ASSIGN:     ASSIGNMENT,
+    token.MINUS_ASSIGN:    ASSIGNMENT,
+    token.ASTERISK_ASSIGN: ASSIGNMENT,
+    token.SLASH_ASSIGN:    ASSIGNMENT,
+    token.PERCENT_ASSIGN:  ASSIGNMENT,
+    token.EQ:              EQUALS,
+    token.NOT_EQ:          EQUALS,
+    token.OR:              LOGICAL_OR,
+    token.AND:             LOGICAL_AND,
+    token.LT:              LESSGREATER,
+    token.GT:              LESSGREATER,
+    token.LT_EQ:           LESSGREATER,
+    token.GT_EQ:           LESSGREATER,
+    token.PLUS:            SUM,
+    token.MINUS:           SUM,
+    token.SLASH:           PRODUCT,
+    token.ASTERISK:        PRODUCT,
+    token.PERCENT:         PRODUCT,
+    token.LPAREN:          CALL,
+    token.LBRACKET:        INDEX,
+    token.DOT:             INDEX,
+}
+
+// ParseError is a syntax error found at a position in the source.
+type ParseError struct {
+    Pos     token.Position
+    Message string
+}
+
+func (e *ParseError) Error() string {
+    return fmt.Sprintf("%s: %s", e.Pos, e.Message)
 }
 
 type (
@@ -41,11 +68,15 @@ type (
 type Parser struct {
     lexer *lexer.Lexer
     
-    errors []string
+    errors []*ParseError
+    comments []token.Token // skipped COMMENT tokens, in source order
 
     currToken token.Token
     peekToken token.Token
 
+    loopDepth int // number of loops around the current statement, inside the current function
+    blockDepth int // number of blocks around the current statement
+
     prefixParseFns map[token.TokenType]prefixParseFn
     infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -53,19 +84,22 @@ type Parser struct {
 func New(lexer *lexer.Lexer) *Parser {
     parser := &Parser{
         lexer:  lexer,
-        errors: []string{},
+        errors: []*ParseError{},
     }
     
     parser.prefixParseFns = make(map[token.TokenType]prefixParseFn)
     parser.registerPrefix(token.IDENT, parser.parseIdentifier)
     parser.registerPrefix(token.INT, parser.parseIntegerLiteral)
+    parser.registerPrefix(token.FLOAT, parser.parseFloatLiteral)
     parser.registerPrefix(token.BANG, parser.parsePrefixExpression)
     parser.registerPrefix(token.MINUS, parser.parsePrefixExpression)
     parser.registerPrefix(token.TRUE, parser.parseBoolean)
     parser.registerPrefix(token.FALSE, parser.parseBoolean)
     parser.registerPrefix(token.LPAREN, parser.parseGroupedExpression)
     parser.registerPrefix(token.IF, parser.parserIfExpression)
+    parser.registerPrefix(token.TRY, parser.parseTryExpression)
     parser.registerPrefix(token.FUNCTION, parser.parseFunctionLiteral)
+    parser.registerPrefix(token.MACRO, parser.parseMacroLiteral)
     parser.registerPrefix(token.STRING, parser.parseStringLiteral)
     parser.registerPrefix(token.LBRACKET, parser.parseArrayLiteral)
     parser.registerPrefix(token.LBRACE, parser.parseHashLiteral)
@@ -75,11 +109,23 @@ func New(lexer *lexer.Lexer) *Parser {
     parser.registerInfix(token.MINUS, parser.parseInfixExpression)
     parser.registerInfix(token.SLASH, parser.parseInfixExpression)
     parser.registerInfix(token.ASTERISK, parser.parseInfixExpression)
+    parser.registerInfix(token.PERCENT, parser.parseInfixExpression)
     parser.registerInfix(token.EQ, parser.parseInfixExpression)
     parser.registerInfix(token.NOT_EQ, parser.parseInfixExpression)
     parser.registerInfix(token.LT, parser.parseInfixExpression)
     parser.registerInfix(token.GT, parser.parseInfixExpression)
+    parser.registerInfix(token.LT_EQ, parser.parseInfixExpression)
+    parser.registerInfix(token.GT_EQ, parser.parseInfixExpression)
+    parser.registerInfix(token.AND, parser.parseInfixExpression)
+    parser.registerInfix(token.OR, parser.parseInfixExpression)
+    parser.registerInfix(token.ASSIGN, parser.parseAssignExpression)
+    parser.registerInfix(token.PLUS_ASSIGN, parser.parseAssignExpression)
+    parser.registerInfix(token.MINUS_ASSIGN, parser.parseAssignExpression)
+    parser.registerInfix(token.ASTERISK_ASSIGN, parser.parseAssignExpression)
+    parser.registerInfix(token.SLASH_ASSIGN, parser.parseAssignExpression)
+    parser.registerInfix(token.PERCENT_ASSIGN, parser.parseAssignExpression)
     parser.registerInfix(token.LPAREN, parser.parseCallExpression)
+    parser.registerInfix(token.DOT, parser.parseMemberExpression)
     parser.registerInfix(token.LBRACKET, parser.parseIndexExpression)
 
 
@@ -101,23 +147,62 @@ func (parser *Parser) parseIdentifier() ast.Expression {
     return &ast.Identifier{Token: parser.currToken, Value: parser.currToken.Literal}
 }
 
-func (parser *Parser) Errors() []string {
+func (parser *Parser) Errors() []*ParseError {
     return parser.errors
 }
 
-func (parser *Parser) noPrefixFnError(token token.TokenType) {
-    msg := fmt.Sprintf("no prefix parse function found for %s", token)
-    parser.errors = append(parser.errors, msg)
+// Comments returns the comments read so far, which the lexer only emits
+// when it is created with lexer.NewWithComments.
+func (parser *Parser) Comments() []token.Token {
+    return parser.comments
 }
 
-func (parser *Parser) peekError(tokenType token.TokenType) {
-    err := fmt.Sprintf("Next token should be %s but got %s", tokenType, parser.peekToken.Type)
+func (parser *Parser) addError(pos token.Position, format string, a ...interface{}) {
+    err := &ParseError{Pos: pos, Message: fmt.Sprintf(format, a...)}
     parser.errors = append(parser.errors, err)
 }
 
+func (parser *Parser) noPrefixFnError(tokenType token.TokenType) {
+    // ERROR and ILLEGAL tokens were already reported when they were read
+    if tokenType == token.ERROR || tokenType == token.ILLEGAL {
+        return
+    }
+    parser.addError(parser.currToken.Pos, "no prefix parse function found for %s", tokenType)
+}
+
+func (parser *Parser) peekError(tokenType token.TokenType) {
+    if parser.peekTokenIs(token.ERROR) || parser.peekTokenIs(token.ILLEGAL) {
+        return
+    }
+    parser.addError(parser.peekToken.Pos, "Next token should be %s but got %s", tokenType, parser.peekToken.Type)
+}
+
 func (parser *Parser) nextToken() {
     parser.currToken = parser.peekToken
     parser.peekToken = parser.lexer.NextToken()
+    for parser.peekTokenIs(token.COMMENT) {
+        parser.comments = append(parser.comments, parser.peekToken)
+        parser.peekToken = parser.lexer.NextToken()
+    }
+
+    switch parser.peekToken.Type {
+    case token.ERROR:
+        parser.addError(parser.peekToken.Pos, "%s", parser.peekToken.Literal)
+    case token.ILLEGAL:
+        parser.addError(parser.peekToken.Pos, "%s", illegalMessage(parser.peekToken.Literal))
+    }
+}
+
+// illegalMessage describes what is wrong with an ILLEGAL token.
+func illegalMessage(literal string) string {
+    switch {
+    case strings.HasPrefix(literal, "\""):
+        return "invalid UTF-8 in string"
+    case !utf8.ValidString(literal):
+        return fmt.Sprintf("invalid UTF-8 byte 0x%02x", literal[0])
+    default:
+        return fmt.Sprintf("illegal character %q", []rune(literal)[0])
+    }
 }
 
 func (parser *Parser) ParseProgram() *ast.Program {
@@ -135,12 +220,32 @@ func (parser *Parser) ParseProgram() *ast.Program {
     return program
 }
 
+// parseStatement returns nil, not a nil pointer of a statement type, for a
+// statement that did not parse, so callers can leave it out.
 func (parser *Parser) parseStatement() ast.Statement {
     switch parser.currToken.Type {
-    case token.LET:
-        return parser.parseLetStatement()
+    case token.LET, token.CONST:
+        if statement := parser.parseLetStatement(); statement != nil {
+            return statement
+        }
+        return nil
     case token.RETURN:
         return parser.parserReturnStatement()
+    case token.THROW:
+        if statement := parser.parseThrowStatement(); statement != nil {
+            return statement
+        }
+        return nil
+    case token.WHILE:
+        return parser.parseWhileStatement()
+    case token.FOR:
+        return parser.parseForStatement()
+    case token.BREAK, token.CONTINUE:
+        return parser.parseLoopControlStatement()
+    case token.IMPORT:
+        return parser.parseImportStatement()
+    case token.EXPORT:
+        return parser.parseExportStatement()
     default:
         return parser.parseExpressionStatement()
     }
@@ -158,6 +263,15 @@ func (parser *Parser) parseLetStatement() *ast.LetStatement {
         Value: parser.currToken.Literal,
     }
 
+    if parser.peekTokenIs(token.COLON) {
+        parser.nextToken()
+        parser.nextToken()
+        statement.Type = parser.parseTypeExpression()
+        if statement.Type == nil {
+            return nil
+        }
+    }
+
     if !parser.expectPeek(token.ASSIGN) {
         return nil
     }
@@ -172,6 +286,23 @@ func (parser *Parser) parseLetStatement() *ast.LetStatement {
     return statement
 }
 
+func (parser *Parser) parseThrowStatement() *ast.ThrowStatement {
+    statement := &ast.ThrowStatement{Token: parser.currToken}
+
+    parser.nextToken()
+
+    statement.Value = parser.parseExpression(LOWEST)
+    if statement.Value == nil {
+        return nil
+    }
+
+    if parser.peekTokenIs(token.SEMICOLON) {
+        parser.nextToken()
+    }
+
+    return statement
+}
+
 func (parser *Parser) parserReturnStatement() *ast.ReturnStatement {
     statement := &ast.ReturnStatement{Token: parser.currToken}
 
@@ -186,6 +317,146 @@ func (parser *Parser) parserReturnStatement() *ast.ReturnStatement {
     return statement
 }
 
+func (parser *Parser) parseWhileStatement() ast.Statement {
+    statement := &ast.WhileStatement{Token: parser.currToken}
+
+    if !parser.expectPeek(token.LPAREN) {
+        return nil
+    }
+
+    parser.nextToken()
+    statement.Condition = parser.parseExpression(LOWEST)
+
+    if !parser.expectPeek(token.RPAREN) {
+        return nil
+    }
+
+    if !parser.expectPeek(token.LBRACE) {
+        return nil
+    }
+
+    statement.Body = parser.parseLoopBody()
+
+    if parser.peekTokenIs(token.SEMICOLON) {
+        parser.nextToken()
+    }
+
+    return statement
+}
+
+func (parser *Parser) parseForStatement() ast.Statement {
+    statement := &ast.ForStatement{Token: parser.currToken}
+
+    if !parser.expectPeek(token.LPAREN) {
+        return nil
+    }
+
+    if !parser.expectPeek(token.IDENT) {
+        return nil
+    }
+    statement.Variable = &ast.Identifier{Token: parser.currToken, Value: parser.currToken.Literal}
+
+    if !parser.expectPeek(token.IN) {
+        return nil
+    }
+
+    parser.nextToken()
+    statement.Iterable = parser.parseExpression(LOWEST)
+
+    if !parser.expectPeek(token.RPAREN) {
+        return nil
+    }
+
+    if !parser.expectPeek(token.LBRACE) {
+        return nil
+    }
+
+    statement.Body = parser.parseLoopBody()
+
+    if parser.peekTokenIs(token.SEMICOLON) {
+        parser.nextToken()
+    }
+
+    return statement
+}
+
+func (parser *Parser) parseLoopBody() *ast.BlockStatement {
+    parser.loopDepth++
+    defer func() { parser.loopDepth-- }()
+
+    return parser.parseBlockStatement()
+}
+
+func (parser *Parser) parseLoopControlStatement() ast.Statement {
+    var statement ast.Statement
+    if parser.currTokenIs(token.BREAK) {
+        statement = &ast.BreakStatement{Token: parser.currToken}
+    } else {
+        statement = &ast.ContinueStatement{Token: parser.currToken}
+    }
+
+    if parser.loopDepth == 0 {
+        parser.addError(parser.currToken.Pos, "%s outside of a loop", parser.currToken.Literal)
+    }
+
+    if parser.peekTokenIs(token.SEMICOLON) {
+        parser.nextToken()
+    }
+
+    return statement
+}
+
+// parseImportStatement parses `import "path" as name`. Imports are only
+// allowed at the top level of a file.
+func (parser *Parser) parseImportStatement() ast.Statement {
+    statement := &ast.ImportStatement{Token: parser.currToken}
+
+    if parser.blockDepth > 0 {
+        parser.addError(parser.currToken.Pos, "import is only allowed at the top level")
+    }
+
+    if !parser.expectPeek(token.STRING) {
+        return nil
+    }
+    statement.Path = &ast.StringLiteral{Token: parser.currToken, Value: parser.currToken.Literal}
+
+    if !parser.expectPeek(token.AS) {
+        return nil
+    }
+    if !parser.expectPeek(token.IDENT) {
+        return nil
+    }
+    statement.Name = &ast.Identifier{Token: parser.currToken, Value: parser.currToken.Literal}
+
+    if parser.peekTokenIs(token.SEMICOLON) {
+        parser.nextToken()
+    }
+
+    return statement
+}
+
+// parseExportStatement parses `export let name = value` and `export const`.
+func (parser *Parser) parseExportStatement() ast.Statement {
+    statement := &ast.ExportStatement{Token: parser.currToken}
+
+    if parser.blockDepth > 0 {
+        parser.addError(parser.currToken.Pos, "export is only allowed at the top level")
+    }
+
+    if !parser.peekTokenIs(token.LET) && !parser.peekTokenIs(token.CONST) {
+        parser.peekError(token.LET)
+        return nil
+    }
+    parser.nextToken()
+
+    statement.Statement = parser.parseLetStatement()
+    if statement.Statement == nil {
+        return nil
+    }
+
+    return statement
+}
+
 func (parser *Parser) parseExpressionStatement() *ast.ExpressionStatement {
     statement := &ast.ExpressionStatement{Token: parser.currToken}
 
@@ -230,6 +501,18 @@ func (parser *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
     if !parser.expectPeek(token.RBRACKET) {
         return nil
     }
+    exp.Rbracket = parser.currToken
+
+    return exp
+}
+
+func (parser *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+    exp := &ast.MemberExpression{Token: parser.currToken, Object: object}
+
+    if !parser.expectPeek(token.IDENT) {
+        return nil
+    }
+    exp.Member = &ast.Identifier{Token: parser.currToken, Value: parser.currToken.Literal}
 
     return exp
 }
@@ -239,8 +522,7 @@ func (parser *Parser) parseIntegerLiteral() ast.Expression {
 
     value, err := strconv.ParseInt(parser.currToken.Literal, 0, 64)
     if err != nil {
-        msg := fmt.Sprintf("unable to parse literal %q as int", parser.currToken.Literal)
-        parser.errors = append(parser.errors, msg)
+        parser.addError(parser.currToken.Pos, "unable to parse literal %q as int", parser.currToken.Literal)
         return nil
     }
     il.Value = value
@@ -248,6 +530,19 @@ func (parser *Parser) parseIntegerLiteral() ast.Expression {
     return il
 }
 
+func (parser *Parser) parseFloatLiteral() ast.Expression {
+    fl := &ast.FloatLiteral{Token: parser.currToken}
+
+    value, err := strconv.ParseFloat(parser.currToken.Literal, 64)
+    if err != nil {
+        parser.addError(parser.currToken.Pos, "unable to parse literal %q as float", parser.currToken.Literal)
+        return nil
+    }
+    fl.Value = value
+
+    return fl
+}
+
 func (parser* Parser) parseBoolean() ast.Expression {
     return &ast.Boolean{
         Token: parser.currToken, 
@@ -289,6 +584,7 @@ func (parser *Parser) parseArrayLiteral() ast.Expression {
     array := &ast.ArrayLiteral{Token: parser.currToken}
 
     array.Elements = parser.parseExpressionList(token.RBRACKET)
+    array.Rbracket = parser.currToken
 
     return array
 }
@@ -341,6 +637,7 @@ func (parser *Parser) parseHashLiteral() ast.Expression {
     if !parser.expectPeek(token.RBRACE) {
         return nil
     }
+    hash.Rbrace = parser.currToken
 
     return hash
 }
@@ -363,6 +660,32 @@ func (parser *Parser) expectPeek(tokenType token.TokenType) bool {
     }
 }
 
+// parseAssignExpression parses `target = value` and the compound forms like
+// `target += value`. Assignment is right associative, a = b = 1 assigns 1 to
+// both.
+func (parser *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+    expression := &ast.AssignExpression{
+        Token:    parser.currToken,
+        Target:   target,
+        Operator: parser.currToken.Literal,
+    }
+
+    switch target.(type) {
+    case *ast.Identifier, *ast.IndexExpression:
+    case nil:
+        // the target failed to parse, which has already been reported
+        return nil
+    default:
+        parser.addError(target.Pos(), "cannot assign to %s", target.String())
+        return nil
+    }
+
+    parser.nextToken()
+    expression.Value = parser.parseExpression(ASSIGNMENT - 1)
+
+    return expression
+}
+
 func (parser *Parser) parseGroupedExpression() ast.Expression {
     parser.nextToken()
 
@@ -408,12 +731,44 @@ func (parser *Parser) parserIfExpression() ast.Expression {
     return expression
 }
 
+// parseTryExpression parses `try { ... } catch (e) { ... }`.
+func (parser *Parser) parseTryExpression() ast.Expression {
+    expression := &ast.TryExpression{Token: parser.currToken}
+
+    if !parser.expectPeek(token.LBRACE) {
+        return nil
+    }
+    expression.Block = parser.parseBlockStatement()
+
+    if !parser.expectPeek(token.CATCH) {
+        return nil
+    }
+    if !parser.expectPeek(token.LPAREN) {
+        return nil
+    }
+    if !parser.expectPeek(token.IDENT) {
+        return nil
+    }
+    expression.Parameter = &ast.Identifier{Token: parser.currToken, Value: parser.currToken.Literal}
+    if !parser.expectPeek(token.RPAREN) {
+        return nil
+    }
+
+    if !parser.expectPeek(token.LBRACE) {
+        return nil
+    }
+    expression.Catch = parser.parseBlockStatement()
+
+    return expression
+}
+
 func (parser *Parser) parseBlockStatement() *ast.BlockStatement {
     block := &ast.BlockStatement{Token: parser.currToken}
     block.Statements = []ast.Statement{}
 
     parser.nextToken()
 
+    parser.blockDepth += 1
     for !parser.currTokenIs(token.RBRACE) && !parser.currTokenIs(token.EOF) {
         statement := parser.parseStatement()
         if statement != nil {
@@ -421,6 +776,8 @@ func (parser *Parser) parseBlockStatement() *ast.BlockStatement {
         }
         parser.nextToken()
     }
+    parser.blockDepth -= 1
+    block.Rbrace = parser.currToken
     return block
 }
 
@@ -430,57 +787,250 @@ func (parser *Parser) parseFunctionLiteral() ast.Expression {
         return nil
     }
 
-    fl.Parameters = parser.parseFunctionParameters()
+    if !parser.parseFunctionParameters(fl) {
+        return nil
+    }
+
+    if parser.peekTokenIs(token.COLON) {
+        parser.nextToken()
+        parser.nextToken()
+        fl.ReturnType = parser.parseTypeExpression()
+        if fl.ReturnType == nil {
+            return nil
+        }
+    }
     
     if !parser.expectPeek(token.LBRACE) {
         return nil
     }
 
+    // break and continue cannot cross function boundaries
+    loopDepth := parser.loopDepth
+    parser.loopDepth = 0
     fl.Body = parser.parseBlockStatement()
+    parser.loopDepth = loopDepth
 
     return fl
 }
 
-func (parser *Parser) parseFunctionParameters() []*ast.Identifier {
-    identifiers := []*ast.Identifier{}
+// parseMacroLiteral parses `macro(a, b) { body }`. Macro parameters have no
+// default values and no rest parameter.
+func (parser *Parser) parseMacroLiteral() ast.Expression {
+    ml := &ast.MacroLiteral{Token: parser.currToken, Parameters: []*ast.Identifier{}}
+    if !parser.expectPeek(token.LPAREN) {
+        return nil
+    }
 
     if parser.peekTokenIs(token.RPAREN) {
         parser.nextToken()
-        return identifiers
+    } else {
+        for {
+            if !parser.expectPeek(token.IDENT) {
+                return nil
+            }
+            ml.Parameters = append(ml.Parameters, &ast.Identifier{Token: parser.currToken, Value: parser.currToken.Literal})
+
+            if !parser.peekTokenIs(token.COMMA) {
+                break
+            }
+            parser.nextToken()
+        }
+        if !parser.expectPeek(token.RPAREN) {
+            return nil
+        }
     }
 
-    parser.nextToken()
-
-    ident := &ast.Identifier{
-        Token:  parser.currToken,
-        Value:  parser.currToken.Literal, 
+    if !parser.expectPeek(token.LBRACE) {
+        return nil
     }
-    identifiers = append(identifiers, ident)    
-    
-    for parser.peekTokenIs(token.COMMA) {
+
+    loopDepth := parser.loopDepth
+    parser.loopDepth = 0
+    ml.Body = parser.parseBlockStatement()
+    parser.loopDepth = loopDepth
+
+    return ml
+}
+
+// parseFunctionParameters parses `(a, b: int = 2, ...rest)`. Parameters with
+// a default value have to come after the required ones and the rest parameter
+// has to be the last one.
+func (parser *Parser) parseFunctionParameters(fl *ast.FunctionLiteral) bool {
+    fl.Parameters = []*ast.Identifier{}
+
+    if parser.peekTokenIs(token.RPAREN) {
         parser.nextToken()
+        return true
+    }
+
+    for {
         parser.nextToken()
+
+        if parser.currTokenIs(token.ELLIPSIS) {
+            if !parser.expectPeek(token.IDENT) {
+                return false
+            }
+            fl.Rest = &ast.Identifier{Token: parser.currToken, Value: parser.currToken.Literal}
+            if !parser.parseParameterType(fl, fl.Rest) {
+                return false
+            }
+            break
+        }
+
+        if !parser.currTokenIs(token.IDENT) {
+            parser.addError(parser.currToken.Pos, "expected parameter name but got %s", parser.currToken.Type)
+            return false
+        }
+
         ident := &ast.Identifier{
             Token:  parser.currToken,
             Value:  parser.currToken.Literal, 
         }
-        identifiers = append(identifiers, ident)    
+        fl.Parameters = append(fl.Parameters, ident)
+        if !parser.parseParameterType(fl, ident) {
+            return false
+        }
+
+        if parser.peekTokenIs(token.ASSIGN) {
+            parser.nextToken()
+            parser.nextToken()
+            if fl.Defaults == nil {
+                fl.Defaults = make(map[string]ast.Expression)
+            }
+            fl.Defaults[ident.Value] = parser.parseExpression(LOWEST)
+        } else if len(fl.Defaults) > 0 {
+            parser.addError(ident.Pos(), "parameter %s without default value follows parameters with default values", ident.Value)
+            return false
+        }
+
+        if !parser.peekTokenIs(token.COMMA) {
+            break
+        }
+        parser.nextToken()
     }
 
-    if !parser.expectPeek(token.RPAREN) {
+    return parser.expectPeek(token.RPAREN)
+}
+
+// parseParameterType parses the annotation after a parameter name, if there
+// is one.
+func (parser *Parser) parseParameterType(fl *ast.FunctionLiteral, parameter *ast.Identifier) bool {
+    if !parser.peekTokenIs(token.COLON) {
+        return true
+    }
+    parser.nextToken()
+    parser.nextToken()
+
+    t := parser.parseTypeExpression()
+    if t == nil {
+        return false
+    }
+    if fl.ParameterTypes == nil {
+        fl.ParameterTypes = make(map[string]*ast.TypeExpression)
+    }
+    fl.ParameterTypes[parameter.Value] = t
+    return true
+}
+
+// typeArguments holds the type names an annotation can use, with the number
+// of element types they take between < and >.
+var typeArguments = map[string]int {
+    "int":    0,
+    "float":  0,
+    "string": 0,
+    "bool":   0,
+    "null":   0,
+    "any":    0,
+    "array":  1,
+    "hash":   2,
+}
+
+// parseTypeExpression parses a type annotation like int, array<string>,
+// hash<string, int> or fn(int, int): bool, starting at its first token.
+func (parser *Parser) parseTypeExpression() *ast.TypeExpression {
+    te := &ast.TypeExpression{Token: parser.currToken, Name: parser.currToken.Literal}
+
+    if parser.currTokenIs(token.FUNCTION) {
+        if !parser.peekTokenIs(token.LPAREN) {
+            return te
+        }
+        parser.nextToken()
+
+        te.Arguments = []*ast.TypeExpression{}
+        for !parser.peekTokenIs(token.RPAREN) {
+            if len(te.Arguments) > 0 && !parser.expectPeek(token.COMMA) {
+                return nil
+            }
+            parser.nextToken()
+            argument := parser.parseTypeExpression()
+            if argument == nil {
+                return nil
+            }
+            te.Arguments = append(te.Arguments, argument)
+        }
+        parser.nextToken()
+        te.Close = parser.currToken
+
+        if parser.peekTokenIs(token.COLON) {
+            parser.nextToken()
+            parser.nextToken()
+            te.Result = parser.parseTypeExpression()
+            if te.Result == nil {
+                return nil
+            }
+        }
+        return te
+    }
+
+    if !parser.currTokenIs(token.IDENT) {
+        parser.addError(parser.currToken.Pos, "expected type but got %s", parser.currToken.Type)
         return nil
     }
+    count, ok := typeArguments[te.Name]
+    if !ok {
+        parser.addError(parser.currToken.Pos, "unknown type %s", te.Name)
+        return nil
+    }
+    if count == 0 || !parser.peekTokenIs(token.LT) {
+        return te
+    }
+    parser.nextToken()
 
-    return identifiers
+    for i := 0; i < count; i++ {
+        if i > 0 && !parser.expectPeek(token.COMMA) {
+            return nil
+        }
+        parser.nextToken()
+        argument := parser.parseTypeExpression()
+        if argument == nil {
+            return nil
+        }
+        te.Arguments = append(te.Arguments, argument)
+    }
+    if !parser.expectPeek(token.GT) {
+        return nil
+    }
+    te.Close = parser.currToken
+    return te
 }
 
 func (parser *Parser) parseCallExpression(function ast.Expression) ast.Expression {
     e := &ast.CallExpression{Token: parser.currToken, Function: function}
     e.Arguments = parser.parseExpressionList(token.RPAREN)
+    e.Rparen = parser.currToken
 
     return e
 }
 
+// Precedence returns how tightly an infix operator binds, LOWEST for tokens
+// that are not infix operators.
+func Precedence(tokenType token.TokenType) int {
+    if p, ok := precedences[tokenType]; ok {
+        return p
+    }
+    return LOWEST
+}
+
 func (parser *Parser) peekPrecedence() int {
     if p, ok := precedences[parser.peekToken.Type]; ok {
         return p
@@ -3,6 +3,7 @@ package parser
 import (
 	"interpreter/ast"
 	"interpreter/lexer"
+	"reflect"
 	"testing"
     "fmt"
 )
@@ -41,6 +42,33 @@ func TestLetStatements(t *testing.T) {
     }
 }
 
+func TestConstStatements(t *testing.T) {
+    l := lexer.New("const x = 5; let y = x;")
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if len(program.Statements) != 2 {
+        t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+    }
+
+    constant, ok := program.Statements[0].(*ast.LetStatement)
+    if !ok {
+        t.Fatalf("statement is not *ast.LetStatement. got=%T", program.Statements[0])
+    }
+    if !constant.IsConst() || constant.Name.Value != "x" {
+        t.Errorf("wrong const statement. got=%q", constant.String())
+    }
+    testLiteralExpression(t, constant.Value, 5)
+
+    if program.Statements[1].(*ast.LetStatement).IsConst() {
+        t.Errorf("let statement is const")
+    }
+    if program.String() != "const x = 5;let y = x;" {
+        t.Errorf("wrong program. got=%q", program.String())
+    }
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
     if s.TokenLiteral() != "let" {
         t.Errorf("statement.TokenLiteral is not let, got: %q", s.TokenLiteral())
@@ -243,6 +271,10 @@ func TestParsingInfixExpressions(t *testing.T) {
         {"5 < 5", 5, "<",5},
         {"5 == 5", 5, "==",5},
         {"5 != 5", 5, "!=",5},
+        {"5 <= 5", 5, "<=",5},
+        {"5 >= 5", 5, ">=",5},
+        {"true && false", true, "&&", false},
+        {"true || false", true, "||", false},
         {"true == true", true, "==", true},
         {"true != false", true, "!=", false},
         {"false == false", false, "==", false},
@@ -394,6 +426,22 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
             "add(a * b[2], b[1], 2 * [1, 2][1])",
             "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
         },
+        {
+            "a <= b == c >= d",
+            "((a <= b) == (c >= d))",
+        },
+        {
+            "a || b && c",
+            "(a || (b && c))",
+        },
+        {
+            "a && b || c && d",
+            "((a && b) || (c && d))",
+        },
+        {
+            "!a && b == c || d < e + 1",
+            "(((!a) && (b == c)) || (d < (e + 1)))",
+        },
     }
 
     for _, tt := range tests{
@@ -603,6 +651,126 @@ func TestFunctionParameters(t *testing.T) {
     }
 }
 
+func TestMacroLiteralParsing(t *testing.T) {
+    input := `macro(x, y) { x + y; }`
+
+    l := lexer.New(input)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    if len(program.Statements) != 1 {
+        t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+    }
+
+    stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+    if !ok {
+        t.Fatalf("statement is not ast.ExpressionStatement. got=%T", program.Statements[0])
+    }
+
+    macro, ok := stmt.Expression.(*ast.MacroLiteral)
+    if !ok {
+        t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T", stmt.Expression)
+    }
+
+    if len(macro.Parameters) != 2 {
+        t.Fatalf("macro literal parameters wrong. want 2, got=%d", len(macro.Parameters))
+    }
+    testLiteralExpression(t, macro.Parameters[0], "x")
+    testLiteralExpression(t, macro.Parameters[1], "y")
+
+    if len(macro.Body.Statements) != 1 {
+        t.Fatalf("macro.Body.Statements has not 1 statements. got=%d", len(macro.Body.Statements))
+    }
+    bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+    if !ok {
+        t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T", macro.Body.Statements[0])
+    }
+    testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+
+    for _, input := range []string{"macro() { 1 }", "macro(a) { a }"} {
+        p := New(lexer.New(input))
+        p.ParseProgram()
+        checkParserErrors(t, p)
+    }
+
+    p = New(lexer.New("macro(a = 1) { a }"))
+    p.ParseProgram()
+    if len(p.Errors()) == 0 {
+        t.Errorf("expected an error for a macro parameter with a default value")
+    }
+}
+
+func TestImportAndExportStatements(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {`import "lib/math.mk" as math`, `import "lib/math.mk" as math;`},
+        {`import "a.mk" as a; import "b.mk" as b;`, `import "a.mk" as a;import "b.mk" as b;`},
+        {`export let square = fn(x) { x * x };`, `export let square = fn(x) (x * x);`},
+        {`export const pi = 3`, `export const pi = 3;`},
+        {`math.square(2)`, `math.square(2)`},
+        {`-lib.value * 2`, `((-lib.value) * 2)`},
+        {`a.b.c`, `a.b.c`},
+        {`lib.items[0]`, `(lib.items[0])`},
+    }
+
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        if program.String() != tt.expected {
+            t.Errorf("wrong program. expected=%q, got=%q", tt.expected, program.String())
+        }
+    }
+
+    l := lexer.New(`import "lib.mk" as lib`)
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    stmt, ok := program.Statements[0].(*ast.ImportStatement)
+    if !ok {
+        t.Fatalf("statement is not *ast.ImportStatement. got=%T", program.Statements[0])
+    }
+    if stmt.Path.Value != "lib.mk" || stmt.Name.Value != "lib" {
+        t.Errorf("wrong import. path=%q, name=%q", stmt.Path.Value, stmt.Name.Value)
+    }
+}
+
+func TestImportAndExportErrors(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {`import lib`, "Next token should be STRING but got IDENT"},
+        {`import "lib.mk"`, "Next token should be AS but got EOF"},
+        {`import "lib.mk" as "lib"`, "Next token should be IDENT but got STRING"},
+        {`export fn() {}`, "Next token should be LET but got FUNCTION"},
+        {`fn() { import "lib.mk" as lib }`, "import is only allowed at the top level"},
+        {`if (true) { export let x = 1 }`, "export is only allowed at the top level"},
+        {`lib.x = 1`, "cannot assign to lib.x"},
+        {`lib.(x)`, "Next token should be IDENT but got ("},
+    }
+
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        p.ParseProgram()
+
+        if len(p.Errors()) == 0 {
+            t.Errorf("%q: expected a parse error", tt.input)
+            continue
+        }
+        if p.Errors()[0].Message != tt.expected {
+            t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected, p.Errors()[0].Message)
+        }
+    }
+}
+
 func TestCallExpressionParsing(t *testing.T) {
     input := "add(1, 2 * 3 , 4 + 5)"
 
@@ -736,7 +904,7 @@ func TestParsingHashLiteralsStringsKeys(t *testing.T) {
         if !ok {
             t.Errorf("key is not ast.StringLiteral. got=%T", key)
         }
-        expectedValue := expected[literal.String()]
+        expectedValue := expected[literal.Value]
 
         testIntegerLiteral(t, value, expectedValue)
     }
@@ -792,11 +960,485 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
             t.Errorf("key is not ast.StringLiteral. got=%T", key)
             continue
         }
-        testFunc, ok := tests[literal.String()]
+        testFunc, ok := tests[literal.Value]
         if !ok {
-            t.Errorf("No test function for key %q found", literal.String())
+            t.Errorf("No test function for key %q found", literal.Value)
             continue
         }
         testFunc(value)
     }
 }
+
+func TestParserErrorPositions(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"let x 5;", "1:7: Next token should be = but got INT"},
+        {"add(1,\n  2", "2:4: Next token should be ) but got EOF"},
+        {"let a = 1;\n  }", "2:3: no prefix parse function found for }"},
+        {"let a = 1; /* oops", "1:12: unterminated comment"},
+        {"let a = /* oops", "1:9: unterminated comment"},
+        {"let a = 1 @ 2;", "1:11: illegal character '@'"},
+        {"let ä = \xff;", "1:9: invalid UTF-8 byte 0xff"},
+        {"let s = \"a\xffb\";", "1:9: invalid UTF-8 in string"},
+        {"let s = \"never closed;", "1:9: unterminated string"},
+        {"let s = \"tab\\q\";", "1:13: unknown escape sequence \\q"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        p.ParseProgram()
+
+        errors := p.Errors()
+        if len(errors) == 0 {
+            t.Errorf("expected parser errors for %q", tt.input)
+            continue
+        }
+
+        if errors[0].Error() != tt.expected {
+            t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0].Error())
+        }
+    }
+}
+
+// Statements that do not parse are left out, never added as nil pointers.
+func TestBrokenStatementsAreLeftOut(t *testing.T) {
+    inputs := []string{
+        "let = 5;\nlet x = 1;",
+        "let x: array< = 1",
+        "throw ;",
+        "export let ;",
+        "fn() { let = 1; throw ; }",
+    }
+
+    for _, input := range inputs {
+        program := New(lexer.New(input)).ParseProgram()
+        ast.Inspect(program, func(node ast.Node) bool {
+            if block, ok := node.(*ast.BlockStatement); ok {
+                checkStatements(t, input, block.Statements)
+            }
+            return true
+        })
+        checkStatements(t, input, program.Statements)
+    }
+}
+
+func checkStatements(t *testing.T, input string, statements []ast.Statement) {
+    for i, statement := range statements {
+        if statement == nil || reflect.ValueOf(statement).IsNil() {
+            t.Errorf("%q: statement %d is nil", input, i)
+        }
+    }
+}
+
+func TestParsingWithComments(t *testing.T) {
+    input := `
+// add two numbers
+let add = fn(a, /* first */ b) {
+    a + b // sum
+};
+/* call it */ add(1, 2);
+`
+    expected := "let add = fn(a,b) (a + b);add(1, 2)"
+
+    for _, l := range []*lexer.Lexer{lexer.New(input), lexer.NewWithComments(input)} {
+        p := New(l)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        if program.String() != expected {
+            t.Errorf("wrong program. expected=%q, got=%q", expected, program.String())
+        }
+    }
+}
+
+func TestNodePositions(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"a + b", "1:1-1:6"},
+        {"  -a * b", "1:3-1:9"},
+        {"add(1,\n 2)", "1:1-2:4"},
+        {"myArray[1 + 1]", "1:1-1:15"},
+        {"if (x) { y } else { z }", "1:1-1:24"},
+        {"fn(x) {\n  x\n}", "1:1-3:2"},
+        {`{"a": 1}`, "1:1-1:9"},
+        {"let x = [1, 2];", "1:1-1:15"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        stmt := program.Statements[0]
+        actual := fmt.Sprintf("%s-%s", stmt.Pos(), stmt.End())
+        if actual != tt.expected {
+            t.Errorf("wrong position for %q. expected=%q, got=%q", tt.input, tt.expected, actual)
+        }
+    }
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected float64
+    }{
+        {"1.5;", 1.5},
+        {".25", 0.25},
+        {"1e-3", 0.001},
+    }
+
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        stmt := program.Statements[0].(*ast.ExpressionStatement)
+        literal, ok := stmt.Expression.(*ast.FloatLiteral)
+        if !ok {
+            t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+        }
+
+        if literal.Value != tt.expected {
+            t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+        }
+    }
+}
+
+func TestFunctionDefaultAndRestParameters(t *testing.T) {
+    tests := []struct{
+        input            string
+        expectedParams   []string
+        expectedDefaults map[string]string
+        expectedRest     string
+        expectedString   string
+    }{
+        {"fn(a, b = 2) {}", []string{"a", "b"}, map[string]string{"b": "2"}, "", "fn(a,b = 2) "},
+        {"fn(a = 1 + 1, b = a) {}", []string{"a", "b"}, map[string]string{"a": "(1 + 1)", "b": "a"}, "", "fn(a = (1 + 1),b = a) "},
+        {"fn(a, ...rest) {}", []string{"a"}, map[string]string{}, "rest", "fn(a,...rest) "},
+        {"fn(...args) {}", []string{}, map[string]string{}, "args", "fn(...args) "},
+        {"fn(a, b = 2, ...c) {}", []string{"a", "b"}, map[string]string{"b": "2"}, "c", "fn(a,b = 2,...c) "},
+    }
+
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+
+        if len(function.Parameters) != len(tt.expectedParams) {
+            t.Fatalf("length parameters wrong. want %d, got=%d", len(tt.expectedParams), len(function.Parameters))
+        }
+        for i, ident := range tt.expectedParams {
+            testLiteralExpression(t, function.Parameters[i], ident)
+        }
+
+        if len(function.Defaults) != len(tt.expectedDefaults) {
+            t.Errorf("wrong number of defaults. want %d, got=%d", len(tt.expectedDefaults), len(function.Defaults))
+        }
+        for name, expected := range tt.expectedDefaults {
+            if value, ok := function.Defaults[name]; !ok || value.String() != expected {
+                t.Errorf("wrong default for %s. want %q, got=%v", name, expected, value)
+            }
+        }
+
+        if tt.expectedRest == "" && function.Rest != nil {
+            t.Errorf("unexpected rest parameter %s", function.Rest)
+        }
+        if tt.expectedRest != "" && (function.Rest == nil || function.Rest.Value != tt.expectedRest) {
+            t.Errorf("wrong rest parameter. want %s, got=%v", tt.expectedRest, function.Rest)
+        }
+
+        if function.String() != tt.expectedString {
+            t.Errorf("wrong String(). want %q, got=%q", tt.expectedString, function.String())
+        }
+    }
+}
+
+func TestFunctionParameterErrors(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"fn(a = 1, b) {}", "1:11: parameter b without default value follows parameters with default values"},
+        {"fn(...a, b) {}", "1:8: Next token should be ) but got ,"},
+        {"fn(1) {}", "1:4: expected parameter name but got INT"},
+        {"fn(...) {}", "1:7: Next token should be IDENT but got )"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        p.ParseProgram()
+
+        if len(p.Errors()) == 0 {
+            t.Errorf("expected parser errors for %q", tt.input)
+            continue
+        }
+
+        if p.Errors()[0].Error() != tt.expected {
+            t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, p.Errors()[0].Error())
+        }
+    }
+}
+
+func TestTypeAnnotations(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"let x: int = 1;", "let x: int = 1;"},
+        {"const names: array<string> = [];", "const names: array<string> = [];"},
+        {"let h: hash<string, array<int>> = {};", "let h: hash<string, array<int>> = {};"},
+        {"let f: fn = len;", "let f: fn = len;"},
+        {"let f: fn(int, string): bool = g;", "let f: fn(int, string): bool = g;"},
+        {"let f: fn(): null = g;", "let f: fn(): null = g;"},
+        {"fn(a: int, b: float = 1.5, ...rest: array<any>): string { a }", "fn(a: int,b: float = 1.5,...rest: array<any>) : string a"},
+        {"fn(f: fn(int): int): fn(int) { f }", "fn(f: fn(int): int) : fn(int) f"},
+        {"fn(a, b: hash) { a }", "fn(a,b: hash) a"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        if program.String() != tt.expected {
+            t.Errorf("wrong program. expected=%q, got=%q", tt.expected, program.String())
+        }
+    }
+
+    program := New(lexer.New("let x: array<int> = [];")).ParseProgram()
+    let := program.Statements[0].(*ast.LetStatement)
+    if let.Type.Name != "array" || len(let.Type.Arguments) != 1 || let.Type.Arguments[0].Name != "int" {
+        t.Errorf("wrong type. got=%+v", let.Type)
+    }
+    if let.Type.Pos().String() != "1:8" || let.Type.End().String() != "1:18" {
+        t.Errorf("wrong type position. got=%s to %s", let.Type.Pos(), let.Type.End())
+    }
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"let x: integer = 1;", "1:8: unknown type integer"},
+        {"let x: = 1;", "1:8: expected type but got ="},
+        {"let x: array<int = 1;", "1:18: Next token should be > but got ="},
+        {"let x: hash<string> = {};", "1:19: Next token should be , but got >"},
+        {"fn(a: 1) {}", "1:7: expected type but got INT"},
+        {"fn(): {}", "1:7: expected type but got {"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        p.ParseProgram()
+
+        if len(p.Errors()) == 0 {
+            t.Errorf("expected parser errors for %q", tt.input)
+            continue
+        }
+
+        if p.Errors()[0].Error() != tt.expected {
+            t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, p.Errors()[0].Error())
+        }
+    }
+}
+
+func TestLoopStatements(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"while (x < 10) { x }", "while(x < 10) x"},
+        {"while (true) { break; }", "whiletrue break;"},
+        {"for (x in [1, 2]) { continue; x }", "for(x in [1, 2]) continue;x"},
+        {"for (c in \"abc\") { if (c == \"b\") { break } }", "for(c in \"abc\") if(c == \"b\") break;"},
+        {"while (a) { fn() { while (b) { break } } };", "whilea fn() whileb break;"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        if len(program.Statements) != 1 {
+            t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+        }
+
+        if program.String() != tt.expected {
+            t.Errorf("wrong program. expected=%q, got=%q", tt.expected, program.String())
+        }
+    }
+
+    l := lexer.New("for (item in items) { item }")
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    statement, ok := program.Statements[0].(*ast.ForStatement)
+    if !ok {
+        t.Fatalf("statement is not *ast.ForStatement. got=%T", program.Statements[0])
+    }
+    testIdentifier(t, statement.Variable, "item")
+    testIdentifier(t, statement.Iterable, "items")
+    if len(statement.Body.Statements) != 1 {
+        t.Errorf("body does not contain 1 statement. got=%d", len(statement.Body.Statements))
+    }
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"break;", "1:1: break outside of a loop"},
+        {"if (true) { continue }", "1:13: continue outside of a loop"},
+        {"while (true) { fn() { break } }", "1:23: break outside of a loop"},
+        {"for (x [1]) { x }", "1:8: Next token should be IN but got ["},
+        {"for (1 in x) { x }", "1:6: Next token should be IDENT but got INT"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        p.ParseProgram()
+
+        if len(p.Errors()) == 0 {
+            t.Errorf("expected parser errors for %q", tt.input)
+            continue
+        }
+
+        if p.Errors()[0].Error() != tt.expected {
+            t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, p.Errors()[0].Error())
+        }
+    }
+}
+
+func TestTryAndThrow(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"try { x } catch (e) { e }", "try x catch(e) e"},
+        {"let v = try { f() } catch (err) { 0 };", "let v = try f() catch(err) 0;"},
+        {"throw \"boom\";", "throw \"boom\";"},
+        {"throw {\"kind\": k}", "throw {\"kind\":k};"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        if program.String() != tt.expected {
+            t.Errorf("wrong program. expected=%q, got=%q", tt.expected, program.String())
+        }
+    }
+
+    errorTests := []struct{
+        input    string
+        expected string
+    }{
+        {"try { x }", "1:10: Next token should be CATCH but got EOF"},
+        {"try { x } catch { e }", "1:17: Next token should be ( but got {"},
+        {"try { x } catch (1) { e }", "1:18: Next token should be IDENT but got INT"},
+        {"throw;", "1:6: no prefix parse function found for ;"},
+    }
+
+    for _, tt := range errorTests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        p.ParseProgram()
+
+        if len(p.Errors()) == 0 {
+            t.Errorf("expected parser errors for %q", tt.input)
+            continue
+        }
+
+        if p.Errors()[0].Error() != tt.expected {
+            t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, p.Errors()[0].Error())
+        }
+    }
+}
+
+func TestAssignExpressions(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"x = 5;", "x = 5"},
+        {"x += 1 + 2", "x += (1 + 2)"},
+        {"x -= y", "x -= y"},
+        {"x *= 2; y /= 2; z %= 2", "x *= 2y /= 2z %= 2"},
+        {"a = b = c", "a = b = c"},
+        {"arr[0] = 1", "(arr[0]) = 1"},
+        {`h["k"] += 2`, `(h["k"]) += 2`},
+        {"x = y || z", "x = (y || z)"},
+        {"f(x = 1)", "f(x = 1)"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        program := p.ParseProgram()
+        checkParserErrors(t, p)
+
+        if program.String() != tt.expected {
+            t.Errorf("wrong program. expected=%q, got=%q", tt.expected, program.String())
+        }
+    }
+
+    l := lexer.New("a = b = 1")
+    p := New(l)
+    program := p.ParseProgram()
+    checkParserErrors(t, p)
+
+    outer := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.AssignExpression)
+    testIdentifier(t, outer.Target, "a")
+    inner, ok := outer.Value.(*ast.AssignExpression)
+    if !ok {
+        t.Fatalf("assignment is not right associative. got=%T", outer.Value)
+    }
+    testIdentifier(t, inner.Target, "b")
+    testLiteralExpression(t, inner.Value, 1)
+}
+
+func TestInvalidAssignmentTargets(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {"1 = 2", "1:1: cannot assign to 1"},
+        {"a + b = 2", "1:1: cannot assign to (a + b)"},
+        {"f() += 1", "1:1: cannot assign to f()"},
+    }
+
+    for _, tt := range tests {
+        l := lexer.New(tt.input)
+        p := New(l)
+        p.ParseProgram()
+
+        if len(p.Errors()) == 0 {
+            t.Errorf("expected parser errors for %q", tt.input)
+            continue
+        }
+
+        if p.Errors()[0].Error() != tt.expected {
+            t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, p.Errors()[0].Error())
+        }
+    }
+}
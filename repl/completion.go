@@ -0,0 +1,101 @@
+package repl
+
+import (
+	"interpreter/evaluator"
+	"interpreter/object"
+	"interpreter/token"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// complete returns the completions of the word before cursor, a rune index
+// into line, and the index the word starts at. After `h["` the word is
+// completed with the string keys of the hash h, otherwise with the names
+// bound in the environment, the builtins and the keywords.
+func (r *REPL) complete(line string, cursor int) ([]string, int) {
+    before := string([]rune(line)[:cursor])
+
+    if name, prefix, ok := hashKeyPrefix(before); ok {
+        return r.hashKeys(name, prefix), cursor - len([]rune(prefix))
+    }
+
+    prefix := identifierSuffix(before)
+    if prefix == "" {
+        return nil, cursor
+    }
+
+    seen := make(map[string]bool)
+    var candidates []string
+    for _, names := range [][]string{r.env.Names(), evaluator.BuiltinNames, token.Keywords()} {
+        for _, name := range names {
+            if strings.HasPrefix(name, prefix) && !seen[name] {
+                seen[name] = true
+                candidates = append(candidates, name)
+            }
+        }
+    }
+    sort.Strings(candidates)
+    return candidates, cursor - len([]rune(prefix))
+}
+
+// hashKeys returns the string keys of the hash bound to name that start with
+// prefix, closed with `"]`.
+func (r *REPL) hashKeys(name, prefix string) []string {
+    value, ok := r.env.Get(name)
+    if !ok {
+        return nil
+    }
+    hash, ok := value.(*object.Hash)
+    if !ok {
+        return nil
+    }
+
+    var keys []string
+    for _, pair := range hash.Pairs {
+        key, ok := pair.Key.(*object.String)
+        if ok && strings.HasPrefix(key.Value, prefix) {
+            keys = append(keys, key.Value + `"]`)
+        }
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// hashKeyPrefix splits text ending in `name["prefix` into name and prefix.
+func hashKeyPrefix(text string) (name, prefix string, ok bool) {
+    open := strings.LastIndex(text, `["`)
+    if open < 0 {
+        return "", "", false
+    }
+    prefix = text[open+2:]
+    if strings.Contains(prefix, `"`) {
+        return "", "", false
+    }
+    name = identifierSuffix(text[:open])
+    return name, prefix, name != ""
+}
+
+// identifierSuffix returns the identifier text ends with, if any.
+func identifierSuffix(text string) string {
+    runes := []rune(text)
+    start := len(runes)
+    for start > 0 && (unicode.IsLetter(runes[start-1]) || runes[start-1] == '_') {
+        start--
+    }
+    return string(runes[start:])
+}
+
+// commonPrefix returns the longest prefix shared by all words.
+func commonPrefix(words []string) string {
+    prefix := []rune(words[0])
+    for _, word := range words[1:] {
+        runes := []rune(word)
+        n := 0
+        for n < len(prefix) && n < len(runes) && prefix[n] == runes[n] {
+            n++
+        }
+        prefix = prefix[:n]
+    }
+    return string(prefix)
+}
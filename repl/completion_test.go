@@ -0,0 +1,80 @@
+package repl
+
+import (
+	"bufio"
+	"interpreter/evaluator"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+    r := New(io.Discard, evaluator.Options{})
+    r.eval(`let person = {"name": "Ada", "nationality": "UK", "age": 36, 1: "one"}; let pushAll = fn() {}; let count = 0;`, r.options)
+
+    tests := []struct{
+        line     string
+        expected []string
+        start    int
+    }{
+        {"pu", []string{"push", "pushAll", "puts"}, 0},
+        {"let x = fir", []string{"first"}, 8},
+        {"co", []string{"const", "continue", "count"}, 0},
+        {"per", []string{"person"}, 0},
+        {"wh", []string{"while"}, 0},
+        {`person["na`, []string{`name"]`, `nationality"]`}, 8},
+        {`person["`, []string{`age"]`, `name"]`, `nationality"]`}, 8},
+        {`count["`, nil, 7},
+        {`missing["`, nil, 9},
+        {`person["name"] + le`, []string{"len", "let"}, 17},
+        {"1 + ", nil, 4},
+        {"zzz", nil, 0},
+    }
+
+    for _, tt := range tests {
+        candidates, start := r.complete(tt.line, len([]rune(tt.line)))
+
+        if !reflect.DeepEqual(candidates, tt.expected) {
+            t.Errorf("%q: wrong completions. expected=%q, got=%q", tt.line, tt.expected, candidates)
+        }
+        if tt.expected != nil && start != tt.start {
+            t.Errorf("%q: wrong start. expected=%d, got=%d", tt.line, tt.start, start)
+        }
+    }
+}
+
+func TestTabCompletion(t *testing.T) {
+    r := New(io.Discard, evaluator.Options{})
+    r.eval(`let person = {"name": "Ada"}; let pushAll = fn() {};`, r.options)
+
+    tests := []struct{
+        keys     string
+        expected string
+        listed   string
+    }{
+        {"pers\t\r", "person", ""},
+        {"person[\"n\t\r", `person["name"]`, ""},
+        {"first(pe\t)\x1b[D\r", "first(person)", ""},
+        {"pu\t\r", "pu", "push  pushAll  puts"},
+        {"pus\t\r", "push", ""},
+        {"xyz\t\r", "xyz", ""},
+    }
+
+    for _, tt := range tests {
+        var out strings.Builder
+        e := &lineEditor{in: bufio.NewReader(strings.NewReader(tt.keys)), out: &out, fd: -1, history: &History{}, complete: r.complete}
+
+        line, err := e.ReadLine(PROMPT)
+        if err != nil {
+            t.Errorf("%q: unexpected error %s", tt.keys, err)
+            continue
+        }
+        if line != tt.expected {
+            t.Errorf("%q: wrong line. expected=%q, got=%q", tt.keys, tt.expected, line)
+        }
+        if tt.listed != "" && !strings.Contains(out.String(), "\r\n" + tt.listed + "\r\n") {
+            t.Errorf("%q: completions not listed. got=%q", tt.keys, out.String())
+        }
+    }
+}
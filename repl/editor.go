@@ -0,0 +1,374 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// errInterrupted is returned by ReadLine when the user presses Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+type lineReader interface {
+    // ReadLine shows prompt and reads a line without its line ending. It
+    // returns io.EOF at the end of the input.
+    ReadLine(prompt string) (string, error)
+}
+
+// plainReader reads lines without any editing, for input that is not a
+// terminal.
+type plainReader struct {
+    scanner *bufio.Scanner
+    out     io.Writer
+}
+
+func (r *plainReader) ReadLine(prompt string) (string, error) {
+    io.WriteString(r.out, prompt)
+    if !r.scanner.Scan() {
+        if err := r.scanner.Err(); err != nil {
+            return "", err
+        }
+        return "", io.EOF
+    }
+    return r.scanner.Text(), nil
+}
+
+const (
+    keyCtrlA     = 1
+    keyCtrlB     = 2
+    keyCtrlC     = 3
+    keyCtrlD     = 4
+    keyCtrlE     = 5
+    keyCtrlF     = 6
+    keyCtrlG     = 7
+    keyCtrlH     = 8
+    keyTab       = 9
+    keyNewline   = 10
+    keyCtrlK     = 11
+    keyCtrlL     = 12
+    keyEnter     = 13
+    keyCtrlN     = 14
+    keyCtrlP     = 16
+    keyCtrlR     = 18
+    keyCtrlU     = 21
+    keyCtrlW     = 23
+    keyEscape    = 27
+    keyBackspace = 127
+)
+
+// Keys sent as escape sequences get negative codes, so they cannot clash
+// with typed characters.
+const (
+    keyUp rune = -(iota + 1)
+    keyDown
+    keyRight
+    keyLeft
+    keyHome
+    keyEnd
+    keyDelete
+    keyUnknown
+    keyNone // no key left to handle
+)
+
+// lineEditor reads lines from a terminal with cursor movement, Emacs style
+// shortcuts, history browsing, reverse search (Ctrl-R) and tab completion.
+type lineEditor struct {
+    in      *bufio.Reader
+    out     io.Writer
+    fd      int // terminal put in raw mode while reading, -1 for none
+    history *History
+
+    // complete returns the completions for the word before cursor and where
+    // that word starts.
+    complete func(line string, cursor int) ([]string, int)
+
+    prompt string
+    line   []rune
+    cursor int
+}
+
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+    if e.fd >= 0 {
+        restore, err := makeRaw(e.fd)
+        if err != nil {
+            return "", err
+        }
+        defer restore()
+    }
+
+    e.prompt = prompt
+    e.line = nil
+    e.cursor = 0
+    historyIndex := e.history.Len()
+    edited := "" // the new line, kept while browsing the history
+    e.refresh()
+
+    for {
+        key, err := e.readKey()
+        if err != nil {
+            return "", err
+        }
+        if key == keyCtrlR {
+            key, err = e.reverseSearch()
+            if err != nil {
+                return "", err
+            }
+        }
+
+        switch key {
+        case keyEnter, keyNewline:
+            io.WriteString(e.out, "\r\n")
+            return string(e.line), nil
+        case keyCtrlC:
+            io.WriteString(e.out, "^C\r\n")
+            return "", errInterrupted
+        case keyCtrlD:
+            if len(e.line) == 0 {
+                io.WriteString(e.out, "\r\n")
+                return "", io.EOF
+            }
+            e.deleteRange(e.cursor, e.cursor+1)
+        case keyDelete:
+            e.deleteRange(e.cursor, e.cursor+1)
+        case keyBackspace, keyCtrlH:
+            e.deleteRange(e.cursor-1, e.cursor)
+        case keyCtrlK:
+            e.deleteRange(e.cursor, len(e.line))
+        case keyCtrlU:
+            e.deleteRange(0, e.cursor)
+        case keyCtrlW:
+            e.deleteRange(e.previousWord(), e.cursor)
+        case keyLeft, keyCtrlB:
+            if e.cursor > 0 {
+                e.cursor--
+            }
+        case keyRight, keyCtrlF:
+            if e.cursor < len(e.line) {
+                e.cursor++
+            }
+        case keyHome, keyCtrlA:
+            e.cursor = 0
+        case keyEnd, keyCtrlE:
+            e.cursor = len(e.line)
+        case keyUp, keyCtrlP:
+            if historyIndex > 0 {
+                if historyIndex == e.history.Len() {
+                    edited = string(e.line)
+                }
+                historyIndex--
+                e.setLine(e.history.At(historyIndex))
+            }
+        case keyDown, keyCtrlN:
+            if historyIndex < e.history.Len() {
+                historyIndex++
+                if historyIndex == e.history.Len() {
+                    e.setLine(edited)
+                } else {
+                    e.setLine(e.history.At(historyIndex))
+                }
+            }
+        case keyTab:
+            e.completeWord()
+        case keyCtrlL:
+            io.WriteString(e.out, "\x1b[H\x1b[2J")
+        default:
+            if key >= 0 && unicode.IsPrint(key) {
+                e.insert(key)
+            }
+        }
+        e.refresh()
+    }
+}
+
+// readKey reads a typed character or an escape sequence.
+func (e *lineEditor) readKey() (rune, error) {
+    r, _, err := e.in.ReadRune()
+    if err != nil || r != keyEscape {
+        return r, err
+    }
+
+    r, _, err = e.in.ReadRune()
+    if err != nil {
+        return 0, err
+    }
+    if r != '[' && r != 'O' {
+        return keyUnknown, nil
+    }
+
+    r, _, err = e.in.ReadRune()
+    if err != nil {
+        return 0, err
+    }
+    switch r {
+    case 'A':
+        return keyUp, nil
+    case 'B':
+        return keyDown, nil
+    case 'C':
+        return keyRight, nil
+    case 'D':
+        return keyLeft, nil
+    case 'H':
+        return keyHome, nil
+    case 'F':
+        return keyEnd, nil
+    }
+    if r < '0' || r > '9' {
+        return keyUnknown, nil
+    }
+
+    // sequences like ESC [ 3 ~
+    code := string(r)
+    for {
+        r, _, err = e.in.ReadRune()
+        if err != nil {
+            return 0, err
+        }
+        if r < '0' || r > '9' {
+            break
+        }
+        code += string(r)
+    }
+    if r != '~' {
+        return keyUnknown, nil
+    }
+    switch code {
+    case "1", "7":
+        return keyHome, nil
+    case "4", "8":
+        return keyEnd, nil
+    case "3":
+        return keyDelete, nil
+    }
+    return keyUnknown, nil
+}
+
+// reverseSearch searches the history incrementally for what the user types,
+// Ctrl-R going to the next older match. The search ends with the first key
+// that is not part of it, which is returned for the editor to handle, with
+// the match as the current line. Ctrl-G and Ctrl-C restore the line.
+func (e *lineEditor) reverseSearch() (rune, error) {
+    query := []rune{}
+    match := e.history.Len()
+    original := e.line
+
+    for {
+        e.refreshSearch(string(query))
+
+        key, err := e.readKey()
+        if err != nil {
+            return 0, err
+        }
+
+        switch key {
+        case keyCtrlR:
+            if i := e.history.Search(string(query), match); i >= 0 {
+                match = i
+                e.setLine(e.history.At(i))
+            }
+        case keyBackspace, keyCtrlH:
+            if len(query) > 0 {
+                query = query[:len(query)-1]
+                match = e.history.Len()
+                if i := e.history.Search(string(query), match); i >= 0 && len(query) > 0 {
+                    match = i
+                    e.setLine(e.history.At(i))
+                }
+            }
+        case keyCtrlG, keyCtrlC:
+            e.line = original
+            e.cursor = len(original)
+            return keyNone, nil
+        default:
+            if key < 0 || !unicode.IsPrint(key) {
+                return key, nil
+            }
+            query = append(query, key)
+            // the current match may still contain the longer query
+            if i := e.history.Search(string(query), match+1); i >= 0 {
+                match = i
+                e.setLine(e.history.At(i))
+            }
+        }
+    }
+}
+
+// completeWord completes the word before the cursor as far as all
+// completions agree, and lists them when that does not add anything.
+func (e *lineEditor) completeWord() {
+    if e.complete == nil {
+        return
+    }
+    candidates, start := e.complete(string(e.line), e.cursor)
+    if len(candidates) == 0 {
+        return
+    }
+
+    word := []rune(commonPrefix(candidates))
+    if len(candidates) > 1 && len(word) <= e.cursor-start {
+        io.WriteString(e.out, "\r\n" + strings.Join(candidates, "  ") + "\r\n")
+        return
+    }
+
+    rest := e.line[e.cursor:]
+    e.line = append(append(append([]rune{}, e.line[:start]...), word...), rest...)
+    e.cursor = start + len(word)
+}
+
+func (e *lineEditor) refresh() {
+    var b strings.Builder
+    b.WriteString("\r\x1b[K")
+    b.WriteString(e.prompt)
+    b.WriteString(string(e.line))
+    if n := len(e.line) - e.cursor; n > 0 {
+        fmt.Fprintf(&b, "\x1b[%dD", n)
+    }
+    io.WriteString(e.out, b.String())
+}
+
+func (e *lineEditor) refreshSearch(query string) {
+    io.WriteString(e.out, "\r\x1b[K(reverse-i-search)`" + query + "': " + string(e.line))
+}
+
+func (e *lineEditor) setLine(line string) {
+    e.line = []rune(line)
+    e.cursor = len(e.line)
+}
+
+func (e *lineEditor) insert(r rune) {
+    e.line = append(e.line, 0)
+    copy(e.line[e.cursor+1:], e.line[e.cursor:])
+    e.line[e.cursor] = r
+    e.cursor++
+}
+
+// deleteRange removes line[from:to], clamped to the line, and leaves the
+// cursor at from.
+func (e *lineEditor) deleteRange(from, to int) {
+    if from < 0 {
+        from = 0
+    }
+    if to > len(e.line) {
+        to = len(e.line)
+    }
+    if from >= to {
+        return
+    }
+    e.line = append(e.line[:from], e.line[to:]...)
+    e.cursor = from
+}
+
+// previousWord returns the start of the word before the cursor.
+func (e *lineEditor) previousWord() int {
+    i := e.cursor
+    for i > 0 && unicode.IsSpace(e.line[i-1]) {
+        i--
+    }
+    for i > 0 && !unicode.IsSpace(e.line[i-1]) {
+        i--
+    }
+    return i
+}
@@ -0,0 +1,73 @@
+package repl
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLineEditor(t *testing.T) {
+    history := &History{entries: []string{"let a = 1;", "puts(a)", "let b = 2;"}}
+
+    tests := []struct{
+        keys     string
+        expected string
+    }{
+        {"abc\r", "abc"},
+        {"ac\x1b[Db\r", "abc"},
+        {"bc\x01a\x05d\r", "abcd"},
+        {"abc\x7f\x7fd\r", "ad"},
+        {"abc\x1b[D\x1b[D\x1b[3~\r", "ac"},
+        {"abc\x1b[H\x1b[C\x04\r", "ac"},
+        {"abcdef\x1b[D\x1b[D\x0b\r", "abcd"},
+        {"abc def\x17\r", "abc "},
+        {"abc\x1b[D\x15\r", "c"},
+        {"\x1b[A\r", "let b = 2;"},
+        {"\x1b[A\x1b[A\r", "puts(a)"},
+        {"\x1b[A\x1b[A\x1b[A\x1b[A\r", "let a = 1;"},
+        {"new\x1b[A\x1b[B\r", "new"},
+        {"\x10\x10\x0e\r", "let b = 2;"},
+        {"\x12let\r", "let b = 2;"},
+        {"\x12let\x12\r", "let a = 1;"},
+        {"\x12put\x1b[D(\r", "puts(a()"},
+        {"x\x12let\x07\r", "x"},
+        {"\x12zzz\r", ""},
+        {"é\r", "é"},
+    }
+
+    for _, tt := range tests {
+        var out strings.Builder
+        e := &lineEditor{in: bufio.NewReader(strings.NewReader(tt.keys)), out: &out, fd: -1, history: history}
+
+        line, err := e.ReadLine(PROMPT)
+        if err != nil {
+            t.Errorf("%q: unexpected error %s", tt.keys, err)
+            continue
+        }
+        if line != tt.expected {
+            t.Errorf("%q: wrong line. expected=%q, got=%q", tt.keys, tt.expected, line)
+        }
+    }
+}
+
+func TestLineEditorControl(t *testing.T) {
+    tests := []struct{
+        keys     string
+        expected error
+    }{
+        {"abc\x03", errInterrupted},
+        {"\x04", io.EOF},
+        {"abc", io.EOF},
+    }
+
+    for _, tt := range tests {
+        var out strings.Builder
+        e := &lineEditor{in: bufio.NewReader(strings.NewReader(tt.keys)), out: &out, fd: -1, history: &History{}}
+
+        _, err := e.ReadLine(PROMPT)
+        if err != tt.expected {
+            t.Errorf("%q: wrong error. expected=%v, got=%v", tt.keys, tt.expected, err)
+        }
+    }
+}
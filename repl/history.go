@@ -0,0 +1,138 @@
+package repl
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxHistory is the number of lines kept in the history file.
+const MaxHistory = 1000
+
+// History holds previously entered lines, oldest first. Lines are appended to
+// the history file as they are added, so the history survives a crash.
+type History struct {
+    entries []string
+    path    string
+    lines   int // number of lines in the history file
+}
+
+// LoadHistory reads the history file at path. A missing file gives an empty
+// history, and an empty path a history that is not saved at all.
+func LoadHistory(path string) (*History, error) {
+    h := &History{path: path}
+    if path == "" {
+        return h, nil
+    }
+
+    file, err := os.Open(path)
+    if os.IsNotExist(err) {
+        return h, nil
+    }
+    if err != nil {
+        return h, err
+    }
+    defer file.Close()
+
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        h.entries = append(h.entries, scanner.Text())
+    }
+    h.lines = len(h.entries)
+    if len(h.entries) > MaxHistory {
+        h.entries = h.entries[len(h.entries)-MaxHistory:]
+    }
+    return h, scanner.Err()
+}
+
+// Add records line, skipping blank lines and repeats of the previous line.
+// When the history file would grow past MaxHistory lines it is rewritten with
+// the newest ones. After an error the history is no longer saved.
+func (h *History) Add(line string) error {
+    if strings.TrimSpace(line) == "" {
+        return nil
+    }
+    if len(h.entries) > 0 && h.entries[len(h.entries)-1] == line {
+        return nil
+    }
+    h.entries = append(h.entries, line)
+    if len(h.entries) > MaxHistory {
+        h.entries = h.entries[len(h.entries)-MaxHistory:]
+    }
+    if h.path == "" {
+        return nil
+    }
+
+    var err error
+    if h.lines < MaxHistory {
+        err = h.append(line)
+    } else {
+        err = h.rewrite()
+    }
+    if err != nil {
+        h.path = ""
+    }
+    return err
+}
+
+// append adds line to the end of the history file.
+func (h *History) append(line string) error {
+    file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+    if err != nil {
+        return err
+    }
+    _, err = file.WriteString(line + "\n")
+    if closeErr := file.Close(); err == nil {
+        err = closeErr
+    }
+    if err == nil {
+        h.lines++
+    }
+    return err
+}
+
+// rewrite replaces the history file with the entries. The new file is
+// renamed into place, so a crash leaves the old one.
+func (h *History) rewrite() error {
+    file, err := os.CreateTemp(filepath.Dir(h.path), filepath.Base(h.path) + ".*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(file.Name())
+
+    _, err = file.WriteString(strings.Join(h.entries, "\n") + "\n")
+    if closeErr := file.Close(); err == nil {
+        err = closeErr
+    }
+    if err == nil {
+        err = os.Rename(file.Name(), h.path)
+    }
+    if err == nil {
+        h.lines = len(h.entries)
+    }
+    return err
+}
+
+func (h *History) Len() int {
+    return len(h.entries)
+}
+
+// At returns the i-th entry, 0 being the oldest.
+func (h *History) At(i int) string {
+    return h.entries[i]
+}
+
+// Search looks for query backwards from entry from, and returns the index of
+// the newest entry before from containing it, or -1.
+func (h *History) Search(query string, from int) int {
+    if from > len(h.entries) {
+        from = len(h.entries)
+    }
+    for i := from - 1; i >= 0; i-- {
+        if strings.Contains(h.entries[i], query) {
+            return i
+        }
+    }
+    return -1
+}
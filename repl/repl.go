@@ -2,53 +2,211 @@ package repl
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"interpreter/evaluator"
 	"interpreter/lexer"
 	"interpreter/object"
 	"interpreter/parser"
+	"interpreter/token"
 	"io"
+	"os"
+	"strings"
 )
 
 const PROMPT = ">> "
 
-func Start(input io.Reader, output io.Writer) {
-    scanner := bufio.NewScanner(input)
-    env := object.NewEnvironment()
+// CONTINUATION_PROMPT is shown while the input so far is incomplete.
+const CONTINUATION_PROMPT = ".. "
+
+const HELP = `Commands:
+  :help         show this help
+  :reset        forget all bindings and macros
+  :load FILE    evaluate FILE in the current environment
+  :env          list the bindings of the environment
+
+Input continues on the next line while brackets are open or a line ends
+with an operator, an empty line ends it anyway. Ctrl-C discards the input,
+Ctrl-D exits. On a terminal the arrow keys edit the line and browse the
+history, Ctrl-R searches it and Tab completes names and hash keys.
+`
+
+type REPL struct {
+    out      io.Writer
+    env      *object.Environment
+    macroEnv *object.Environment
+    options  evaluator.Options
+}
+
+// New returns a REPL that evaluates its input with options. Imports are
+// relative to the working directory unless options has a module loader.
+func New(output io.Writer, options evaluator.Options) *REPL {
+    if options.Modules == nil {
+        options.Modules = evaluator.NewModuleLoader("")
+    }
+    return &REPL{
+        out:      output,
+        env:      object.NewEnvironment(),
+        macroEnv: object.NewEnvironment(),
+        options:  options,
+    }
+}
+
+// Start runs the REPL until the input ends. When input is a terminal the
+// lines can be edited, and entered lines are kept in the history file at
+// historyFile unless it is empty.
+func Start(input io.Reader, output io.Writer, historyFile string, options evaluator.Options) {
+    file, ok := input.(*os.File)
+    if !ok || !isTerminal(int(file.Fd())) {
+        reader := &plainReader{scanner: bufio.NewScanner(input), out: output}
+        New(output, options).run(reader, &History{})
+        return
+    }
+
+    history, err := LoadHistory(historyFile)
+    if err != nil {
+        fmt.Fprintf(output, "could not read history: %s\n", err)
+    }
+    r := New(output, options)
+    reader := &lineEditor{in: bufio.NewReader(file), out: output, fd: int(file.Fd()), history: history, complete: r.complete}
+    r.run(reader, history)
+}
+
+func (r *REPL) run(reader lineReader, history *History) {
+    var lines []string
 
     for {
-        fmt.Printf(PROMPT)
-        scanned := scanner.Scan()
-        if !scanned {
+        prompt := PROMPT
+        if len(lines) > 0 {
+            prompt = CONTINUATION_PROMPT
+        }
+
+        line, err := reader.ReadLine(prompt)
+        if err == errInterrupted {
+            lines = nil
+            continue
+        }
+        if err != nil {
             return
         }
+        if err := history.Add(line); err != nil {
+            fmt.Fprintf(r.out, "could not save history: %s\n", err)
+        }
 
-        line := scanner.Text()
-        lex := lexer.New(line)
-        parser := parser.New(lex)
+        if len(lines) == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+            r.command(strings.TrimSpace(line))
+            continue
+        }
 
-        program := parser.ParseProgram()
-        if len(parser.Errors()) != 0 {
-            printParserErrors(output, parser.Errors())
+        lines = append(lines, line)
+        source := strings.Join(lines, "\n")
+        if strings.TrimSpace(line) != "" && !isComplete(source) {
             continue
         }
+        lines = nil
+
+        r.eval(source, r.options)
+    }
+}
+
+// command runs a meta-command like :help.
+func (r *REPL) command(line string) {
+    fields := strings.Fields(line)
+
+    switch fields[0] {
+    case ":help":
+        io.WriteString(r.out, HELP)
+    case ":reset":
+        r.env = object.NewEnvironment()
+        r.macroEnv = object.NewEnvironment()
+    case ":load":
+        if len(fields) != 2 {
+            io.WriteString(r.out, "usage: :load FILE\n")
+            return
+        }
+        source, err := os.ReadFile(fields[1])
+        if err != nil {
+            io.WriteString(r.out, err.Error() + "\n")
+            return
+        }
+        // imports in the file are relative to it, not to the working directory
+        options := r.options
+        options.Modules = evaluator.NewModuleLoader(fields[1])
+        r.eval(string(source), options)
+    case ":env":
+        for _, name := range r.env.Names() {
+            value, _ := r.env.Get(name)
+            io.WriteString(r.out, name + " = " + value.Inspect() + "\n")
+        }
+    default:
+        io.WriteString(r.out, "unknown command " + fields[0] + ", try :help\n")
+    }
+}
+
+func (r *REPL) eval(source string, options evaluator.Options) {
+    lex := lexer.New(source)
+    parser := parser.New(lex)
 
-        evaluated := evaluator.Eval(program, env)
-        if evaluated != nil {
-            io.WriteString(output, evaluated.Inspect())
-            io.WriteString(output, "\n")
+    program := parser.ParseProgram()
+    if len(parser.Errors()) != 0 {
+        printParserErrors(r.out, parser.Errors())
+        return
+    }
+
+    evaluator.DefineMacros(program, r.macroEnv)
+    expanded, err := evaluator.ExpandMacrosContext(context.Background(), program, r.macroEnv, options)
+    if err != nil {
+        io.WriteString(r.out, err.Inspect() + "\n")
+        return
+    }
+
+    evaluated := evaluator.EvalOptions(context.Background(), expanded, r.env, options)
+    if evaluated != nil {
+        io.WriteString(r.out, evaluated.Inspect())
+        io.WriteString(r.out, "\n")
+    }
+}
+
+// isComplete tells whether source can be evaluated, or whether it needs more
+// lines because a bracket, string or comment is still open or the last token
+// is an operator.
+func isComplete(source string) bool {
+    l := lexer.New(source)
+    depth := 0
+    var last token.Token
+
+    for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+        switch tok.Type {
+        case token.LPAREN, token.LBRACE, token.LBRACKET:
+            depth++
+        case token.RPAREN, token.RBRACE, token.RBRACKET:
+            depth--
+        case token.ERROR:
+            // other errors, like bad escape sequences, are left to the parser
+            if tok.Literal == "unterminated comment" || tok.Literal == "unterminated string" {
+                return false
+            }
         }
-        // io.WriteString(output, program.String())
-        // io.WriteString(output, "\n")
-        
-        // for tok := lex.NextToken(); tok.Type != token.EOF; tok = lex.NextToken() {
-        //     fmt.Printf("%+v\n", tok)
-        // }
+        last = tok
+    }
+
+    if depth > 0 {
+        return false
+    }
+
+    switch last.Type {
+    case token.ASSIGN, token.PLUS, token.MINUS, token.BANG, token.ASTERISK,
+        token.SLASH, token.PERCENT, token.PLUS_ASSIGN, token.MINUS_ASSIGN,
+        token.ASTERISK_ASSIGN, token.SLASH_ASSIGN, token.PERCENT_ASSIGN,
+        token.LT, token.GT, token.LT_EQ, token.GT_EQ, token.EQ, token.NOT_EQ,
+        token.AND, token.OR, token.COMMA, token.COLON, token.DOT:
+        return false
     }
+    return true
 }
 
-func printParserErrors(output io.Writer, errors []string) {
-    for _, msg := range errors {
-        io.WriteString(output, "\t" + msg + "\n") 
+func printParserErrors(output io.Writer, errors []*parser.ParseError) {
+    for _, err := range errors {
+        io.WriteString(output, "\t" + err.Error() + "\n")
     }
 }
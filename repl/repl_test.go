@@ -0,0 +1,169 @@
+package repl
+
+import (
+	"bytes"
+	"interpreter/evaluator"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestIsComplete(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected bool
+    }{
+        {"", true},
+        {"1 + 2", true},
+        {"let f = fn(x) {", false},
+        {"let f = fn(x) {\n  x\n}", true},
+        {"[1, 2,", false},
+        {"puts(1,\n 2)", true},
+        {"1 +", false},
+        {"a &&", false},
+        {"let x =", false},
+        {"h.", false},
+        {"}", true},
+        {`"abc`, false},
+        {`"abc"`, true},
+        {`"say \"hi`, false},
+        {`"ends with a quote\"`, false},
+        {`"bad \q escape"`, true},
+        {"/* open", false},
+        {"1 // comment (", true},
+    }
+
+    for _, tt := range tests {
+        if isComplete(tt.input) != tt.expected {
+            t.Errorf("isComplete(%q) wrong. expected=%t", tt.input, tt.expected)
+        }
+    }
+}
+
+func testRun(t *testing.T, input string) string {
+    var out bytes.Buffer
+    Start(strings.NewReader(input), &out, "", evaluator.Options{})
+    return out.String()
+}
+
+func TestMultiLineInput(t *testing.T) {
+    input := "let add = fn(a, b) {\n  a + b\n};\nadd(1,\n2)\n"
+    expected := ">> .. .. >> .. 3\n>> "
+
+    if out := testRun(t, input); out != expected {
+        t.Errorf("wrong output. expected=%q, got=%q", expected, out)
+    }
+
+    // an empty line ends incomplete input
+    input = "let x = (1 +\n\n5\n"
+    out := testRun(t, input)
+    if !strings.Contains(out, "no prefix parse function") || !strings.HasSuffix(out, ">> 5\n>> ") {
+        t.Errorf("incomplete input was not ended by an empty line. got=%q", out)
+    }
+}
+
+func TestCommands(t *testing.T) {
+    dir := t.TempDir()
+    script := filepath.Join(dir, "lib.mk")
+    err := os.WriteFile(script, []byte("let double = fn(x) { x * 2 };"), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(filepath.Join(dir, "util.mk"), []byte("export let triple = fn(x) { x * 3 };"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    importer := filepath.Join(dir, "main.mk")
+    if err := os.WriteFile(importer, []byte("import \"util.mk\" as util; let nine = util.triple(3);"), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {":help\n", HELP},
+        {"let a = 1;\nlet b = \"x\";\n:env\n", "a = 1\nb = x\n"},
+        {"let a = 1;\n:reset\na\n", "ERROR: 1:1: identifier not found: a\n"},
+        {":load " + script + "\ndouble(4)\n", "8\n"},
+        {":load " + importer + "\nnine\n", "9\n"},
+        {":load\n", "usage: :load FILE\n"},
+        {":load " + filepath.Join(dir, "missing.mk") + "\n", "no such file or directory\n"},
+        {":quit\n", "unknown command :quit, try :help\n"},
+    }
+
+    for _, tt := range tests {
+        out := strings.ReplaceAll(testRun(t, tt.input), PROMPT, "")
+        if !strings.HasSuffix(out, tt.expected) {
+            t.Errorf("%q: wrong output. expected suffix %q, got=%q", tt.input, tt.expected, out)
+        }
+    }
+}
+
+func TestHistory(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "history")
+
+    h, err := LoadHistory(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, line := range []string{"let a = 1;", "", "a", "a", "let b = 2;"} {
+        if err := h.Add(line); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    h, err = LoadHistory(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expected := []string{"let a = 1;", "a", "let b = 2;"}
+    if h.Len() != len(expected) {
+        t.Fatalf("wrong history length. expected=%d, got=%d", len(expected), h.Len())
+    }
+    for i, line := range expected {
+        if h.At(i) != line {
+            t.Errorf("history[%d] wrong. expected=%q, got=%q", i, line, h.At(i))
+        }
+    }
+
+    if i := h.Search("let", h.Len()); i != 2 {
+        t.Errorf("wrong search result. expected=2, got=%d", i)
+    }
+    if i := h.Search("let", 2); i != 0 {
+        t.Errorf("wrong search result. expected=0, got=%d", i)
+    }
+    if i := h.Search("nothing", h.Len()); i != -1 {
+        t.Errorf("wrong search result. expected=-1, got=%d", i)
+    }
+}
+
+func TestHistoryLimit(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "history")
+
+    h, err := LoadHistory(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for i := 0; i < MaxHistory + 10; i++ {
+        if err := h.Add(strconv.Itoa(i)); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+    if len(lines) != MaxHistory {
+        t.Fatalf("wrong number of lines in the history file. expected=%d, got=%d", MaxHistory, len(lines))
+    }
+    if lines[0] != "10" || lines[len(lines)-1] != strconv.Itoa(MaxHistory + 9) {
+        t.Errorf("history file does not hold the newest lines. got=%q ... %q", lines[0], lines[len(lines)-1])
+    }
+    if h.Len() != MaxHistory || h.At(0) != "10" {
+        t.Errorf("wrong history. got length %d starting with %q", h.Len(), h.At(0))
+    }
+}
@@ -0,0 +1,51 @@
+package repl
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func getTermios(fd int) (*syscall.Termios, error) {
+    var termios syscall.Termios
+    _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TCGETS, uintptr(unsafe.Pointer(&termios)))
+    if errno != 0 {
+        return nil, errno
+    }
+    return &termios, nil
+}
+
+func setTermios(fd int, termios *syscall.Termios) error {
+    _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TCSETS, uintptr(unsafe.Pointer(termios)))
+    if errno != 0 {
+        return errno
+    }
+    return nil
+}
+
+func isTerminal(fd int) bool {
+    _, err := getTermios(fd)
+    return err == nil
+}
+
+// makeRaw puts the terminal in raw mode, so keys are read one at a time and
+// without echo, and returns a function restoring the previous mode. Output
+// processing stays on, so "\n" still starts a new line.
+func makeRaw(fd int) (func(), error) {
+    old, err := getTermios(fd)
+    if err != nil {
+        return nil, err
+    }
+
+    raw := *old
+    raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+    raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+    raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+    raw.Cflag |= syscall.CS8
+    raw.Cc[syscall.VMIN] = 1
+    raw.Cc[syscall.VTIME] = 0
+
+    if err := setTermios(fd, &raw); err != nil {
+        return nil, err
+    }
+    return func() { setTermios(fd, old) }, nil
+}
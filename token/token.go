@@ -1,18 +1,47 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+)
+
 type TokenType string
 
+// Position is a location in the source. Line and Column start at 1, Column
+// counts characters, Offset is the byte offset from the start of the input.
+type Position struct {
+    Line   int
+    Column int
+    Offset int
+}
+
+func (p Position) IsValid() bool {
+    return p.Line > 0
+}
+
+func (p Position) String() string {
+    if !p.IsValid() {
+        return "-"
+    }
+    return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
 type Token struct {
     Type    TokenType
     Literal string
+    Pos     Position // position of the first character
+    End     Position // position right after the last character
 }
 
 const (
     ILLEGAL   = "ILLEGAL"
     EOF       = "EOF"
+    ERROR     = "ERROR" // malformed input, the literal is the error message
+    COMMENT   = "COMMENT"
 
     IDENT     = "IDENT"
     INT       = "INT"
+    FLOAT     = "FLOAT"
 
     ASSIGN    = "="
     PLUS      = "+"
@@ -20,9 +49,21 @@ const (
     BANG      = "!"
     ASTERISK  = "*"
     SLASH     = "/"
+    PERCENT   = "%"
+
+    PLUS_ASSIGN     = "+="
+    MINUS_ASSIGN    = "-="
+    ASTERISK_ASSIGN = "*="
+    SLASH_ASSIGN    = "/="
+    PERCENT_ASSIGN  = "%="
 
     LT        = "<"
     GT        = ">"
+    LT_EQ     = "<="
+    GT_EQ     = ">="
+
+    AND       = "&&"
+    OR        = "||"
 
     COMMA     = ","
     SEMICOLON = ";"
@@ -34,11 +75,24 @@ const (
 
     FUNCTION  = "FUNCTION"
     LET       = "LET"
+    CONST     = "CONST"
     TRUE      = "TRUE"
     FALSE     = "FALSE"
     IF        = "IF"
     ELSE      = "ELSE"
     RETURN    = "RETURN"
+    WHILE     = "WHILE"
+    FOR       = "FOR"
+    IN        = "IN"
+    BREAK     = "BREAK"
+    CONTINUE  = "CONTINUE"
+    MACRO     = "MACRO"
+    IMPORT    = "IMPORT"
+    EXPORT    = "EXPORT"
+    AS        = "AS"
+    TRY       = "TRY"
+    CATCH     = "CATCH"
+    THROW     = "THROW"
 
     EQ        = "=="
     NOT_EQ    = "!="
@@ -49,16 +103,41 @@ const (
     RBRACKET  = "]"
 
     COLON     = ":"
+    ELLIPSIS  = "..."
+    DOT       = "."
 )
 
 var keywords = map[string]TokenType {
-    "fn":     FUNCTION,
-    "let":    LET,
-    "true":   TRUE,
-    "false":  FALSE,
-    "if":     IF,
-    "else":   ELSE,
-    "return": RETURN,
+    "fn":       FUNCTION,
+    "let":      LET,
+    "const":    CONST,
+    "true":     TRUE,
+    "false":    FALSE,
+    "if":       IF,
+    "else":     ELSE,
+    "return":   RETURN,
+    "while":    WHILE,
+    "for":      FOR,
+    "in":       IN,
+    "break":    BREAK,
+    "continue": CONTINUE,
+    "macro":    MACRO,
+    "import":   IMPORT,
+    "export":   EXPORT,
+    "as":       AS,
+    "try":      TRY,
+    "catch":    CATCH,
+    "throw":    THROW,
+}
+
+// Keywords returns all keywords, sorted.
+func Keywords() []string {
+    names := make([]string, 0, len(keywords))
+    for name := range keywords {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,553 @@
+// Package types checks the optional type annotations of a program before it
+// runs. Literals, arrays, hashes and functions get their types inferred, and
+// so do let bindings without an annotation unless they are assigned to,
+// declared again or, for arrays and hashes, stored into later. Parameters
+// without an annotation, imports and unknown names are any, and so are the
+// elements of arrays and hashes without an annotated type, so unannotated
+// code is only checked where the types are certain.
+package types
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/token"
+	"strings"
+)
+
+// Error is a type error found at a position in the source.
+type Error struct {
+    Pos     token.Position
+    Message string
+}
+
+func (e *Error) Error() string {
+    return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+type scope struct {
+    outer     *scope
+    types     map[string]Type
+    annotated map[string]bool // names whose type comes from an annotation
+}
+
+func newScope(outer *scope) *scope {
+    return &scope{outer: outer, types: make(map[string]Type), annotated: make(map[string]bool)}
+}
+
+func (s *scope) lookup(name string) (Type, bool) {
+    for ; s != nil; s = s.outer {
+        if t, ok := s.types[name]; ok {
+            return t, true
+        }
+    }
+    return nil, false
+}
+
+// isAnnotated reports whether the type of name comes from an annotation
+// rather than from its value.
+func (s *scope) isAnnotated(name string) bool {
+    for ; s != nil; s = s.outer {
+        if _, ok := s.types[name]; ok {
+            return s.annotated[name]
+        }
+    }
+    return false
+}
+
+// function is the function literal whose body is being checked.
+type function struct {
+    result  Type   // the annotated result type, nil when there is none
+    returns []Type // the types of the return statements
+}
+
+type checker struct {
+    errors   []*Error
+    assigned map[string]bool // names that are assigned to or declared again somewhere
+    stored   map[string]bool // names of containers that elements are stored into somewhere
+    function *function
+}
+
+// ERROR_HASH is the type of the error a catch clause binds.
+var ERROR_HASH = &Hash{Key: STRING, Value: ANY}
+
+// Check returns the type errors in program, which should have its macros
+// expanded. globals are the names already bound in the environment program
+// runs in. They are any, and hide builtins of the same name.
+func Check(program *ast.Program, globals ...string) []*Error {
+    c := &checker{assigned: make(map[string]bool), stored: make(map[string]bool)}
+    declared := make(map[string]bool)
+    ast.Inspect(program, func(node ast.Node) bool {
+        switch node := node.(type) {
+        case *ast.AssignExpression:
+            if ident, ok := node.Target.(*ast.Identifier); ok {
+                c.assigned[ident.Value] = true
+            } else if ident := root(node.Target); ident != nil {
+                c.stored[ident.Value] = true
+            }
+        case *ast.LetStatement:
+            if declared[node.Name.Value] {
+                c.assigned[node.Name.Value] = true
+            }
+            declared[node.Name.Value] = true
+        }
+        return true
+    })
+
+    s := newScope(nil)
+    for _, name := range globals {
+        s.types[name] = ANY
+    }
+    c.statements(program.Statements, s)
+    return c.errors
+}
+
+func (c *checker) errorf(node ast.Node, format string, a ...interface{}) {
+    c.errors = append(c.errors, &Error{Pos: node.Pos(), Message: fmt.Sprintf(format, a...)})
+}
+
+// statements checks a list of statements and returns the type of the value of
+// the last one, or nil when it is not an expression.
+func (c *checker) statements(statements []ast.Statement, s *scope) Type {
+    var last Type
+    for _, statement := range statements {
+        last = c.statement(statement, s)
+    }
+    return last
+}
+
+func (c *checker) block(block *ast.BlockStatement, s *scope) Type {
+    if block == nil {
+        return NULL
+    }
+    t := c.statements(block.Statements, s)
+    if t == nil {
+        return ANY
+    }
+    return t
+}
+
+func (c *checker) statement(statement ast.Statement, s *scope) Type {
+    switch node := statement.(type) {
+    case *ast.ExpressionStatement:
+        return c.expression(node.Expression, s)
+    case *ast.LetStatement:
+        c.let(node, s)
+    case *ast.ExportStatement:
+        c.let(node.Statement, s)
+    case *ast.ImportStatement:
+        s.types[node.Name.Value] = ANY
+    case *ast.ReturnStatement:
+        t := c.expression(node.ReturnValue, s)
+        if c.function != nil {
+            c.function.returns = append(c.function.returns, t)
+            c.checkResult(node.ReturnValue, t)
+        }
+    case *ast.ThrowStatement:
+        c.expression(node.Value, s)
+    case *ast.WhileStatement:
+        c.expression(node.Condition, s)
+        c.block(node.Body, newScope(s))
+    case *ast.ForStatement:
+        iterable := c.expression(node.Iterable, s)
+        element := c.element(node.Iterable, iterable)
+        if isContainer(iterable) && !annotated(node.Iterable, s) {
+            element = ANY
+        }
+        body := newScope(s)
+        body.types[node.Variable.Value] = element
+        c.block(node.Body, body)
+    }
+    return nil
+}
+
+func (c *checker) let(node *ast.LetStatement, s *scope) {
+    name := node.Name.Value
+    declared := FromAnnotation(node.Type)
+
+    // a function can call itself, it is declared before its body is checked
+    if function, ok := node.Value.(*ast.FunctionLiteral); ok && node.Type == nil {
+        declared = signature(function)
+    }
+    if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+        s.types[name] = declared
+    }
+
+    t := c.expression(node.Value, s)
+    if node.Type != nil {
+        if !Assignable(t, declared) {
+            c.errorf(node.Value, "cannot use %s as %s in let %s", t, declared, name)
+        }
+        s.types[name] = declared
+        s.annotated[name] = true
+    } else if c.assigned[name] || c.stored[name] && isContainer(t) {
+        s.types[name] = ANY
+    } else {
+        s.types[name] = t
+    }
+}
+
+// element returns the type of the loop variable of a for loop over a value of
+// type t.
+func (c *checker) element(node ast.Node, t Type) Type {
+    switch t := t.(type) {
+    case *Array:
+        return t.Element
+    case *Hash:
+        return t.Key
+    }
+    switch t {
+    case STRING:
+        return STRING
+    case ANY:
+        return ANY
+    }
+    c.errorf(node, "cannot iterate over %s", t)
+    return ANY
+}
+
+func (c *checker) expression(expression ast.Expression, s *scope) Type {
+    switch node := expression.(type) {
+    case *ast.IntegerLiteral:
+        return INT
+    case *ast.FloatLiteral:
+        return FLOAT
+    case *ast.StringLiteral:
+        return STRING
+    case *ast.Boolean:
+        return BOOL
+    case *ast.Identifier:
+        if t, ok := s.lookup(node.Value); ok {
+            return t
+        }
+        if t, ok := builtins[node.Value]; ok {
+            return t
+        }
+        return ANY
+    case *ast.PrefixExpression:
+        return c.prefix(node, c.expression(node.Right, s))
+    case *ast.InfixExpression:
+        left := c.expression(node.Left, s)
+        right := c.expression(node.Right, s)
+        if node.Operator == "&&" || node.Operator == "||" {
+            return join(left, right)
+        }
+        return c.infix(node, node.Operator, left, right)
+    case *ast.AssignExpression:
+        return c.assign(node, s)
+    case *ast.IfExpression:
+        c.expression(node.Condition, s)
+        consequence := c.block(node.Consequence, newScope(s))
+        return join(consequence, c.block(node.Alternative, newScope(s)))
+    case *ast.TryExpression:
+        block := c.block(node.Block, newScope(s))
+        catch := newScope(s)
+        catch.types[node.Parameter.Value] = ERROR_HASH
+        return join(block, c.block(node.Catch, catch))
+    case *ast.FunctionLiteral:
+        return c.functionLiteral(node, s)
+    case *ast.CallExpression:
+        return c.call(node, s)
+    case *ast.ArrayLiteral:
+        var element Type = ANY
+        for i, e := range node.Elements {
+            t := c.expression(e, s)
+            if i == 0 {
+                element = t
+            } else {
+                element = join(element, t)
+            }
+        }
+        return &Array{Element: element}
+    case *ast.HashLiteral:
+        var key, value Type = ANY, ANY
+        for i, k := range node.Keys() {
+            kt := c.expression(k, s)
+            vt := c.expression(node.Pairs[k], s)
+            if i == 0 {
+                key, value = kt, vt
+            } else {
+                key, value = join(key, kt), join(value, vt)
+            }
+        }
+        return &Hash{Key: key, Value: value}
+    case *ast.IndexExpression:
+        left := c.expression(node.Left, s)
+        return c.read(node.Left, left, c.index(node, left, c.expression(node.Index, s)), s)
+    case *ast.MemberExpression:
+        left := c.expression(node.Object, s)
+        return c.read(node.Object, left, c.index(node, left, STRING), s)
+    }
+    return ANY
+}
+
+// read returns the type t of an element read from container, whose type is
+// left. Element types that were inferred from a literal are any, since the
+// container may have been changed since, also through another name.
+func (c *checker) read(container ast.Expression, left Type, t Type, s *scope) Type {
+    if isContainer(left) && !annotated(container, s) {
+        return ANY
+    }
+    return t
+}
+
+func isContainer(t Type) bool {
+    switch t.(type) {
+    case *Array, *Hash:
+        return true
+    }
+    return false
+}
+
+// root returns the name an assignment target like a[0].b stores into, or
+// nil when it is not a name.
+func root(node ast.Expression) *ast.Identifier {
+    switch node := node.(type) {
+    case *ast.Identifier:
+        return node
+    case *ast.IndexExpression:
+        return root(node.Left)
+    case *ast.MemberExpression:
+        return root(node.Object)
+    }
+    return nil
+}
+
+func (c *checker) prefix(node *ast.PrefixExpression, right Type) Type {
+    switch {
+    case node.Operator == "!":
+        return BOOL
+    case node.Operator == "-" && (isNumber(right) || right == ANY):
+        return right
+    }
+    c.errorf(node, "unknown operator: %s%s", node.Operator, right)
+    return ANY
+}
+
+// infix returns the type of an arithmetic or comparison operation, following
+// the rules of the evaluator.
+func (c *checker) infix(node ast.Node, operator string, left, right Type) Type {
+    comparison := operator == "<" || operator == ">" || operator == "<=" || operator == ">="
+
+    switch {
+    case operator == "==" || operator == "!=":
+        return BOOL
+    case left == ANY || right == ANY:
+        if comparison {
+            return BOOL
+        }
+        return ANY
+    case isNumber(left) && isNumber(right):
+        if comparison {
+            return BOOL
+        }
+        if left == INT && right == INT {
+            return INT
+        }
+        return FLOAT
+    case left.String() != right.String():
+        c.errorf(node, "type mismatch: %s %s %s", left, operator, right)
+    case left == STRING && operator == "+":
+        return STRING
+    default:
+        c.errorf(node, "unknown operator: %s %s %s", left, operator, right)
+    }
+    return ANY
+}
+
+func (c *checker) assign(node *ast.AssignExpression, s *scope) Type {
+    value := c.expression(node.Value, s)
+
+    var target Type
+    switch t := node.Target.(type) {
+    case *ast.Identifier:
+        target = c.expression(t, s)
+    case *ast.IndexExpression:
+        left := c.expression(t.Left, s)
+        index := c.expression(t.Index, s)
+        if left == STRING {
+            c.errorf(t, "index assignment not supported: %s", left)
+            return value
+        }
+        target = c.index(t, left, index)
+        // element types inferred from a literal do not restrict what can be
+        // stored in the container later
+        if !annotated(t.Left, s) {
+            target = ANY
+        }
+    default:
+        return value
+    }
+
+    if node.Operator != "=" {
+        value = c.infix(node, strings.TrimSuffix(node.Operator, "="), target, value)
+    }
+    if !Assignable(value, target) {
+        c.errorf(node.Value, "cannot use %s as %s in assignment to %s", value, target, node.Target)
+    }
+    return value
+}
+
+// annotated reports whether the container an element is read from or stored
+// into is bound with a type annotation.
+func annotated(node ast.Expression, s *scope) bool {
+    ident := root(node)
+    return ident != nil && s.isAnnotated(ident.Value)
+}
+
+func (c *checker) index(node ast.Node, left, index Type) Type {
+    switch left := left.(type) {
+    case *Array:
+        if index != INT && index != ANY {
+            c.errorf(node, "index operator not supported: %s[%s]", left, index)
+            return ANY
+        }
+        return left.Element
+    case *Hash:
+        return left.Value
+    }
+    if left == STRING {
+        if index != INT && index != ANY {
+            c.errorf(node, "index operator not supported: %s[%s]", left, index)
+            return ANY
+        }
+        return STRING
+    }
+    if left != ANY {
+        c.errorf(node, "index operator not supported: %s", left)
+    }
+    return ANY
+}
+
+func (c *checker) call(node *ast.CallExpression, s *scope) Type {
+    if ident, ok := node.Function.(*ast.Identifier); ok && (ident.Value == "quote" || ident.Value == "unquote") {
+        return ANY
+    }
+
+    callee := c.expression(node.Function, s)
+    arguments := []Type{}
+    for _, argument := range node.Arguments {
+        arguments = append(arguments, c.expression(argument, s))
+    }
+
+    function, ok := callee.(*Function)
+    if !ok {
+        if callee != ANY {
+            c.errorf(node, "not a function: %s", callee)
+        }
+        return ANY
+    }
+    if function.Parameters == nil && function.Rest == nil {
+        return function.Result
+    }
+
+    if !function.accepts(len(arguments)) {
+        c.errorf(node, "wrong number of arguments to %s. got=%d, want=%s", node.Function, len(arguments), arity(function))
+        return function.Result
+    }
+    for i, argument := range arguments {
+        parameter := function.parameter(i)
+        if !Assignable(argument, parameter) {
+            c.errorf(node.Arguments[i], "cannot use %s as %s in argument %d to %s", argument, parameter, i + 1, node.Function)
+        }
+    }
+    return function.Result
+}
+
+func arity(function *Function) string {
+    switch {
+    case function.Rest != nil:
+        return fmt.Sprintf("at least %d", function.Required)
+    case function.Required != len(function.Parameters):
+        return fmt.Sprintf("%d to %d", function.Required, len(function.Parameters))
+    default:
+        return fmt.Sprintf("%d", len(function.Parameters))
+    }
+}
+
+// signature returns the type of a function literal from its annotations.
+func signature(node *ast.FunctionLiteral) *Function {
+    t := &Function{Parameters: []Type{}, Required: len(node.Parameters) - len(node.Defaults), Result: FromAnnotation(node.ReturnType)}
+    for _, parameter := range node.Parameters {
+        t.Parameters = append(t.Parameters, FromAnnotation(node.ParameterTypes[parameter.Value]))
+    }
+    if node.Rest != nil {
+        t.Rest = ANY
+        if array, ok := FromAnnotation(node.ParameterTypes[node.Rest.Value]).(*Array); ok {
+            t.Rest = array.Element
+        }
+    }
+    return t
+}
+
+// functionLiteral checks the body of a function and returns its type. The
+// result type is inferred from the body when it is not annotated.
+func (c *checker) functionLiteral(node *ast.FunctionLiteral, s *scope) Type {
+    t := signature(node)
+    body := newScope(s)
+
+    for i, parameter := range node.Parameters {
+        // defaults are evaluated after the parameters before them are bound
+        if value, ok := node.Defaults[parameter.Value]; ok {
+            if vt := c.expression(value, body); !Assignable(vt, t.Parameters[i]) {
+                c.errorf(value, "cannot use %s as %s in default value of %s", vt, t.Parameters[i], parameter.Value)
+            }
+        }
+        body.types[parameter.Value] = t.Parameters[i]
+        body.annotated[parameter.Value] = node.ParameterTypes[parameter.Value] != nil
+    }
+    if node.Rest != nil {
+        annotation := node.ParameterTypes[node.Rest.Value]
+        if _, ok := FromAnnotation(annotation).(*Array); annotation != nil && !ok {
+            c.errorf(annotation, "rest parameter %s must be an array, got %s", node.Rest.Value, FromAnnotation(annotation))
+        }
+        body.types[node.Rest.Value] = &Array{Element: t.Rest}
+        body.annotated[node.Rest.Value] = annotation != nil
+    }
+
+    outer := c.function
+    c.function = &function{}
+    if node.ReturnType != nil {
+        c.function.result = t.Result
+    }
+
+    var last Type
+    if node.Body != nil {
+        last = c.statements(node.Body.Statements, body)
+        if n := len(node.Body.Statements); n > 0 && last != nil {
+            statement := node.Body.Statements[n-1].(*ast.ExpressionStatement)
+            c.checkResult(statement.Expression, last)
+        }
+    }
+
+    if node.ReturnType == nil {
+        t.Result = c.inferResult(last)
+    }
+    c.function = outer
+    return t
+}
+
+// checkResult reports a value returned from the current function that does
+// not have its annotated result type.
+func (c *checker) checkResult(node ast.Node, t Type) {
+    if c.function.result != nil && !Assignable(t, c.function.result) {
+        c.errorf(node, "cannot use %s as %s in return value", t, c.function.result)
+    }
+}
+
+// inferResult joins the types of the values the current function can return,
+// last being the type of the last statement of its body.
+func (c *checker) inferResult(last Type) Type {
+    results := c.function.returns
+    if last != nil {
+        results = append(results, last)
+    }
+    if len(results) == 0 {
+        return ANY
+    }
+
+    result := results[0]
+    for _, t := range results[1:] {
+        result = join(result, t)
+    }
+    return result
+}
@@ -0,0 +1,171 @@
+package types
+
+import (
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+    p := parser.New(lexer.New(input))
+    program := p.ParseProgram()
+    if len(p.Errors()) != 0 {
+        t.Fatalf("%q: parse errors: %v", input, p.Errors())
+    }
+    return program
+}
+
+func TestCheck(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected []string
+    }{
+        // annotated bindings
+        {"let x: int = 1; let y: float = 1.5; let s: string = \"a\"; let b: bool = !x;", []string{}},
+        {"let x: int = \"a\";", []string{"1:14: cannot use string as int in let x"}},
+        {"let x: float = 1;", []string{"1:16: cannot use int as float in let x"}},
+        {"let x: any = 1; let y: int = x; let z: string = x;", []string{}},
+        {"let xs: array<int> = [1, 2]; let ys: array<string> = xs;", []string{"1:54: cannot use array<int> as array<string> in let ys"}},
+        {"let xs: array = [1, \"a\"]; let ys: array<int> = [];", []string{}},
+        {`let h: hash<string, int> = {"a": 1}; let g: hash<string, string> = h;`, []string{"1:68: cannot use hash<string, int> as hash<string, string> in let g"}},
+        {"let x: int = 1; x = 2; x = \"a\";", []string{"1:28: cannot use string as int in assignment to x"}},
+        {"let x: int = 1; x += 1.5;", []string{"1:22: cannot use float as int in assignment to x"}},
+        {"let xs: array<int> = []; xs[0] = \"a\";", []string{"1:34: cannot use string as int in assignment to (xs[0])"}},
+        {`let h: hash<string, int> = {}; h["a"] = true; let f = fn(xs: array<int>) { xs[0] = "a"; };`, []string{"1:41: cannot use bool as int in assignment to (h[\"a\"])", "1:84: cannot use string as int in assignment to (xs[0])"}},
+        // inferred bindings
+        {"let x = 1; x + \"a\"", []string{"1:12: type mismatch: int + string"}},
+        {"let x = 1; x = \"a\"; x + \"b\"", []string{}},
+        {"let a = [1, 2]; a[0] = \"s\";", []string{}},
+        {`let h = {"a": 1}; h["b"] = "x";`, []string{}},
+        {"let xs: array<int> = [1, 2]; let s: string = xs[0];", []string{"1:46: cannot use int as string in let s"}},
+        {`let h: hash<string, bool> = {"a": true}; let n: int = h.a;`, []string{"1:55: cannot use bool as int in let n"}},
+        // elements of containers without an annotation are any, they can change
+        {"let xs = [1, 2]; let s: string = xs[0];", []string{}},
+        {`let h = {"a": true}; let n: int = h.a;`, []string{}},
+        {`let h = {"a": 1}; h["b"] = "x"; puts(h["b"] + "y");`, []string{}},
+        {`let a = [1]; a[0] = "s"; puts(a[0] + "t");`, []string{}},
+        {`let a = [1]; a[0] = "s"; let f = fn(xs: array<string>) { xs }; f(a);`, []string{}},
+        {`let a = [1]; let b = a; b[0] = "s"; a[0] + "t"`, []string{}},
+        // a name declared again can change its type under a closure
+        {`let x = 1; let g = fn() { x + "b" }; let x = "a"; puts(g());`, []string{}},
+        {"let f = fn(a) { a }; f(1) + true", []string{}},
+        {"let f = fn() { 1 }; let s: string = f();", []string{"1:37: cannot use int as string in let s"}},
+        {"let f = fn(a) { if (a) { return 1; } 2 }; let s: string = f(true);", []string{"1:59: cannot use int as string in let s"}},
+        {"let f = fn(a) { if (a) { return 1; } \"x\" }; let s: string = f(true);", []string{}},
+        {"let x = if (true) { 1 } else { 2 }; let s: string = x;", []string{"1:53: cannot use int as string in let s"}},
+        {"let x = if (true) { 1 }; let s: string = x;", []string{}},
+        {`let e = try { 1 } catch (err) { err.message }; let n: int = e;`, []string{}},
+        // operators
+        {"-true; !1; 1 + 2.5; 1 < 2.5; \"a\" == 1", []string{"1:1: unknown operator: -bool"}},
+        {"\"a\" - \"b\"; [1] + [2]", []string{"1:1: unknown operator: string - string", "1:12: unknown operator: array<int> + array<int>"}},
+        {"1 && \"a\"; let b: bool = 1 < 2;", []string{}},
+        // indexing and iteration
+        {"let x = 1; x[0]; x.y", []string{"1:12: index operator not supported: int", "1:18: index operator not supported: int"}},
+        {"[1][\"a\"]", []string{"1:1: index operator not supported: array<int>[string]"}},
+        {"let s = \"héllo\"; let c: string = s[1]; let n: int = s[0];", []string{"1:53: cannot use string as int in let n"}},
+        {"let s = \"a\"; s[\"b\"]; s.x; s[0] = \"b\";", []string{"1:14: index operator not supported: string[string]", "1:22: index operator not supported: string[string]", "1:27: index assignment not supported: string"}},
+        {"for (x in 5) { x }", []string{"1:11: cannot iterate over int"}},
+        {"for (c in \"ab\") { let n: int = c; }", []string{"1:32: cannot use string as int in let n"}},
+        {"let xs: array<int> = [1, 2]; for (x in xs) { let s: string = x; }", []string{"1:62: cannot use int as string in let s"}},
+        {"for (x in [1, 2]) { let s: string = x; }", []string{}},
+        // functions
+        {"let add = fn(a: int, b: int): int { a + b }; add(1, 2); add(1, \"2\")", []string{"1:64: cannot use string as int in argument 2 to add"}},
+        {"let add = fn(a: int, b: int) { a + b }; add(1)", []string{"1:41: wrong number of arguments to add. got=1, want=2"}},
+        {"let f = fn(a, b = 1, ...c) { a }; f(); f(1, 2, 3, 4)", []string{"1:35: wrong number of arguments to f. got=0, want=at least 1"}},
+        {"let f = fn(a, b: int = \"x\") { a }; f(1)", []string{"1:24: cannot use string as int in default value of b"}},
+        {"let f = fn(...xs: array<int>) { xs }; f(1, 2, \"3\")", []string{"1:47: cannot use string as int in argument 3 to f"}},
+        {"let f = fn(...xs: int) { xs }", []string{"1:19: rest parameter xs must be an array, got int"}},
+        {"let f = fn(a): string { a + 1 }; f(1)", []string{}},
+        {"let f = fn(): string { 1 }", []string{"1:24: cannot use int as string in return value"}},
+        {"let f = fn(): int { if (true) { return \"a\"; } 1 }", []string{"1:40: cannot use string as int in return value"}},
+        {"let fact = fn(n: int): int { if (n < 2) { return 1; } n * fact(n - 1) }; let s: string = fact(5);", []string{"1:90: cannot use int as string in let s"}},
+        {"let apply = fn(f: fn(int): int, x: int): int { f(x) }; apply(fn(x: int): int { x * 2 }, 1)", []string{}},
+        {"let apply = fn(f: fn(int): int) { f(1) }; apply(fn(s: string): int { 1 })", []string{"1:49: cannot use fn(string): int as fn(int): int in argument 1 to apply"}},
+        {"let apply = fn(f: fn(int): int) { f(1) }; apply(fn(a, b) { 1 })", []string{"1:49: cannot use fn(any, any): int as fn(int): int in argument 1 to apply"}},
+        {"let apply = fn(f: fn) { f(1, 2, 3) }; apply(len); apply(1)", []string{"1:57: cannot use int as fn in argument 1 to apply"}},
+        {"let x = 1; x(2)", []string{"1:12: not a function: int"}},
+        // builtins
+        {"let n: int = len(\"abc\"); first(1); push([], 1, 2); puts(1, 2, 3)", []string{"1:32: cannot use int as array in argument 1 to first", "1:36: wrong number of arguments to push. got=3, want=2"}},
+        // unknown names and imports are any
+        {`import "lib" as lib; let n: int = lib.count + missing;`, []string{}},
+        {"let m = macro(x) { quote(unquote(x) + 1) };", []string{}},
+    }
+
+    for _, tt := range tests {
+        errors := Check(parse(t, tt.input))
+
+        got := []string{}
+        for _, err := range errors {
+            got = append(got, err.Error())
+        }
+        if len(got) != len(tt.expected) {
+            t.Errorf("%q: wrong errors. expected=%q, got=%q", tt.input, tt.expected, got)
+            continue
+        }
+        for i := range got {
+            if got[i] != tt.expected[i] {
+                t.Errorf("%q: wrong error %d. expected=%q, got=%q", tt.input, i, tt.expected[i], got[i])
+            }
+        }
+    }
+}
+
+func TestFromAnnotation(t *testing.T) {
+    tests := []struct{
+        annotation string
+        expected   string
+    }{
+        {"int", "int"},
+        {"any", "any"},
+        {"array", "array"},
+        {"array<array<string>>", "array<array<string>>"},
+        {"hash", "hash"},
+        {"hash<string, float>", "hash<string, float>"},
+        {"fn", "fn"},
+        {"fn()", "fn(): any"},
+        {"fn(int, bool): null", "fn(int, bool): null"},
+    }
+
+    for _, tt := range tests {
+        program := parse(t, "let x: " + tt.annotation + " = 1;")
+        annotation := program.Statements[0].(*ast.LetStatement).Type
+
+        if got := FromAnnotation(annotation).String(); got != tt.expected {
+            t.Errorf("%q: wrong type. expected=%q, got=%q", tt.annotation, tt.expected, got)
+        }
+    }
+}
+
+func TestAssignable(t *testing.T) {
+    intToInt := &Function{Parameters: []Type{INT}, Required: 1, Result: INT}
+    optional := &Function{Parameters: []Type{INT, STRING}, Required: 1, Result: INT}
+    variadic := &Function{Parameters: []Type{}, Rest: ANY, Result: NULL}
+
+    tests := []struct{
+        value    Type
+        target   Type
+        expected bool
+    }{
+        {INT, INT, true},
+        {INT, FLOAT, false},
+        {ANY, STRING, true},
+        {NULL, ANY, true},
+        {&Array{INT}, &Array{ANY}, true},
+        {&Array{ANY}, &Array{INT}, true},
+        {&Array{INT}, &Hash{INT, INT}, false},
+        {&Hash{STRING, INT}, &Hash{STRING, ANY}, true},
+        {intToInt, &Function{Result: ANY}, true},
+        {intToInt, intToInt, true},
+        {optional, intToInt, true},
+        {intToInt, optional, false},
+        {variadic, intToInt, false},
+        {variadic, &Function{Parameters: []Type{INT, INT}, Required: 2, Result: ANY}, true},
+    }
+
+    for _, tt := range tests {
+        if got := Assignable(tt.value, tt.target); got != tt.expected {
+            t.Errorf("Assignable(%s, %s) wrong. expected=%t, got=%t", tt.value, tt.target, tt.expected, got)
+        }
+    }
+}
@@ -0,0 +1,193 @@
+package types
+
+import (
+	"interpreter/ast"
+	"strings"
+)
+
+// Type is the static type of an expression.
+type Type interface {
+    String() string
+}
+
+// Basic is a type without element types. ANY is the type of values the
+// checker knows nothing about, it is consistent with every other type.
+type Basic struct {
+    Name string
+}
+
+func (b *Basic) String() string { return b.Name }
+
+var (
+    INT    = &Basic{Name: "int"}
+    FLOAT  = &Basic{Name: "float"}
+    STRING = &Basic{Name: "string"}
+    BOOL   = &Basic{Name: "bool"}
+    NULL   = &Basic{Name: "null"}
+    ANY    = &Basic{Name: "any"}
+)
+
+type Array struct {
+    Element Type
+}
+
+func (a *Array) String() string {
+    if a.Element == ANY {
+        return "array"
+    }
+    return "array<" + a.Element.String() + ">"
+}
+
+type Hash struct {
+    Key   Type
+    Value Type
+}
+
+func (h *Hash) String() string {
+    if h.Key == ANY && h.Value == ANY {
+        return "hash"
+    }
+    return "hash<" + h.Key.String() + ", " + h.Value.String() + ">"
+}
+
+// Function is the type of functions and builtins. The parameters of a bare
+// fn are not known, it can be called with any arguments.
+type Function struct {
+    Parameters []Type // nil when the signature is not known
+    Required   int    // number of parameters without a default value
+    Rest       Type   // element type of the rest parameter, nil when there is none
+    Result     Type
+}
+
+func (f *Function) String() string {
+    if f.Parameters == nil && f.Rest == nil {
+        return "fn"
+    }
+
+    parameters := []string{}
+    for _, parameter := range f.Parameters {
+        parameters = append(parameters, parameter.String())
+    }
+    if f.Rest != nil {
+        parameters = append(parameters, "..." + f.Rest.String())
+    }
+    return "fn(" + strings.Join(parameters, ", ") + "): " + f.Result.String()
+}
+
+// accepts tells whether f can be called with n arguments.
+func (f *Function) accepts(n int) bool {
+    return n >= f.Required && (f.Rest != nil || n <= len(f.Parameters))
+}
+
+// parameter returns the type of the i-th argument of a call.
+func (f *Function) parameter(i int) Type {
+    if i < len(f.Parameters) {
+        return f.Parameters[i]
+    }
+    if f.Rest != nil {
+        return f.Rest
+    }
+    return ANY
+}
+
+// builtins holds the types of the builtin functions.
+var builtins = map[string]Type {
+    "len":   &Function{Parameters: []Type{ANY}, Required: 1, Result: INT},
+    "first": &Function{Parameters: []Type{&Array{ANY}}, Required: 1, Result: ANY},
+    "last":  &Function{Parameters: []Type{&Array{ANY}}, Required: 1, Result: ANY},
+    "rest":  &Function{Parameters: []Type{&Array{ANY}}, Required: 1, Result: ANY},
+    "push":  &Function{Parameters: []Type{&Array{ANY}, ANY}, Required: 2, Result: &Array{ANY}},
+    "puts":  &Function{Parameters: []Type{}, Rest: ANY, Result: NULL},
+}
+
+var basics = map[string]Type {
+    "int":    INT,
+    "float":  FLOAT,
+    "string": STRING,
+    "bool":   BOOL,
+    "null":   NULL,
+    "any":    ANY,
+}
+
+// FromAnnotation returns the type an annotation stands for.
+func FromAnnotation(te *ast.TypeExpression) Type {
+    if te == nil {
+        return ANY
+    }
+
+    switch te.Name {
+    case "array":
+        if len(te.Arguments) == 1 {
+            return &Array{FromAnnotation(te.Arguments[0])}
+        }
+        return &Array{ANY}
+    case "hash":
+        if len(te.Arguments) == 2 {
+            return &Hash{FromAnnotation(te.Arguments[0]), FromAnnotation(te.Arguments[1])}
+        }
+        return &Hash{ANY, ANY}
+    case "fn":
+        if te.Close.Literal == "" {
+            return &Function{Result: ANY}
+        }
+        parameters := []Type{}
+        for _, argument := range te.Arguments {
+            parameters = append(parameters, FromAnnotation(argument))
+        }
+        return &Function{Parameters: parameters, Required: len(parameters), Result: FromAnnotation(te.Result)}
+    }
+
+    if t, ok := basics[te.Name]; ok {
+        return t
+    }
+    return ANY
+}
+
+// Assignable tells whether a value of type value can be used where a target
+// is expected. any is assignable to and from every type.
+func Assignable(value, target Type) bool {
+    if value == ANY || target == ANY {
+        return true
+    }
+
+    switch target := target.(type) {
+    case *Array:
+        value, ok := value.(*Array)
+        return ok && Assignable(value.Element, target.Element)
+    case *Hash:
+        value, ok := value.(*Hash)
+        return ok && Assignable(value.Key, target.Key) && Assignable(value.Value, target.Value)
+    case *Function:
+        value, ok := value.(*Function)
+        if !ok {
+            return false
+        }
+        if value.Parameters == nil && value.Rest == nil || target.Parameters == nil && target.Rest == nil {
+            return true
+        }
+        // the value is called the way the target type allows
+        if !value.accepts(len(target.Parameters)) {
+            return false
+        }
+        for i, parameter := range target.Parameters {
+            if !Assignable(parameter, value.parameter(i)) {
+                return false
+            }
+        }
+        return Assignable(value.Result, target.Result)
+    default:
+        return value == target
+    }
+}
+
+// join returns the type of a value that is either a or b.
+func join(a, b Type) Type {
+    if a.String() == b.String() {
+        return a
+    }
+    return ANY
+}
+
+func isNumber(t Type) bool {
+    return t == INT || t == FLOAT
+}
@@ -0,0 +1,29 @@
+package vm
+
+import (
+	"interpreter/object"
+)
+
+const CELL_OBJ = "CELL"
+
+// cell holds a local variable that has been captured by a closure. The stack
+// slot of the variable and the free variable of the closure both point to
+// the cell, so an assignment on one side is visible on the other.
+type cell struct {
+    value object.Object
+}
+
+func (c *cell) Type() object.ObjectType {
+    return CELL_OBJ
+}
+func (c *cell) Inspect() string {
+    return "cell(" + c.value.Inspect() + ")"
+}
+
+// unwrapCell returns the value of obj, looking through cells.
+func unwrapCell(obj object.Object) object.Object {
+    if c, ok := obj.(*cell); ok {
+        return c.value
+    }
+    return obj
+}
@@ -0,0 +1,30 @@
+package vm
+
+import (
+	"interpreter/evaluator"
+	"interpreter/object"
+)
+
+const ITERATOR_OBJ = "ITERATOR"
+
+// iterator walks over the elements of a for loop. It is kept in a hidden
+// variable of the loop and never reaches the program.
+type iterator struct {
+    elements []object.Object
+    index    int
+}
+
+func (i *iterator) Type() object.ObjectType {
+    return ITERATOR_OBJ
+}
+func (i *iterator) Inspect() string {
+    return "iterator"
+}
+
+func newIterator(obj object.Object) object.Object {
+    elements, err := evaluator.Iterate(obj)
+    if err != nil {
+        return err
+    }
+    return &iterator{elements: elements}
+}
@@ -0,0 +1,595 @@
+package vm
+
+import (
+	"fmt"
+	"interpreter/code"
+	"interpreter/compiler"
+	"interpreter/evaluator"
+	"interpreter/object"
+)
+
+const StackSize = 2048
+const GlobalsSize = 65536
+const MaxFrames = 1024
+
+var infixOperators = map[code.Opcode]string {
+    code.OpAdd:          "+",
+    code.OpSub:          "-",
+    code.OpMul:          "*",
+    code.OpDiv:          "/",
+    code.OpMod:          "%",
+    code.OpEqual:        "==",
+    code.OpNotEqual:     "!=",
+    code.OpGreaterThan:  ">",
+    code.OpLessThan:     "<",
+    code.OpGreaterEqual: ">=",
+    code.OpLessEqual:    "<=",
+}
+
+type VM struct {
+    constants []object.Object
+
+    stack []object.Object
+    sp    int // always points to the next free slot, the top of the stack is stack[sp-1]
+
+    globals []object.Object
+
+    frames      []*Frame
+    framesIndex int
+
+    handlers []handler
+
+    overflow evaluator.OverflowPolicy
+}
+
+// handler is an active try block: the frame and stack height to return to
+// and the position of its catch block.
+type handler struct {
+    framesIndex int
+    sp          int
+    catchPos    int
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+    mainFn := &object.CompiledFunction{
+        Instructions: bytecode.Instructions,
+        Positions:    bytecode.Positions,
+        NumLocals:    bytecode.NumLocals,
+    }
+    mainClosure := &object.Closure{Fn: mainFn}
+    mainFrame := NewFrame(mainClosure, 0)
+
+    frames := make([]*Frame, MaxFrames)
+    frames[0] = mainFrame
+
+    return &VM{
+        constants:   bytecode.Constants,
+        stack:       make([]object.Object, StackSize),
+        sp:          bytecode.NumLocals,
+        globals:     make([]object.Object, GlobalsSize),
+        frames:      frames,
+        framesIndex: 1,
+    }
+}
+
+// NewWithGlobalsState creates a vm that shares its globals with previous
+// runs, which the REPL needs.
+func NewWithGlobalsState(bytecode *compiler.Bytecode, s []object.Object) *VM {
+    vm := New(bytecode)
+    vm.globals = s
+    return vm
+}
+
+// SetOverflow sets what integer arithmetic does on overflow, it wraps around
+// by default.
+func (vm *VM) SetOverflow(policy evaluator.OverflowPolicy) {
+    vm.overflow = policy
+}
+
+func (vm *VM) LastPoppedStackElem() object.Object {
+    return vm.stack[vm.sp]
+}
+
+// Run executes the bytecode. Runtime errors of the program are returned as
+// *object.Error, with the same kinds, messages and positions evaluator.Eval
+// would produce, but without a stack trace.
+func (vm *VM) Run() error {
+    for {
+        err := vm.run()
+        errObj, ok := err.(*object.Error)
+        if ok && !errObj.Pos.IsValid() {
+            frame := vm.currentFrame()
+            errObj.Pos = frame.cl.Fn.Positions.At(frame.ip)
+        }
+        if !ok || len(vm.handlers) == 0 {
+            return err
+        }
+
+        h := vm.handlers[len(vm.handlers)-1]
+        vm.handlers = vm.handlers[:len(vm.handlers)-1]
+        vm.framesIndex = h.framesIndex
+        vm.sp = h.sp
+        err = vm.push(evaluator.ErrorValue(errObj))
+        if err != nil {
+            return err
+        }
+        vm.currentFrame().ip = h.catchPos - 1
+    }
+}
+
+func (vm *VM) run() error {
+    var ip int
+    var ins code.Instructions
+    var op code.Opcode
+
+    for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+        vm.currentFrame().ip++
+
+        ip = vm.currentFrame().ip
+        ins = vm.currentFrame().Instructions()
+        op = code.Opcode(ins[ip])
+
+        switch op {
+        case code.OpConstant:
+            constIndex := code.ReadUint16(ins[ip+1:])
+            vm.currentFrame().ip += 2
+
+            err := vm.push(vm.constants[constIndex])
+            if err != nil {
+                return err
+            }
+        case code.OpPop:
+            vm.pop()
+        case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+            code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+            code.OpGreaterEqual, code.OpLessEqual:
+            right := vm.pop()
+            left := vm.pop()
+
+            err := vm.pushResult(evaluator.EvalInfix(infixOperators[op], left, right, vm.overflow))
+            if err != nil {
+                return err
+            }
+        case code.OpBang:
+            err := vm.pushResult(evaluator.EvalPrefix("!", vm.pop(), vm.overflow))
+            if err != nil {
+                return err
+            }
+        case code.OpMinus:
+            err := vm.pushResult(evaluator.EvalPrefix("-", vm.pop(), vm.overflow))
+            if err != nil {
+                return err
+            }
+        case code.OpTrue:
+            err := vm.push(evaluator.TRUE)
+            if err != nil {
+                return err
+            }
+        case code.OpFalse:
+            err := vm.push(evaluator.FALSE)
+            if err != nil {
+                return err
+            }
+        case code.OpNull:
+            err := vm.push(evaluator.NULL)
+            if err != nil {
+                return err
+            }
+        case code.OpJump:
+            pos := int(code.ReadUint16(ins[ip+1:]))
+            vm.currentFrame().ip = pos - 1
+        case code.OpJumpIfBound:
+            localIndex := int(code.ReadUint8(ins[ip+1:]))
+            pos := int(code.ReadUint16(ins[ip+2:]))
+            vm.currentFrame().ip += 3
+
+            if unwrapCell(vm.stack[vm.currentFrame().basePointer+localIndex]) != nil {
+                vm.currentFrame().ip = pos - 1
+            }
+        case code.OpJumpNotTruthy:
+            pos := int(code.ReadUint16(ins[ip+1:]))
+            vm.currentFrame().ip += 2
+
+            condition := vm.pop()
+            if !evaluator.IsTruthy(condition) {
+                vm.currentFrame().ip = pos - 1
+            }
+        case code.OpJumpNotTruthyOrPop, code.OpJumpTruthyOrPop:
+            pos := int(code.ReadUint16(ins[ip+1:]))
+            vm.currentFrame().ip += 2
+
+            if evaluator.IsTruthy(vm.stack[vm.sp-1]) == (op == code.OpJumpTruthyOrPop) {
+                vm.currentFrame().ip = pos - 1
+            } else {
+                vm.pop()
+            }
+        case code.OpIter:
+            err := vm.pushResult(newIterator(vm.pop()))
+            if err != nil {
+                return err
+            }
+        case code.OpIterNext:
+            pos := int(code.ReadUint16(ins[ip+1:]))
+            vm.currentFrame().ip += 2
+
+            iter := vm.pop().(*iterator)
+            if iter.index >= len(iter.elements) {
+                vm.currentFrame().ip = pos - 1
+            } else {
+                err := vm.push(iter.elements[iter.index])
+                if err != nil {
+                    return err
+                }
+                iter.index++
+            }
+        case code.OpSetGlobal:
+            globalIndex := code.ReadUint16(ins[ip+1:])
+            vm.currentFrame().ip += 2
+
+            vm.globals[globalIndex] = vm.pop()
+        case code.OpGetGlobal:
+            globalIndex := code.ReadUint16(ins[ip+1:])
+            vm.currentFrame().ip += 2
+
+            err := vm.push(vm.globals[globalIndex])
+            if err != nil {
+                return err
+            }
+        case code.OpSetLocal:
+            localIndex := code.ReadUint8(ins[ip+1:])
+            vm.currentFrame().ip += 1
+
+            frame := vm.currentFrame()
+            slot := frame.basePointer + int(localIndex)
+            if c, ok := vm.stack[slot].(*cell); ok {
+                c.value = vm.pop()
+            } else {
+                vm.stack[slot] = vm.pop()
+            }
+        case code.OpGetLocal:
+            localIndex := code.ReadUint8(ins[ip+1:])
+            vm.currentFrame().ip += 1
+
+            frame := vm.currentFrame()
+            err := vm.push(unwrapCell(vm.stack[frame.basePointer+int(localIndex)]))
+            if err != nil {
+                return err
+            }
+        case code.OpClearLocals:
+            firstLocal := int(code.ReadUint8(ins[ip+1:]))
+            count := int(code.ReadUint8(ins[ip+2:]))
+            vm.currentFrame().ip += 2
+
+            slot := vm.currentFrame().basePointer + firstLocal
+            for i := 0; i < count; i++ {
+                vm.stack[slot+i] = nil
+            }
+        case code.OpCaptureLocal:
+            localIndex := code.ReadUint8(ins[ip+1:])
+            vm.currentFrame().ip += 1
+
+            slot := vm.currentFrame().basePointer + int(localIndex)
+            c, ok := vm.stack[slot].(*cell)
+            if !ok {
+                c = &cell{value: vm.stack[slot]}
+                vm.stack[slot] = c
+            }
+
+            err := vm.push(c)
+            if err != nil {
+                return err
+            }
+        case code.OpGetBuiltin:
+            builtinIndex := code.ReadUint8(ins[ip+1:])
+            vm.currentFrame().ip += 1
+
+            builtin, _ := evaluator.LookupBuiltin(evaluator.BuiltinNames[builtinIndex])
+            err := vm.push(builtin)
+            if err != nil {
+                return err
+            }
+        case code.OpGetFree:
+            freeIndex := code.ReadUint8(ins[ip+1:])
+            vm.currentFrame().ip += 1
+
+            err := vm.push(unwrapCell(vm.currentFrame().cl.Free[freeIndex]))
+            if err != nil {
+                return err
+            }
+        case code.OpSetFree:
+            freeIndex := code.ReadUint8(ins[ip+1:])
+            vm.currentFrame().ip += 1
+
+            free := vm.currentFrame().cl.Free
+            if c, ok := free[freeIndex].(*cell); ok {
+                c.value = vm.pop()
+            } else {
+                free[freeIndex] = vm.pop()
+            }
+        case code.OpCaptureFree:
+            freeIndex := code.ReadUint8(ins[ip+1:])
+            vm.currentFrame().ip += 1
+
+            err := vm.push(vm.currentFrame().cl.Free[freeIndex])
+            if err != nil {
+                return err
+            }
+        case code.OpCurrentClosure:
+            err := vm.push(vm.currentFrame().cl)
+            if err != nil {
+                return err
+            }
+        case code.OpArray:
+            numElements := int(code.ReadUint16(ins[ip+1:]))
+            vm.currentFrame().ip += 2
+
+            array := vm.buildArray(vm.sp-numElements, vm.sp)
+            vm.sp = vm.sp - numElements
+
+            err := vm.push(array)
+            if err != nil {
+                return err
+            }
+        case code.OpHash:
+            numElements := int(code.ReadUint16(ins[ip+1:]))
+            vm.currentFrame().ip += 2
+
+            hash := vm.buildHash(vm.sp-numElements, vm.sp)
+            vm.sp = vm.sp - numElements
+
+            err := vm.pushResult(hash)
+            if err != nil {
+                return err
+            }
+        case code.OpIndex:
+            index := vm.pop()
+            left := vm.pop()
+
+            err := vm.pushResult(evaluator.EvalIndex(left, index))
+            if err != nil {
+                return err
+            }
+        case code.OpPeekIndex:
+            index := vm.stack[vm.sp-1]
+            left := vm.stack[vm.sp-2]
+
+            err := vm.pushResult(evaluator.EvalIndex(left, index))
+            if err != nil {
+                return err
+            }
+        case code.OpSetIndex:
+            value := vm.pop()
+            index := vm.pop()
+            left := vm.pop()
+
+            err := vm.pushResult(evaluator.SetIndex(left, index, value))
+            if err != nil {
+                return err
+            }
+        case code.OpCall:
+            numArgs := code.ReadUint8(ins[ip+1:])
+            vm.currentFrame().ip += 1
+
+            err := vm.executeCall(int(numArgs))
+            if err != nil {
+                return err
+            }
+        case code.OpTry:
+            catchPos := int(code.ReadUint16(ins[ip+1:]))
+            vm.currentFrame().ip += 2
+
+            vm.handlers = append(vm.handlers, handler{vm.framesIndex, vm.sp, catchPos})
+        case code.OpEndTry:
+            vm.handlers = vm.handlers[:len(vm.handlers)-1]
+        case code.OpThrow:
+            return evaluator.Throw(vm.pop())
+        case code.OpReturnValue:
+            returnValue := vm.pop()
+
+            // A return at the top level ends the program, and the returned
+            // value stays in place as the last popped element.
+            if vm.framesIndex == 1 {
+                return nil
+            }
+
+            vm.dropHandlers()
+            frame := vm.popFrame()
+            vm.sp = frame.basePointer - 1
+
+            err := vm.push(returnValue)
+            if err != nil {
+                return err
+            }
+        case code.OpReturn:
+            vm.dropHandlers()
+            frame := vm.popFrame()
+            vm.sp = frame.basePointer - 1
+
+            err := vm.push(evaluator.NULL)
+            if err != nil {
+                return err
+            }
+        case code.OpClosure:
+            constIndex := code.ReadUint16(ins[ip+1:])
+            numFree := code.ReadUint8(ins[ip+3:])
+            vm.currentFrame().ip += 3
+
+            err := vm.pushClosure(int(constIndex), int(numFree))
+            if err != nil {
+                return err
+            }
+        default:
+            def, err := code.Lookup(byte(op))
+            if err != nil {
+                return err
+            }
+            return fmt.Errorf("unhandled opcode %s", def.Name)
+        }
+    }
+
+    return nil
+}
+
+// dropHandlers removes the handlers of the try blocks a return leaves.
+func (vm *VM) dropHandlers() {
+    for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].framesIndex >= vm.framesIndex {
+        vm.handlers = vm.handlers[:len(vm.handlers)-1]
+    }
+}
+
+func (vm *VM) currentFrame() *Frame {
+    return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+    if vm.framesIndex >= MaxFrames {
+        return fmt.Errorf("frame overflow")
+    }
+    vm.frames[vm.framesIndex] = f
+    vm.framesIndex++
+    return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+    vm.framesIndex--
+    return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) push(obj object.Object) error {
+    if vm.sp >= StackSize {
+        return fmt.Errorf("stack overflow")
+    }
+
+    vm.stack[vm.sp] = obj
+    vm.sp++
+
+    return nil
+}
+
+// pushResult pushes the result of an operation, unless the operation failed,
+// in which case the error ends the execution.
+func (vm *VM) pushResult(obj object.Object) error {
+    if errObj, ok := obj.(*object.Error); ok {
+        return errObj
+    }
+    return vm.push(obj)
+}
+
+func (vm *VM) pop() object.Object {
+    obj := vm.stack[vm.sp-1]
+    vm.sp--
+    return obj
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+    elements := make([]object.Object, endIndex-startIndex)
+
+    for i := startIndex; i < endIndex; i++ {
+        elements[i-startIndex] = vm.stack[i]
+    }
+
+    return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) object.Object {
+    hashedPairs := make(map[object.HashKey]object.HashPair)
+
+    for i := startIndex; i < endIndex; i += 2 {
+        key := vm.stack[i]
+        value := vm.stack[i+1]
+
+        hashKey, ok := key.(object.Hashable)
+        if !ok {
+            return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("unusable as hash key: %s", key.Type())}
+        }
+
+        hashedPairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+    }
+
+    return &object.Hash{Pairs: hashedPairs}
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+    callee := vm.stack[vm.sp-1-numArgs]
+    switch callee := callee.(type) {
+    case *object.Closure:
+        return vm.callClosure(callee, numArgs)
+    case *object.Builtin:
+        return vm.callBuiltin(callee, numArgs)
+    default:
+        return &object.Error{Kind: object.TYPE_ERROR, Message: fmt.Sprintf("not a function: %s", callee.Type())}
+    }
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+    fn := cl.Fn
+
+    required := fn.NumParameters - fn.NumDefaults
+    if errObj := evaluator.CheckArity(numArgs, required, fn.NumParameters, fn.Variadic); errObj != nil {
+        return errObj.(*object.Error)
+    }
+
+    basePointer := vm.sp - numArgs
+    if basePointer+fn.NumLocals >= StackSize {
+        return fmt.Errorf("stack overflow")
+    }
+
+    rest := []object.Object{}
+    if numArgs > fn.NumParameters {
+        rest = append(rest, vm.stack[basePointer+fn.NumParameters:vm.sp]...)
+    }
+
+    // Missing optional arguments stay unset, so that OpJumpIfBound runs the
+    // code of their default values.
+    for i := numArgs; i < fn.NumParameters; i++ {
+        vm.stack[basePointer+i] = nil
+    }
+    firstLocal := fn.NumParameters
+    if fn.Variadic {
+        vm.stack[basePointer+fn.NumParameters] = &object.Array{Elements: rest}
+        firstLocal++
+    }
+    // The slots of locals may still hold cells of an earlier call.
+    for i := firstLocal; i < fn.NumLocals; i++ {
+        vm.stack[basePointer+i] = nil
+    }
+
+    frame := NewFrame(cl, basePointer)
+    err := vm.pushFrame(frame)
+    if err != nil {
+        return err
+    }
+
+    vm.sp = frame.basePointer + fn.NumLocals
+
+    return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+    args := vm.stack[vm.sp-numArgs : vm.sp]
+
+    result := builtin.Fn(args...)
+    vm.sp = vm.sp - numArgs - 1
+
+    if result == nil {
+        result = evaluator.NULL
+    }
+    return vm.pushResult(result)
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+    constant := vm.constants[constIndex]
+    function, ok := constant.(*object.CompiledFunction)
+    if !ok {
+        return fmt.Errorf("not a function: %+v", constant)
+    }
+
+    free := make([]object.Object, numFree)
+    for i := 0; i < numFree; i++ {
+        free[i] = vm.stack[vm.sp-numFree+i]
+    }
+    vm.sp = vm.sp - numFree
+
+    closure := &object.Closure{Fn: function, Free: free}
+    return vm.push(closure)
+}
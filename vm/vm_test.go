@@ -0,0 +1,387 @@
+package vm
+
+import (
+	"context"
+	"interpreter/ast"
+	"interpreter/compiler"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"testing"
+)
+
+func parse(input string) *ast.Program {
+    l := lexer.New(input)
+    p := parser.New(l)
+    return p.ParseProgram()
+}
+
+func testRun(t *testing.T, input string) object.Object {
+    comp := compiler.New()
+    err := comp.Compile(parse(input))
+    if compileError, ok := err.(*compiler.Error); ok {
+        return &object.Error{Pos: compileError.Pos, Message: compileError.Message}
+    }
+    if err != nil {
+        return &object.Error{Message: err.Error()}
+    }
+
+    vm := New(comp.Bytecode())
+    err = vm.Run()
+    if errObj, ok := err.(*object.Error); ok {
+        return errObj
+    }
+    if err != nil {
+        t.Fatalf("vm error: %s", err)
+    }
+
+    return vm.LastPoppedStackElem()
+}
+
+// The vm has to agree with the tree-walking evaluator on every program, so
+// each input is run through both backends and the results are compared.
+func TestVMMatchesEvaluator(t *testing.T) {
+    inputs := []string{
+        // integers
+        "5", "10", "-5", "-10",
+        "5 + 5 + 5 + 5 - 10",
+        "2 * 2 * 2 * 2 * 2",
+        "-50 + 100 + -50",
+        "5 * 2 + 10",
+        "5 + 2 * 10",
+        "20 + 2 * -10",
+        "50 / 2 * 2 + 10",
+        "2 * (5 + 10)",
+        "3 * 3 * 3 + 10",
+        "3 * (3 * 3) + 10",
+        "(5 + 10 * 2 + 15 / 3) * 2 + -10",
+        "7 % 3", "1 / 0", "1 % 0", "let f = fn(x) { 10 / x }; f(0)",
+        // floats
+        "1.5", "-2.5", "1 + 0.5", "10 / 4.0", "1 == 1.0", "2.5 > 2",
+        "1.5 + true",
+        `{1: "one"}[1.0]`,
+        // booleans
+        "true", "false",
+        "1 < 2", "1 > 2", "1 < 1", "1 > 1",
+        "1 == 1", "1 != 1", "1 == 2", "1 != 2",
+        "true == true", "false == false", "true == false",
+        "true != false", "false != true",
+        "(1 < 2) == true", "(1 < 2) == false",
+        "(1 > 2) == true", "(1 > 2) == false",
+        "!true", "!false", "!!true", "!!false", "!5", "!!5",
+        // conditionals
+        "if (true) { 10 }",
+        "if (false) { 10 }",
+        "if (1) { 10 }",
+        "if (1 < 2) { 10 }",
+        "if (1 > 2) { 10 }",
+        "if (1 > 2) { 10 } else { 20 }",
+        "if (1 < 2) { 10 } else { 20 }",
+        "if ((if (false) { 10 })) { 10 } else { 20 }",
+        // return statements
+        "return 10;",
+        "return 10; 9",
+        "return 2 * 5; 9",
+        "9; return 2 * 5; 9",
+        "if (10 > 1) { if (10 > 1) { return 10; } return 1; }",
+        // errors
+        "5 + true;",
+        "5 + true; 5;",
+        "-true",
+        "true + false",
+        "5; true + false; 5",
+        "if (10 > 1) { true + false }",
+        "if (10 > 1) { if (10 > 1) { return true + false; } return 1; }",
+        "foobar",
+        `"Hello" - "World"`,
+        `{"name": "Monkey"}[fn(x) { x }];`,
+        "1(2)",
+        // let statements
+        "let a = 5; a;",
+        "let a = 5 * 5; a;",
+        "let a = 5; let b = a; b;",
+        "let a = 5; let b = a; let c = a + b + 5; c;",
+        // functions and closures
+        "let identity = fn(x) { x; }; identity(5);",
+        "let identity = fn(x) { return x; }; identity(5);",
+        "let double = fn(x) { x * 2; }; double(5);",
+        "let add = fn(x,y) { x + y; }; add(5, 5);",
+        "let add = fn(x,y) { x + y; }; add(5 + 5, add(5,5));",
+        "fn(x) { x; }(5)",
+        "let newAdder = fn(x) { fn(y) { x + y }; }; let addTwo = newAdder(2); addTwo(2);",
+        `let newAdder = fn(a, b) {
+            let c = a + b;
+            fn(d) { let e = d + c; fn(f) { e + f; }; };
+        };
+        let inner = newAdder(1, 2)(3);
+        inner(8);`,
+        `let fibonacci = fn(x) {
+            if (x == 0) { return 0; }
+            if (x == 1) { return 1; }
+            fibonacci(x - 1) + fibonacci(x - 2);
+        };
+        fibonacci(15);`,
+        `let wrapper = fn() {
+            let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+            countDown(1);
+        };
+        wrapper();`,
+        // strings
+        `"Hello world!"`,
+        `"Hello" + " " + "World!"`,
+        // builtins
+        `len("")`,
+        `len("four")`,
+        `len("hello world")`,
+        `len("日本語")`,
+        `"héllo"[1]`,
+        `"abc"[5]`,
+        `len(1)`,
+        `len("one", "two")`,
+        `len([1, 2, 3])`,
+        `first([1, 2, 3])`,
+        `first([])`,
+        `last([1, 2, 3])`,
+        `rest([1, 2, 3])`,
+        `rest([])`,
+        `push([], 1)`,
+        `push(1, 1)`,
+        // arrays
+        "[1, 2 * 2, 3 + 3]",
+        "[1, 2, 3][0]",
+        "[1, 2, 3][1]",
+        "[1, 2, 3][2]",
+        "let i = 0; [1][i];",
+        "[1, 2, 3][1 + 1];",
+        "let myArray = [1, 2, 3]; myArray[2];",
+        "let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
+        "let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+        "[1, 2, 3][3]",
+        "[1, 2, 3][-1]",
+        // hashes
+        `let two = "two"; {"one": 10 - 9, two: 1 + 1, "thr" + "ee": 6 / 2, 4: 4, true: 5, false: 6}`,
+        `{"foo": 5}["foo"]`,
+        `{"foo": 5}["bar"]`,
+        `let key = "foo"; {"foo": 5}[key]`,
+        `{}["foo"]`,
+        `{5: 5}[5]`,
+        `{true: 5}[true]`,
+        `{false: 5}[false]`,
+        // logical operators and comparisons
+        "1 <= 2", "2 >= 3", "2.5 >= 2.5", `"a" <= "b"`,
+        "true && false", "1 && 2", "false || 3", "0 || 3",
+        "if (false) { 1 } || 3", "if (false) { 1 } && 3",
+        "false && -true", "true || -true", "true && -true",
+        "let f = fn(x) { x > 1 && x < 5 }; [f(0), f(3), f(9)]",
+        "let f = fn(a, b) { a || b }; f(false, 7)",
+        // loops
+        "let i = 0; while (i < 5) { i = i + 1; }; i",
+        "let i = 0; while (true) { i = i + 1; if (i == 3) { break; } }; i",
+        "let i = 0; let n = 0; while (i < 10) { i = i + 1; if (i % 2 == 0) { continue; } n = n + 1; }; n",
+        "let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { continue } sum = sum + x; }; sum",
+        `let s = ""; for (c in "abc") { s = c + s; }; s`,
+        `let s = ""; for (c in "añ日") { s = c + s; }; s`,
+        `let s = ""; for (k in {"b": 2, "a": 1, "c": 3}) { s = s + k; }; s`,
+        "let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } 0 }; f()",
+        "let f = fn(xs) { let n = 0; for (x in xs) { for (y in xs) { n = n + x * y; } } n }; f([1, 2, 3])",
+        "let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y == 2) { break; } n = n + 1; } }; n",
+        "let fs = []; for (x in [1, 2]) { fs = push(fs, fn() { x }); }; fs[0]()",
+        "for (x in 5) { x }",
+        "for (x in [1, 2]) { x + true }",
+        "let f = fn() { while (true) { return 7; } }; f()",
+        // assignment
+        "let x = 1; x = 2; x",
+        "let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x %= 4; x",
+        "let a = 1; let b = 2; a = b = 7; a + b",
+        "let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()",
+        "let counter = fn() { let n = 0; [fn() { n += 1 }, fn() { n }] }; let c = counter(); c[0](); c[0](); c[1]()",
+        "let outer = fn() { let n = 0; let mid = fn() { fn() { n = n + 10 } }; mid()(); mid()(); n }; outer()",
+        "let f = fn(a) { let g = fn() { a }; a = 5; g() }; f(1)",
+        "let n = 0; let inc = fn() { n = n + 1; }; inc(); inc(); n",
+        "let f = fn() { let fs = []; for (x in [1, 2]) { fs = push(fs, fn() { x }); } fs[0]() }; f()",
+        "let f = fn() { let i = 0; let sum = 0; while (i < 4) { sum += i; i += 1; } sum }; [f(), f()]",
+        "let g = fn() { let a = fn() { 1 }; let b = 2; b }; let h = fn() { let k = fn() { k }; 3 }; [g(), h(), g()]",
+        "let arr = [1, 2, 3]; arr[1] = 20; arr",
+        "let arr = [1, 2, 3]; let i = 0; arr[i += 2] *= 10; [arr, i]",
+        `let h = {"a": 1}; h["a"] += 1; h["b"] = 5; h["a"] + h["b"]`,
+        "let x = 1; x += true",
+        "let arr = [1]; arr[1] = 2",
+        `let s = "abc"; s[0] = "x"`,
+        // const and block scoping
+        "const x = 1; x",
+        "const x = 1; x = 2",
+        "const x = 1; let x = 2",
+        "const x = 1; let f = fn() { let x = 2; x = 3; x }; f() + x",
+        "let x = 1; if (true) { let x = 2; }; x",
+        "let x = 1; if (true) { x = 2; }; x",
+        "if (true) { let t = 1; t }",
+        "if (true) { let t = 1; }; t",
+        "for (x in [1, 2]) { }; x",
+        "let f = fn() { if (true) { let a = 1; let b = 2; a + b } }; f()",
+        "let f = fn(x) { let y = 1; if (x) { let y = 2; y = 3; } y }; f(true)",
+        "let n = 0; for (x in [1, 2, 3]) { const y = x * 2; n += y; }; n",
+        "let fs = []; for (x in [1, 2, 3]) { let y = x * 10; fs = push(fs, fn() { y }); }; fs[0]() + fs[2]()",
+        "let f = fn() { let fs = []; let i = 0; while (i < 2) { let j = i; fs = push(fs, fn() { j }); i += 1; } [fs[0](), fs[1]()] }; f()",
+        "let fs = []; for (x in [1, 2]) { if (x == 1) { continue; } let y = x; fs = push(fs, fn() { y }); }; fs[0]()",
+        // parameters
+        "fn(a, b = 2) { a + b }(1)",
+        "fn(a, b = 2) { a + b }(1, 5)",
+        "fn(a, b = a * 10) { b }(4)",
+        "let base = 100; fn(a, b = base) { a + b }(1)",
+        "fn(a) { fn(b = a) { b } }(7)()",
+        "fn(a, ...rest) { rest }(1, 2, 3)",
+        "fn(a, ...rest) { rest }(1)",
+        "fn(a, b = 2, ...rest) { [a, b, rest] }(1, 1, 1, 1)",
+        "fn(a, b = 2) { a }(1, 2, 3)",
+        "fn(a, ...rest) { a }()",
+        "fn(a, b = -true) { b }(1)",
+        // try, catch and throw
+        "try { 1 } catch (e) { 2 }",
+        "try { 1 + true } catch (e) { [e.kind, e.message] }",
+        "try { 1 / 0 } catch (e) { e.kind }",
+        "try { len(1, 2) } catch (e) { e.kind }",
+        `try { throw "boom"; } catch (e) { [e.kind, e.message, e.value] }`,
+        `try { throw {"kind": "ValueError", "message": "bad"}; } catch (e) { e.kind + ": " + e.message }`,
+        `try { throw {"kind": "LimitError", "message": "fake"}; } catch (e) { e.kind + ": " + e.message }`,
+        `try { try { throw "inner"; } catch (e) { throw e.message + "!"; } } catch (e) { e.message }`,
+        `throw "uncaught";`,
+        "let f = fn(n) { if (n == 0) { -true } else { f(n - 1) } }; let g = fn() { try { f(3) } catch (e) { e.message } }; [g(), g()]",
+        "let f = fn() { try { return 1; } catch (e) { 2 } }; let g = fn() { f(); 1 + true }; try { g() } catch (e) { e.kind }",
+        "let n = 0; while (true) { try { n += 1; if (n == 3) { break; } } catch (e) { } }; try { throw n; } catch (e) { e.value }",
+        "let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { continue; } n += x; } catch (e) { } }; try { -true } catch (e) { n }",
+        "let r = []; for (x in [0, 1, 2]) { let v = try { 10 / x } catch (e) { let m = -1; m }; r = push(r, v); }; r",
+        "let x = try { let a = [1]; a[5] = 1 } catch (e) { e.kind }; x",
+        "let f = fn() { let a = 1; try { let b = 2; b + true } catch (e) { a } }; f()",
+        "let h = fn() { 1 + 1 }; try { h() } catch (e) { 0 }",
+    }
+
+    for _, input := range inputs {
+        expected := evaluator.Eval(parse(input), object.NewEnvironment())
+        actual := testRun(t, input)
+
+        if !objectsEqual(expected, actual) {
+            t.Errorf("vm result differs from evaluator for %q. evaluator=%s, vm=%s",
+                input, describe(expected), describe(actual))
+        }
+    }
+}
+
+func objectsEqual(expected, actual object.Object) bool {
+    if expected == nil || actual == nil {
+        return expected == actual
+    }
+
+    if expected.Type() != actual.Type() {
+        return false
+    }
+
+    switch expected := expected.(type) {
+    case *object.Error:
+        actual := actual.(*object.Error)
+        return expected.Message == actual.Message && expected.Pos == actual.Pos
+    case *object.Array:
+        actual := actual.(*object.Array)
+        if len(expected.Elements) != len(actual.Elements) {
+            return false
+        }
+        for i := range expected.Elements {
+            if !objectsEqual(expected.Elements[i], actual.Elements[i]) {
+                return false
+            }
+        }
+        return true
+    case *object.Hash:
+        actual := actual.(*object.Hash)
+        if len(expected.Pairs) != len(actual.Pairs) {
+            return false
+        }
+        for key, pair := range expected.Pairs {
+            other, ok := actual.Pairs[key]
+            if !ok || !objectsEqual(pair.Value, other.Value) {
+                return false
+            }
+        }
+        return true
+    default:
+        return expected.Inspect() == actual.Inspect()
+    }
+}
+
+func describe(obj object.Object) string {
+    if obj == nil {
+        return "nil"
+    }
+    return string(obj.Type()) + "(" + obj.Inspect() + ")"
+}
+
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+    tests := []struct{
+        input    string
+        expected string
+    }{
+        {`fn() { 1; }(1);`, "wrong number of arguments. got=1, want=0"},
+        {`fn(a) { a; }();`, "wrong number of arguments. got=0, want=1"},
+        {`fn(a, b) { a + b; }(1);`, "wrong number of arguments. got=1, want=2"},
+    }
+
+    for _, tt := range tests {
+        result := testRun(t, tt.input)
+
+        errObj, ok := result.(*object.Error)
+        if !ok {
+            t.Fatalf("expected *object.Error. got=%T (%+v)", result, result)
+        }
+
+        if errObj.Message != tt.expected {
+            t.Errorf("wrong error message. want=%q, got=%q", tt.expected, errObj.Message)
+        }
+    }
+}
+
+func TestRecursionDepth(t *testing.T) {
+    input := `
+    let countDown = fn(x) { if (x == 0) { return 0; } countDown(x - 1); };
+    countDown(100000);
+    `
+
+    comp := compiler.New()
+    err := comp.Compile(parse(input))
+    if err != nil {
+        t.Fatalf("compiler error: %s", err)
+    }
+
+    vm := New(comp.Bytecode())
+    err = vm.Run()
+    if err == nil {
+        t.Errorf("expected deep recursion to fail, got=%+v", vm.LastPoppedStackElem())
+    }
+}
+
+func TestOverflowPolicies(t *testing.T) {
+    inputs := []string{"9223372036854775807 + 1", "let min = -9223372036854775807 - 1; -min", "4611686018427387904 * 4"}
+
+    for _, policy := range []evaluator.OverflowPolicy{evaluator.OverflowWrap, evaluator.OverflowError, evaluator.OverflowPromote} {
+        for _, input := range inputs {
+            expected := evaluator.EvalOptions(context.Background(), parse(input), object.NewEnvironment(), evaluator.Options{Overflow: policy})
+
+            comp := compiler.New()
+            if err := comp.Compile(parse(input)); err != nil {
+                t.Fatalf("compiler error: %s", err)
+            }
+            vm := New(comp.Bytecode())
+            vm.SetOverflow(policy)
+            var actual object.Object
+            if err := vm.Run(); err != nil {
+                actual = err.(*object.Error)
+            } else {
+                actual = vm.LastPoppedStackElem()
+            }
+
+            if !objectsEqual(expected, actual) {
+                t.Errorf("%s: vm result differs from evaluator for %q. evaluator=%s, vm=%s",
+                    policy, input, describe(expected), describe(actual))
+            }
+        }
+    }
+}